@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"forgor/internal/models"
+	"forgor/internal/profile"
+	"forgor/internal/storage"
+	"forgor/internal/sync"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// runCommand runs a subcommand such as "forgor backup" and reports whether
+// args named one.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var err error
+	switch args[0] {
+	case "backup":
+		err = runBackup(args[1:])
+	case "restore":
+		err = runRestore(args[1:])
+	case "fsck":
+		err = runFsck(args[1:])
+	case "lookup":
+		err = runLookup(args[1:])
+	default:
+		return false
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return true
+}
+
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Custom database path")
+	profileName := fs.String("profile", "", "Named vault to use instead of the default")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: forgor backup [-db path | -profile name] <archive>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	out := fs.Arg(0)
+
+	path, err := resolveDBPath(*dbPath, *profileName)
+	if err != nil {
+		return err
+	}
+	store, err := storage.OpenReadOnly(path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	passphrase, err := readPassphrase("Backup passphrase: ")
+	if err != nil {
+		return err
+	}
+	if len(passphrase) < 8 {
+		return fmt.Errorf("passphrase must be at least 8 characters")
+	}
+	confirm, err := readPassphrase("Confirm passphrase: ")
+	if err != nil {
+		return err
+	}
+	if passphrase != confirm {
+		return fmt.Errorf("passphrases do not match")
+	}
+
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	if err := store.WriteBackup(f, passphrase); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(out)
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Backup written to %s\n", out)
+	return nil
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Custom database path")
+	profileName := fs.String("profile", "", "Named vault to use instead of the default")
+	force := fs.Bool("force", false, "Replace an existing vault")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: forgor restore [-db path | -profile name] [-force] <archive>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	path, err := resolveDBPath(*dbPath, *profileName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil && !*force {
+		return fmt.Errorf("a vault already exists at %s (use -force to replace it)", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create db directory: %w", err)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	passphrase, err := readPassphrase("Backup passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	if err := storage.RestoreBackup(f, passphrase, path, *force); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Vault restored to %s\n", path)
+	return nil
+}
+
+func runFsck(args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Custom database path")
+	profileName := fs.String("profile", "", "Named vault to use instead of the default")
+	keyfilePath := fs.String("keyfile", "", "Path to the vault's keyfile")
+	repair := fs.Bool("repair", false, "Apply the safe repairs after backing up the database")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: forgor fsck [-db path | -profile name] [-keyfile path] [-repair]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	path, err := resolveDBPath(*dbPath, *profileName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("no vault at %s", path)
+	}
+
+	// Checking only reads, so it can run next to the app. Repairs need the
+	// vault to themselves.
+	var store *storage.Store
+	if *repair {
+		store, err = storage.Open(path)
+	} else {
+		store, err = storage.OpenReadOnly(path)
+	}
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if !store.IsInitialized() {
+		return fmt.Errorf("no vault at %s", path)
+	}
+	if store.Snapshot() {
+		fmt.Fprintln(os.Stderr, "Vault is open elsewhere; checking a copy taken now")
+	}
+	if *keyfilePath != "" {
+		if err := store.LoadKeyfile(*keyfilePath); err != nil {
+			return fmt.Errorf("failed to load keyfile: %w", err)
+		}
+	}
+
+	password, err := readPassphrase("Master password: ")
+	if err != nil {
+		return err
+	}
+	if _, err := store.Unlock(password); err != nil {
+		return err
+	}
+	defer store.Lock()
+
+	problems, err := checkVault(store, false)
+	if err != nil {
+		return err
+	}
+	fixable := 0
+	for _, p := range problems {
+		if p.Fix != "" {
+			fixable++
+		}
+	}
+
+	if *repair && fixable > 0 {
+		backup := path + ".fsck.bak"
+		if err := store.CopyTo(backup); err != nil {
+			return fmt.Errorf("failed to back up database: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Backed up database to %s\n", backup)
+		if problems, err = checkVault(store, true); err != nil {
+			return err
+		}
+	}
+
+	remaining := 0
+	for _, p := range problems {
+		fmt.Println(p)
+		if !p.Fixed {
+			remaining++
+		}
+	}
+	switch {
+	case len(problems) == 0:
+		fmt.Fprintln(os.Stderr, "No problems found")
+		return nil
+	case remaining == 0:
+		fmt.Fprintf(os.Stderr, "Repaired %d problem(s)\n", len(problems))
+		return nil
+	case !*repair && fixable > 0:
+		fmt.Fprintf(os.Stderr, "%d of these can be repaired with -repair\n", fixable)
+	}
+	return fmt.Errorf("%d problem(s) found", remaining)
+}
+
+func runLookup(args []string) error {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Custom database path")
+	profileName := fs.String("profile", "", "Named vault to use instead of the default")
+	keyfilePath := fs.String("keyfile", "", "Path to the vault's keyfile")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: forgor lookup [-db path | -profile name] [-keyfile path] <url>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	path, err := resolveDBPath(*dbPath, *profileName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("no vault at %s", path)
+	}
+
+	store, err := storage.OpenReadOnly(path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if !store.IsInitialized() {
+		return fmt.Errorf("no vault at %s", path)
+	}
+	if *keyfilePath != "" {
+		if err := store.LoadKeyfile(*keyfilePath); err != nil {
+			return fmt.Errorf("failed to load keyfile: %w", err)
+		}
+	}
+
+	password, err := readPassphrase("Master password: ")
+	if err != nil {
+		return err
+	}
+	if _, err := store.Unlock(password); err != nil {
+		return err
+	}
+	defer store.Lock()
+
+	entries, err := store.Entries()
+	if err != nil {
+		return err
+	}
+	matches, err := models.Lookup(entries, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no entries match %s", fs.Arg(0))
+	}
+	for _, m := range matches {
+		fmt.Printf("%s\t%s\t%s (%s)\n", m.Entry.Title(), m.Entry.Username, m.URI.URI, m.URI.Mode())
+	}
+	return nil
+}
+
+// checkVault checks the vault and, when the device has joined a sync
+// vault, the sync state that refers to its entries.
+func checkVault(store *storage.Store, repair bool) ([]storage.Problem, error) {
+	problems, err := store.Check(repair)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check vault: %w", err)
+	}
+	entryIDs, err := store.EntryIDs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault index: %w", err)
+	}
+	syncState, err := sync.NewSyncState(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sync state: %w", err)
+	}
+	syncProblems, err := syncState.Check(entryIDs, repair)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check sync state: %w", err)
+	}
+	return append(problems, syncProblems...), nil
+}
+
+func resolveDBPath(custom, profileName string) (string, error) {
+	if custom != "" {
+		if profileName != "" {
+			return "", fmt.Errorf("-db and -profile cannot be combined")
+		}
+		return custom, nil
+	}
+	dataDir, err := getDataDir()
+	if err != nil {
+		return "", err
+	}
+	return profile.Path(dataDir, profileName)
+}
+
+// readPassphrase prompts on the terminal without echo, or reads a line from
+// stdin when it is not a terminal so the commands can be scripted.
+func readPassphrase(prompt string) (string, error) {
+	fd := os.Stdin.Fd()
+	if !term.IsTerminal(fd) {
+		line, err := stdinReader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(b), nil
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
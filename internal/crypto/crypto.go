@@ -4,12 +4,19 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
 	"golang.org/x/crypto/nacl/box"
 )
 
@@ -22,11 +29,68 @@ const (
 
 	SaltSize  = 16
 	NonceSize = 24
+
+	// Bounds for CalibrateKDF. The floor follows the OWASP minimum for
+	// Argon2id so slow devices still get a meaningful cost.
+	MinArgon2Time    = 2
+	MaxArgon2Time    = 64
+	MinArgon2Memory  = 19 * 1024
+	MaxArgon2Memory  = 1024 * 1024 // 1 GB
+	MaxArgon2Threads = 4
+
+	// Recovery codes carry 160 bits of entropy, written as eight groups of
+	// four base32 characters.
+	RecoveryCodeBytes     = 20
+	RecoveryCodeGroupSize = 4
 )
 
+var ErrInvalidRecoveryCode = errors.New("invalid recovery key format")
+
+// KDFParams are the Argon2id cost settings a vault key was derived with.
+// They are persisted next to the salt so each vault can carry its own cost.
+type KDFParams struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// DefaultKDFParams returns the parameters every vault used before they were
+// stored, so vaults without a kdf_params record keep unlocking.
+func DefaultKDFParams() KDFParams {
+	return KDFParams{
+		Time:    Argon2Time,
+		Memory:  Argon2Memory,
+		Threads: Argon2Threads,
+	}
+}
+
+func (p KDFParams) Validate() error {
+	if p.Time == 0 || p.Time > MaxArgon2Time {
+		return fmt.Errorf("invalid argon2 time: %d", p.Time)
+	}
+	if p.Memory < 8*uint32(p.Threads) || p.Memory > MaxArgon2Memory {
+		return fmt.Errorf("invalid argon2 memory: %d KiB", p.Memory)
+	}
+	if p.Threads == 0 {
+		return fmt.Errorf("invalid argon2 threads: %d", p.Threads)
+	}
+	return nil
+}
+
+// AtLeast reports whether p costs at least as much as other in both time and
+// memory. Thread count only affects wall-clock time, not attack cost.
+func (p KDFParams) AtLeast(other KDFParams) bool {
+	return p.Time >= other.Time && p.Memory >= other.Memory
+}
+
+func (p KDFParams) String() string {
+	return fmt.Sprintf("argon2id t=%d m=%dMiB p=%d", p.Time, p.Memory/1024, p.Threads)
+}
+
 var (
-	ErrDecryptionFailed = errors.New("decryption failed: invalid password or corrupted data")
+	ErrDecryptionFailed  = errors.New("decryption failed: invalid password or corrupted data")
 	ErrInvalidCiphertext = errors.New("ciphertext too short")
+	ErrMissingKey        = errors.New("private key is not available")
 )
 
 func GenerateSalt() ([]byte, error) {
@@ -37,18 +101,81 @@ func GenerateSalt() ([]byte, error) {
 	return salt, nil
 }
 
+// GenerateKey returns a random key suitable for Encrypt.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, Argon2KeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
 func DeriveKey(password string, salt []byte) []byte {
+	return DeriveKeyWithParams(password, salt, DefaultKDFParams())
+}
+
+func DeriveKeyWithParams(password string, salt []byte, params KDFParams) []byte {
 	return argon2.IDKey(
 		[]byte(password),
 		salt,
-		Argon2Time,
-		Argon2Memory,
-		Argon2Threads,
+		params.Time,
+		params.Memory,
+		params.Threads,
 		Argon2KeyLen,
 	)
 }
 
+// CalibrateKDF picks Argon2id parameters that take roughly target to derive
+// a key on this machine. Memory is raised first since it is what makes
+// GPU attacks expensive, then iterations fill the remaining time budget.
+func CalibrateKDF(target time.Duration) KDFParams {
+	threads := runtime.NumCPU()
+	if threads > MaxArgon2Threads {
+		threads = MaxArgon2Threads
+	}
+
+	salt := make([]byte, SaltSize)
+	return calibrateKDF(target, uint8(threads), func(p KDFParams) time.Duration {
+		start := time.Now()
+		argon2.IDKey([]byte("forgor-calibration"), salt, p.Time, p.Memory, p.Threads, Argon2KeyLen)
+		return time.Since(start)
+	})
+}
+
+// calibrateKDF is CalibrateKDF with the timing passed in. It measures with
+// the minimum number of passes from the start, so the minimum counts
+// against target instead of being added on top of it.
+func calibrateKDF(target time.Duration, threads uint8, measure func(KDFParams) time.Duration) KDFParams {
+	params := KDFParams{Time: MinArgon2Time, Memory: MinArgon2Memory, Threads: threads}
+
+	elapsed := measure(params)
+	for elapsed < target/2 && params.Memory*2 <= MaxArgon2Memory {
+		params.Memory *= 2
+		elapsed = measure(params)
+	}
+
+	if elapsed > 0 && elapsed < target {
+		scaled := uint64(params.Time) * uint64(target) / uint64(elapsed)
+		if scaled > MaxArgon2Time {
+			scaled = MaxArgon2Time
+		}
+		params.Time = uint32(scaled)
+	}
+
+	return params
+}
+
 func Encrypt(key, plaintext []byte) ([]byte, error) {
+	return EncryptWithAD(key, plaintext, nil)
+}
+
+func Decrypt(key, ciphertext []byte) ([]byte, error) {
+	return DecryptWithAD(key, ciphertext, nil)
+}
+
+// EncryptWithAD is Encrypt with associated data. The ciphertext only
+// decrypts when the same ad is passed to DecryptWithAD.
+func EncryptWithAD(key, plaintext, ad []byte) ([]byte, error) {
 	aead, err := chacha20poly1305.NewX(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cipher: %w", err)
@@ -59,11 +186,11 @@ func Encrypt(key, plaintext []byte) ([]byte, error) {
 		return nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	ciphertext := aead.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := aead.Seal(nonce, nonce, plaintext, ad)
 	return ciphertext, nil
 }
 
-func Decrypt(key, ciphertext []byte) ([]byte, error) {
+func DecryptWithAD(key, ciphertext, ad []byte) ([]byte, error) {
 	if len(ciphertext) < NonceSize {
 		return nil, ErrInvalidCiphertext
 	}
@@ -76,7 +203,7 @@ func Decrypt(key, ciphertext []byte) ([]byte, error) {
 	nonce := ciphertext[:NonceSize]
 	encrypted := ciphertext[NonceSize:]
 
-	plaintext, err := aead.Open(nil, nonce, encrypted, nil)
+	plaintext, err := aead.Open(nil, nonce, encrypted, ad)
 	if err != nil {
 		return nil, ErrDecryptionFailed
 	}
@@ -84,6 +211,102 @@ func Decrypt(key, ciphertext []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
+// StorageADVersion is the storage schema version that introduced bound
+// ciphertexts. It only changes when the layout of StorageAD does.
+const StorageADVersion = 4
+
+// StorageAD returns the associated data for a value stored under key in
+// bucket, so a ciphertext copied to any other location fails to decrypt.
+func StorageAD(bucket, key []byte) []byte {
+	ad := make([]byte, 0, 16+len(bucket)+len(key))
+	ad = append(ad, "forgor-storage"...)
+	ad = binary.BigEndian.AppendUint32(ad, StorageADVersion)
+	ad = binary.BigEndian.AppendUint32(ad, uint32(len(bucket)))
+	ad = append(ad, bucket...)
+	return append(ad, key...)
+}
+
+// GenerateRecoveryCode returns a random recovery code such as
+// "ABCD-EFGH-...". Use DeriveRecoveryKey to turn it into a wrapping key.
+func GenerateRecoveryCode() (string, error) {
+	raw := make([]byte, RecoveryCodeBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+
+	var groups []string
+	for i := 0; i < len(encoded); i += RecoveryCodeGroupSize {
+		groups = append(groups, encoded[i:i+RecoveryCodeGroupSize])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// NormalizeRecoveryCode strips separators and fixes characters that are
+// easy to misread when a code is typed back from paper.
+func NormalizeRecoveryCode(code string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(code) {
+		switch {
+		case r == '-' || r == ' ' || r == '\t':
+			continue
+		case r == '0':
+			r = 'O'
+		case r == '1':
+			r = 'I'
+		case r == '8':
+			r = 'B'
+		}
+		b.WriteRune(r)
+	}
+
+	normalized := b.String()
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalized)
+	if err != nil || len(decoded) != RecoveryCodeBytes {
+		return "", ErrInvalidRecoveryCode
+	}
+	return normalized, nil
+}
+
+// DeriveRecoveryKey turns a recovery code into a key-encryption key. The
+// code is already high entropy, so HKDF is used instead of Argon2id.
+func DeriveRecoveryKey(code string, salt []byte) ([]byte, error) {
+	normalized, err := NormalizeRecoveryCode(code)
+	if err != nil {
+		return nil, err
+	}
+	reader := hkdf.New(sha256.New, []byte(normalized), salt, []byte("forgor-recovery-kek"))
+	key := make([]byte, Argon2KeyLen)
+	if _, err := io.ReadFull(reader, key); err != nil {
+		return nil, fmt.Errorf("failed to derive recovery key: %w", err)
+	}
+	return key, nil
+}
+
+// HashKeyfile reduces a keyfile of any size to a 32-byte digest.
+func HashKeyfile(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	if n == 0 {
+		return nil, errors.New("keyfile is empty")
+	}
+	return h.Sum(nil), nil
+}
+
+// MixKeyfile combines a password-derived key with a keyfile digest so that
+// both are needed to reproduce the result.
+func MixKeyfile(key, keyfileHash []byte) ([]byte, error) {
+	reader := hkdf.New(sha256.New, key, keyfileHash, []byte("forgor-keyfile-kek"))
+	mixed := make([]byte, Argon2KeyLen)
+	if _, err := io.ReadFull(reader, mixed); err != nil {
+		return nil, fmt.Errorf("failed to mix keyfile: %w", err)
+	}
+	return mixed, nil
+}
+
 func GenerateBoxKeyPair() (pub, priv *[32]byte, err error) {
 	pub, priv, err = box.GenerateKey(rand.Reader)
 	if err != nil {
@@ -93,6 +316,9 @@ func GenerateBoxKeyPair() (pub, priv *[32]byte, err error) {
 }
 
 func BoxSeal(message []byte, recipientPub, senderPriv *[32]byte) ([]byte, error) {
+	if senderPriv == nil {
+		return nil, ErrMissingKey
+	}
 	var nonce [24]byte
 	if _, err := rand.Read(nonce[:]); err != nil {
 		return nil, fmt.Errorf("failed to generate nonce: %w", err)
@@ -103,6 +329,9 @@ func BoxSeal(message []byte, recipientPub, senderPriv *[32]byte) ([]byte, error)
 }
 
 func BoxOpen(ciphertext []byte, senderPub, recipientPriv *[32]byte) ([]byte, error) {
+	if recipientPriv == nil {
+		return nil, ErrMissingKey
+	}
 	if len(ciphertext) < 24 {
 		return nil, ErrInvalidCiphertext
 	}
@@ -128,8 +357,13 @@ func GenerateSignKeyPair() (pub [32]byte, priv [64]byte, err error) {
 	return pub, priv, nil
 }
 
-func Sign(privateKey [64]byte, message []byte) []byte {
-	return ed25519.Sign(privateKey[:], message)
+// Sign signs message with an Ed25519 private key. It fails rather than
+// panicking when the key has been wiped.
+func Sign(privateKey, message []byte) ([]byte, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, ErrMissingKey
+	}
+	return ed25519.Sign(privateKey, message), nil
 }
 
 func Verify(publicKey [32]byte, message, signature []byte) bool {
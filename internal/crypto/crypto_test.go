@@ -0,0 +1,116 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEncryptWithAD(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("secret")
+	ad := StorageAD([]byte("vault"), []byte("r:1"))
+
+	tests := []struct {
+		name      string
+		sealAD    []byte
+		openKey   []byte
+		openAD    []byte
+		wantError bool
+	}{
+		{"same ad", ad, key, ad, false},
+		{"no ad", nil, key, nil, false},
+		{"other key", ad, otherKey, ad, true},
+		{"other record", ad, key, StorageAD([]byte("vault"), []byte("r:2")), true},
+		{"other bucket", ad, key, StorageAD([]byte("history"), []byte("r:1")), true},
+		{"ad dropped", ad, key, nil, true},
+		{"ad added", nil, key, ad, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ciphertext, err := EncryptWithAD(key, plaintext, tt.sealAD)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecryptWithAD(tt.openKey, ciphertext, tt.openAD)
+			if tt.wantError {
+				if !errors.Is(err, ErrDecryptionFailed) {
+					t.Errorf("got %v, want %v", err, ErrDecryptionFailed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecryptWithAD: %v", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("got %q, want %q", got, plaintext)
+			}
+		})
+	}
+}
+
+func TestDecryptShortCiphertext(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(key, make([]byte, NonceSize-1)); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Errorf("got %v, want %v", err, ErrInvalidCiphertext)
+	}
+}
+
+func TestStorageADIsUnambiguous(t *testing.T) {
+	// Moving bytes between the bucket and key names must change the AD.
+	pairs := [][2]string{
+		{"vault", "r:1"},
+		{"vaul", "tr:1"},
+		{"vaultr", ":1"},
+		{"", "vaultr:1"},
+	}
+	seen := make(map[string][2]string)
+	for _, p := range pairs {
+		ad := string(StorageAD([]byte(p[0]), []byte(p[1])))
+		if prev, ok := seen[ad]; ok {
+			t.Errorf("StorageAD(%q, %q) equals StorageAD(%q, %q)", p[0], p[1], prev[0], prev[1])
+		}
+		seen[ad] = p
+	}
+}
+
+func TestCalibrateKDF(t *testing.T) {
+	const target = time.Second
+
+	// Model machines of different speeds by the cost of one pass over one
+	// KiB.
+	for _, perKiB := range []time.Duration{1, 5, 20, 24, 30, 40, 80, 200, 1000, 30000} {
+		cost := func(p KDFParams) time.Duration {
+			return time.Duration(p.Time) * time.Duration(p.Memory) * perKiB
+		}
+		params := calibrateKDF(target, 4, cost)
+		if err := params.Validate(); err != nil {
+			t.Errorf("%s/KiB: %v", perKiB, err)
+			continue
+		}
+		if params.Time < MinArgon2Time || params.Memory < MinArgon2Memory {
+			t.Errorf("%s/KiB: %s is below the minimum", perKiB, params)
+		}
+		// Only the minimum itself may take longer than target, and only
+		// the maximum number of passes may fall well short of it.
+		atFloor := params.Time == MinArgon2Time && params.Memory == MinArgon2Memory
+		got := cost(params)
+		if got > target && !atFloor {
+			t.Errorf("%s/KiB: %s takes %s, more than the %s target", perKiB, params, got, target)
+		}
+		if got < target/2 && params.Time != MaxArgon2Time {
+			t.Errorf("%s/KiB: %s takes %s, less than half the %s target", perKiB, params, got, target)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxAttachmentSize caps a single file. Contents live outside the entry
+	// JSON, so this bounds storage and transfer time rather than event size.
+	MaxAttachmentSize = 10 << 20
+	MaxAttachments    = 20
+)
+
+// Attachment describes a file attached to an entry. The contents are stored
+// separately under ID and never change; replacing a file adds a new ID.
+type Attachment struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// NewAttachment describes content to be attached under the file name name.
+func NewAttachment(name string, content []byte) (Attachment, error) {
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return Attachment{}, errors.New("attachment name is required")
+	}
+	if len(content) > MaxAttachmentSize {
+		return Attachment{}, fmt.Errorf("%s is %s, the limit is %s", name, FormatSize(int64(len(content))), FormatSize(MaxAttachmentSize))
+	}
+	sum := sha256.Sum256(content)
+	return Attachment{
+		ID:      generateID(),
+		Name:    name,
+		Size:    int64(len(content)),
+		SHA256:  hex.EncodeToString(sum[:]),
+		AddedAt: time.Now(),
+	}, nil
+}
+
+// Verify checks that content is what a describes.
+func (a Attachment) Verify(content []byte) error {
+	if int64(len(content)) != a.Size {
+		return fmt.Errorf("attachment %s: expected %d bytes, got %d", a.Name, a.Size, len(content))
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != a.SHA256 {
+		return fmt.Errorf("attachment %s: checksum mismatch", a.Name)
+	}
+	return nil
+}
+
+// AttachmentChunk is one piece of an attachment's contents, sized to fit
+// transports with a message limit. Size and SHA256 describe the whole file
+// so the receiver can check it once every chunk has arrived.
+type AttachmentChunk struct {
+	AttachmentID string `json:"attachment_id"`
+	Index        int    `json:"index"`
+	Count        int    `json:"count"`
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256"`
+	Data         []byte `json:"data"`
+}
+
+// SplitAttachment cuts content into chunks of at most chunkSize bytes. An
+// empty file is sent as a single empty chunk.
+func SplitAttachment(a Attachment, content []byte, chunkSize int) []AttachmentChunk {
+	count := (len(content) + chunkSize - 1) / chunkSize
+	if count == 0 {
+		count = 1
+	}
+	chunks := make([]AttachmentChunk, 0, count)
+	for i := 0; i < count; i++ {
+		start := i * chunkSize
+		end := min(start+chunkSize, len(content))
+		chunks = append(chunks, AttachmentChunk{
+			AttachmentID: a.ID,
+			Index:        i,
+			Count:        count,
+			Size:         a.Size,
+			SHA256:       a.SHA256,
+			Data:         content[start:end],
+		})
+	}
+	return chunks
+}
+
+// Validate checks that a received chunk is consistent with itself and with
+// the size limit.
+func (c AttachmentChunk) Validate(chunkSize int) error {
+	if c.AttachmentID == "" {
+		return errors.New("chunk has no attachment id")
+	}
+	if c.Size < 0 || c.Size > MaxAttachmentSize {
+		return fmt.Errorf("attachment size %d out of range", c.Size)
+	}
+	want := int((c.Size + int64(chunkSize) - 1) / int64(chunkSize))
+	if want == 0 {
+		want = 1
+	}
+	if c.Count != want || c.Index < 0 || c.Index >= c.Count {
+		return fmt.Errorf("chunk %d of %d does not match size %d", c.Index, c.Count, c.Size)
+	}
+	if len(c.Data) > chunkSize {
+		return fmt.Errorf("chunk of %d bytes exceeds %d", len(c.Data), chunkSize)
+	}
+	return nil
+}
+
+// AttachmentIDs returns the IDs of the entries' attachments.
+func AttachmentIDs(entries []Entry) map[string]bool {
+	ids := make(map[string]bool)
+	for _, e := range entries {
+		for _, a := range e.Attachments {
+			ids[a.ID] = true
+		}
+	}
+	return ids
+}
+
+// FormatSize renders a byte count for display.
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSplitAttachment(t *testing.T) {
+	const chunkSize = 4
+	tests := []struct {
+		name    string
+		content string
+		count   int
+	}{
+		{"empty", "", 1},
+		{"short", "abc", 1},
+		{"exact", "abcd", 1},
+		{"one over", "abcde", 2},
+		{"several", "abcdefghijkl", 3},
+		{"uneven", "abcdefghijklm", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := []byte(tt.content)
+			a, err := NewAttachment("file.txt", content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks := SplitAttachment(a, content, chunkSize)
+			if len(chunks) != tt.count {
+				t.Fatalf("got %d chunks, want %d", len(chunks), tt.count)
+			}
+			var joined []byte
+			for i, c := range chunks {
+				if c.AttachmentID != a.ID || c.Index != i || c.Count != tt.count || c.Size != a.Size || c.SHA256 != a.SHA256 {
+					t.Errorf("chunk %d: %+v does not describe %+v", i, c, a)
+				}
+				if err := c.Validate(chunkSize); err != nil {
+					t.Errorf("chunk %d: Validate: %v", i, err)
+				}
+				joined = append(joined, c.Data...)
+			}
+			if !bytes.Equal(joined, content) {
+				t.Errorf("joined chunks = %q, want %q", joined, content)
+			}
+			if err := a.Verify(joined); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateChunk(t *testing.T) {
+	const chunkSize = 4
+	valid := AttachmentChunk{AttachmentID: "a", Index: 1, Count: 3, Size: 10, SHA256: "x", Data: []byte("efgh")}
+	tests := []struct {
+		name   string
+		modify func(c *AttachmentChunk)
+		ok     bool
+	}{
+		{"valid", func(c *AttachmentChunk) {}, true},
+		{"last chunk", func(c *AttachmentChunk) { c.Index, c.Data = 2, []byte("ij") }, true},
+		{"empty file", func(c *AttachmentChunk) { c.Index, c.Count, c.Size, c.Data = 0, 1, 0, nil }, true},
+		{"largest file", func(c *AttachmentChunk) {
+			c.Size = MaxAttachmentSize
+			c.Count = MaxAttachmentSize / chunkSize
+		}, true},
+		{"no id", func(c *AttachmentChunk) { c.AttachmentID = "" }, false},
+		{"negative size", func(c *AttachmentChunk) { c.Size = -1 }, false},
+		{"too large", func(c *AttachmentChunk) {
+			c.Size = MaxAttachmentSize + 1
+			c.Count = MaxAttachmentSize/chunkSize + 1
+		}, false},
+		{"count too high", func(c *AttachmentChunk) { c.Count = 4 }, false},
+		{"count too low", func(c *AttachmentChunk) { c.Count = 2 }, false},
+		{"zero count for empty file", func(c *AttachmentChunk) { c.Index, c.Count, c.Size, c.Data = 0, 0, 0, nil }, false},
+		{"negative index", func(c *AttachmentChunk) { c.Index = -1 }, false},
+		{"index past count", func(c *AttachmentChunk) { c.Index = 3 }, false},
+		{"data too long", func(c *AttachmentChunk) { c.Data = []byte("efghi") }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			err := c.Validate(chunkSize)
+			if tt.ok && err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("Validate accepted an invalid chunk")
+			}
+		})
+	}
+}
+
+func TestNewAttachment(t *testing.T) {
+	if _, err := NewAttachment("  ", nil); err == nil {
+		t.Error("NewAttachment accepted an empty name")
+	}
+	if _, err := NewAttachment("big.bin", make([]byte, MaxAttachmentSize+1)); err == nil {
+		t.Error("NewAttachment accepted a file over the limit")
+	}
+	a, err := NewAttachment("dir/../notes.txt", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "notes.txt" || a.Size != 5 {
+		t.Errorf("got %+v", a)
+	}
+	if err := a.Verify([]byte("hellO")); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Verify with changed content: %v", err)
+	}
+	if err := a.Verify([]byte("hello!")); err == nil {
+		t.Error("Verify accepted content of the wrong size")
+	}
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxFolderNameLength keeps folder paths readable in the list.
+const MaxFolderNameLength = 100
+
+// Folder groups entries. Folders nest through ParentID; an empty ParentID,
+// or one naming a folder that no longer exists, puts a folder at the top.
+type Folder struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewFolder(name, parentID string) Folder {
+	return Folder{
+		ID:        generateID(),
+		Name:      strings.TrimSpace(name),
+		ParentID:  parentID,
+		UpdatedAt: time.Now(),
+	}
+}
+
+func (f Folder) Validate() error {
+	name := strings.TrimSpace(f.Name)
+	if name == "" {
+		return errors.New("folder name is required")
+	}
+	if len(name) > MaxFolderNameLength {
+		return fmt.Errorf("folder name is longer than %d characters", MaxFolderNameLength)
+	}
+	return nil
+}
+
+// Folders indexes a folder list for tree lookups.
+type Folders struct {
+	byID     map[string]Folder
+	children map[string][]Folder
+}
+
+func NewFolders(list []Folder) Folders {
+	t := Folders{
+		byID:     make(map[string]Folder, len(list)),
+		children: make(map[string][]Folder),
+	}
+	for _, f := range list {
+		t.byID[f.ID] = f
+	}
+	for _, f := range list {
+		parent := t.Parent(f.ID)
+		t.children[parent] = append(t.children[parent], f)
+	}
+	for _, kids := range t.children {
+		sort.SliceStable(kids, func(i, j int) bool {
+			return strings.ToLower(kids[i].Name) < strings.ToLower(kids[j].Name)
+		})
+	}
+	return t
+}
+
+func (t Folders) Get(id string) (Folder, bool) {
+	f, ok := t.byID[id]
+	return f, ok
+}
+
+// Parent returns the ID of the folder's parent, or "" at the top. Parents
+// that are missing or would form a cycle count as the top.
+func (t Folders) Parent(id string) string {
+	f, ok := t.byID[id]
+	if !ok {
+		return ""
+	}
+	if _, ok := t.byID[f.ParentID]; !ok || t.cycles(id) {
+		return ""
+	}
+	return f.ParentID
+}
+
+func (t Folders) cycles(id string) bool {
+	seen := map[string]bool{id: true}
+	for cur := t.byID[id].ParentID; cur != ""; cur = t.byID[cur].ParentID {
+		if seen[cur] {
+			return true
+		}
+		if _, ok := t.byID[cur]; !ok {
+			return false
+		}
+		seen[cur] = true
+	}
+	return false
+}
+
+// Children returns the folders directly inside parentID, sorted by name.
+// An empty parentID lists the top level.
+func (t Folders) Children(parentID string) []Folder {
+	return t.children[parentID]
+}
+
+// Resolve maps a folder ID to itself if the folder exists and to "" if not,
+// so entries in deleted folders show at the top.
+func (t Folders) Resolve(id string) string {
+	if _, ok := t.byID[id]; ok {
+		return id
+	}
+	return ""
+}
+
+// Path returns the folder's names from the top, joined with " / ".
+func (t Folders) Path(id string) string {
+	var names []string
+	for cur := t.Resolve(id); cur != ""; cur = t.Parent(cur) {
+		names = append([]string{t.byID[cur].Name}, names...)
+	}
+	return strings.Join(names, " / ")
+}
+
+// Depth returns how many folders contain id; top-level folders are 0.
+func (t Folders) Depth(id string) int {
+	depth := 0
+	for cur := t.Parent(id); cur != ""; cur = t.Parent(cur) {
+		depth++
+	}
+	return depth
+}
+
+// Contains reports whether folder other is id or inside it.
+func (t Folders) Contains(id, other string) bool {
+	for cur := t.Resolve(other); cur != ""; cur = t.Parent(cur) {
+		if cur == id {
+			return true
+		}
+	}
+	return false
+}
+
+// All returns every folder in tree order: each folder followed by its
+// children.
+func (t Folders) All() []Folder {
+	var out []Folder
+	var walk func(parent string)
+	walk = func(parent string) {
+		for _, f := range t.children[parent] {
+			out = append(out, f)
+			walk(f.ID)
+		}
+	}
+	walk("")
+	return out
+}
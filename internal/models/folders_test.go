@@ -0,0 +1,80 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func folderNames(folders []Folder) string {
+	var names []string
+	for _, f := range folders {
+		names = append(names, f.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestFolders(t *testing.T) {
+	folders := NewFolders([]Folder{
+		{ID: "work", Name: "Work"},
+		{ID: "banks", Name: "banks"},
+		{ID: "mail", Name: "Mail", ParentID: "work"},
+		{ID: "old", Name: "Old", ParentID: "mail"},
+		{ID: "lost", Name: "Lost", ParentID: "deleted"},
+	})
+
+	if got := folderNames(folders.Children("")); got != "banks,Lost,Work" {
+		t.Errorf("top level = %s, want banks,Lost,Work", got)
+	}
+	if got := folderNames(folders.All()); got != "banks,Lost,Work,Mail,Old" {
+		t.Errorf("All = %s", got)
+	}
+	if got := folders.Path("old"); got != "Work / Mail / Old" {
+		t.Errorf("Path = %q", got)
+	}
+	if got := folders.Depth("old"); got != 2 {
+		t.Errorf("Depth = %d, want 2", got)
+	}
+	if got := folders.Parent("lost"); got != "" {
+		t.Errorf("folder with a missing parent is under %q", got)
+	}
+	if got := folders.Resolve("deleted"); got != "" {
+		t.Errorf("Resolve of a missing folder = %q", got)
+	}
+	if !folders.Contains("work", "old") || !folders.Contains("work", "work") {
+		t.Error("work does not contain itself and its descendants")
+	}
+	if folders.Contains("mail", "work") || folders.Contains("work", "banks") {
+		t.Error("Contains crosses branches")
+	}
+}
+
+func TestFolderCycles(t *testing.T) {
+	// Two devices moved each folder into the other.
+	folders := NewFolders([]Folder{
+		{ID: "a", Name: "A", ParentID: "b"},
+		{ID: "b", Name: "B", ParentID: "a"},
+	})
+	if got := folderNames(folders.All()); got != "A,B" {
+		t.Errorf("All = %s, want both folders at the top", got)
+	}
+	if got := folders.Path("a"); got != "A" {
+		t.Errorf("Path = %q", got)
+	}
+	if folders.Contains("a", "b") {
+		t.Error("cycle counted as nesting")
+	}
+}
+
+func TestFolderValidate(t *testing.T) {
+	if err := NewFolder("  Work ", "").Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	if f := NewFolder("  Work ", ""); f.Name != "Work" || f.ID == "" {
+		t.Errorf("NewFolder = %+v", f)
+	}
+	for _, name := range []string{"", "   ", strings.Repeat("x", MaxFolderNameLength+1)} {
+		if err := (Folder{ID: "f", Name: name}).Validate(); err == nil {
+			t.Errorf("accepted name of length %d", len(name))
+		}
+	}
+}
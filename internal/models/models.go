@@ -3,7 +3,16 @@ package models
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"forgor/internal/secmem"
 )
 
 type Entry struct {
@@ -14,6 +23,28 @@ type Entry struct {
 	Notes     string    `json:"notes"`
 	Tags      []string  `json:"tags,omitempty"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// Favorite pins the entry; see SortFavoritesFirst.
+	Favorite bool `json:"favorite,omitempty"`
+	// Type selects the form and fields; empty means EntryLogin.
+	Type EntryType `json:"type,omitempty"`
+	// Name titles entries that have no website.
+	Name string `json:"name,omitempty"`
+	// FolderID places the entry in a Folder; empty means the top level.
+	FolderID string `json:"folder_id,omitempty"`
+	// URIs lists the URLs the entry is used on; see MatchURIs.
+	URIs []EntryURI `json:"uris,omitempty"`
+	// Data holds the values of type-specific fields, keyed by FieldSpec.Key.
+	Data map[string]string `json:"data,omitempty"`
+	// TOTP is an otpauth:// URI or base32 secret for two-factor codes.
+	TOTP string `json:"totp,omitempty"`
+	// Fields holds user-defined fields in display order.
+	Fields []CustomField `json:"fields,omitempty"`
+	// Attachments describes attached files; see Store.Attachment.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// History holds earlier usernames and passwords, newest first.
+	History []CredentialChange `json:"history,omitempty"`
+	// DeletedAt is set while the entry is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 func NewEntry(website, username, password, notes string, tags []string) Entry {
@@ -28,6 +59,28 @@ func NewEntry(website, username, password, notes string, tags []string) Entry {
 	}
 }
 
+// Duplicate returns a copy of e under a new ID, for placing the same
+// credentials in another vault. Folders belong to a vault, so the copy
+// starts at the top level.
+func (e Entry) Duplicate() Entry {
+	dup := e
+	dup.ID = generateID()
+	dup.FolderID = ""
+	dup.DeletedAt = nil
+	dup.Tags = append([]string(nil), e.Tags...)
+	dup.Fields = append([]CustomField(nil), e.Fields...)
+	dup.URIs = append([]EntryURI(nil), e.URIs...)
+	dup.Attachments = append([]Attachment(nil), e.Attachments...)
+	if e.Data != nil {
+		dup.Data = make(map[string]string, len(e.Data))
+		for k, v := range e.Data {
+			dup.Data[k] = v
+		}
+	}
+	dup.History = append([]CredentialChange(nil), e.History...)
+	return dup
+}
+
 type Friend struct {
 	Fingerprint string    `json:"fingerprint"`
 	Name        string    `json:"name"`
@@ -37,15 +90,20 @@ type Friend struct {
 }
 
 type Device struct {
-	Name    string   `json:"name"`
-	PubKey  [32]byte `json:"pubkey"`
-	PrivKey [32]byte `json:"privkey"`
+	Name    string         `json:"name"`
+	PubKey  [32]byte       `json:"pubkey"`
+	PrivKey *secmem.Buffer `json:"-"`
 }
 
 func (d *Device) Fingerprint() string {
 	return ComputeFingerprint(d.PubKey[:])
 }
 
+// Destroy wipes the device's private key.
+func (d *Device) Destroy() {
+	d.PrivKey.Destroy()
+}
+
 type Peer struct {
 	Name        string
 	Fingerprint string
@@ -71,6 +129,9 @@ type IncomingShare struct {
 	FromFingerprint string
 	FromName        string
 	Entry           Entry
+	// Attachments holds the contents of Entry.Attachments that arrived,
+	// keyed by attachment ID.
+	Attachments map[string][]byte
 }
 
 func ComputeFingerprint(pubKey []byte) string {
@@ -85,3 +146,138 @@ func generateID() string {
 	rand.Read(b)
 	return hex.EncodeToString(b)
 }
+
+type VaultSnapshot struct {
+	ID      string    `json:"-"`
+	SavedAt time.Time `json:"saved_at"`
+	Entries []Entry   `json:"entries"`
+}
+
+// MaxCredentialHistory caps Entry.History so entries stay well inside the
+// sync event size limit.
+const MaxCredentialHistory = 20
+
+// CredentialChange is a username and password an entry used to have, and
+// when it was replaced.
+type CredentialChange struct {
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// RecordCredentials pushes the entry's current username and password onto
+// its history, newest first. Call it before overwriting them.
+func (e *Entry) RecordCredentials(at time.Time) {
+	change := CredentialChange{Username: e.Username, Password: e.Password, ChangedAt: at}
+	e.History = MergeCredentialHistory([]CredentialChange{change}, e.History)
+}
+
+// MergeCredentialHistory combines two histories, dropping duplicates and
+// keeping the newest MaxCredentialHistory changes.
+func MergeCredentialHistory(a, b []CredentialChange) []CredentialChange {
+	seen := make(map[CredentialChange]bool, len(a)+len(b))
+	merged := make([]CredentialChange, 0, len(a)+len(b))
+	for _, list := range [][]CredentialChange{a, b} {
+		for _, c := range list {
+			key := CredentialChange{Username: c.Username, Password: c.Password, ChangedAt: c.ChangedAt.UTC()}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, c)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].ChangedAt.After(merged[j].ChangedAt)
+	})
+	if len(merged) > MaxCredentialHistory {
+		merged = merged[:MaxCredentialHistory]
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// MaxCustomFields caps Entry.Fields for the same reason as
+// MaxCredentialHistory.
+const MaxCustomFields = 50
+
+type FieldType string
+
+const (
+	FieldText   FieldType = "text"
+	FieldHidden FieldType = "hidden"
+	FieldEmail  FieldType = "email"
+	FieldURL    FieldType = "url"
+	FieldNumber FieldType = "number"
+	FieldDate   FieldType = "date"
+)
+
+// FieldTypes lists the field types in the order they are offered.
+var FieldTypes = []FieldType{FieldText, FieldHidden, FieldEmail, FieldURL, FieldNumber, FieldDate}
+
+// FieldDateLayout is the format date fields are entered and stored in.
+const FieldDateLayout = "2006-01-02"
+
+// ParseFieldType maps a case-insensitive name to a FieldType. An empty name
+// means text.
+func ParseFieldType(s string) (FieldType, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return FieldText, nil
+	}
+	for _, t := range FieldTypes {
+		if string(t) == s {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown field type %q", s)
+}
+
+// CustomField is a named value on an entry. Type controls how the value is
+// validated and whether it is masked.
+type CustomField struct {
+	Name  string    `json:"name"`
+	Type  FieldType `json:"type"`
+	Value string    `json:"value"`
+}
+
+// Hidden reports whether the value should be masked like a password.
+func (f CustomField) Hidden() bool {
+	return f.Type == FieldHidden
+}
+
+// Validate checks the name and that the value matches the type. Empty
+// values are allowed for every type.
+func (f CustomField) Validate() error {
+	if strings.TrimSpace(f.Name) == "" {
+		return errors.New("field name is required")
+	}
+	if f.Value == "" {
+		return nil
+	}
+	switch f.Type {
+	case FieldText, FieldHidden:
+	case FieldEmail:
+		if _, err := mail.ParseAddress(f.Value); err != nil {
+			return fmt.Errorf("%s: not a valid email address", f.Name)
+		}
+	case FieldURL:
+		u, err := url.Parse(f.Value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%s: not a valid URL", f.Name)
+		}
+	case FieldNumber:
+		if _, err := strconv.ParseFloat(f.Value, 64); err != nil {
+			return fmt.Errorf("%s: not a number", f.Name)
+		}
+	case FieldDate:
+		if _, err := time.Parse(FieldDateLayout, f.Value); err != nil {
+			return fmt.Errorf("%s: date must be YYYY-MM-DD", f.Name)
+		}
+	default:
+		return fmt.Errorf("%s: unknown field type %q", f.Name, f.Type)
+	}
+	return nil
+}
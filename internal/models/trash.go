@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// DefaultTrashRetention is how long trashed entries are kept when no
+// retention has been set.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// Trashed returns the entry as moved to the trash at the given time.
+func (e Entry) Trashed(at time.Time) Entry {
+	e.DeletedAt = &at
+	return e
+}
+
+// Restored returns the entry taken back out of the trash.
+func (e Entry) Restored() Entry {
+	e.DeletedAt = nil
+	return e
+}
+
+// PurgeAt returns when a trashed entry is due to be purged, or the zero
+// time if retention is 0, which keeps the trash forever.
+func (e Entry) PurgeAt(retention time.Duration) time.Time {
+	if e.DeletedAt == nil || retention <= 0 {
+		return time.Time{}
+	}
+	return e.DeletedAt.Add(retention)
+}
+
+// PurgeTrash splits trashed entries into those kept and those past the
+// retention period.
+func PurgeTrash(trash []Entry, retention time.Duration, now time.Time) (kept, purged []Entry) {
+	for _, e := range trash {
+		if at := e.PurgeAt(retention); !at.IsZero() && !now.Before(at) {
+			purged = append(purged, e)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept, purged
+}
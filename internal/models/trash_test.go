@@ -0,0 +1,43 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurgeTrash(t *testing.T) {
+	now := time.Date(2026, 5, 31, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	old := Entry{ID: "old"}.Trashed(now.Add(-31 * day))
+	due := Entry{ID: "due"}.Trashed(now.Add(-30 * day))
+	recent := Entry{ID: "recent"}.Trashed(now.Add(-day))
+	trash := []Entry{old, due, recent}
+
+	kept, purged := PurgeTrash(trash, DefaultTrashRetention, now)
+	if len(kept) != 1 || kept[0].ID != "recent" {
+		t.Errorf("kept = %v, want recent", kept)
+	}
+	if len(purged) != 2 || purged[0].ID != "old" || purged[1].ID != "due" {
+		t.Errorf("purged = %v, want old and due", purged)
+	}
+
+	// A retention of 0 keeps the trash forever.
+	kept, purged = PurgeTrash(trash, 0, now)
+	if len(kept) != 3 || len(purged) != 0 {
+		t.Errorf("retention 0: kept %d, purged %d", len(kept), len(purged))
+	}
+}
+
+func TestTrashedRestored(t *testing.T) {
+	at := time.Now()
+	e := Entry{ID: "a"}.Trashed(at)
+	if e.DeletedAt == nil || !e.DeletedAt.Equal(at) {
+		t.Fatalf("DeletedAt = %v, want %v", e.DeletedAt, at)
+	}
+	if got := e.PurgeAt(time.Hour); !got.Equal(at.Add(time.Hour)) {
+		t.Errorf("PurgeAt = %v", got)
+	}
+	if e = e.Restored(); e.DeletedAt != nil || !e.PurgeAt(time.Hour).IsZero() {
+		t.Errorf("restored entry still trashed: %v", e.DeletedAt)
+	}
+}
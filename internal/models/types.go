@@ -0,0 +1,287 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"forgor/internal/totp"
+)
+
+type EntryType string
+
+const (
+	EntryLogin    EntryType = "login"
+	EntryNote     EntryType = "note"
+	EntryCard     EntryType = "card"
+	EntryIdentity EntryType = "identity"
+	EntrySSHKey   EntryType = "ssh_key"
+	EntryAPIToken EntryType = "api_token"
+)
+
+// FieldSpec describes one input of an entry type's form. Key is what
+// Entry.Get and Entry.Set take.
+type FieldSpec struct {
+	Key         string
+	Label       string
+	Type        FieldType
+	Placeholder string
+	Required    bool
+	Multiline   bool
+	// Check adds validation beyond what Type implies.
+	Check func(string) error
+}
+
+// Hidden reports whether the value should be masked like a password.
+func (f FieldSpec) Hidden() bool {
+	return f.Type == FieldHidden
+}
+
+// Validate checks a value entered for the field.
+func (f FieldSpec) Validate(value string) error {
+	if value == "" {
+		if f.Required {
+			return fmt.Errorf("%s is required", f.Label)
+		}
+		return nil
+	}
+	if err := (CustomField{Name: f.Label, Type: f.Type, Value: value}).Validate(); err != nil {
+		return err
+	}
+	if f.Check != nil {
+		if err := f.Check(value); err != nil {
+			return fmt.Errorf("%s: %w", f.Label, err)
+		}
+	}
+	return nil
+}
+
+// TypeSpec describes an entry type: its form fields in order, which one
+// titles the entry, and which one "copy secret" copies.
+type TypeSpec struct {
+	Type      EntryType
+	Label     string
+	TitleKey  string
+	SecretKey string
+	Fields    []FieldSpec
+}
+
+var (
+	nameField  = FieldSpec{Key: "name", Label: "Name", Type: FieldText, Required: true}
+	notesField = FieldSpec{Key: "notes", Label: "Notes", Type: FieldText, Multiline: true}
+)
+
+// EntryTypes lists every entry type in the order they are offered.
+var EntryTypes = []TypeSpec{
+	{
+		Type: EntryLogin, Label: "Login", TitleKey: "website", SecretKey: "password",
+		Fields: []FieldSpec{
+			{Key: "website", Label: "Website", Type: FieldText, Required: true},
+			{Key: "uris", Label: "URLs", Type: FieldText, Multiline: true, Placeholder: "One per line, optionally followed by host, prefix, exact, regex or never", Check: checkURIs},
+			{Key: "username", Label: "Username", Type: FieldText},
+			{Key: "password", Label: "Password", Type: FieldHidden},
+			{Key: "totp", Label: "TOTP", Type: FieldText, Placeholder: "otpauth:// URI or secret (optional)", Check: checkTOTP},
+			notesField,
+		},
+	},
+	{
+		Type: EntryNote, Label: "Secure note", TitleKey: "name", SecretKey: "notes",
+		Fields: []FieldSpec{
+			nameField,
+			{Key: "notes", Label: "Note", Type: FieldText, Multiline: true},
+		},
+	},
+	{
+		Type: EntryCard, Label: "Payment card", TitleKey: "name", SecretKey: "number",
+		Fields: []FieldSpec{
+			nameField,
+			{Key: "cardholder", Label: "Cardholder", Type: FieldText},
+			{Key: "number", Label: "Number", Type: FieldHidden, Required: true, Check: checkCardNumber},
+			{Key: "expiry", Label: "Expiry", Type: FieldText, Placeholder: "MM/YY", Check: checkCardExpiry},
+			{Key: "cvv", Label: "CVV", Type: FieldHidden, Check: checkCVV},
+			{Key: "pin", Label: "PIN", Type: FieldHidden},
+			notesField,
+		},
+	},
+	{
+		Type: EntryIdentity, Label: "Identity", TitleKey: "name", SecretKey: "document",
+		Fields: []FieldSpec{
+			nameField,
+			{Key: "full_name", Label: "Full name", Type: FieldText},
+			{Key: "email", Label: "Email", Type: FieldEmail},
+			{Key: "phone", Label: "Phone", Type: FieldText},
+			{Key: "address", Label: "Address", Type: FieldText, Multiline: true},
+			{Key: "birth_date", Label: "Birth date", Type: FieldDate, Placeholder: FieldDateLayout},
+			{Key: "document", Label: "ID number", Type: FieldHidden, Placeholder: "Passport, license or national ID"},
+			notesField,
+		},
+	},
+	{
+		Type: EntrySSHKey, Label: "SSH key", TitleKey: "name", SecretKey: "private_key",
+		Fields: []FieldSpec{
+			nameField,
+			{Key: "private_key", Label: "Private key", Type: FieldHidden, Multiline: true, Required: true},
+			{Key: "public_key", Label: "Public key", Type: FieldText, Multiline: true},
+			{Key: "passphrase", Label: "Passphrase", Type: FieldHidden},
+			notesField,
+		},
+	},
+	{
+		Type: EntryAPIToken, Label: "API token", TitleKey: "name", SecretKey: "token",
+		Fields: []FieldSpec{
+			nameField,
+			{Key: "token", Label: "Token", Type: FieldHidden, Required: true},
+			{Key: "scopes", Label: "Scopes", Type: FieldText},
+			{Key: "expires", Label: "Expires", Type: FieldDate, Placeholder: FieldDateLayout},
+			notesField,
+		},
+	},
+}
+
+// SpecFor returns the spec for t. Unknown types, such as ones added by a
+// newer version, are shown as secure notes so their data is not lost.
+func SpecFor(t EntryType) TypeSpec {
+	if t == "" {
+		t = EntryLogin
+	}
+	for _, spec := range EntryTypes {
+		if spec.Type == t {
+			return spec
+		}
+	}
+	spec := EntryTypes[1]
+	spec.Type = t
+	return spec
+}
+
+// Kind returns the entry's type, treating entries from before types
+// existed as logins.
+func (e Entry) Kind() EntryType {
+	if e.Type == "" {
+		return EntryLogin
+	}
+	return e.Type
+}
+
+// Title names the entry in lists.
+func (e Entry) Title() string {
+	return e.Get(SpecFor(e.Kind()).TitleKey)
+}
+
+// Get returns the value stored under a FieldSpec key.
+func (e Entry) Get(key string) string {
+	switch key {
+	case "website":
+		return e.Website
+	case "username":
+		return e.Username
+	case "password":
+		return e.Password
+	case "notes":
+		return e.Notes
+	case "name":
+		return e.Name
+	case "totp":
+		return e.TOTP
+	case "uris":
+		return FormatURIs(e.URIs)
+	}
+	return e.Data[key]
+}
+
+// Set stores a value under a FieldSpec key. Empty values are removed from
+// Data.
+func (e *Entry) Set(key, value string) {
+	switch key {
+	case "website":
+		e.Website = value
+	case "username":
+		e.Username = value
+	case "password":
+		e.Password = value
+	case "notes":
+		e.Notes = value
+	case "name":
+		e.Name = value
+	case "totp":
+		e.TOTP = value
+	case "uris":
+		e.URIs, _ = ParseURIs(value)
+	default:
+		if value == "" {
+			delete(e.Data, key)
+			return
+		}
+		if e.Data == nil {
+			e.Data = make(map[string]string)
+		}
+		e.Data[key] = value
+	}
+}
+
+func checkURIs(s string) error {
+	_, err := ParseURIs(s)
+	return err
+}
+
+func checkTOTP(s string) error {
+	_, err := totp.Parse(s)
+	return err
+}
+
+func checkCardNumber(s string) error {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	if len(digits) < 12 || len(digits) > 19 {
+		return errors.New("must be 12 to 19 digits")
+	}
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if d < '0' || d > '9' {
+			return errors.New("must contain only digits")
+		}
+		n := int(d - '0')
+		if i%2 == 1 {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+	}
+	if sum%10 != 0 {
+		return errors.New("failed checksum, check for typos")
+	}
+	return nil
+}
+
+func checkCardExpiry(s string) error {
+	month, year, ok := strings.Cut(s, "/")
+	if !ok {
+		return errors.New("use MM/YY")
+	}
+	m, err := strconv.Atoi(strings.TrimSpace(month))
+	if err != nil || m < 1 || m > 12 {
+		return errors.New("month must be 01 to 12")
+	}
+	layout := "06"
+	if len(strings.TrimSpace(year)) == 4 {
+		layout = "2006"
+	}
+	if _, err := time.Parse(layout, strings.TrimSpace(year)); err != nil {
+		return errors.New("use MM/YY")
+	}
+	return nil
+}
+
+func checkCVV(s string) error {
+	if len(s) < 3 || len(s) > 4 {
+		return errors.New("must be 3 or 4 digits")
+	}
+	if _, err := strconv.Atoi(s); err != nil {
+		return errors.New("must be 3 or 4 digits")
+	}
+	return nil
+}
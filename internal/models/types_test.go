@@ -0,0 +1,96 @@
+package models
+
+import "testing"
+
+func TestSpecFor(t *testing.T) {
+	if got := SpecFor(""); got.Type != EntryLogin {
+		t.Errorf("SpecFor(\"\") = %s, want %s", got.Type, EntryLogin)
+	}
+	for _, spec := range EntryTypes {
+		if got := SpecFor(spec.Type); got.Label != spec.Label {
+			t.Errorf("SpecFor(%s) = %s, want %s", spec.Type, got.Label, spec.Label)
+		}
+	}
+
+	// Unknown types keep their name but get the secure note form.
+	got := SpecFor("vehicle")
+	if got.Type != "vehicle" || got.TitleKey != "name" || len(got.Fields) != len(SpecFor(EntryNote).Fields) {
+		t.Errorf("SpecFor(vehicle) = %+v, want a secure note form", got)
+	}
+	if EntryTypes[1].Type != EntryNote {
+		t.Error("SpecFor falls back to EntryTypes[1], which is no longer the secure note")
+	}
+}
+
+func TestEntryGetSet(t *testing.T) {
+	var e Entry
+	for _, spec := range EntryTypes {
+		for _, field := range spec.Fields {
+			value := "value of " + field.Key
+			if field.Key == "uris" {
+				value = "example.com"
+			}
+			e.Set(field.Key, value)
+			if got := e.Get(field.Key); got != value {
+				t.Errorf("%s: Get(%q) = %q, want %q", spec.Type, field.Key, got, value)
+			}
+		}
+	}
+
+	e.Set("pin", "")
+	if _, ok := e.Data["pin"]; ok {
+		t.Error("Set with an empty value left the key in Data")
+	}
+	if _, ok := e.Data["website"]; ok {
+		t.Error("website was stored in Data")
+	}
+}
+
+func TestEntryTitle(t *testing.T) {
+	tests := []struct {
+		entry Entry
+		want  string
+	}{
+		{Entry{Website: "example.com", Name: "ignored"}, "example.com"},
+		{Entry{Type: EntryCard, Website: "ignored", Name: "Visa"}, "Visa"},
+		{Entry{Type: "vehicle", Name: "Car"}, "Car"},
+	}
+	for _, tt := range tests {
+		if got := tt.entry.Title(); got != tt.want {
+			t.Errorf("Title of %s = %q, want %q", tt.entry.Kind(), got, tt.want)
+		}
+	}
+}
+
+func TestFieldChecks(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(string) error
+		value string
+		ok    bool
+	}{
+		{"card", checkCardNumber, "4111 1111 1111 1111", true},
+		{"card with dashes", checkCardNumber, "5555-5555-5555-4444", true},
+		{"card typo", checkCardNumber, "4111 1111 1111 1112", false},
+		{"card too short", checkCardNumber, "4111", false},
+		{"card letters", checkCardNumber, "4111 1111 1111 111a", false},
+		{"expiry", checkCardExpiry, "09/27", true},
+		{"expiry four digit year", checkCardExpiry, "09/2027", true},
+		{"expiry month", checkCardExpiry, "13/27", false},
+		{"expiry no slash", checkCardExpiry, "0927", false},
+		{"cvv", checkCVV, "123", true},
+		{"cvv amex", checkCVV, "1234", true},
+		{"cvv short", checkCVV, "12", false},
+		{"cvv letters", checkCVV, "12a", false},
+	}
+	for _, tt := range tests {
+		if err := tt.check(tt.value); (err == nil) != tt.ok {
+			t.Errorf("%s %q: got %v, want ok %v", tt.name, tt.value, err, tt.ok)
+		}
+	}
+
+	required := FieldSpec{Label: "Token", Type: FieldHidden, Required: true}
+	if err := required.Validate(""); err == nil {
+		t.Error("required field accepted an empty value")
+	}
+}
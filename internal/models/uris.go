@@ -0,0 +1,235 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// MatchMode decides which URLs an EntryURI matches.
+type MatchMode string
+
+const (
+	// MatchDomain matches any host under the same registrable domain, so
+	// https://example.co.uk covers login.example.co.uk.
+	MatchDomain MatchMode = "domain"
+	MatchHost   MatchMode = "host"
+	MatchPrefix MatchMode = "prefix"
+	MatchExact  MatchMode = "exact"
+	MatchRegex  MatchMode = "regex"
+	MatchNever  MatchMode = "never"
+)
+
+// MatchModes lists the modes in the order they are offered.
+var MatchModes = []MatchMode{MatchDomain, MatchHost, MatchPrefix, MatchExact, MatchRegex, MatchNever}
+
+// matchRank orders modes by how specific a match is. Lookup ranks results
+// by it first.
+var matchRank = map[MatchMode]int{
+	MatchExact:  5,
+	MatchPrefix: 4,
+	MatchRegex:  3,
+	MatchHost:   2,
+	MatchDomain: 1,
+}
+
+// EntryURI is a URL an entry is used on. An empty Match means MatchDomain.
+type EntryURI struct {
+	URI   string    `json:"uri"`
+	Match MatchMode `json:"match,omitempty"`
+}
+
+func (u EntryURI) Mode() MatchMode {
+	if u.Match == "" {
+		return MatchDomain
+	}
+	return u.Match
+}
+
+func (u EntryURI) Validate() error {
+	switch u.Mode() {
+	case MatchRegex:
+		if _, err := regexp.Compile(u.URI); err != nil {
+			return fmt.Errorf("invalid regex %q: %w", u.URI, err)
+		}
+	case MatchDomain, MatchHost, MatchPrefix, MatchExact:
+		if _, err := normalizeURL(u.URI); err != nil {
+			return err
+		}
+	case MatchNever:
+	default:
+		return fmt.Errorf("unknown match mode %q", u.Match)
+	}
+	return nil
+}
+
+// score reports how well u matches target, 0 meaning not at all. Longer
+// prefixes beat shorter ones within the same mode.
+func (u EntryURI) score(target *url.URL, raw string) int {
+	mode := u.Mode()
+	if mode == MatchRegex {
+		re, err := regexp.Compile(u.URI)
+		if err != nil || !re.MatchString(raw) {
+			return 0
+		}
+		return matchRank[mode] * 10000
+	}
+	if mode == MatchNever {
+		return 0
+	}
+
+	stored, err := normalizeURL(u.URI)
+	if err != nil {
+		return 0
+	}
+
+	var ok bool
+	switch mode {
+	case MatchDomain:
+		ok = baseDomain(stored.Hostname()) == baseDomain(target.Hostname())
+	case MatchHost:
+		ok = stored.Hostname() == target.Hostname() && (stored.Port() == "" || stored.Port() == target.Port())
+	case MatchPrefix:
+		ok = strings.HasPrefix(target.String(), stored.String())
+	case MatchExact:
+		ok = strings.TrimSuffix(target.String(), "/") == strings.TrimSuffix(stored.String(), "/")
+	}
+	if !ok {
+		return 0
+	}
+	return matchRank[mode]*10000 + min(len(stored.String()), 9999)
+}
+
+// normalizeURL parses s, assuming https:// when no scheme is given, and
+// lower-cases the scheme and host.
+func normalizeURL(s string) (*url.URL, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q", strings.TrimPrefix(s, "https://"))
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if u.Path == "" {
+		// So that a prefix of https://example.com does not match
+		// https://example.com.evil.net.
+		u.Path = "/"
+	}
+	return u, nil
+}
+
+// baseDomain returns the registrable domain of host, or host itself for IP
+// addresses and names without a public suffix such as localhost.
+func baseDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// MatchURIs returns the URIs the entry is matched on. Entries without any
+// fall back to their website, matched by domain.
+func (e Entry) MatchURIs() []EntryURI {
+	if len(e.URIs) > 0 {
+		return e.URIs
+	}
+	if e.Website != "" {
+		return []EntryURI{{URI: e.Website}}
+	}
+	return nil
+}
+
+// URIMatch is an entry found by Lookup and the URI that matched best.
+type URIMatch struct {
+	Entry Entry
+	URI   EntryURI
+	score int
+}
+
+// Lookup returns the entries that match rawURL, best match first: exact,
+// then starts-with (longest first), regex, host and base domain.
+func Lookup(entries []Entry, rawURL string) ([]URIMatch, error) {
+	target, err := normalizeURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	raw := strings.TrimSpace(rawURL)
+
+	var matches []URIMatch
+	for _, e := range entries {
+		best := URIMatch{Entry: e}
+		for _, u := range e.MatchURIs() {
+			if s := u.score(target, raw); s > best.score {
+				best.URI = u
+				best.score = s
+			}
+		}
+		if best.score > 0 {
+			matches = append(matches, best)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return strings.ToLower(matches[i].Entry.Title()) < strings.ToLower(matches[j].Entry.Title())
+	})
+	return matches, nil
+}
+
+// FormatURIs writes one URI per line, followed by its match mode unless it
+// is the default.
+func FormatURIs(uris []EntryURI) string {
+	lines := make([]string, 0, len(uris))
+	for _, u := range uris {
+		if u.Match == "" || u.Match == MatchDomain {
+			lines = append(lines, u.URI)
+		} else {
+			lines = append(lines, u.URI+" "+string(u.Match))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseURIs reads the format FormatURIs writes. A line's last word is taken
+// as its match mode only if it names one.
+func ParseURIs(s string) ([]EntryURI, error) {
+	var uris []EntryURI
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		u := EntryURI{URI: line}
+		if i := strings.LastIndexAny(line, " \t"); i >= 0 {
+			word := MatchMode(strings.ToLower(line[i+1:]))
+			for _, mode := range MatchModes {
+				if word == mode {
+					u = EntryURI{URI: strings.TrimSpace(line[:i]), Match: mode}
+					break
+				}
+			}
+		}
+		if u.Match == MatchDomain {
+			u.Match = ""
+		}
+		if err := u.Validate(); err != nil {
+			return nil, err
+		}
+		uris = append(uris, u)
+	}
+	return uris, nil
+}
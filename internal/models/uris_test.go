@@ -0,0 +1,153 @@
+package models
+
+import "testing"
+
+func TestLookupMatchModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		uri    EntryURI
+		target string
+		want   bool
+	}{
+		{"domain same host", EntryURI{URI: "example.com"}, "https://example.com/login", true},
+		{"domain subdomain", EntryURI{URI: "https://example.co.uk"}, "https://login.example.co.uk/", true},
+		{"domain other registrable domain", EntryURI{URI: "https://example.co.uk"}, "https://other.co.uk/", false},
+		{"domain lookalike", EntryURI{URI: "example.com"}, "https://example.com.evil.net/", false},
+		{"domain case insensitive", EntryURI{URI: "EXAMPLE.com"}, "https://Login.Example.COM/", true},
+		{"domain ip", EntryURI{URI: "192.168.1.1"}, "http://192.168.1.1:8080/", true},
+		{"domain localhost", EntryURI{URI: "localhost:3000"}, "http://localhost/", true},
+
+		{"host same", EntryURI{URI: "login.example.com", Match: MatchHost}, "https://login.example.com/a", true},
+		{"host subdomain", EntryURI{URI: "example.com", Match: MatchHost}, "https://login.example.com/", false},
+		{"host any port", EntryURI{URI: "example.com", Match: MatchHost}, "https://example.com:8443/", true},
+		{"host same port", EntryURI{URI: "example.com:8443", Match: MatchHost}, "https://example.com:8443/", true},
+		{"host other port", EntryURI{URI: "example.com:8443", Match: MatchHost}, "https://example.com:9000/", false},
+
+		{"prefix", EntryURI{URI: "https://example.com/app", Match: MatchPrefix}, "https://example.com/app/login", true},
+		{"prefix other path", EntryURI{URI: "https://example.com/app", Match: MatchPrefix}, "https://example.com/admin", false},
+		{"prefix bare host", EntryURI{URI: "https://example.com", Match: MatchPrefix}, "https://example.com.evil.net/", false},
+		{"prefix scheme", EntryURI{URI: "https://example.com", Match: MatchPrefix}, "http://example.com/", false},
+
+		{"exact", EntryURI{URI: "https://example.com/login", Match: MatchExact}, "https://example.com/login", true},
+		{"exact trailing slash", EntryURI{URI: "https://example.com/login/", Match: MatchExact}, "https://example.com/login", true},
+		{"exact longer path", EntryURI{URI: "https://example.com/login", Match: MatchExact}, "https://example.com/login/2fa", false},
+		{"exact query", EntryURI{URI: "https://example.com/login", Match: MatchExact}, "https://example.com/login?next=/", false},
+
+		{"regex", EntryURI{URI: `^https://[a-z]+\.example\.com/`, Match: MatchRegex}, "https://eu.example.com/", true},
+		{"regex no match", EntryURI{URI: `^https://[a-z]+\.example\.com/`, Match: MatchRegex}, "https://example.com/", false},
+		{"regex invalid", EntryURI{URI: `(`, Match: MatchRegex}, "https://example.com/", false},
+
+		{"never", EntryURI{URI: "example.com", Match: MatchNever}, "https://example.com/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := Entry{ID: "a", URIs: []EntryURI{tt.uri}}
+			matches, err := Lookup([]Entry{entry}, tt.target)
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+			if got := len(matches) == 1; got != tt.want {
+				t.Errorf("matched = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupOrder(t *testing.T) {
+	entries := []Entry{
+		{ID: "domain", Website: "example.com"},
+		{ID: "host", URIs: []EntryURI{{URI: "app.example.com", Match: MatchHost}}},
+		{ID: "regex", URIs: []EntryURI{{URI: `example\.com/app`, Match: MatchRegex}}},
+		{ID: "short prefix", URIs: []EntryURI{{URI: "https://app.example.com/", Match: MatchPrefix}}},
+		{ID: "long prefix", URIs: []EntryURI{{URI: "https://app.example.com/app/", Match: MatchPrefix}}},
+		{ID: "exact", URIs: []EntryURI{{URI: "https://app.example.com/app/login", Match: MatchExact}}},
+		{ID: "never", URIs: []EntryURI{{URI: "example.com", Match: MatchNever}}},
+		{ID: "other", Website: "example.org"},
+	}
+	matches, err := Lookup(entries, "https://app.example.com/app/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"exact", "long prefix", "short prefix", "regex", "host", "domain"}
+	var got []string
+	for _, m := range matches {
+		got = append(got, m.Entry.ID)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLookupBestURI(t *testing.T) {
+	entry := Entry{ID: "a", URIs: []EntryURI{
+		{URI: "example.com"},
+		{URI: "https://example.com/login", Match: MatchExact},
+		{URI: "https://example.com/", Match: MatchPrefix},
+	}}
+	matches, err := Lookup([]Entry{entry}, "https://example.com/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(matches))
+	}
+	if got := matches[0].URI.Mode(); got != MatchExact {
+		t.Errorf("best URI mode = %s, want %s", got, MatchExact)
+	}
+}
+
+func TestLookupInvalidURL(t *testing.T) {
+	if _, err := Lookup(nil, "https://"); err == nil {
+		t.Error("Lookup accepted a URL without a host")
+	}
+}
+
+func TestParseURIs(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []EntryURI
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "example.com", want: []EntryURI{{URI: "example.com"}}},
+		{input: "example.com domain", want: []EntryURI{{URI: "example.com"}}},
+		{input: "  https://example.com/app  PREFIX\n\nexample.org never", want: []EntryURI{
+			{URI: "https://example.com/app", Match: MatchPrefix},
+			{URI: "example.org", Match: MatchNever},
+		}},
+		{input: `^https://a b\.com regex`, want: []EntryURI{{URI: `^https://a b\.com`, Match: MatchRegex}}},
+		{input: "( regex", wantErr: true},
+		{input: "https:// exact", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseURIs(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseURIs(%q) succeeded: %v", tt.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseURIs(%q): %v", tt.input, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseURIs(%q) = %v, want %v", tt.input, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseURIs(%q) = %v, want %v", tt.input, got, tt.want)
+				break
+			}
+		}
+		if again, err := ParseURIs(FormatURIs(got)); err != nil || len(again) != len(got) {
+			t.Errorf("ParseURIs(FormatURIs(%v)) = %v, %v", got, again, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Usage records how often and how recently an entry was viewed or had a
+// field copied. It is kept per device and not synced.
+type Usage struct {
+	LastUsedAt time.Time `json:"last_used_at"`
+	Count      int       `json:"count"`
+}
+
+// SortMode orders the vault list.
+type SortMode string
+
+const (
+	SortAlphabetical     SortMode = "name"
+	SortRecentlyUsed     SortMode = "recent"
+	SortMostUsed         SortMode = "frequent"
+	SortRecentlyModified SortMode = "modified"
+	SortFavoritesFirst   SortMode = "favorites"
+)
+
+// SortModes lists the sort modes in the order the list cycles through them.
+var SortModes = []SortMode{
+	SortAlphabetical,
+	SortRecentlyUsed,
+	SortMostUsed,
+	SortRecentlyModified,
+	SortFavoritesFirst,
+}
+
+func (m SortMode) Label() string {
+	switch m {
+	case SortRecentlyUsed:
+		return "recently used"
+	case SortMostUsed:
+		return "most used"
+	case SortRecentlyModified:
+		return "recently modified"
+	case SortFavoritesFirst:
+		return "favorites first"
+	}
+	return "name"
+}
+
+// Next returns the mode after m, wrapping around. Unknown modes go to the
+// first one.
+func (m SortMode) Next() SortMode {
+	for i, mode := range SortModes {
+		if mode == m {
+			return SortModes[(i+1)%len(SortModes)]
+		}
+	}
+	return SortModes[0]
+}
+
+// ParseSortMode returns the mode named s, or SortAlphabetical if s names
+// none.
+func ParseSortMode(s string) SortMode {
+	for _, mode := range SortModes {
+		if string(mode) == s {
+			return mode
+		}
+	}
+	return SortAlphabetical
+}
+
+// SortEntries returns a sorted copy of entries. Ties, including entries
+// never used, fall back to the title so the order is stable.
+func SortEntries(entries []Entry, mode SortMode, usage map[string]Usage) []Entry {
+	sorted := append([]Entry(nil), entries...)
+	byTitle := func(a, b Entry) bool {
+		return strings.ToLower(a.Title()) < strings.ToLower(b.Title())
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		switch mode {
+		case SortRecentlyUsed:
+			ua, ub := usage[a.ID].LastUsedAt, usage[b.ID].LastUsedAt
+			if !ua.Equal(ub) {
+				return ua.After(ub)
+			}
+		case SortMostUsed:
+			if ca, cb := usage[a.ID].Count, usage[b.ID].Count; ca != cb {
+				return ca > cb
+			}
+		case SortRecentlyModified:
+			if !a.UpdatedAt.Equal(b.UpdatedAt) {
+				return a.UpdatedAt.After(b.UpdatedAt)
+			}
+		case SortFavoritesFirst:
+			if a.Favorite != b.Favorite {
+				return a.Favorite
+			}
+		}
+		return byTitle(a, b)
+	})
+	return sorted
+}
@@ -0,0 +1,243 @@
+// Package profile keeps several named vaults side by side. Each profile is
+// its own database, so the salt, device identity, friends and sync setup
+// are never shared between them.
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"forgor/internal/crypto"
+	"forgor/internal/storage"
+)
+
+// DefaultName is the profile stored at the original vault.db location.
+const DefaultName = "default"
+
+var (
+	ErrInvalidName = errors.New("profile names use letters, digits, '-' and '_' (up to 32)")
+	ErrFixedPath   = errors.New("profiles are not available with -db")
+
+	validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+)
+
+// ValidName reports whether name can be used for a profile.
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Path returns the database path of a profile under the forgor data
+// directory: vault.db for the default profile, profiles/<name>.db otherwise.
+func Path(dataDir, name string) (string, error) {
+	if name == "" || name == DefaultName {
+		return filepath.Join(dataDir, "vault.db"), nil
+	}
+	if !ValidName(name) {
+		return "", ErrInvalidName
+	}
+	return filepath.Join(dataDir, "profiles", name+".db"), nil
+}
+
+// Options are command-line settings applied to every profile as it is
+// opened. Keyfile only goes to the first one, the profile named on the
+// command line; other profiles ask for their keyfile on the unlock screen.
+type Options struct {
+	Keyfile   string
+	KDFParams *crypto.KDFParams
+	// Negative values leave the setting saved in the vault alone.
+	UnlockFailureLimit int
+	TrashRetentionDays int
+}
+
+// Manager opens profiles on demand and keeps them open, so more than one
+// can be unlocked at a time. One of them is active in the UI.
+type Manager struct {
+	mu      sync.Mutex
+	dataDir string
+	opts    Options
+	stores  map[string]*storage.Store
+	active  string
+}
+
+// NewManager manages the profiles under dataDir.
+func NewManager(dataDir string, opts Options) *Manager {
+	return &Manager{dataDir: dataDir, opts: opts, stores: make(map[string]*storage.Store)}
+}
+
+// Fixed wraps a store opened from an explicit path. It is the only profile
+// and cannot be switched away from.
+func Fixed(name string, store *storage.Store, opts Options) (*Manager, error) {
+	m := &Manager{opts: opts}
+	if err := m.apply(store); err != nil {
+		return nil, err
+	}
+	m.stores = map[string]*storage.Store{name: store}
+	m.active = name
+	return m, nil
+}
+
+// apply gives a newly opened store the command-line options.
+func (m *Manager) apply(store *storage.Store) error {
+	if m.opts.Keyfile != "" {
+		err := store.LoadKeyfile(m.opts.Keyfile)
+		m.opts.Keyfile = ""
+		if err != nil {
+			return fmt.Errorf("failed to load keyfile: %w", err)
+		}
+	}
+	if m.opts.KDFParams != nil {
+		if err := store.SetKDFParams(*m.opts.KDFParams); err != nil {
+			return fmt.Errorf("invalid KDF parameters: %w", err)
+		}
+	}
+	if m.opts.UnlockFailureLimit >= 0 {
+		if err := store.SetUnlockFailureLimit(m.opts.UnlockFailureLimit); err != nil {
+			return fmt.Errorf("invalid unlock failure limit: %w", err)
+		}
+	}
+	if m.opts.TrashRetentionDays >= 0 {
+		if err := store.SetTrashRetention(m.opts.TrashRetentionDays); err != nil {
+			return fmt.Errorf("invalid trash retention: %w", err)
+		}
+	}
+	return nil
+}
+
+// CanSwitch reports whether profiles other than the active one exist or can
+// be created.
+func (m *Manager) CanSwitch() bool {
+	return m.dataDir != ""
+}
+
+// List returns the default profile followed by the others in name order.
+func (m *Manager) List() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.dataDir == "" {
+		return []string{m.active}, nil
+	}
+	seen := map[string]bool{DefaultName: true}
+	names := []string{}
+	files, err := os.ReadDir(filepath.Join(m.dataDir, "profiles"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list profiles: %w", err)
+	}
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), ".db")
+		if !ok || f.IsDir() || !ValidName(name) || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	for name := range m.stores {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultName}, names...), nil
+}
+
+// Open returns the store for a profile, creating its database if needed.
+func (m *Manager) Open(name string) (*storage.Store, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.open(name)
+}
+
+func (m *Manager) open(name string) (*storage.Store, error) {
+	if store, ok := m.stores[name]; ok {
+		return store, nil
+	}
+	if m.dataDir == "" {
+		return nil, ErrFixedPath
+	}
+	path, err := Path(m.dataDir, name)
+	if err != nil {
+		return nil, err
+	}
+	store, err := storage.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.apply(store); err != nil {
+		store.Close()
+		return nil, err
+	}
+	m.stores[name] = store
+	return store, nil
+}
+
+// Switch opens a profile and makes it the active one.
+func (m *Manager) Switch(name string) (*storage.Store, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	store, err := m.open(name)
+	if err != nil {
+		return nil, err
+	}
+	m.active = name
+	return store, nil
+}
+
+// Active returns the name and store of the active profile.
+func (m *Manager) Active() (string, *storage.Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active, m.stores[m.active]
+}
+
+// IsUnlocked reports whether name is open and unlocked.
+func (m *Manager) IsUnlocked(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	store, ok := m.stores[name]
+	return ok && store.IsUnlocked()
+}
+
+// Unlocked returns the names of the unlocked profiles other than except.
+func (m *Manager) Unlocked(except string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name, store := range m.stores {
+		if name != except && store.IsUnlocked() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LockAll locks every open profile.
+func (m *Manager) LockAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, store := range m.stores {
+		store.Lock()
+	}
+}
+
+// Close locks and closes every open profile.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var firstErr error
+	for name, store := range m.stores {
+		store.Lock()
+		if err := store.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(m.stores, name)
+	}
+	return firstErr
+}
@@ -0,0 +1,18 @@
+//go:build !unix && !windows
+
+package secmem
+
+import (
+	"errors"
+	"unsafe"
+)
+
+func addr(b []byte) uintptr {
+	return uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+}
+
+func lock(b []byte) error {
+	return errors.New("memory locking is not supported on this platform")
+}
+
+func unlock(b []byte) {}
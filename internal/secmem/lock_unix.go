@@ -0,0 +1,21 @@
+//go:build unix
+
+package secmem
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func addr(b []byte) uintptr {
+	return uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+}
+
+func lock(b []byte) error {
+	return unix.Mlock(b)
+}
+
+func unlock(b []byte) {
+	unix.Munlock(b)
+}
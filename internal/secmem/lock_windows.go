@@ -0,0 +1,21 @@
+//go:build windows
+
+package secmem
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func addr(b []byte) uintptr {
+	return uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+}
+
+func lock(b []byte) error {
+	return windows.VirtualLock(addr(b), uintptr(len(b)))
+}
+
+func unlock(b []byte) {
+	windows.VirtualUnlock(addr(b), uintptr(len(b)))
+}
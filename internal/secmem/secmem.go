@@ -0,0 +1,186 @@
+// Package secmem holds key material in memory that is locked against
+// swapping where the platform allows it and zeroed when it is destroyed.
+package secmem
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+var ErrDestroyed = errors.New("secret buffer has been destroyed")
+
+// Buffer is a fixed-size secret. Buffers derived from another buffer are
+// destroyed with it, so destroying a vault key also wipes every private key
+// that was decrypted with it.
+//
+// The memory is never unmapped, so a buffer destroyed while in use reads as
+// zeros instead of faulting. Callers that must not act on a zeroed key copy
+// it out and wipe the copy when done.
+type Buffer struct {
+	mu        sync.Mutex
+	mem       []byte
+	data      []byte
+	locked    bool
+	destroyed bool
+	parent    *Buffer
+	children  map[*Buffer]struct{}
+}
+
+// New returns a zeroed buffer of size bytes.
+func New(size int) *Buffer {
+	// Give every buffer its own pages, since unlocking one page would
+	// otherwise unlock a neighbouring buffer too.
+	pageSize := os.Getpagesize()
+	pages := (size + pageSize - 1) / pageSize
+	if pages == 0 {
+		pages = 1
+	}
+	raw := make([]byte, (pages+1)*pageSize)
+	offset := pageSize - int(addr(raw)%uintptr(pageSize))
+	if offset == pageSize {
+		offset = 0
+	}
+	mem := raw[offset : offset+pages*pageSize]
+
+	return &Buffer{
+		mem:    mem,
+		data:   mem[:size:size],
+		locked: lock(mem) == nil,
+	}
+}
+
+// FromBytes moves b into a new buffer and wipes b.
+func FromBytes(b []byte) *Buffer {
+	buf := New(len(b))
+	copy(buf.data, b)
+	Wipe(b)
+	return buf
+}
+
+// Derive moves b into a new buffer that is destroyed along with parent.
+func (parent *Buffer) Derive(b []byte) (*Buffer, error) {
+	parent.mu.Lock()
+	defer parent.mu.Unlock()
+	if parent.destroyed {
+		Wipe(b)
+		return nil, ErrDestroyed
+	}
+	child := FromBytes(b)
+	child.parent = parent
+	if parent.children == nil {
+		parent.children = make(map[*Buffer]struct{})
+	}
+	parent.children[child] = struct{}{}
+	return child, nil
+}
+
+// Bytes returns the secret itself, not a copy. It returns nil once the
+// buffer is destroyed.
+func (b *Buffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.destroyed {
+		return nil
+	}
+	return b.data
+}
+
+// Copy returns a copy of the secret for use after the buffer may have been
+// destroyed. The caller must Wipe it.
+func (b *Buffer) Copy() ([]byte, error) {
+	if b == nil {
+		return nil, ErrDestroyed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.destroyed {
+		return nil, ErrDestroyed
+	}
+	out := make([]byte, len(b.data))
+	copy(out, b.data)
+	return out, nil
+}
+
+// Array32 returns the secret as a 32-byte array for APIs such as NaCl box.
+// It returns nil if the buffer is destroyed or not 32 bytes long.
+func (b *Buffer) Array32() *[32]byte {
+	data := b.Bytes()
+	if len(data) != 32 {
+		return nil
+	}
+	return (*[32]byte)(data)
+}
+
+func (b *Buffer) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.data)
+}
+
+// Alive reports whether the buffer still holds its secret.
+func (b *Buffer) Alive() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.destroyed
+}
+
+// Locked reports whether the platform locked the buffer into memory.
+func (b *Buffer) Locked() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.locked
+}
+
+// Destroy wipes the buffer and every buffer derived from it. It is safe to
+// call more than once and on a nil buffer.
+func (b *Buffer) Destroy() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	if b.destroyed {
+		b.mu.Unlock()
+		return
+	}
+	b.destroyed = true
+	children := b.children
+	b.children = nil
+	parent := b.parent
+	b.parent = nil
+	Wipe(b.mem)
+	if b.locked {
+		unlock(b.mem)
+		b.locked = false
+	}
+	b.mu.Unlock()
+
+	for child := range children {
+		child.mu.Lock()
+		child.parent = nil
+		child.mu.Unlock()
+		child.Destroy()
+	}
+	if parent != nil {
+		parent.mu.Lock()
+		delete(parent.children, b)
+		parent.mu.Unlock()
+	}
+}
+
+// Wipe zeroes b.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -19,24 +19,51 @@ import (
 
 type Server struct {
 	httpServer *http.Server
-	store      *storage.Store
+	store      storage.Vault
 	shareChan  chan models.IncomingShare
 	port       int
 	seenNonces map[string]int64
 	nonceMu    sync.Mutex
+
+	// Attachment chunks are buffered per sender and attachment until the
+	// entry that refers to them arrives on /share.
+	uploads   map[string]*upload
+	uploadsMu sync.Mutex
 }
 
 const (
 	maxSeenNonces = 1000
 	nonceTTL      = 5 * time.Minute
+
+	// ShareChunkSize keeps a boxed, twice base64-encoded chunk well under
+	// the 1 MB body limit.
+	ShareChunkSize = 256 * 1024
+	// maxUploadBytes bounds what all senders together may have buffered.
+	maxUploadBytes = models.MaxAttachments * models.MaxAttachmentSize
+	uploadTTL      = 10 * time.Minute
 )
 
-func New(store *storage.Store, shareChan chan models.IncomingShare, port int) *Server {
+// upload is an attachment being received in chunks. content is set once
+// every chunk is in and the checksum matched.
+type upload struct {
+	// count is kept apart from chunks, which are dropped once the upload
+	// is complete, so a retransmitted chunk still matches it.
+	count    int
+	chunks   [][]byte
+	received int
+	size     int64
+	sha256   string
+	content  []byte
+	touched  time.Time
+}
+
+func New(store storage.Vault, shareChan chan models.IncomingShare, port int) *Server {
 	return &Server{
 		store:      store,
 		shareChan:  shareChan,
 		port:       port,
 		seenNonces: make(map[string]int64),
+		uploads:    make(map[string]*upload),
 	}
 }
 
@@ -44,6 +71,7 @@ func (s *Server) Start() error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/whoami", s.handleWhoAmI)
 	mux.HandleFunc("/share", s.handleShare)
+	mux.HandleFunc("/share/chunk", s.handleShareChunk)
 
 	s.httpServer = &http.Server{
 		Addr:         fmt.Sprintf(":%d", s.port),
@@ -91,6 +119,7 @@ func (s *Server) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Vault is locked", http.StatusServiceUnavailable)
 		return
 	}
+	device.Destroy()
 
 	response := models.WhoAmIResponse{
 		DeviceName:  device.Name,
@@ -103,47 +132,55 @@ func (s *Server) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+// openShare reads a boxed message from a paired friend, rejecting replays.
+// It writes the error response itself and returns ok=false on failure.
+func (s *Server) openShare(w http.ResponseWriter, r *http.Request) (plaintext []byte, friend *models.Friend, ok bool) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+		return nil, nil, false
 	}
 
 	// Fetch device fresh from store (fails if locked - this is the atomic check)
 	device, err := s.store.GetDevice()
 	if err != nil {
 		http.Error(w, "Vault is locked", http.StatusServiceUnavailable)
-		return
+		return nil, nil, false
 	}
+	defer device.Destroy()
 
 	body, err := io.ReadAll(io.LimitReader(r.Body, 1024*1024)) // im limiting this to 1 MB (note here because im not gonna remember 1024*1024 in the morning)
 	if err != nil {
 		http.Error(w, "Failed to read body", http.StatusBadRequest)
-		return
+		return nil, nil, false
 	}
 
 	var shareMsg models.ShareMessage
 	if err := json.Unmarshal(body, &shareMsg); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
+		return nil, nil, false
 	}
 
 	if len(shareMsg.Ciphertext) < 24 {
 		http.Error(w, "Invalid ciphertext", http.StatusBadRequest)
-		return
+		return nil, nil, false
 	}
 	nonceKey := shareMsg.FromFingerprint + ":" + hex.EncodeToString(shareMsg.Ciphertext[:24])
 
-	friend, err := s.store.GetFriend(shareMsg.FromFingerprint)
+	friend, err = s.store.GetFriend(shareMsg.FromFingerprint)
 	if err != nil {
 		http.Error(w, "Sender not paired", http.StatusForbidden)
-		return
+		return nil, nil, false
 	}
 
-	plaintext, err := crypto.BoxOpen(shareMsg.Ciphertext, &friend.PubKey, &device.PrivKey)
+	privKey := device.PrivKey.Array32()
+	if privKey == nil {
+		http.Error(w, "Vault is locked", http.StatusServiceUnavailable)
+		return nil, nil, false
+	}
+	plaintext, err = crypto.BoxOpen(shareMsg.Ciphertext, &friend.PubKey, privKey)
 	if err != nil {
 		http.Error(w, "Decryption failed", http.StatusBadRequest)
-		return
+		return nil, nil, false
 	}
 
 	now := time.Now().Unix()
@@ -152,7 +189,7 @@ func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
 
 	if seenTime, exists := s.seenNonces[nonceKey]; exists && (now-seenTime) < int64(nonceTTL.Seconds()) {
 		http.Error(w, "Replay detected", http.StatusConflict)
-		return
+		return nil, nil, false
 	}
 
 	if len(s.seenNonces) >= maxSeenNonces {
@@ -177,6 +214,15 @@ func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
 
 	s.seenNonces[nonceKey] = now
 
+	return plaintext, friend, true
+}
+
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	plaintext, friend, ok := s.openShare(w, r)
+	if !ok {
+		return
+	}
+
 	var entry models.Entry
 	if err := json.Unmarshal(plaintext, &entry); err != nil {
 		http.Error(w, "Invalid entry data", http.StatusBadRequest)
@@ -184,9 +230,10 @@ func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
 	}
 
 	incoming := models.IncomingShare{
-		FromFingerprint: shareMsg.FromFingerprint,
+		FromFingerprint: friend.Fingerprint,
 		FromName:        friend.Name,
 		Entry:           entry,
+		Attachments:     s.takeUploads(friend.Fingerprint, entry.Attachments),
 	}
 
 	select {
@@ -198,6 +245,128 @@ func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleShareChunk receives one chunk of an attachment ahead of the entry
+// that refers to it.
+func (s *Server) handleShareChunk(w http.ResponseWriter, r *http.Request) {
+	plaintext, friend, ok := s.openShare(w, r)
+	if !ok {
+		return
+	}
+
+	var chunk models.AttachmentChunk
+	if err := json.Unmarshal(plaintext, &chunk); err != nil {
+		http.Error(w, "Invalid chunk data", http.StatusBadRequest)
+		return
+	}
+	if err := chunk.Validate(ShareChunkSize); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.addChunk(friend.Fingerprint, chunk); err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) addChunk(fingerprint string, chunk models.AttachmentChunk) error {
+	s.uploadsMu.Lock()
+	defer s.uploadsMu.Unlock()
+
+	s.expireUploads()
+
+	key := fingerprint + ":" + chunk.AttachmentID
+	u, ok := s.uploads[key]
+	if !ok || u.size != chunk.Size || u.sha256 != chunk.SHA256 || u.count != chunk.Count {
+		if ok {
+			u.wipe()
+		}
+		var buffered int64
+		for k, other := range s.uploads {
+			if k != key {
+				buffered += other.size
+			}
+		}
+		if buffered+chunk.Size > maxUploadBytes {
+			return fmt.Errorf("too many attachments in flight")
+		}
+		u = &upload{count: chunk.Count, chunks: make([][]byte, chunk.Count), size: chunk.Size, sha256: chunk.SHA256}
+		s.uploads[key] = u
+	}
+	u.touched = time.Now()
+	if u.content != nil || u.chunks[chunk.Index] != nil {
+		return nil
+	}
+
+	u.chunks[chunk.Index] = append([]byte{}, chunk.Data...)
+	u.received++
+	if u.received < u.count {
+		return nil
+	}
+
+	content := make([]byte, 0, u.size)
+	for _, c := range u.chunks {
+		content = append(content, c...)
+	}
+	u.wipeChunks()
+	whole := models.Attachment{Name: chunk.AttachmentID, Size: u.size, SHA256: u.sha256}
+	if err := whole.Verify(content); err != nil {
+		delete(s.uploads, key)
+		return err
+	}
+	u.content = content
+	return nil
+}
+
+// takeUploads hands over the finished uploads for the attachments of an
+// entry from fingerprint. Attachments that did not arrive are left out.
+func (s *Server) takeUploads(fingerprint string, attachments []models.Attachment) map[string][]byte {
+	s.uploadsMu.Lock()
+	defer s.uploadsMu.Unlock()
+
+	contents := make(map[string][]byte)
+	for _, a := range attachments {
+		key := fingerprint + ":" + a.ID
+		u, ok := s.uploads[key]
+		if !ok || u.content == nil {
+			continue
+		}
+		if a.Verify(u.content) == nil {
+			contents[a.ID] = u.content
+		}
+		delete(s.uploads, key)
+	}
+	return contents
+}
+
+// expireUploads drops uploads that stalled or whose entry never came. The
+// caller holds uploadsMu.
+func (s *Server) expireUploads() {
+	for k, u := range s.uploads {
+		if time.Since(u.touched) > uploadTTL {
+			u.wipe()
+			delete(s.uploads, k)
+		}
+	}
+}
+
+func (u *upload) wipeChunks() {
+	for _, c := range u.chunks {
+		for i := range c {
+			c[i] = 0
+		}
+	}
+	u.chunks = nil
+}
+
+func (u *upload) wipe() {
+	u.wipeChunks()
+	for i := range u.content {
+		u.content[i] = 0
+	}
+	u.content = nil
+}
+
 func FetchWhoAmI(host string, port int) (*models.WhoAmIResponse, error) {
 	url := fmt.Sprintf("http://%s:%d/whoami", host, port)
 
@@ -220,13 +389,39 @@ func FetchWhoAmI(host string, port int) (*models.WhoAmIResponse, error) {
 	return &whoami, nil
 }
 
-func SendShare(host string, port int, entry models.Entry, senderDevice *models.Device, recipientPubKey *[32]byte) error {
+// SendShare sends entry to a paired device. The contents of its
+// attachments, keyed by attachment ID, go first in chunks; attachments
+// missing from the map are sent without contents.
+func SendShare(host string, port int, entry models.Entry, attachments map[string][]byte, senderDevice *models.Device, recipientPubKey *[32]byte) error {
+	for _, a := range entry.Attachments {
+		content, ok := attachments[a.ID]
+		if !ok {
+			continue
+		}
+		for _, chunk := range models.SplitAttachment(a, content, ShareChunkSize) {
+			plaintext, err := json.Marshal(chunk)
+			if err != nil {
+				return fmt.Errorf("failed to serialize attachment: %w", err)
+			}
+			if err := postShare(host, port, "/share/chunk", plaintext, senderDevice, recipientPubKey); err != nil {
+				return fmt.Errorf("failed to send attachment %s: %w", a.Name, err)
+			}
+		}
+	}
+
 	plaintext, err := json.Marshal(entry)
 	if err != nil {
 		return fmt.Errorf("failed to serialize entry: %w", err)
 	}
+	return postShare(host, port, "/share", plaintext, senderDevice, recipientPubKey)
+}
 
-	ciphertext, err := crypto.BoxSeal(plaintext, recipientPubKey, &senderDevice.PrivKey)
+func postShare(host string, port int, path string, plaintext []byte, senderDevice *models.Device, recipientPubKey *[32]byte) error {
+	privKey := senderDevice.PrivKey.Array32()
+	if privKey == nil {
+		return fmt.Errorf("device key is not available; unlock the vault")
+	}
+	ciphertext, err := crypto.BoxSeal(plaintext, recipientPubKey, privKey)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt: %w", err)
 	}
@@ -241,7 +436,7 @@ func SendShare(host string, port int, entry models.Entry, senderDevice *models.D
 		return fmt.Errorf("failed to serialize message: %w", err)
 	}
 
-	url := fmt.Sprintf("http://%s:%d/share", host, port)
+	url := fmt.Sprintf("http://%s:%d%s", host, port, path)
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
 	if err != nil {
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"forgor/internal/models"
+)
+
+func splitForTest(t *testing.T, content []byte) (models.Attachment, []models.AttachmentChunk) {
+	t.Helper()
+	a, err := models.NewAttachment("file.bin", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := models.SplitAttachment(a, content, ShareChunkSize)
+	for _, c := range chunks {
+		if err := c.Validate(ShareChunkSize); err != nil {
+			t.Fatalf("chunk %d: %v", c.Index, err)
+		}
+	}
+	return a, chunks
+}
+
+func TestAddChunkReassembles(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), ShareChunkSize/4)
+	a, chunks := splitForTest(t, content)
+	if len(chunks) < 3 {
+		t.Fatalf("want several chunks, got %d", len(chunks))
+	}
+
+	s := New(nil, nil, 0)
+	// Out of order and with a duplicate, as a retrying sender would.
+	order := []int{2, 0, 0, 1}
+	for i := 3; i < len(chunks); i++ {
+		order = append(order, i)
+	}
+	for _, i := range order {
+		if err := s.addChunk("friend", chunks[i]); err != nil {
+			t.Fatalf("addChunk %d: %v", i, err)
+		}
+	}
+
+	got := s.takeUploads("friend", []models.Attachment{a})
+	if !bytes.Equal(got[a.ID], content) {
+		t.Fatalf("reassembled %d bytes, want %d", len(got[a.ID]), len(content))
+	}
+	if len(s.uploads) != 0 {
+		t.Errorf("%d uploads left after takeUploads", len(s.uploads))
+	}
+}
+
+func TestAddChunkRetransmitKeepsFinishedUpload(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), ShareChunkSize+1)
+	a, chunks := splitForTest(t, content)
+
+	s := New(nil, nil, 0)
+	for _, c := range chunks {
+		if err := s.addChunk("friend", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The sender did not see our reply to the last chunk and sends it again.
+	if err := s.addChunk("friend", chunks[len(chunks)-1]); err != nil {
+		t.Fatalf("retransmit: %v", err)
+	}
+
+	got := s.takeUploads("friend", []models.Attachment{a})
+	if !bytes.Equal(got[a.ID], content) {
+		t.Error("finished upload was lost after a retransmitted chunk")
+	}
+}
+
+func TestAddChunkKeepsSendersApart(t *testing.T) {
+	content := []byte("secret")
+	a, chunks := splitForTest(t, content)
+
+	s := New(nil, nil, 0)
+	if err := s.addChunk("alice", chunks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.takeUploads("mallory", []models.Attachment{a}); len(got) != 0 {
+		t.Error("upload handed to another sender")
+	}
+	if got := s.takeUploads("alice", []models.Attachment{a}); !bytes.Equal(got[a.ID], content) {
+		t.Error("upload not handed to its sender")
+	}
+}
+
+func TestAddChunkChecksum(t *testing.T) {
+	a, chunks := splitForTest(t, []byte("hello"))
+	chunks[0].Data = []byte("hellO")
+
+	s := New(nil, nil, 0)
+	if err := s.addChunk("friend", chunks[0]); err == nil {
+		t.Error("addChunk accepted content that does not match its checksum")
+	}
+	if got := s.takeUploads("friend", []models.Attachment{a}); len(got) != 0 {
+		t.Error("corrupt upload was handed over")
+	}
+}
@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"forgor/internal/crypto"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// A backup archive is the magic, a length-prefixed JSON header with the KDF
+// parameters for the backup passphrase, and the encrypted payload. The
+// payload repeats the header so tampering with it is detected on restore.
+var archiveMagic = []byte("FORGOR-BACKUP\x00")
+
+const (
+	archiveFormat       = 1
+	maxArchiveHeaderLen = 4096
+)
+
+var ErrInvalidArchive = errors.New("not a valid forgor backup")
+
+type archiveHeader struct {
+	Format        int              `json:"format"`
+	CreatedAt     time.Time        `json:"created_at"`
+	SchemaVersion int              `json:"schema_version"`
+	Salt          []byte           `json:"salt"`
+	KDF           crypto.KDFParams `json:"kdf"`
+}
+
+type archivePayload struct {
+	Header  json.RawMessage `json:"header"`
+	Buckets []archiveBucket `json:"buckets"`
+}
+
+type archiveBucket struct {
+	Name  string        `json:"name"`
+	Items []archiveItem `json:"items"`
+}
+
+type archiveItem struct {
+	Key   []byte `json:"k"`
+	Value []byte `json:"v"`
+}
+
+// WriteBackup writes every bucket in the database to w, encrypted with a key
+// derived from passphrase. Values that are sealed with the vault key stay
+// sealed, so restoring still needs the master password to unlock.
+func (s *Store) WriteBackup(w io.Writer, passphrase string) error {
+	if !s.IsInitialized() {
+		return fmt.Errorf("vault not initialized")
+	}
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return err
+	}
+	header := archiveHeader{
+		Format:        archiveFormat,
+		CreatedAt:     time.Now().UTC(),
+		SchemaVersion: version,
+		Salt:          salt,
+		KDF:           s.desiredKDFParams(),
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	payload := archivePayload{Header: headerJSON}
+	err = s.backend.View(func(tx Tx) error {
+		return tx.ForEach(func(name []byte, b Bucket) error {
+			bucket := archiveBucket{Name: string(name)}
+			err := b.ForEach(func(k, v []byte) error {
+				if v == nil {
+					return fmt.Errorf("nested bucket %s/%s is not supported", name, k)
+				}
+				bucket.Items = append(bucket.Items, archiveItem{Key: copyBytes(k), Value: copyBytes(v)})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			payload.Buckets = append(payload.Buckets, bucket)
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read database: %w", err)
+	}
+
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to serialize backup: %w", err)
+	}
+	defer wipe(plaintext)
+
+	key := crypto.DeriveKeyWithParams(passphrase, salt, header.KDF)
+	defer wipe(key)
+	ciphertext, err := crypto.Encrypt(key, plaintext)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(archiveMagic)
+	binary.Write(bw, binary.BigEndian, uint32(len(headerJSON)))
+	bw.Write(headerJSON)
+	bw.Write(ciphertext)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+// RestoreBackup validates the archive read from r and rebuilds the database
+// at dbPath from it. An existing database is only replaced when overwrite is
+// set, and the new file is moved into place only once it is complete. The
+// existing database stays locked throughout, so a forgor started meanwhile
+// waits for the restored one.
+func RestoreBackup(r io.Reader, passphrase, dbPath string, overwrite bool) error {
+	payload, err := readArchive(r, passphrase)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		if !overwrite {
+			return fmt.Errorf("%s already exists", dbPath)
+		}
+		// Never pull the file out from under a running forgor.
+		current, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: lockTimeout})
+		if errors.Is(err, bolt.ErrTimeout) {
+			return inUse(dbPath)
+		}
+		if err == nil {
+			defer current.Close()
+		}
+	}
+
+	tmpPath := dbPath + ".restore"
+	os.Remove(tmpPath)
+	db, err := bolt.Open(tmpPath, 0600, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range payload.Buckets {
+			b, err := tx.CreateBucket([]byte(bucket.Name))
+			if err != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", bucket.Name, err)
+			}
+			for _, item := range bucket.Items {
+				if err := b.Put(item.Key, item.Value); err != nil {
+					return err
+				}
+			}
+		}
+		return resetRestoredSync(tx)
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write database: %w", err)
+	}
+
+	if overwrite {
+		err = os.Rename(tmpPath, dbPath)
+	} else {
+		// Link fails instead of replacing a database created meanwhile.
+		if err = os.Link(tmpPath, dbPath); err == nil {
+			os.Remove(tmpPath)
+		}
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to move restored database into place: %w", err)
+	}
+	return nil
+}
+
+// resetRestoredSync rewinds the sync state of a restored database. Peers
+// have already seen the events this device sent after the backup, so its
+// event heads would fork its own chain and its pending changes would replay
+// old data as new. Both are dropped along with the pull cursor, and the
+// resync flag makes the engine rebuild its heads and lamport clock from the
+// server before it pushes again.
+func resetRestoredSync(tx *bolt.Tx) error {
+	meta := tx.Bucket(syncMetaBucket)
+	if meta == nil || meta.Get(keySyncVaultID) == nil {
+		return nil
+	}
+	for _, name := range [][]byte{syncEventHeadsBucket, syncPendingBucket, syncPendingFoldersBucket} {
+		if tx.Bucket(name) == nil {
+			continue
+		}
+		if err := tx.DeleteBucket(name); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", name, err)
+		}
+		if _, err := tx.CreateBucket(name); err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", name, err)
+		}
+	}
+	if err := meta.Delete(keySyncCursor); err != nil {
+		return err
+	}
+	return meta.Put(keySyncResync, []byte{1})
+}
+
+func readArchive(r io.Reader, passphrase string) (*archivePayload, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, archiveMagic) {
+		return nil, ErrInvalidArchive
+	}
+	var headerLen uint32
+	if err := binary.Read(br, binary.BigEndian, &headerLen); err != nil || headerLen > maxArchiveHeaderLen {
+		return nil, ErrInvalidArchive
+	}
+	headerJSON := make([]byte, headerLen)
+	if _, err := io.ReadFull(br, headerJSON); err != nil {
+		return nil, ErrInvalidArchive
+	}
+
+	var header archiveHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrInvalidArchive
+	}
+	if header.Format != archiveFormat {
+		return nil, fmt.Errorf("unsupported backup format %d", header.Format)
+	}
+	if header.SchemaVersion > schemaVersion {
+		return nil, fmt.Errorf("%w (schema %d, this build supports %d)", ErrSchemaTooNew, header.SchemaVersion, schemaVersion)
+	}
+	if err := header.KDF.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if len(header.Salt) != crypto.SaltSize {
+		return nil, ErrInvalidArchive
+	}
+
+	ciphertext, err := io.ReadAll(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	key := crypto.DeriveKeyWithParams(passphrase, header.Salt, header.KDF)
+	defer wipe(key)
+	plaintext, err := crypto.Decrypt(key, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(plaintext)
+
+	var payload archivePayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if !bytes.Equal(payload.Header, headerJSON) {
+		return nil, fmt.Errorf("%w: header does not match contents", ErrInvalidArchive)
+	}
+	if err := validateArchive(&payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// validateArchive checks that the payload holds an initialized vault.
+func validateArchive(payload *archivePayload) error {
+	seen := make(map[string]bool)
+	var meta map[string][]byte
+	for _, bucket := range payload.Buckets {
+		if bucket.Name == "" || seen[bucket.Name] {
+			return fmt.Errorf("%w: bad bucket %q", ErrInvalidArchive, bucket.Name)
+		}
+		seen[bucket.Name] = true
+		if bucket.Name == string(metaBucket) {
+			meta = make(map[string][]byte, len(bucket.Items))
+			for _, item := range bucket.Items {
+				meta[string(item.Key)] = item.Value
+			}
+		}
+	}
+
+	if meta == nil || meta[string(keyVaultSalt)] == nil {
+		return fmt.Errorf("%w: vault is not initialized", ErrInvalidArchive)
+	}
+	if !seen[string(vaultBucket)] {
+		return fmt.Errorf("%w: vault bucket missing", ErrInvalidArchive)
+	}
+	return nil
+}
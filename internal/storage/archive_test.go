@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"forgor/internal/crypto"
+	"forgor/internal/models"
+)
+
+const testBackupPassphrase = "backup passphrase"
+
+func writeTestBackup(t *testing.T, s *Store) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := s.WriteBackup(&buf, testBackupPassphrase); err != nil {
+		t.Fatalf("WriteBackup: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBackupRestore(t *testing.T) {
+	entries := []models.Entry{
+		{ID: "a", Website: "a.example", Password: "1"},
+		{ID: "b", Website: "b.example", Password: "2"},
+	}
+	_, s := newTestFile(t, entries)
+	if err := s.SaveFriend(models.Friend{Name: "bob", Fingerprint: "fp"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutAttachment("att", []byte("file contents")); err != nil {
+		t.Fatal(err)
+	}
+	archive := writeTestBackup(t, s)
+
+	path := filepath.Join(t.TempDir(), "restored.db")
+	if err := RestoreBackup(bytes.NewReader(archive), testBackupPassphrase, path, false); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if _, err := os.Stat(path + ".restore"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	restored, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	got, err := restored.Unlock(testPassword)
+	if err != nil {
+		t.Fatalf("Unlock restored vault: %v", err)
+	}
+	if !equalStrings(entryIDs(got), entryIDs(entries)) {
+		t.Errorf("entries = %v, want %v", entryIDs(got), entryIDs(entries))
+	}
+	if _, err := restored.GetFriend("fp"); err != nil {
+		t.Errorf("GetFriend: %v", err)
+	}
+	if content, err := restored.Attachment("att"); err != nil || string(content) != "file contents" {
+		t.Errorf("Attachment = %q, %v", content, err)
+	}
+}
+
+func TestRestoreResetsSyncState(t *testing.T) {
+	_, s := newTestFile(t, nil)
+	err := s.backend.Update(func(tx Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(syncMetaBucket)
+		if err != nil {
+			return err
+		}
+		meta.Put(keySyncVaultID, []byte("vault id"))
+		meta.Put(keySyncCursor, []byte{0, 0, 0, 42})
+		for _, name := range [][]byte{syncEventHeadsBucket, syncPendingBucket, syncPendingFoldersBucket} {
+			b, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte("k"), []byte("v")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := writeTestBackup(t, s)
+
+	path := filepath.Join(t.TempDir(), "restored.db")
+	if err := RestoreBackup(bytes.NewReader(archive), testBackupPassphrase, path, false); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	restored.backend.View(func(tx Tx) error {
+		meta := tx.Bucket(syncMetaBucket)
+		if string(meta.Get(keySyncVaultID)) != "vault id" {
+			t.Error("vault ID was not kept")
+		}
+		if meta.Get(keySyncCursor) != nil {
+			t.Error("sync cursor was not cleared")
+		}
+		if meta.Get(keySyncResync) == nil {
+			t.Error("resync flag was not set")
+		}
+		for _, name := range [][]byte{syncEventHeadsBucket, syncPendingBucket, syncPendingFoldersBucket} {
+			b := tx.Bucket(name)
+			if b == nil {
+				t.Errorf("%s is missing", name)
+			} else if b.Get([]byte("k")) != nil {
+				t.Errorf("%s was not cleared", name)
+			}
+		}
+		return nil
+	})
+}
+
+func TestRestoreRefuses(t *testing.T) {
+	entries := []models.Entry{{ID: "a", Website: "a.example", Password: "1"}}
+	path, s := newTestFile(t, entries)
+	archive := writeTestBackup(t, s)
+
+	newPath := filepath.Join(t.TempDir(), "new.db")
+	if err := RestoreBackup(bytes.NewReader(archive), "wrong", newPath, false); !errors.Is(err, crypto.ErrDecryptionFailed) {
+		t.Errorf("wrong passphrase: got %v, want %v", err, crypto.ErrDecryptionFailed)
+	}
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Error("database created from a backup that did not decrypt")
+	}
+
+	tampered := append([]byte(nil), archive...)
+	tampered[len(archiveMagic)+8] ^= 1
+	if err := RestoreBackup(bytes.NewReader(tampered), testBackupPassphrase, newPath, false); err == nil {
+		t.Error("restored an archive with a modified header")
+	}
+	if err := RestoreBackup(bytes.NewReader([]byte("not a backup")), testBackupPassphrase, newPath, false); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("not an archive: got %v, want %v", err, ErrInvalidArchive)
+	}
+
+	if err := RestoreBackup(bytes.NewReader(archive), testBackupPassphrase, path, false); err == nil {
+		t.Error("replaced an existing vault without overwrite")
+	}
+	var inUse *InUseError
+	if err := RestoreBackup(bytes.NewReader(archive), testBackupPassphrase, path, true); !errors.As(err, &inUse) {
+		t.Errorf("overwrite while open: got %v, want an InUseError", err)
+	}
+
+	// Once the vault is closed, overwriting replaces it.
+	if err := s.SaveEntries(nil); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if err := RestoreBackup(bytes.NewReader(archive), testBackupPassphrase, path, true); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	restored, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	got, err := restored.Unlock(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(entryIDs(got), entryIDs(entries)) {
+		t.Errorf("entries after overwrite = %v, want %v", entryIDs(got), entryIDs(entries))
+	}
+}
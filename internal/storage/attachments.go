@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"forgor/internal/models"
+)
+
+// The attachments bucket holds the contents of entry attachments, sealed
+// under their attachment IDs. Entries only carry the models.Attachment
+// metadata, so editing an entry does not rewrite its files.
+var attachmentsBucket = []byte("attachments")
+
+// PutAttachment stores the contents of an attachment. Contents never change,
+// so an existing value is left alone.
+func (s *Store) PutAttachment(id string, content []byte) error {
+	if id == "" {
+		return fmt.Errorf("attachment id is required")
+	}
+	if len(content) > models.MaxAttachmentSize {
+		return fmt.Errorf("attachment of %s exceeds the %s limit", models.FormatSize(int64(len(content))), models.FormatSize(models.MaxAttachmentSize))
+	}
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(vaultKey)
+
+	key := []byte(id)
+	ciphertext, err := seal(vaultKey, attachmentsBucket, key, content)
+	if err != nil {
+		return err
+	}
+	return s.backend.Update(func(tx Tx) error {
+		bucket := tx.Bucket(attachmentsBucket)
+		if bucket.Get(key) != nil {
+			return nil
+		}
+		return bucket.Put(key, ciphertext)
+	})
+}
+
+// Attachment returns the contents stored for an attachment ID.
+func (s *Store) Attachment(id string) ([]byte, error) {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(vaultKey)
+
+	var content []byte
+	err = s.backend.View(func(tx Tx) error {
+		bucket := tx.Bucket(attachmentsBucket)
+		if bucket == nil {
+			return fmt.Errorf("attachment %s not found", id)
+		}
+		ciphertext := bucket.Get([]byte(id))
+		if ciphertext == nil {
+			return fmt.Errorf("attachment %s not found", id)
+		}
+		content, err = unseal(vaultKey, attachmentsBucket, []byte(id), ciphertext)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt attachment %s: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// HasAttachment reports whether the contents of an attachment are stored.
+// They may not be yet when the entry arrived by sync before its chunks.
+func (s *Store) HasAttachment(id string) bool {
+	var ok bool
+	s.backend.View(func(tx Tx) error {
+		if bucket := tx.Bucket(attachmentsBucket); bucket != nil {
+			ok = bucket.Get([]byte(id)) != nil
+		}
+		return nil
+	})
+	return ok
+}
+
+// pruneAttachments deletes contents that neither the saved entries, the
+// trash nor any history snapshot refer to. Snapshots are only decrypted
+// when something is a candidate for removal.
+func pruneAttachments(tx Tx, vaultKey []byte, entries []models.Entry) error {
+	bucket := tx.Bucket(attachmentsBucket)
+	trash, err := readTrash(tx, vaultKey)
+	if err != nil {
+		// A damaged trash could refer to any of them.
+		return nil
+	}
+	keep := models.AttachmentIDs(append(append([]models.Entry(nil), entries...), trash...))
+
+	var unused [][]byte
+	bucket.ForEach(func(k, _ []byte) error {
+		if !keep[string(k)] {
+			unused = append(unused, copyBytes(k))
+		}
+		return nil
+	})
+	if len(unused) == 0 {
+		return nil
+	}
+
+	referenced, ok := snapshotAttachmentIDs(tx, vaultKey)
+	if !ok {
+		return nil
+	}
+	for _, k := range unused {
+		if referenced[string(k)] {
+			continue
+		}
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotAttachmentIDs returns the attachment IDs used by any history
+// snapshot, so restoring one brings its files back. It reports false if a
+// snapshot is damaged, since that snapshot could refer to any of them.
+func snapshotAttachmentIDs(tx Tx, vaultKey []byte) (map[string]bool, bool) {
+	ids := make(map[string]bool)
+	ok := true
+	tx.Bucket(historyBucket).ForEach(func(k, v []byte) error {
+		plaintext, err := unseal(vaultKey, historyBucket, k, v)
+		if err != nil {
+			ok = false
+			return nil
+		}
+		var snapshot models.VaultSnapshot
+		err = json.Unmarshal(plaintext, &snapshot)
+		wipe(plaintext)
+		if err != nil {
+			ok = false
+			return nil
+		}
+		for id := range models.AttachmentIDs(snapshot.Entries) {
+			ids[id] = true
+		}
+		return nil
+	})
+	return ids, ok
+}
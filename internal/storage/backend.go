@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Backend is the transactional key-value store a Store and its sync state
+// keep their buckets in. It mirrors the subset of bbolt forgor uses, so
+// the bbolt implementation is a thin wrapper.
+type Backend interface {
+	View(fn func(tx Tx) error) error
+	Update(fn func(tx Tx) error) error
+	ReadOnly() bool
+	// Path is the database file, or "" when there is none.
+	Path() string
+	// CopyFile writes a consistent copy of the database to path.
+	CopyFile(path string) error
+	Close() error
+}
+
+type Tx interface {
+	// Bucket returns nil when the bucket does not exist.
+	Bucket(name []byte) Bucket
+	CreateBucket(name []byte) (Bucket, error)
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	DeleteBucket(name []byte) error
+	ForEach(fn func(name []byte, b Bucket) error) error
+}
+
+// Bucket values are only valid for the life of the transaction and must
+// not be modified.
+type Bucket interface {
+	Get(key []byte) []byte
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	// ForEach visits the keys in byte order.
+	ForEach(fn func(k, v []byte) error) error
+	Cursor() Cursor
+}
+
+// Cursor walks a bucket in byte order. Methods return a nil key past
+// either end.
+type Cursor interface {
+	First() (key, value []byte)
+	Last() (key, value []byte)
+	Next() (key, value []byte)
+	Prev() (key, value []byte)
+	Seek(seek []byte) (key, value []byte)
+}
+
+type boltBackend struct {
+	db   *bolt.DB
+	path string
+	// snapshotPath is the private copy a read-only open fell back to.
+	snapshotPath string
+}
+
+func (b *boltBackend) View(fn func(tx Tx) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (b *boltBackend) Update(fn func(tx Tx) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (b *boltBackend) ReadOnly() bool {
+	return b.db.IsReadOnly()
+}
+
+func (b *boltBackend) Path() string {
+	return b.path
+}
+
+func (b *boltBackend) CopyFile(path string) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+func (b *boltBackend) Close() error {
+	err := b.db.Close()
+	switch {
+	case b.snapshotPath != "":
+		os.Remove(b.snapshotPath)
+	case !b.db.IsReadOnly():
+		os.Remove(pidPath(b.path))
+	}
+	return err
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltTx) Bucket(name []byte) Bucket {
+	if b := t.tx.Bucket(name); b != nil {
+		return boltBucket{b}
+	}
+	return nil
+}
+
+func (t boltTx) CreateBucket(name []byte) (Bucket, error) {
+	b, err := t.tx.CreateBucket(name)
+	if err != nil {
+		return nil, err
+	}
+	return boltBucket{b}, nil
+}
+
+func (t boltTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+	return boltBucket{b}, nil
+}
+
+func (t boltTx) DeleteBucket(name []byte) error {
+	return t.tx.DeleteBucket(name)
+}
+
+func (t boltTx) ForEach(fn func(name []byte, b Bucket) error) error {
+	return t.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		return fn(name, boltBucket{b})
+	})
+}
+
+type boltBucket struct {
+	b *bolt.Bucket
+}
+
+func (b boltBucket) Get(key []byte) []byte                    { return b.b.Get(key) }
+func (b boltBucket) Put(key, value []byte) error              { return b.b.Put(key, value) }
+func (b boltBucket) Delete(key []byte) error                  { return b.b.Delete(key) }
+func (b boltBucket) ForEach(fn func(k, v []byte) error) error { return b.b.ForEach(fn) }
+func (b boltBucket) Cursor() Cursor                           { return b.b.Cursor() }
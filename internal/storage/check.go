@@ -0,0 +1,477 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"forgor/internal/models"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// Problem is an inconsistency found by Check. Fix describes the repair
+// Check can make, and is empty when the data can only be restored from
+// history or a backup.
+type Problem struct {
+	Location string
+	Issue    string
+	Fix      string
+	Fixed    bool
+}
+
+func (p Problem) String() string {
+	s := p.Location + ": " + p.Issue
+	switch {
+	case p.Fixed:
+		s += " (fixed: " + p.Fix + ")"
+	case p.Fix != "":
+		s += " (repair: " + p.Fix + ")"
+	}
+	return s
+}
+
+// Check verifies that every value in the vault decrypts and parses and that
+// the index matches the records. With repair set, the problems that have a
+// fix are repaired in one transaction. The vault must be unlocked.
+func (s *Store) Check(repair bool) ([]Problem, error) {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(vaultKey)
+
+	var problems []Problem
+	run := s.backend.View
+	if repair {
+		run = s.backend.Update
+	}
+	err = run(func(tx Tx) error {
+		c := &checker{tx: tx, vaultKey: vaultKey, repair: repair}
+		c.checkMeta()
+		if err := c.checkVault(); err != nil {
+			return err
+		}
+		if err := c.checkHistory(); err != nil {
+			return err
+		}
+		if err := c.checkFriends(); err != nil {
+			return err
+		}
+		if err := c.checkTrash(); err != nil {
+			return err
+		}
+		if err := c.checkAttachments(); err != nil {
+			return err
+		}
+		if err := c.checkFolders(); err != nil {
+			return err
+		}
+		if err := c.checkUsage(); err != nil {
+			return err
+		}
+		problems = c.problems
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
+
+// EntryIDs returns the IDs of every entry in the index, including entries
+// whose records are damaged.
+func (s *Store) EntryIDs() (map[string]bool, error) {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(vaultKey)
+
+	ids := make(map[string]bool)
+	err = s.backend.View(func(tx Tx) error {
+		index, err := loadIndex(tx.Bucket(vaultBucket), vaultKey)
+		if err != nil {
+			return err
+		}
+		for _, rec := range index.Records {
+			ids[rec.EntryID] = true
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// CopyTo writes a consistent copy of the database file to path.
+func (s *Store) CopyTo(path string) error {
+	return s.backend.CopyFile(path)
+}
+
+type checker struct {
+	tx       Tx
+	vaultKey []byte
+	repair   bool
+	problems []Problem
+	// attachments maps the attachment IDs of readable entries to the
+	// title of the entry, filled in by checkVault and checkTrash.
+	attachments map[string]string
+	// trashUnreadable is set when the trash is damaged and kept, so it
+	// may still refer to any file.
+	trashUnreadable bool
+}
+
+// report records a problem and returns whether its fix should be applied.
+func (c *checker) report(location, issue, fix string) bool {
+	fixed := c.repair && fix != ""
+	c.problems = append(c.problems, Problem{Location: location, Issue: issue, Fix: fix, Fixed: fixed})
+	return fixed
+}
+
+func (c *checker) checkMeta() {
+	meta := c.tx.Bucket(metaBucket)
+
+	if _, err := readSchemaVersion(meta); err != nil {
+		c.report("meta/schema_version", err.Error(), "")
+	}
+	if _, err := readKDFParams(meta); err != nil {
+		c.report("meta/kdf_params", err.Error(), "")
+	}
+	if meta.Get(keyVaultKeyWrapped) == nil {
+		c.report("meta/vault_key_wrapped", "missing", "")
+	}
+
+	pub := meta.Get(keyDevicePubKey)
+	if len(pub) != 32 {
+		c.report("meta/device_pubkey", fmt.Sprintf("invalid length %d", len(pub)), "")
+	}
+	privEnc := meta.Get(keyDevicePrivKeyEnc)
+	if privEnc == nil {
+		c.report("meta/device_privkey_enc", "missing", "")
+		return
+	}
+	priv, err := unseal(c.vaultKey, metaBucket, keyDevicePrivKeyEnc, privEnc)
+	if err != nil {
+		c.report("meta/device_privkey_enc", "does not decrypt", "")
+		return
+	}
+	defer wipe(priv)
+	if len(priv) != 32 {
+		c.report("meta/device_privkey_enc", fmt.Sprintf("invalid length %d", len(priv)), "")
+		return
+	}
+	derived, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err == nil && len(pub) == 32 && !bytes.Equal(derived, pub) {
+		c.report("meta/device_pubkey", "does not match the device private key", "")
+	}
+}
+
+func (c *checker) checkVault() error {
+	vault := c.tx.Bucket(vaultBucket)
+
+	if vault.Get(keyVaultBlob) != nil {
+		c.report("vault/blob", "unmigrated vault blob left next to the records", "")
+	}
+
+	var index *vaultIndex
+	dirty := false
+	ciphertext := vault.Get(keyVaultIndex)
+	if ciphertext != nil {
+		if plaintext, err := unseal(c.vaultKey, vaultBucket, keyVaultIndex, ciphertext); err == nil {
+			var parsed vaultIndex
+			if json.Unmarshal(plaintext, &parsed) == nil {
+				index = &parsed
+			}
+		}
+	}
+	if index == nil {
+		issue := "damaged"
+		if ciphertext == nil {
+			issue = "missing"
+		}
+		dirty = c.report("vault/index", issue, "rebuild the index from the records")
+		rebuilt, err := rebuildIndex(vault, c.vaultKey)
+		if err != nil {
+			return err
+		}
+		index = rebuilt
+	}
+
+	next := vaultIndex{Records: make([]indexRecord, 0, len(index.Records))}
+	referenced := make(map[string]bool, len(index.Records))
+	entries := make(map[string]string, len(index.Records))
+	for _, rec := range index.Records {
+		location := "vault/" + string(recordKey(rec.RecordID))
+		if referenced[rec.RecordID] {
+			if c.report(location, "listed twice in the index", "drop the duplicate index row") {
+				dirty = true
+				continue
+			}
+		}
+		referenced[rec.RecordID] = true
+
+		ciphertext := vault.Get(recordKey(rec.RecordID))
+		if ciphertext == nil {
+			if c.report(location, "listed in the index but missing", "drop it from the index") {
+				dirty = true
+				continue
+			}
+			next.Records = append(next.Records, rec)
+			continue
+		}
+		plaintext, err := unseal(c.vaultKey, vaultBucket, recordKey(rec.RecordID), ciphertext)
+		if err != nil {
+			c.report(location, "does not decrypt", "")
+			next.Records = append(next.Records, rec)
+			continue
+		}
+		var entry models.Entry
+		err = json.Unmarshal(plaintext, &entry)
+		digest := recordDigest(plaintext)
+		wipe(plaintext)
+		if err != nil {
+			c.report(location, "does not parse", "")
+			next.Records = append(next.Records, rec)
+			continue
+		}
+
+		if entry.ID != rec.EntryID {
+			if c.report(location, fmt.Sprintf("index says entry %s but the record holds %s", rec.EntryID, entry.ID), "update the index") {
+				rec.EntryID = entry.ID
+				dirty = true
+			}
+		}
+		if rec.Digest != digest {
+			if c.report(location, "index digest is stale", "update the index") {
+				rec.Digest = digest
+				dirty = true
+			}
+		}
+		c.noteAttachments(entry)
+		if other, ok := entries[entry.ID]; ok {
+			c.report(location, fmt.Sprintf("entry %s is also stored in r:%s", entry.ID, other), "")
+		}
+		entries[entry.ID] = rec.RecordID
+		next.Records = append(next.Records, rec)
+	}
+
+	// Records missing from the index are entries the app can no longer see.
+	cur := vault.Cursor()
+	for k, v := cur.Seek(recordKeyPrefix); k != nil && bytes.HasPrefix(k, recordKeyPrefix); k, v = cur.Next() {
+		recordID := string(k[len(recordKeyPrefix):])
+		if referenced[recordID] {
+			continue
+		}
+		location := "vault/" + string(k)
+		plaintext, err := unseal(c.vaultKey, vaultBucket, k, v)
+		if err != nil {
+			c.report(location, "orphaned record that does not decrypt", "")
+			continue
+		}
+		var entry models.Entry
+		err = json.Unmarshal(plaintext, &entry)
+		digest := recordDigest(plaintext)
+		wipe(plaintext)
+		if err != nil {
+			c.report(location, "orphaned record that does not parse", "")
+			continue
+		}
+		if c.report(location, fmt.Sprintf("entry %q is not in the index", entry.Title()), "add it back to the index") {
+			c.noteAttachments(entry)
+			next.Records = append(next.Records, indexRecord{EntryID: entry.ID, RecordID: recordID, Digest: digest})
+			dirty = true
+		}
+	}
+
+	if dirty {
+		return writeIndex(vault, c.vaultKey, &next)
+	}
+	return nil
+}
+
+func (c *checker) checkHistory() error {
+	history := c.tx.Bucket(historyBucket)
+	var damaged [][]byte
+	history.ForEach(func(k, v []byte) error {
+		location := "history/" + hex.EncodeToString(k)
+		plaintext, err := unseal(c.vaultKey, historyBucket, k, v)
+		if err != nil {
+			if c.report(location, "snapshot does not decrypt", "delete the snapshot") {
+				damaged = append(damaged, copyBytes(k))
+			}
+			return nil
+		}
+		var snapshot models.VaultSnapshot
+		err = json.Unmarshal(plaintext, &snapshot)
+		wipe(plaintext)
+		if err != nil && c.report(location, "snapshot does not parse", "delete the snapshot") {
+			damaged = append(damaged, copyBytes(k))
+		}
+		return nil
+	})
+	for _, k := range damaged {
+		if err := history.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *checker) checkFriends() error {
+	friends := c.tx.Bucket(friendsBucket)
+	ciphertext := friends.Get(keyFriendsBlob)
+	if ciphertext == nil {
+		return nil
+	}
+	const fix = "clear the friends list; devices have to pair again"
+	plaintext, err := unseal(c.vaultKey, friendsBucket, keyFriendsBlob, ciphertext)
+	if err != nil {
+		if c.report("friends/blob", "does not decrypt", fix) {
+			return friends.Delete(keyFriendsBlob)
+		}
+		return nil
+	}
+	var list []models.Friend
+	err = json.Unmarshal(plaintext, &list)
+	wipe(plaintext)
+	if err != nil && c.report("friends/blob", "does not parse", fix) {
+		return friends.Delete(keyFriendsBlob)
+	}
+	return nil
+}
+
+func (c *checker) checkFolders() error {
+	folders := c.tx.Bucket(foldersBucket)
+	if folders == nil {
+		return nil
+	}
+	ciphertext := folders.Get(keyFoldersBlob)
+	if ciphertext == nil {
+		return nil
+	}
+	const fix = "clear the folders; their entries move to the top level"
+	plaintext, err := unseal(c.vaultKey, foldersBucket, keyFoldersBlob, ciphertext)
+	if err != nil {
+		if c.report("folders/blob", "does not decrypt", fix) {
+			return folders.Delete(keyFoldersBlob)
+		}
+		return nil
+	}
+	var list []models.Folder
+	err = json.Unmarshal(plaintext, &list)
+	wipe(plaintext)
+	if err != nil && c.report("folders/blob", "does not parse", fix) {
+		return folders.Delete(keyFoldersBlob)
+	}
+	return nil
+}
+
+func (c *checker) checkTrash() error {
+	trash := c.tx.Bucket(trashBucket)
+	if trash == nil || trash.Get(keyTrashBlob) == nil {
+		return nil
+	}
+	entries, err := readTrash(c.tx, c.vaultKey)
+	if err != nil {
+		issue := "does not parse"
+		if _, uerr := unseal(c.vaultKey, trashBucket, keyTrashBlob, trash.Get(keyTrashBlob)); uerr != nil {
+			issue = "does not decrypt"
+		}
+		if c.report("trash/blob", issue, "empty the trash") {
+			return trash.Delete(keyTrashBlob)
+		}
+		c.trashUnreadable = true
+		return nil
+	}
+	for _, entry := range entries {
+		c.noteAttachments(entry)
+	}
+	return nil
+}
+
+func (c *checker) checkUsage() error {
+	usage := c.tx.Bucket(usageBucket)
+	if usage == nil {
+		return nil
+	}
+	ciphertext := usage.Get(keyUsageBlob)
+	if ciphertext == nil {
+		return nil
+	}
+	const fix = "clear the usage counts"
+	plaintext, err := unseal(c.vaultKey, usageBucket, keyUsageBlob, ciphertext)
+	if err != nil {
+		if c.report("usage/blob", "does not decrypt", fix) {
+			return usage.Delete(keyUsageBlob)
+		}
+		return nil
+	}
+	var counts map[string]models.Usage
+	err = json.Unmarshal(plaintext, &counts)
+	wipe(plaintext)
+	if err != nil && c.report("usage/blob", "does not parse", fix) {
+		return usage.Delete(keyUsageBlob)
+	}
+	return nil
+}
+
+func (c *checker) noteAttachments(entry models.Entry) {
+	if c.attachments == nil {
+		c.attachments = make(map[string]string)
+	}
+	for _, a := range entry.Attachments {
+		c.attachments[a.ID] = entry.Title()
+	}
+}
+
+// checkAttachments verifies that every attachment decrypts and is used by
+// an entry, a trashed entry or a history snapshot, and that every entry's
+// files are there.
+func (c *checker) checkAttachments() error {
+	bucket := c.tx.Bucket(attachmentsBucket)
+	if bucket == nil {
+		return nil
+	}
+	snapshots, snapshotsOK := snapshotAttachmentIDs(c.tx, c.vaultKey)
+
+	var damaged [][]byte
+	present := make(map[string]bool)
+	bucket.ForEach(func(k, v []byte) error {
+		location := "attachments/" + string(k)
+		plaintext, err := unseal(c.vaultKey, attachmentsBucket, k, v)
+		if err != nil {
+			if c.report(location, "does not decrypt", "delete it") {
+				damaged = append(damaged, copyBytes(k))
+			}
+			return nil
+		}
+		wipe(plaintext)
+		present[string(k)] = true
+		if _, ok := c.attachments[string(k)]; ok || snapshots[string(k)] || !snapshotsOK || c.trashUnreadable {
+			return nil
+		}
+		if c.report(location, "not used by any entry or snapshot", "delete it") {
+			damaged = append(damaged, copyBytes(k))
+		}
+		return nil
+	})
+
+	ids := make([]string, 0, len(c.attachments))
+	for id := range c.attachments {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !present[id] {
+			c.report("attachments/"+id, fmt.Sprintf("file of entry %q is missing", c.attachments[id]), "")
+		}
+	}
+
+	for _, k := range damaged {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"sort"
+	"testing"
+
+	"forgor/internal/models"
+)
+
+func problemLocations(problems []Problem) []string {
+	var locations []string
+	for _, p := range problems {
+		locations = append(locations, p.Location)
+	}
+	sort.Strings(locations)
+	return locations
+}
+
+func TestCheckCleanVault(t *testing.T) {
+	s := newTestStore(t)
+	entries := []models.Entry{
+		{ID: "a", Website: "a.example", Password: "1", Attachments: []models.Attachment{{ID: "att", Name: "a.txt"}}},
+		{ID: "b", Website: "b.example", Password: "2"},
+	}
+	if err := s.PutAttachment("att", []byte("file contents")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveEntries(entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveFriend(models.Friend{Name: "bob", Fingerprint: "fp"}); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := s.Check(false)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("clean vault has problems: %v", problems)
+	}
+}
+
+func TestCheckRepairs(t *testing.T) {
+	s := newTestStore(t)
+	entries := []models.Entry{
+		{ID: "a", Website: "a.example", Password: "1"},
+		{ID: "b", Website: "b.example", Password: "2"},
+	}
+	if err := s.SaveEntries(entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveFriend(models.Friend{Name: "bob", Fingerprint: "fp"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutAttachment("unused", []byte("file contents")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop a from the index, list a record that does not exist, and
+	// damage the friends list.
+	vaultKey := s.mustSessionKey(t)
+	orphan := s.recordKeys(t)["a"]
+	err := s.backend.Update(func(tx Tx) error {
+		vault := tx.Bucket(vaultBucket)
+		index, err := loadIndex(vault, vaultKey)
+		if err != nil {
+			return err
+		}
+		var next vaultIndex
+		for _, rec := range index.Records {
+			if rec.EntryID != "a" {
+				next.Records = append(next.Records, rec)
+			}
+		}
+		next.Records = append(next.Records, indexRecord{EntryID: "gone", RecordID: "missing"})
+		if err := writeIndex(vault, vaultKey, &next); err != nil {
+			return err
+		}
+		return tx.Bucket(friendsBucket).Put(keyFriendsBlob, []byte("damaged"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"attachments/unused", "friends/blob", "vault/" + string(orphan), "vault/r:missing"}
+	sort.Strings(want)
+
+	problems, err := s.Check(false)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if got := problemLocations(problems); !equalStrings(got, want) {
+		t.Fatalf("problems at %v, want %v", got, want)
+	}
+	for _, p := range problems {
+		if p.Fixed {
+			t.Errorf("%s fixed without repair", p.Location)
+		}
+	}
+
+	problems, err = s.Check(true)
+	if err != nil {
+		t.Fatalf("Check with repair: %v", err)
+	}
+	if got := problemLocations(problems); !equalStrings(got, want) {
+		t.Fatalf("repaired %v, want %v", got, want)
+	}
+	for _, p := range problems {
+		if !p.Fixed {
+			t.Errorf("%s was not fixed", p)
+		}
+	}
+
+	problems, err = s.Check(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("problems left after repair: %v", problems)
+	}
+	got, err := s.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(entryIDs(got), entryIDs(entries)) {
+		t.Errorf("entries after repair = %v, want %v", entryIDs(got), entryIDs(entries))
+	}
+	if _, err := s.Attachment("unused"); err == nil {
+		t.Error("unused attachment was not deleted")
+	}
+}
+
+func TestCheckRebuildsIndex(t *testing.T) {
+	s := newTestStore(t)
+	entries := []models.Entry{
+		{ID: "a", Website: "a.example", Password: "1"},
+		{ID: "b", Website: "b.example", Password: "2"},
+	}
+	if err := s.SaveEntries(entries); err != nil {
+		t.Fatal(err)
+	}
+	s.backend.Update(func(tx Tx) error {
+		return tx.Bucket(vaultBucket).Put(keyVaultIndex, []byte("damaged"))
+	})
+
+	problems, err := s.Check(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Location != "vault/index" || !problems[0].Fixed {
+		t.Fatalf("problems = %v, want a fixed vault/index", problems)
+	}
+	if problems, _ := s.Check(false); len(problems) != 0 {
+		t.Errorf("problems left after repair: %v", problems)
+	}
+	got, err := s.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(entryIDs(got), entryIDs(entries)) {
+		t.Errorf("entries after repair = %v, want %v", entryIDs(got), entryIDs(entries))
+	}
+}
+
+func TestCheckKeepsUnrepairable(t *testing.T) {
+	s := newTestStore(t)
+	entries := []models.Entry{
+		{ID: "a", Website: "a.example", Password: "1"},
+		{ID: "b", Website: "b.example", Password: "2"},
+	}
+	if err := s.SaveEntries(entries); err != nil {
+		t.Fatal(err)
+	}
+	damaged := s.recordKeys(t)["b"]
+	s.backend.Update(func(tx Tx) error {
+		vault := tx.Bucket(vaultBucket)
+		ciphertext := copyBytes(vault.Get(damaged))
+		ciphertext[len(ciphertext)-1] ^= 1
+		return vault.Put(damaged, ciphertext)
+	})
+
+	// Only a backup or snapshot can bring b back, so repair leaves the
+	// record and its index row alone.
+	for _, repair := range []bool{true, false} {
+		problems, err := s.Check(repair)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(problems) != 1 || problems[0].Location != "vault/"+string(damaged) || problems[0].Fix != "" || problems[0].Fixed {
+			t.Errorf("Check(%v) = %v, want one unrepairable record", repair, problems)
+		}
+	}
+	ids, err := s.EntryIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ids["a"] || !ids["b"] {
+		t.Errorf("EntryIDs = %v, want a and b", ids)
+	}
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"forgor/internal/models"
+)
+
+// The folders bucket holds the folder list as one sealed blob, so folder
+// names are encrypted like everything else.
+var (
+	foldersBucket  = []byte("folders")
+	keyFoldersBlob = []byte("blob")
+)
+
+// Folders returns the folders of an unlocked vault.
+func (s *Store) Folders() ([]models.Folder, error) {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(vaultKey)
+
+	var ciphertext []byte
+	s.backend.View(func(tx Tx) error {
+		if bucket := tx.Bucket(foldersBucket); bucket != nil {
+			ciphertext = copyBytes(bucket.Get(keyFoldersBlob))
+		}
+		return nil
+	})
+	if ciphertext == nil {
+		return nil, nil
+	}
+
+	plaintext, err := unseal(vaultKey, foldersBucket, keyFoldersBlob, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt folders: %w", err)
+	}
+	defer wipe(plaintext)
+
+	var folders []models.Folder
+	if err := json.Unmarshal(plaintext, &folders); err != nil {
+		return nil, fmt.Errorf("failed to parse folders: %w", err)
+	}
+	return folders, nil
+}
+
+func (s *Store) SaveFolders(folders []models.Folder) error {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(vaultKey)
+
+	plaintext, err := json.Marshal(folders)
+	if err != nil {
+		return fmt.Errorf("failed to serialize folders: %w", err)
+	}
+	defer wipe(plaintext)
+	ciphertext, err := seal(vaultKey, foldersBucket, keyFoldersBlob, plaintext)
+	if err != nil {
+		return err
+	}
+
+	return s.backend.Update(func(tx Tx) error {
+		return tx.Bucket(foldersBucket).Put(keyFoldersBlob, ciphertext)
+	})
+}
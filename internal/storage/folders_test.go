@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+
+	"forgor/internal/models"
+)
+
+func TestFolders(t *testing.T) {
+	s := newTestStore(t)
+	if folders, err := s.Folders(); err != nil || folders != nil {
+		t.Fatalf("Folders on a new vault = %v, %v", folders, err)
+	}
+
+	work := models.NewFolder("Work", "")
+	mail := models.NewFolder("Secret mail", work.ID)
+	if err := s.SaveFolders([]models.Folder{work, mail}); err != nil {
+		t.Fatalf("SaveFolders: %v", err)
+	}
+	got, err := s.Folders()
+	if err != nil {
+		t.Fatalf("Folders: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != work.ID || got[1].ParentID != work.ID || got[1].Name != mail.Name {
+		t.Errorf("Folders = %+v", got)
+	}
+
+	s.backend.View(func(tx Tx) error {
+		if bytes.Contains(tx.Bucket(foldersBucket).Get(keyFoldersBlob), []byte("Secret mail")) {
+			t.Error("folder name stored in the clear")
+		}
+		return nil
+	})
+
+	s.Lock()
+	if _, err := s.Folders(); err == nil {
+		t.Error("Folders succeeded on a locked vault")
+	}
+	if err := s.SaveFolders(nil); err == nil {
+		t.Error("SaveFolders succeeded on a locked vault")
+	}
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"forgor/internal/models"
+)
+
+// The history bucket keeps encrypted copies of earlier vault versions keyed
+// by the big-endian UnixNano time they were taken, so the newest is last.
+var historyBucket = []byte("history")
+
+const (
+	maxHistorySnapshots = 20
+	// Single-entry edits within this window share one snapshot. Removals
+	// and bulk changes, such as a sync merge, are always snapshotted.
+	historyInterval = 10 * time.Minute
+)
+
+func historyKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// shouldSnapshot decides whether the vault as it is now should be kept
+// before a save that removes or changes entries.
+func shouldSnapshot(history Bucket, removed, changed int) bool {
+	if removed > 0 || changed > 1 {
+		return true
+	}
+	if changed == 0 {
+		return false
+	}
+	last, _ := history.Cursor().Last()
+	if len(last) != 8 {
+		return true
+	}
+	lastAt := time.Unix(0, int64(binary.BigEndian.Uint64(last)))
+	return time.Since(lastAt) >= historyInterval
+}
+
+// snapshotIndex stores the entries referenced by index as a history
+// snapshot and prunes the oldest ones past maxHistorySnapshots.
+func snapshotIndex(tx Tx, vaultKey []byte, index *vaultIndex) error {
+	vault := tx.Bucket(vaultBucket)
+	history := tx.Bucket(historyBucket)
+
+	snapshot := models.VaultSnapshot{
+		SavedAt: time.Now(),
+		Entries: make([]models.Entry, 0, len(index.Records)),
+	}
+	for _, rec := range index.Records {
+		entry, err := readRecord(vault, vaultKey, rec.RecordID)
+		if err != nil {
+			continue
+		}
+		snapshot.Entries = append(snapshot.Entries, entry)
+	}
+
+	plaintext, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to serialize snapshot: %w", err)
+	}
+	defer wipe(plaintext)
+	key := historyKey(snapshot.SavedAt)
+	ciphertext, err := seal(vaultKey, historyBucket, key, plaintext)
+	if err != nil {
+		return err
+	}
+	if err := history.Put(key, ciphertext); err != nil {
+		return err
+	}
+
+	var keys [][]byte
+	history.ForEach(func(k, _ []byte) error {
+		keys = append(keys, copyBytes(k))
+		return nil
+	})
+	for len(keys) > maxHistorySnapshots {
+		if err := history.Delete(keys[0]); err != nil {
+			return err
+		}
+		keys = keys[1:]
+	}
+	return nil
+}
+
+// ListSnapshots returns the saved vault versions, newest first. Snapshots
+// that fail to decrypt are skipped.
+func (s *Store) ListSnapshots() ([]models.VaultSnapshot, error) {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(vaultKey)
+
+	var snapshots []models.VaultSnapshot
+	err = s.backend.View(func(tx Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			plaintext, err := unseal(vaultKey, historyBucket, k, v)
+			if err != nil {
+				continue
+			}
+			var snapshot models.VaultSnapshot
+			if err := json.Unmarshal(plaintext, &snapshot); err != nil {
+				continue
+			}
+			snapshot.ID = hex.EncodeToString(k)
+			snapshots = append(snapshots, snapshot)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
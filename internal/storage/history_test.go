@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+
+	"forgor/internal/models"
+)
+
+func TestSnapshots(t *testing.T) {
+	s := newTestStore(t)
+	a := models.Entry{ID: "a", Website: "a.example", Password: "1"}
+	b := models.Entry{ID: "b", Website: "b.example", Password: "2"}
+	original := []models.Entry{a, b}
+
+	steps := []struct {
+		name    string
+		entries []models.Entry
+		// want lists the entries of each snapshot, newest first.
+		want [][]models.Entry
+	}{
+		{"add", original, nil},
+		{"first edit", []models.Entry{a, {ID: "b", Website: "b.example", Password: "22"}}, [][]models.Entry{original}},
+		{"edit again soon", []models.Entry{a, {ID: "b", Website: "b.example", Password: "222"}}, [][]models.Entry{original}},
+		{"remove", []models.Entry{a}, [][]models.Entry{
+			{a, {ID: "b", Website: "b.example", Password: "222"}},
+			original,
+		}},
+	}
+	for _, step := range steps {
+		if err := s.SaveEntries(step.entries); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		snapshots, err := s.ListSnapshots()
+		if err != nil {
+			t.Fatalf("%s: ListSnapshots: %v", step.name, err)
+		}
+		if len(snapshots) != len(step.want) {
+			t.Fatalf("%s: %d snapshots, want %d", step.name, len(snapshots), len(step.want))
+		}
+		for i, snapshot := range snapshots {
+			if !equalStrings(entryIDs(snapshot.Entries), entryIDs(step.want[i])) {
+				t.Errorf("%s: snapshot %d = %v, want %v", step.name, i, entryIDs(snapshot.Entries), entryIDs(step.want[i]))
+			}
+			if snapshot.ID == "" || snapshot.SavedAt.IsZero() {
+				t.Errorf("%s: snapshot %d has no ID or time", step.name, i)
+			}
+		}
+	}
+
+	// Restoring a snapshot saves its entries.
+	snapshots, _ := s.ListSnapshots()
+	oldest := snapshots[len(snapshots)-1]
+	if err := s.SaveEntries(oldest.Entries); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(entryIDs(got), entryIDs(original)) {
+		t.Errorf("restored entries = %v, want %v", entryIDs(got), entryIDs(original))
+	}
+}
+
+func TestSnapshotsArePruned(t *testing.T) {
+	s := newTestStore(t)
+	var entries []models.Entry
+	for i := 0; i < maxHistorySnapshots+5; i++ {
+		entries = append(entries, models.Entry{ID: strconv.Itoa(i), Website: "example.com", Password: "x"})
+	}
+	if err := s.SaveEntries(entries); err != nil {
+		t.Fatal(err)
+	}
+	// Every removal is snapshotted.
+	for len(entries) > 1 {
+		entries = entries[1:]
+		if err := s.SaveEntries(entries); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshots, err := s.ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != maxHistorySnapshots {
+		t.Fatalf("%d snapshots, want %d", len(snapshots), maxHistorySnapshots)
+	}
+	// The newest one holds the last two entries.
+	if n := len(snapshots[0].Entries); n != 2 {
+		t.Errorf("newest snapshot has %d entries, want 2", n)
+	}
+}
+
+func TestSnapshotsNeedUnlock(t *testing.T) {
+	s := newTestStore(t)
+	s.Lock()
+	if _, err := s.ListSnapshots(); err == nil {
+		t.Error("ListSnapshots succeeded on a locked vault")
+	}
+}
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// memoryBackend keeps buckets in maps. Update works on a copy that replaces
+// the live data only when fn succeeds, so a failed transaction leaves no
+// trace, as with bbolt. It returns bbolt's errors for the same mistakes.
+type memoryBackend struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+	closed  bool
+}
+
+// NewMemoryBackend returns an empty backend that lives only in memory.
+func NewMemoryBackend() Backend {
+	return &memoryBackend{buckets: make(map[string]map[string][]byte)}
+}
+
+// OpenMemory returns a new, uninitialized vault kept only in memory, for
+// tests and tools that should not touch the disk.
+func OpenMemory() (*Store, error) {
+	return New(NewMemoryBackend())
+}
+
+func (m *memoryBackend) View(fn func(tx Tx) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return bolt.ErrDatabaseNotOpen
+	}
+	return fn(&memoryTx{buckets: m.buckets})
+}
+
+func (m *memoryBackend) Update(fn func(tx Tx) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return bolt.ErrDatabaseNotOpen
+	}
+
+	buckets := make(map[string]map[string][]byte, len(m.buckets))
+	for name, data := range m.buckets {
+		copied := make(map[string][]byte, len(data))
+		for k, v := range data {
+			copied[k] = v
+		}
+		buckets[name] = copied
+	}
+	if err := fn(&memoryTx{buckets: buckets, writable: true}); err != nil {
+		return err
+	}
+	m.buckets = buckets
+	return nil
+}
+
+func (m *memoryBackend) ReadOnly() bool {
+	return false
+}
+
+func (m *memoryBackend) Path() string {
+	return ""
+}
+
+func (m *memoryBackend) CopyFile(string) error {
+	return errors.New("an in-memory vault has no file to copy")
+}
+
+func (m *memoryBackend) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	m.buckets = nil
+	return nil
+}
+
+type memoryTx struct {
+	buckets  map[string]map[string][]byte
+	writable bool
+}
+
+func (t *memoryTx) Bucket(name []byte) Bucket {
+	data, ok := t.buckets[string(name)]
+	if !ok {
+		return nil
+	}
+	return &memoryBucket{tx: t, data: data}
+}
+
+func (t *memoryTx) CreateBucket(name []byte) (Bucket, error) {
+	if !t.writable {
+		return nil, bolt.ErrTxNotWritable
+	}
+	if len(name) == 0 {
+		return nil, bolt.ErrBucketNameRequired
+	}
+	if _, ok := t.buckets[string(name)]; ok {
+		return nil, bolt.ErrBucketExists
+	}
+	data := make(map[string][]byte)
+	t.buckets[string(name)] = data
+	return &memoryBucket{tx: t, data: data}, nil
+}
+
+func (t *memoryTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if b := t.Bucket(name); b != nil {
+		return b, nil
+	}
+	return t.CreateBucket(name)
+}
+
+func (t *memoryTx) DeleteBucket(name []byte) error {
+	if !t.writable {
+		return bolt.ErrTxNotWritable
+	}
+	if _, ok := t.buckets[string(name)]; !ok {
+		return bolt.ErrBucketNotFound
+	}
+	delete(t.buckets, string(name))
+	return nil
+}
+
+func (t *memoryTx) ForEach(fn func(name []byte, b Bucket) error) error {
+	for _, name := range sortedKeys(t.buckets) {
+		if err := fn([]byte(name), &memoryBucket{tx: t, data: t.buckets[name]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryBucket struct {
+	tx   *memoryTx
+	data map[string][]byte
+}
+
+func (b *memoryBucket) Get(key []byte) []byte {
+	return b.data[string(key)]
+}
+
+func (b *memoryBucket) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return bolt.ErrTxNotWritable
+	}
+	if len(key) == 0 {
+		return bolt.ErrKeyRequired
+	}
+	b.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (b *memoryBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return bolt.ErrTxNotWritable
+	}
+	delete(b.data, string(key))
+	return nil
+}
+
+func (b *memoryBucket) ForEach(fn func(k, v []byte) error) error {
+	for _, k := range sortedKeys(b.data) {
+		if err := fn([]byte(k), b.data[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cursor walks the keys present when it was created.
+func (b *memoryBucket) Cursor() Cursor {
+	return &memoryCursor{data: b.data, keys: sortedKeys(b.data)}
+}
+
+type memoryCursor struct {
+	data map[string][]byte
+	keys []string
+	pos  int
+}
+
+func (c *memoryCursor) at(pos int) ([]byte, []byte) {
+	c.pos = pos
+	if pos < 0 || pos >= len(c.keys) {
+		return nil, nil
+	}
+	k := c.keys[pos]
+	return []byte(k), c.data[k]
+}
+
+func (c *memoryCursor) First() ([]byte, []byte) { return c.at(0) }
+func (c *memoryCursor) Last() ([]byte, []byte)  { return c.at(len(c.keys) - 1) }
+func (c *memoryCursor) Next() ([]byte, []byte)  { return c.at(min(c.pos+1, len(c.keys))) }
+func (c *memoryCursor) Prev() ([]byte, []byte)  { return c.at(max(c.pos-1, -1)) }
+
+func (c *memoryCursor) Seek(seek []byte) ([]byte, []byte) {
+	return c.at(sort.SearchStrings(c.keys, string(seek)))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
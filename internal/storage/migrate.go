@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"forgor/internal/crypto"
+	"forgor/internal/models"
+)
+
+// schemaVersion is the version of the on-disk layout this build writes.
+// Every change to the meta, vault, friends or sync buckets that older code
+// cannot read needs a new version and an entry in migrations.
+const schemaVersion = 4
+
+var ErrSchemaTooNew = errors.New("database was written by a newer version of forgor")
+
+// migrationContext carries the keys available to migrations that run at
+// unlock. kek is nil when unlocking with a recovery key, and vaultKey is
+// nil on schema 1 vaults until the wrapped key migration creates it.
+type migrationContext struct {
+	kek      []byte
+	vaultKey []byte
+}
+
+type migration struct {
+	// version is the schema version the database is at after apply.
+	version int
+	// needsKey defers the migration from Open to the next unlock.
+	needsKey bool
+	apply    func(tx Tx, mc *migrationContext) error
+}
+
+var migrations = []migration{
+	// Schema 1 encrypted data directly with the password-derived key.
+	// Schema 2 encrypts it with a random vault key wrapped by a key derived
+	// from the password, so changing the password only rewraps 32 bytes.
+	{version: 2, needsKey: true, apply: migrateWrappedKey},
+	// Schema 3 replaces the single vault blob with one record per entry.
+	{version: 3, needsKey: true, apply: migrateRecords},
+	// Schema 4 binds every ciphertext to its bucket and key with AEAD
+	// associated data, so values can no longer be swapped on disk.
+	{version: 4, needsKey: true, apply: migrateAssociatedData},
+}
+
+// SchemaVersion returns the schema version recorded in the database.
+func (s *Store) SchemaVersion() (int, error) {
+	var version int
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		version, err = readSchemaVersion(tx.Bucket(metaBucket))
+		return err
+	})
+	return version, err
+}
+
+func readSchemaVersion(meta Bucket) (int, error) {
+	data := meta.Get(keySchemaVersion)
+	if data == nil {
+		// Databases from before versioning are schema 1 unless they were
+		// never initialized, in which case there is nothing to migrate.
+		if meta.Get(keyVaultSalt) == nil {
+			return schemaVersion, nil
+		}
+		return 1, nil
+	}
+	version, err := strconv.Atoi(string(data))
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid schema version %q", data)
+	}
+	return version, nil
+}
+
+func putSchemaVersion(meta Bucket, version int) error {
+	return meta.Put(keySchemaVersion, []byte(strconv.Itoa(version)))
+}
+
+// migrate applies pending migrations in order. With a nil context it stops
+// at the first migration that needs the vault key; the rest run on unlock.
+func (s *Store) migrate(mc *migrationContext) error {
+	backedUp := false
+	for {
+		var version int
+		var initialized bool
+		err := s.backend.View(func(tx Tx) error {
+			meta := tx.Bucket(metaBucket)
+			initialized = meta.Get(keyVaultSalt) != nil
+			var err error
+			version, err = readSchemaVersion(meta)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if version > schemaVersion {
+			return fmt.Errorf("%w (schema %d, this build supports %d)", ErrSchemaTooNew, version, schemaVersion)
+		}
+		if version == schemaVersion {
+			return nil
+		}
+
+		// An empty database has nothing to convert.
+		if !initialized {
+			return s.backend.Update(func(tx Tx) error {
+				return putSchemaVersion(tx.Bucket(metaBucket), schemaVersion)
+			})
+		}
+
+		var next *migration
+		for i := range migrations {
+			if migrations[i].version > version {
+				next = &migrations[i]
+				break
+			}
+		}
+		if next == nil {
+			return fmt.Errorf("no migration from schema %d", version)
+		}
+		if next.needsKey && mc == nil {
+			return nil
+		}
+
+		if !backedUp {
+			if err := s.backup(version); err != nil {
+				return err
+			}
+			backedUp = true
+		}
+
+		err = s.backend.Update(func(tx Tx) error {
+			if err := next.apply(tx, mc); err != nil {
+				return err
+			}
+			return putSchemaVersion(tx.Bucket(metaBucket), next.version)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate schema %d to %d: %w", version, next.version, err)
+		}
+	}
+}
+
+// backup copies the database next to itself before it is migrated. A
+// backend without a file has nothing to keep.
+func (s *Store) backup(version int) error {
+	if s.backend.Path() == "" {
+		return nil
+	}
+	path := fmt.Sprintf("%s.schema%d.bak", s.backend.Path(), version)
+	if err := s.backend.CopyFile(path); err != nil {
+		return fmt.Errorf("failed to back up database before migrating: %w", err)
+	}
+	return nil
+}
+
+// migrateWrappedKey moves a schema 1 vault onto a random vault key wrapped
+// by the password-derived key, re-encrypting everything under the new key.
+func migrateWrappedKey(tx Tx, mc *migrationContext) error {
+	meta := tx.Bucket(metaBucket)
+	if meta.Get(keyVaultKeyWrapped) != nil {
+		return nil
+	}
+	if mc.kek == nil {
+		return fmt.Errorf("this vault must be unlocked with the master password first")
+	}
+
+	encryptedVault := tx.Bucket(vaultBucket).Get(keyVaultBlob)
+	if encryptedVault == nil {
+		return fmt.Errorf("vault not initialized")
+	}
+	if _, err := crypto.Decrypt(mc.kek, encryptedVault); err != nil {
+		return err
+	}
+
+	vaultKey, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	wrappedKey, err := seal(mc.kek, metaBucket, keyVaultKeyWrapped, vaultKey)
+	if err != nil {
+		wipe(vaultKey)
+		return err
+	}
+	if err := reencryptAll(tx, mc.kek, vaultKey); err != nil {
+		wipe(vaultKey)
+		return err
+	}
+	if err := meta.Put(keyVaultKeyWrapped, wrappedKey); err != nil {
+		wipe(vaultKey)
+		return err
+	}
+
+	mc.vaultKey = vaultKey
+	return nil
+}
+
+// migrateRecords splits the single vault blob into per-entry records.
+func migrateRecords(tx Tx, mc *migrationContext) error {
+	vault := tx.Bucket(vaultBucket)
+
+	ciphertext := vault.Get(keyVaultBlob)
+	if ciphertext == nil || vault.Get(keyVaultIndex) != nil {
+		return nil
+	}
+	plaintext, err := crypto.Decrypt(mc.vaultKey, ciphertext)
+	if err != nil {
+		return err
+	}
+	var entries []models.Entry
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return fmt.Errorf("failed to parse vault: %w", err)
+	}
+
+	index := vaultIndex{Records: make([]indexRecord, 0, len(entries))}
+	for _, entry := range entries {
+		rec, err := putRecord(vault, mc.vaultKey, entry)
+		if err != nil {
+			return err
+		}
+		index.Records = append(index.Records, rec)
+	}
+	if err := writeIndex(vault, mc.vaultKey, &index); err != nil {
+		return err
+	}
+	return vault.Delete(keyVaultBlob)
+}
+
+// migrateAssociatedData reseals everything encrypted with the vault key so
+// its AD names the bucket and key it lives under. Values that already
+// decrypt with their AD, such as records written by migrateRecords, are
+// left as they are. Wrapped vault keys are rewrapped by unwrapKey.
+func migrateAssociatedData(tx Tx, mc *migrationContext) error {
+	for _, name := range [][]byte{vaultBucket, historyBucket, syncPendingBucket} {
+		if err := bindBucket(tx.Bucket(name), name, mc.vaultKey); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if err := bindValue(tx.Bucket(friendsBucket), friendsBucket, keyFriendsBlob, mc.vaultKey); err != nil {
+		return fmt.Errorf("friends: %w", err)
+	}
+	if err := bindValue(tx.Bucket(metaBucket), metaBucket, keyDevicePrivKeyEnc, mc.vaultKey); err != nil {
+		return fmt.Errorf("device key: %w", err)
+	}
+	for _, key := range syncMetaEncryptedKeys {
+		if err := bindValue(tx.Bucket(syncMetaBucket), syncMetaBucket, key, mc.vaultKey); err != nil {
+			return fmt.Errorf("sync_meta %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func bindBucket(bucket Bucket, name, vaultKey []byte) error {
+	if bucket == nil {
+		return nil
+	}
+	var keys [][]byte
+	if err := bucket.ForEach(func(k, _ []byte) error {
+		keys = append(keys, copyBytes(k))
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := bindValue(bucket, name, key, vaultKey); err != nil {
+			return fmt.Errorf("%x: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func bindValue(bucket Bucket, name, key, vaultKey []byte) error {
+	if bucket == nil {
+		return nil
+	}
+	ciphertext := bucket.Get(key)
+	if ciphertext == nil {
+		return nil
+	}
+	if plaintext, err := unseal(vaultKey, name, key, ciphertext); err == nil {
+		wipe(plaintext)
+		return nil
+	}
+	plaintext, err := crypto.Decrypt(vaultKey, ciphertext)
+	if err != nil {
+		return err
+	}
+	defer wipe(plaintext)
+	sealed, err := seal(vaultKey, name, key, plaintext)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, sealed)
+}
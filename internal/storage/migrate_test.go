@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"forgor/internal/crypto"
+	"forgor/internal/models"
+)
+
+// writeLegacyVault replaces the contents of an empty store with a vault in
+// the layout of an older schema, encrypted without associated data.
+func writeLegacyVault(t *testing.T, s *Store, version int, entries []models.Entry) {
+	t.Helper()
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek := crypto.DeriveKeyWithParams(testPassword, salt, testKDFParams)
+	params, _ := json.Marshal(testKDFParams)
+	pub, priv, err := crypto.GenerateBoxKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entriesJSON, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypt := func(key, plaintext []byte) []byte {
+		ciphertext, err := crypto.Encrypt(key, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ciphertext
+	}
+
+	meta := map[string][]byte{
+		string(keyVaultSalt):    salt,
+		string(keyKDFParams):    params,
+		string(keyDeviceName):   []byte("legacy"),
+		string(keyDevicePubKey): pub[:],
+	}
+	vault := map[string][]byte{}
+
+	// Schema 1 encrypts everything with the KEK, later ones with a vault
+	// key wrapped by it.
+	dataKey := kek
+	if version >= 2 {
+		vaultKey, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta[string(keyVaultKeyWrapped)] = encrypt(kek, vaultKey)
+		meta[string(keySchemaVersion)] = []byte(strconv.Itoa(version))
+		dataKey = vaultKey
+	}
+	meta[string(keyDevicePrivKeyEnc)] = encrypt(dataKey, priv[:])
+
+	if version < 3 {
+		vault[string(keyVaultBlob)] = encrypt(dataKey, entriesJSON)
+	} else {
+		var index vaultIndex
+		for i, entry := range entries {
+			plaintext, _ := json.Marshal(entry)
+			recordID := strconv.Itoa(i)
+			vault[string(recordKey(recordID))] = encrypt(dataKey, plaintext)
+			index.Records = append(index.Records, indexRecord{EntryID: entry.ID, RecordID: recordID, Digest: recordDigest(plaintext)})
+		}
+		indexJSON, _ := json.Marshal(index)
+		vault[string(keyVaultIndex)] = encrypt(dataKey, indexJSON)
+	}
+
+	err = s.backend.Update(func(tx Tx) error {
+		if err := tx.Bucket(metaBucket).Delete(keySchemaVersion); err != nil {
+			return err
+		}
+		for bucket, values := range map[string]map[string][]byte{string(metaBucket): meta, string(vaultBucket): vault} {
+			for k, v := range values {
+				if err := tx.Bucket([]byte(bucket)).Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to write schema %d vault: %v", version, err)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	entries := []models.Entry{
+		{ID: "a", Website: "a.example", Username: "alice", Password: "1"},
+		{ID: "b", Website: "b.example", Username: "bob", Password: "2"},
+	}
+	for _, version := range []int{1, 2, 3} {
+		t.Run("schema"+strconv.Itoa(version), func(t *testing.T) {
+			s, err := OpenMemory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeLegacyVault(t, s, version, entries)
+			if got, _ := s.SchemaVersion(); got != version {
+				t.Fatalf("SchemaVersion before unlock = %d, want %d", got, version)
+			}
+
+			got, err := s.Unlock(testPassword)
+			if err != nil {
+				t.Fatalf("Unlock: %v", err)
+			}
+			if !equalStrings(entryIDs(got), entryIDs(entries)) {
+				t.Errorf("entries = %v, want %v", entryIDs(got), entryIDs(entries))
+			}
+			if got, _ := s.SchemaVersion(); got != schemaVersion {
+				t.Errorf("SchemaVersion after unlock = %d, want %d", got, schemaVersion)
+			}
+			if device, err := s.GetDevice(); err != nil {
+				t.Errorf("GetDevice: %v", err)
+			} else {
+				device.Destroy()
+			}
+
+			// Everything must now be bound to where it is stored.
+			vaultKey := s.mustSessionKey(t)
+			s.backend.View(func(tx Tx) error {
+				if tx.Bucket(vaultBucket).Get(keyVaultBlob) != nil {
+					t.Error("vault blob was not removed")
+				}
+				for id, key := range s.recordKeys(t) {
+					if _, err := unseal(vaultKey, vaultBucket, key, tx.Bucket(vaultBucket).Get(key)); err != nil {
+						t.Errorf("record %s is not bound to its key: %v", id, err)
+					}
+				}
+				privKeyEnc := tx.Bucket(metaBucket).Get(keyDevicePrivKeyEnc)
+				if _, err := unseal(vaultKey, metaBucket, keyDevicePrivKeyEnc, privKeyEnc); err != nil {
+					t.Errorf("device key is not bound to its key: %v", err)
+				}
+				return nil
+			})
+
+			s.Lock()
+			got, err = s.Unlock(testPassword)
+			if err != nil {
+				t.Fatalf("Unlock after migrating: %v", err)
+			}
+			if !equalStrings(entryIDs(got), entryIDs(entries)) {
+				t.Errorf("entries after relock = %v, want %v", entryIDs(got), entryIDs(entries))
+			}
+		})
+	}
+}
+
+func TestMigrationBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.db")
+	backup := path + ".schema1.bak"
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	entries := []models.Entry{{ID: "a", Website: "a.example", Password: "1"}}
+	writeLegacyVault(t, s, 1, entries)
+
+	// A wrong password is throttled like on a current vault and must not
+	// get as far as the backup.
+	if _, err := s.Unlock("wrong"); !errors.Is(err, crypto.ErrDecryptionFailed) {
+		t.Fatalf("Unlock with wrong password: got %v, want %v", err, crypto.ErrDecryptionFailed)
+	}
+	if n := s.FailedUnlocks(); n != 1 {
+		t.Errorf("FailedUnlocks = %d, want 1", n)
+	}
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		t.Errorf("backup written for a wrong password: %v", err)
+	}
+	if got, _ := s.SchemaVersion(); got != 1 {
+		t.Errorf("SchemaVersion after wrong password = %d, want 1", got)
+	}
+
+	if _, err := s.Unlock(testPassword); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if _, err := os.Stat(backup); err != nil {
+		t.Fatalf("no backup after migrating: %v", err)
+	}
+
+	// The backup is the database as it was before migrating.
+	old, err := Open(backup)
+	if err != nil {
+		t.Fatalf("Open backup: %v", err)
+	}
+	defer old.Close()
+	if got, _ := old.SchemaVersion(); got != 1 {
+		t.Errorf("backup SchemaVersion = %d, want 1", got)
+	}
+	got, err := old.Unlock(testPassword)
+	if err != nil {
+		t.Fatalf("Unlock backup: %v", err)
+	}
+	if !equalStrings(entryIDs(got), entryIDs(entries)) {
+		t.Errorf("backup entries = %v, want %v", entryIDs(got), entryIDs(entries))
+	}
+}
+
+func TestSchemaTooNew(t *testing.T) {
+	backend := NewMemoryBackend()
+	s, err := New(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initTestStore(t, s)
+	s.backend.Update(func(tx Tx) error {
+		return putSchemaVersion(tx.Bucket(metaBucket), schemaVersion+1)
+	})
+
+	if _, err := New(backend); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("New: got %v, want %v", err, ErrSchemaTooNew)
+	}
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// lockTimeout bounds how long Open and OpenReadOnly wait for the file lock
+// held by another forgor process.
+const lockTimeout = time.Second
+
+var ErrNeedsUpgrade = errors.New("vault needs to be upgraded; open it once with forgor first")
+
+// InUseError reports that another process holds the database open. PID is
+// read from the sidecar file that process wrote, and is 0 when unknown.
+type InUseError struct {
+	Path string
+	PID  int
+}
+
+func (e *InUseError) Error() string {
+	if e.PID > 0 {
+		return fmt.Sprintf("vault %s is in use by PID %d", e.Path, e.PID)
+	}
+	return fmt.Sprintf("vault %s is in use by another process", e.Path)
+}
+
+func pidPath(dbPath string) string {
+	return dbPath + ".pid"
+}
+
+// writePID records this process as the writer of dbPath, so others can
+// name it when they find the database locked.
+func writePID(dbPath string) error {
+	return os.WriteFile(pidPath(dbPath), []byte(strconv.Itoa(os.Getpid())+"\n"), 0600)
+}
+
+func inUse(dbPath string) *InUseError {
+	e := &InUseError{Path: dbPath}
+	if data, err := os.ReadFile(pidPath(dbPath)); err == nil {
+		e.PID, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	return e
+}
+
+// OpenReadOnly opens an existing vault without taking the writer's lock,
+// so it works while the app has the vault open. When a writer holds the
+// database, it reads a private copy taken now; writes always fail.
+func OpenReadOnly(dbPath string) (*Store, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("no vault at %s", dbPath)
+	}
+
+	backend := &boltBackend{path: dbPath}
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: lockTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		db, backend.snapshotPath, err = openSnapshot(dbPath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", inUse(dbPath), err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	backend.db = db
+	s := &Store{backend: backend}
+
+	if err := s.checkReadable(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// openSnapshot copies a database that another process is writing and opens
+// the copy. The copy is checked for consistency and retaken if a write
+// landed mid-copy.
+func openSnapshot(dbPath string) (*bolt.DB, string, error) {
+	var lastErr error
+	for attempt := 0; attempt < 3; attempt++ {
+		path, err := copyToTemp(dbPath)
+		if err != nil {
+			return nil, "", err
+		}
+		db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: lockTimeout})
+		if err == nil {
+			err = db.View(func(tx *bolt.Tx) error {
+				// Check reads pages from its own goroutine until it closes
+				// the channel, so drain it before the transaction ends.
+				var first error
+				for err := range tx.Check() {
+					if first == nil {
+						first = err
+					}
+				}
+				return first
+			})
+			if err == nil {
+				return db, path, nil
+			}
+			db.Close()
+		}
+		os.Remove(path)
+		lastErr = err
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil, "", fmt.Errorf("failed to take a consistent snapshot: %w", lastErr)
+}
+
+func copyToTemp(dbPath string) (string, error) {
+	src, err := os.Open(dbPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open database: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp("", "forgor-snapshot-*.db")
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return "", fmt.Errorf("failed to copy database: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return "", fmt.Errorf("failed to copy database: %w", err)
+	}
+	return dst.Name(), nil
+}
+
+// checkReadable refuses databases this build could only read after
+// migrating them, since a read-only store cannot migrate.
+func (s *Store) checkReadable() error {
+	return s.backend.View(func(tx Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta == nil || meta.Get(keyVaultSalt) == nil {
+			return fmt.Errorf("vault not initialized")
+		}
+		version, err := readSchemaVersion(meta)
+		if err != nil {
+			return err
+		}
+		if version > schemaVersion {
+			return fmt.Errorf("%w (schema %d, this build supports %d)", ErrSchemaTooNew, version, schemaVersion)
+		}
+		if version < schemaVersion {
+			return ErrNeedsUpgrade
+		}
+		return nil
+	})
+}
+
+// ReadOnly reports whether the store was opened with OpenReadOnly.
+func (s *Store) ReadOnly() bool {
+	return s.backend.ReadOnly()
+}
+
+// Snapshot reports whether a read-only store is reading a copy because
+// another process had the vault open.
+func (s *Store) Snapshot() bool {
+	b, ok := s.backend.(*boltBackend)
+	return ok && b.snapshotPath != ""
+}
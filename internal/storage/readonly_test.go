@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"forgor/internal/models"
+)
+
+// newTestFile initializes a vault at a temporary path holding entries and
+// returns the path with the writer still open.
+func newTestFile(t *testing.T, entries []models.Entry) (string, *Store) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "vault.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	initTestStore(t, s)
+	if err := s.SaveEntries(entries); err != nil {
+		t.Fatal(err)
+	}
+	return path, s
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	entries := []models.Entry{{ID: "a", Website: "a.example", Password: "1"}}
+	path, writer := newTestFile(t, entries)
+	writer.Close()
+
+	s, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly: %v", err)
+	}
+	defer s.Close()
+	if !s.ReadOnly() || s.Snapshot() {
+		t.Errorf("ReadOnly = %v, Snapshot = %v, want true, false", s.ReadOnly(), s.Snapshot())
+	}
+	got, err := s.Unlock(testPassword)
+	if err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if !equalStrings(entryIDs(got), entryIDs(entries)) {
+		t.Errorf("entries = %v, want %v", entryIDs(got), entryIDs(entries))
+	}
+	if err := s.SaveEntries(nil); err == nil {
+		t.Error("SaveEntries succeeded on a read-only vault")
+	}
+}
+
+func TestOpenReadOnlyWhileInUse(t *testing.T) {
+	entries := []models.Entry{{ID: "a", Website: "a.example", Password: "1"}}
+	path, writer := newTestFile(t, entries)
+
+	var inUse *InUseError
+	if _, err := Open(path); !errors.As(err, &inUse) || inUse.PID != os.Getpid() {
+		t.Errorf("second writer: got %v, want in use by PID %d", err, os.Getpid())
+	}
+
+	s, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly: %v", err)
+	}
+	if !s.Snapshot() {
+		t.Fatal("read-only open of a vault in use is not a snapshot")
+	}
+	snapshot := s.backend.(*boltBackend).snapshotPath
+
+	// Writes made after the snapshot was taken are not seen.
+	if err := writer.SaveEntries(nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Unlock(testPassword)
+	if err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if !equalStrings(entryIDs(got), entryIDs(entries)) {
+		t.Errorf("entries = %v, want %v", entryIDs(got), entryIDs(entries))
+	}
+
+	s.Close()
+	if _, err := os.Stat(snapshot); !os.IsNotExist(err) {
+		t.Errorf("snapshot %s left behind: %v", snapshot, err)
+	}
+}
+
+func TestOpenReadOnlyRefuses(t *testing.T) {
+	if _, err := OpenReadOnly(filepath.Join(t.TempDir(), "missing.db")); err == nil {
+		t.Error("OpenReadOnly succeeded without a vault")
+	}
+
+	path := filepath.Join(t.TempDir(), "vault.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if _, err := OpenReadOnly(path); err == nil {
+		t.Error("OpenReadOnly succeeded on an uninitialized vault")
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLegacyVault(t, s, 2, nil)
+	s.Close()
+	if _, err := OpenReadOnly(path); !errors.Is(err, ErrNeedsUpgrade) {
+		t.Errorf("OpenReadOnly of an old schema: got %v, want %v", err, ErrNeedsUpgrade)
+	}
+}
@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"forgor/internal/models"
+)
+
+// The vault bucket holds one ciphertext per entry under "r:<record id>" and
+// an encrypted index that maps entry IDs to record IDs in display order.
+// Record IDs are random so keys on disk reveal nothing about the entries.
+var (
+	keyVaultIndex   = []byte("index")
+	recordKeyPrefix = []byte("r:")
+)
+
+type vaultIndex struct {
+	Records []indexRecord `json:"records"`
+}
+
+type indexRecord struct {
+	EntryID  string `json:"entry_id"`
+	RecordID string `json:"record_id"`
+	// Digest is the SHA-256 of the record plaintext, used to skip
+	// rewriting records that did not change.
+	Digest string `json:"digest"`
+}
+
+func recordKey(recordID string) []byte {
+	return append(append([]byte{}, recordKeyPrefix...), recordID...)
+}
+
+func newRecordID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate record id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func recordDigest(plaintext []byte) string {
+	sum := sha256.Sum256(plaintext)
+	return hex.EncodeToString(sum[:])
+}
+
+// Entries returns the entries of an unlocked vault.
+func (s *Store) Entries() ([]models.Entry, error) {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(vaultKey)
+	return s.readEntries(vaultKey)
+}
+
+func (s *Store) readEntries(vaultKey []byte) ([]models.Entry, error) {
+	var entries []models.Entry
+	err := s.backend.View(func(tx Tx) error {
+		vault := tx.Bucket(vaultBucket)
+
+		index, err := loadIndex(vault, vaultKey)
+		if err != nil {
+			return err
+		}
+
+		entries = make([]models.Entry, 0, len(index.Records))
+		for _, rec := range index.Records {
+			// A damaged record is skipped rather than failing the whole
+			// vault. SaveEntries leaves it on disk for later repair.
+			entry, err := readRecord(vault, vaultKey, rec.RecordID)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *Store) SaveEntries(entries []models.Entry) error {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(vaultKey)
+
+	return s.backend.Update(func(tx Tx) error {
+		return saveEntries(tx, vaultKey, entries)
+	})
+}
+
+func saveEntries(tx Tx, vaultKey []byte, entries []models.Entry) error {
+	vault := tx.Bucket(vaultBucket)
+
+	index, err := loadIndex(vault, vaultKey)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string][]indexRecord, len(index.Records))
+	for _, rec := range index.Records {
+		existing[rec.EntryID] = append(existing[rec.EntryID], rec)
+	}
+
+	type pendingRecord struct {
+		rec       indexRecord
+		plaintext []byte
+		digest    string
+		dirty     bool
+	}
+	pending := make([]pendingRecord, 0, len(entries))
+	changed := 0
+	for _, entry := range entries {
+		plaintext, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to serialize entry: %w", err)
+		}
+		digest := recordDigest(plaintext)
+
+		var rec indexRecord
+		if recs := existing[entry.ID]; len(recs) > 0 {
+			rec = recs[0]
+			existing[entry.ID] = recs[1:]
+		} else {
+			recordID, err := newRecordID()
+			if err != nil {
+				return err
+			}
+			rec = indexRecord{EntryID: entry.ID, RecordID: recordID}
+		}
+
+		dirty := rec.Digest != digest || vault.Get(recordKey(rec.RecordID)) == nil
+		if dirty && rec.Digest != "" {
+			changed++
+		}
+		pending = append(pending, pendingRecord{rec: rec, plaintext: plaintext, digest: digest, dirty: dirty})
+	}
+
+	// Records whose entries are gone are deleted, except damaged ones,
+	// which the caller never saw and so cannot have meant to remove.
+	var removed, damaged []indexRecord
+	for _, recs := range existing {
+		for _, rec := range recs {
+			if vault.Get(recordKey(rec.RecordID)) != nil {
+				if _, err := readRecord(vault, vaultKey, rec.RecordID); err != nil {
+					damaged = append(damaged, rec)
+					continue
+				}
+			}
+			removed = append(removed, rec)
+		}
+	}
+
+	if len(index.Records) > 0 && shouldSnapshot(tx.Bucket(historyBucket), len(removed), changed) {
+		if err := snapshotIndex(tx, vaultKey, index); err != nil {
+			return fmt.Errorf("failed to save history: %w", err)
+		}
+	}
+
+	next := vaultIndex{Records: make([]indexRecord, 0, len(entries))}
+	for _, p := range pending {
+		if p.dirty {
+			ciphertext, err := seal(vaultKey, vaultBucket, recordKey(p.rec.RecordID), p.plaintext)
+			if err != nil {
+				return err
+			}
+			if err := vault.Put(recordKey(p.rec.RecordID), ciphertext); err != nil {
+				return err
+			}
+			p.rec.Digest = p.digest
+		}
+		next.Records = append(next.Records, p.rec)
+	}
+
+	next.Records = append(next.Records, damaged...)
+	for _, rec := range removed {
+		if err := vault.Delete(recordKey(rec.RecordID)); err != nil {
+			return err
+		}
+	}
+
+	// Damaged records may still refer to files, so nothing is pruned
+	// until they are repaired.
+	if len(damaged) == 0 {
+		if err := pruneAttachments(tx, vaultKey, entries); err != nil {
+			return fmt.Errorf("failed to prune attachments: %w", err)
+		}
+	}
+
+	return writeIndex(vault, vaultKey, &next)
+}
+
+func putRecord(vault Bucket, vaultKey []byte, entry models.Entry) (indexRecord, error) {
+	plaintext, err := json.Marshal(entry)
+	if err != nil {
+		return indexRecord{}, fmt.Errorf("failed to serialize entry: %w", err)
+	}
+	recordID, err := newRecordID()
+	if err != nil {
+		return indexRecord{}, err
+	}
+	ciphertext, err := seal(vaultKey, vaultBucket, recordKey(recordID), plaintext)
+	if err != nil {
+		return indexRecord{}, err
+	}
+	if err := vault.Put(recordKey(recordID), ciphertext); err != nil {
+		return indexRecord{}, err
+	}
+	return indexRecord{EntryID: entry.ID, RecordID: recordID, Digest: recordDigest(plaintext)}, nil
+}
+
+func readRecord(vault Bucket, vaultKey []byte, recordID string) (models.Entry, error) {
+	var entry models.Entry
+	ciphertext := vault.Get(recordKey(recordID))
+	if ciphertext == nil {
+		return entry, fmt.Errorf("record %s not found", recordID)
+	}
+	plaintext, err := unseal(vaultKey, vaultBucket, recordKey(recordID), ciphertext)
+	if err != nil {
+		return entry, err
+	}
+	if err := json.Unmarshal(plaintext, &entry); err != nil {
+		return entry, fmt.Errorf("failed to parse record %s: %w", recordID, err)
+	}
+	return entry, nil
+}
+
+// loadIndex decrypts the vault index. If the index itself is damaged it is
+// rebuilt from the records, which carry their own entry IDs.
+func loadIndex(vault Bucket, vaultKey []byte) (*vaultIndex, error) {
+	ciphertext := vault.Get(keyVaultIndex)
+	if ciphertext == nil {
+		if vault.Get(keyVaultBlob) != nil {
+			return nil, fmt.Errorf("vault records have not been migrated")
+		}
+		return nil, fmt.Errorf("vault not initialized")
+	}
+
+	plaintext, err := unseal(vaultKey, vaultBucket, keyVaultIndex, ciphertext)
+	if err == nil {
+		var index vaultIndex
+		if err := json.Unmarshal(plaintext, &index); err == nil {
+			return &index, nil
+		}
+	}
+
+	return rebuildIndex(vault, vaultKey)
+}
+
+func rebuildIndex(vault Bucket, vaultKey []byte) (*vaultIndex, error) {
+	var index vaultIndex
+	c := vault.Cursor()
+	for k, v := c.Seek(recordKeyPrefix); k != nil && bytes.HasPrefix(k, recordKeyPrefix); k, v = c.Next() {
+		plaintext, err := unseal(vaultKey, vaultBucket, k, v)
+		if err != nil {
+			continue
+		}
+		var entry models.Entry
+		if err := json.Unmarshal(plaintext, &entry); err != nil {
+			continue
+		}
+		index.Records = append(index.Records, indexRecord{
+			EntryID:  entry.ID,
+			RecordID: string(k[len(recordKeyPrefix):]),
+			Digest:   recordDigest(plaintext),
+		})
+	}
+	return &index, nil
+}
+
+func writeIndex(vault Bucket, vaultKey []byte, index *vaultIndex) error {
+	plaintext, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to serialize vault index: %w", err)
+	}
+	ciphertext, err := seal(vaultKey, vaultBucket, keyVaultIndex, plaintext)
+	if err != nil {
+		return err
+	}
+	return vault.Put(keyVaultIndex, ciphertext)
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"sort"
+	"testing"
+
+	"forgor/internal/crypto"
+	"forgor/internal/models"
+)
+
+// testKDFParams keeps Argon2id cheap so tests that unlock stay fast.
+var testKDFParams = crypto.KDFParams{Time: 1, Memory: 64, Threads: 1}
+
+const testPassword = "correct horse battery staple"
+
+// newTestStore returns an initialized, unlocked vault in memory.
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := OpenMemory()
+	if err != nil {
+		t.Fatalf("OpenMemory: %v", err)
+	}
+	initTestStore(t, s)
+	return s
+}
+
+func initTestStore(t *testing.T, s *Store) {
+	t.Helper()
+	if err := s.SetKDFParams(testKDFParams); err != nil {
+		t.Fatalf("SetKDFParams: %v", err)
+	}
+	if err := s.Initialize(testPassword, "test"); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if _, err := s.Unlock(testPassword); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+}
+
+func entryIDs(entries []models.Entry) []string {
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID + "=" + e.Password
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSaveEntries(t *testing.T) {
+	a := models.Entry{ID: "a", Website: "a.example", Password: "1"}
+	b := models.Entry{ID: "b", Website: "b.example", Password: "2"}
+	c := models.Entry{ID: "c", Website: "c.example", Password: "3"}
+	bEdited := b
+	bEdited.Password = "22"
+
+	s := newTestStore(t)
+	steps := []struct {
+		name    string
+		entries []models.Entry
+	}{
+		{"add", []models.Entry{a, b}},
+		{"add another", []models.Entry{a, b, c}},
+		{"edit", []models.Entry{a, bEdited, c}},
+		{"remove", []models.Entry{bEdited}},
+		{"empty", nil},
+		{"add back", []models.Entry{a, c}},
+	}
+	for _, step := range steps {
+		if err := s.SaveEntries(step.entries); err != nil {
+			t.Fatalf("%s: SaveEntries: %v", step.name, err)
+		}
+		got, err := s.Entries()
+		if err != nil {
+			t.Fatalf("%s: Entries: %v", step.name, err)
+		}
+		if want := entryIDs(step.entries); !equalStrings(entryIDs(got), want) {
+			t.Errorf("%s: got %v, want %v", step.name, entryIDs(got), want)
+		}
+
+		var records int
+		s.backend.View(func(tx Tx) error {
+			index, err := loadIndex(tx.Bucket(vaultBucket), s.mustSessionKey(t))
+			if err != nil {
+				t.Fatalf("%s: loadIndex: %v", step.name, err)
+			}
+			records = len(index.Records)
+			return nil
+		})
+		if records != len(step.entries) {
+			t.Errorf("%s: index has %d records, want %d", step.name, records, len(step.entries))
+		}
+	}
+}
+
+func TestSaveEntriesSkipsUnchangedRecords(t *testing.T) {
+	s := newTestStore(t)
+	a := models.Entry{ID: "a", Website: "a.example", Password: "1"}
+	b := models.Entry{ID: "b", Website: "b.example", Password: "2"}
+	if err := s.SaveEntries([]models.Entry{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	before := s.recordCiphertexts(t)
+
+	b.Password = "22"
+	if err := s.SaveEntries([]models.Entry{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	after := s.recordCiphertexts(t)
+
+	if before["a"] != after["a"] {
+		t.Error("unchanged record a was rewritten")
+	}
+	if before["b"] == after["b"] {
+		t.Error("changed record b was not rewritten")
+	}
+}
+
+func TestDamagedRecordIsSkippedAndKept(t *testing.T) {
+	s := newTestStore(t)
+	a := models.Entry{ID: "a", Website: "a.example", Password: "1"}
+	b := models.Entry{ID: "b", Website: "b.example", Password: "2"}
+	if err := s.SaveEntries([]models.Entry{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	damaged := s.recordKeys(t)["b"]
+	s.backend.Update(func(tx Tx) error {
+		return tx.Bucket(vaultBucket).Put(damaged, []byte("not a ciphertext"))
+	})
+
+	got, err := s.Entries()
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if want := entryIDs([]models.Entry{a}); !equalStrings(entryIDs(got), want) {
+		t.Errorf("got %v, want %v", entryIDs(got), want)
+	}
+
+	// Saving what Entries returned must not delete the damaged record.
+	if err := s.SaveEntries(got); err != nil {
+		t.Fatalf("SaveEntries: %v", err)
+	}
+	s.backend.View(func(tx Tx) error {
+		if tx.Bucket(vaultBucket).Get(damaged) == nil {
+			t.Error("damaged record was deleted")
+		}
+		return nil
+	})
+}
+
+func TestEntriesNeedUnlock(t *testing.T) {
+	s := newTestStore(t)
+	s.Lock()
+	if _, err := s.Entries(); err == nil {
+		t.Error("Entries succeeded on a locked vault")
+	}
+	if err := s.SaveEntries(nil); err == nil {
+		t.Error("SaveEntries succeeded on a locked vault")
+	}
+}
+
+func (s *Store) mustSessionKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := s.sessionKey()
+	if err != nil {
+		t.Fatalf("sessionKey: %v", err)
+	}
+	t.Cleanup(func() { wipe(key) })
+	return key
+}
+
+// recordKeys maps entry IDs to the keys of their records.
+func (s *Store) recordKeys(t *testing.T) map[string][]byte {
+	t.Helper()
+	keys := make(map[string][]byte)
+	s.backend.View(func(tx Tx) error {
+		index, err := loadIndex(tx.Bucket(vaultBucket), s.mustSessionKey(t))
+		if err != nil {
+			t.Fatalf("loadIndex: %v", err)
+		}
+		for _, rec := range index.Records {
+			keys[rec.EntryID] = recordKey(rec.RecordID)
+		}
+		return nil
+	})
+	return keys
+}
+
+func (s *Store) recordCiphertexts(t *testing.T) map[string]string {
+	t.Helper()
+	values := make(map[string]string)
+	keys := s.recordKeys(t)
+	s.backend.View(func(tx Tx) error {
+		for id, key := range keys {
+			values[id] = string(tx.Bucket(vaultBucket).Get(key))
+		}
+		return nil
+	})
+	return values
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 
 	"forgor/internal/crypto"
 	"forgor/internal/models"
+	"forgor/internal/secmem"
 
 	bolt "go.etcd.io/bbolt"
 )
@@ -20,20 +22,53 @@ var (
 
 	keySchemaVersion    = []byte("schema_version")
 	keyVaultSalt        = []byte("vault_salt")
+	keyKDFParams        = []byte("kdf_params")
+	keyVaultKeyWrapped  = []byte("vault_key_wrapped")
+	keyRecoverySalt     = []byte("recovery_salt")
+	keyRecoveryWrapped  = []byte("recovery_key_wrapped")
+	keyKeyfileRequired  = []byte("keyfile_required")
 	keyVaultBlob        = []byte("blob")
 	keyFriendsBlob      = []byte("blob")
 	keyDeviceName       = []byte("device_name")
 	keyDevicePubKey     = []byte("device_pubkey")
 	keyDevicePrivKeyEnc = []byte("device_privkey_enc")
+
+	// sync_meta and sync_pending are owned by the sync package, but their
+	// ciphertexts are sealed with the vault key and have to move with it.
+	syncMetaBucket    = []byte("sync_meta")
+	syncPendingBucket = []byte("sync_pending")
+
+	// Restoring a backup rewinds these; see resetRestoredSync.
+	syncEventHeadsBucket     = []byte("sync_event_heads")
+	syncPendingFoldersBucket = []byte("sync_pending_folders")
+	keySyncVaultID           = []byte("vault_id")
+	keySyncCursor            = []byte("sync_cursor")
+	keySyncResync            = []byte("resync_required")
+
+	syncMetaEncryptedKeys = [][]byte{
+		[]byte("privkey_sign_enc"),
+		[]byte("privkey_box_enc"),
+		[]byte("vault_key_enc"),
+	}
 )
 
-const schemaVersion = "1"
+var ErrKeyfileRequired = errors.New("this vault requires a keyfile")
 
 type Store struct {
-	db       *bolt.DB
-	dbPath   string
-	vaultKey []byte
-	mu       sync.RWMutex
+	backend Backend
+	// vaultKey is shared with the sync state and parents every secret
+	// decrypted with it, so Lock wipes them all.
+	vaultKey  *secmem.Buffer
+	kdfParams *crypto.KDFParams
+	// keyfileHash is the digest of the keyfile loaded for this session. It
+	// is mixed into the KEK when the vault requires a keyfile.
+	keyfileHash []byte
+	// failureLimit is a requested unlock failure limit, saved on unlock.
+	failureLimit *int
+	// trashRetention is a requested trash retention in days, saved on
+	// unlock.
+	trashRetention *int
+	mu             sync.RWMutex
 }
 
 func Open(dbPath string) (*Store, error) {
@@ -42,36 +77,58 @@ func Open(dbPath string) (*Store, error) {
 		return nil, fmt.Errorf("failed to create db directory: %w", err)
 	}
 
-	db, err := bolt.Open(dbPath, 0600, nil)
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: lockTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, inUse(dbPath)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	// The PID only makes the in-use error friendlier, so failing to write
+	// it is not fatal.
+	_ = writePID(dbPath)
 
-	s := &Store{db: db, dbPath: dbPath}
+	return New(&boltBackend{db: db, path: dbPath})
+}
+
+// New opens a vault kept in backend, creating its buckets and running the
+// migrations that do not need the vault key. The backend is closed on error.
+func New(backend Backend) (*Store, error) {
+	s := &Store{backend: backend}
 
 	if err := s.initBuckets(); err != nil {
-		db.Close()
+		s.Close()
 		return nil, err
 	}
 
+	if err := s.migrate(nil); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	if err := s.moveUnlockFailures(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to record unlock failures: %w", err)
+	}
+
 	return s, nil
 }
 
 func (s *Store) Close() error {
-	return s.db.Close()
+	return s.backend.Close()
 }
 
 func (s *Store) initBuckets() error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		for _, bucket := range [][]byte{metaBucket, vaultBucket, friendsBucket} {
+	return s.backend.Update(func(tx Tx) error {
+		for _, bucket := range [][]byte{metaBucket, vaultBucket, friendsBucket, historyBucket, attachmentsBucket, foldersBucket, usageBucket, trashBucket} {
 			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
 				return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
 			}
 		}
 
 		meta := tx.Bucket(metaBucket)
-		if meta.Get(keySchemaVersion) == nil {
-			if err := meta.Put(keySchemaVersion, []byte(schemaVersion)); err != nil {
+		if meta.Get(keySchemaVersion) == nil && meta.Get(keyVaultSalt) == nil {
+			if err := putSchemaVersion(meta, schemaVersion); err != nil {
 				return err
 			}
 		}
@@ -82,7 +139,7 @@ func (s *Store) initBuckets() error {
 
 func (s *Store) IsInitialized() bool {
 	var initialized bool
-	s.db.View(func(tx *bolt.Tx) error {
+	s.backend.View(func(tx Tx) error {
 		meta := tx.Bucket(metaBucket)
 		initialized = meta.Get(keyVaultSalt) != nil
 		return nil
@@ -96,35 +153,61 @@ func (s *Store) Initialize(masterPassword, deviceName string) error {
 		return err
 	}
 
-	vaultKey := crypto.DeriveKey(masterPassword, salt)
+	params := s.desiredKDFParams()
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
 
-	pub, priv, err := crypto.GenerateBoxKeyPair()
+	keyfile := s.loadedKeyfile()
+	kek, err := deriveKEK(masterPassword, salt, params, keyfile)
 	if err != nil {
 		return err
 	}
+	defer wipe(kek)
 
-	privKeyEnc, err := crypto.Encrypt(vaultKey, priv[:])
+	vaultKey, err := crypto.GenerateKey()
 	if err != nil {
 		return err
 	}
+	defer wipe(vaultKey)
 
-	emptyVault, err := json.Marshal([]models.Entry{})
+	wrappedKey, err := seal(kek, metaBucket, keyVaultKeyWrapped, vaultKey)
+	if err != nil {
+		return err
+	}
+
+	pub, priv, err := crypto.GenerateBoxKeyPair()
 	if err != nil {
 		return err
 	}
 
-	encryptedVault, err := crypto.Encrypt(vaultKey, emptyVault)
+	privKeyEnc, err := seal(vaultKey, metaBucket, keyDevicePrivKeyEnc, priv[:])
 	if err != nil {
 		return err
 	}
 
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.backend.Update(func(tx Tx) error {
 		meta := tx.Bucket(metaBucket)
 		vault := tx.Bucket(vaultBucket)
 
+		if err := putSchemaVersion(meta, schemaVersion); err != nil {
+			return err
+		}
 		if err := meta.Put(keyVaultSalt, salt); err != nil {
 			return err
 		}
+		if err := meta.Put(keyKDFParams, paramsJSON); err != nil {
+			return err
+		}
+		if err := meta.Put(keyVaultKeyWrapped, wrappedKey); err != nil {
+			return err
+		}
+		if keyfile != nil {
+			if err := meta.Put(keyKeyfileRequired, []byte("1")); err != nil {
+				return err
+			}
+		}
 		if err := meta.Put(keyDeviceName, []byte(deviceName)); err != nil {
 			return err
 		}
@@ -134,7 +217,7 @@ func (s *Store) Initialize(masterPassword, deviceName string) error {
 		if err := meta.Put(keyDevicePrivKeyEnc, privKeyEnc); err != nil {
 			return err
 		}
-		if err := vault.Put(keyVaultBlob, encryptedVault); err != nil {
+		if err := writeIndex(vault, vaultKey, &vaultIndex{}); err != nil {
 			return err
 		}
 
@@ -143,96 +226,590 @@ func (s *Store) Initialize(masterPassword, deviceName string) error {
 }
 
 func (s *Store) Unlock(masterPassword string) ([]models.Entry, error) {
-	var salt, encryptedVault []byte
+	vaultKey, params, err := s.openVaultKey(masterPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.readEntries(vaultKey)
+	if err != nil {
+		wipe(vaultKey)
+		return nil, err
+	}
 
-	err := s.db.View(func(tx *bolt.Tx) error {
+	// Strengthen the KDF in place when the caller asked for more than the
+	// vault currently uses. A failed upgrade leaves the old wrapping valid.
+	if desired, ok := s.requestedKDFParams(); ok && desired != params && desired.AtLeast(params) {
+		if keyfile, err := s.currentKeyfile(); err == nil {
+			_ = s.wrapVaultKey(vaultKey, masterPassword, desired, keyfile)
+		}
+	}
+
+	s.setVaultKey(vaultKey)
+	return entries, nil
+}
+
+// openVaultKey derives the KEK from masterPassword (and the keyfile, when
+// required) and unwraps the vault key, running any migrations that were
+// waiting for it. Wrong passwords count towards the unlock backoff.
+func (s *Store) openVaultKey(masterPassword string) ([]byte, crypto.KDFParams, error) {
+	var salt, wrappedKey, legacyVault []byte
+	var params crypto.KDFParams
+
+	keyfile, err := s.currentKeyfile()
+	if err != nil {
+		return nil, params, err
+	}
+	if err := s.checkUnlockAllowed(); err != nil {
+		return nil, params, err
+	}
+
+	err = s.backend.View(func(tx Tx) error {
 		meta := tx.Bucket(metaBucket)
-		vault := tx.Bucket(vaultBucket)
 
 		salt = copyBytes(meta.Get(keyVaultSalt))
-		encryptedVault = copyBytes(vault.Get(keyVaultBlob))
-		return nil
+		wrappedKey = copyBytes(meta.Get(keyVaultKeyWrapped))
+		if wrappedKey == nil {
+			legacyVault = copyBytes(tx.Bucket(vaultBucket).Get(keyVaultBlob))
+		}
+
+		var err error
+		params, err = readKDFParams(meta)
+		return err
 	})
 	if err != nil {
-		return nil, err
+		return nil, params, err
 	}
-
-	if salt == nil || encryptedVault == nil {
-		return nil, fmt.Errorf("vault not initialized")
+	if salt == nil {
+		return nil, params, fmt.Errorf("vault not initialized")
 	}
 
-	vaultKey := crypto.DeriveKey(masterPassword, salt)
-
-	plaintext, err := crypto.Decrypt(vaultKey, encryptedVault)
+	kek, err := deriveKEK(masterPassword, salt, params, keyfile)
 	if err != nil {
-		return nil, err
+		return nil, params, err
+	}
+	defer wipe(kek)
+
+	mc := &migrationContext{kek: kek}
+	if wrappedKey != nil {
+		mc.vaultKey, err = s.unwrapKey(kek, keyVaultKeyWrapped, wrappedKey)
+	} else if legacyVault != nil {
+		// Schema 1 vaults have no wrapped key yet. Check the password against
+		// the vault itself so a wrong one is throttled and never reaches the
+		// migration, which would back up the database first.
+		var plaintext []byte
+		plaintext, err = crypto.Decrypt(kek, legacyVault)
+		wipe(plaintext)
+	}
+	if errors.Is(err, crypto.ErrDecryptionFailed) {
+		if recErr := s.recordUnlockFailure(); recErr != nil {
+			return nil, params, fmt.Errorf("failed to record unlock failure: %w", recErr)
+		}
+	}
+	if err != nil {
+		return nil, params, err
 	}
 
-	var entries []models.Entry
-	if err := json.Unmarshal(plaintext, &entries); err != nil {
-		return nil, fmt.Errorf("failed to parse vault: %w", err)
+	if err := s.migrate(mc); err != nil {
+		wipe(mc.vaultKey)
+		return nil, params, err
+	}
+	if mc.vaultKey == nil {
+		return nil, params, fmt.Errorf("vault key missing")
 	}
+	_ = s.unlockSucceeded()
+	return mc.vaultKey, params, nil
+}
 
+// Lock destroys the vault key and every secret derived from it, including
+// the copies held by the sync state and the device returned by GetDevice.
+func (s *Store) Lock() {
 	s.mu.Lock()
-	s.vaultKey = vaultKey
-	s.mu.Unlock()
-	return entries, nil
+	defer s.mu.Unlock()
+	s.vaultKey.Destroy()
+	s.vaultKey = nil
 }
 
-func (s *Store) Lock() {
+// setVaultKey moves vaultKey into guarded memory and wipes the slice.
+func (s *Store) setVaultKey(vaultKey []byte) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	for i := range s.vaultKey {
-		s.vaultKey[i] = 0
+	s.vaultKey.Destroy()
+	s.vaultKey = secmem.FromBytes(vaultKey)
+}
+
+// sessionKey returns a copy of the unlocked vault key for a single
+// operation, so a concurrent Lock cannot zero it mid-use. Callers wipe it.
+func (s *Store) sessionKey() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.vaultKey == nil {
+		return nil, fmt.Errorf("vault is locked")
 	}
-	s.vaultKey = nil
+	key, err := s.vaultKey.Copy()
+	if err != nil {
+		return nil, fmt.Errorf("vault is locked")
+	}
+	return key, nil
 }
 
-func (s *Store) IsUnlocked() bool {
+// SetKDFParams sets the Argon2id parameters used for new vaults and password
+// changes. Existing vaults with weaker parameters are upgraded on unlock.
+func (s *Store) SetKDFParams(params crypto.KDFParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.kdfParams = &params
+	s.mu.Unlock()
+	return nil
+}
+
+// KDFParams returns the parameters the vault on disk is currently using.
+func (s *Store) KDFParams() (crypto.KDFParams, error) {
+	var params crypto.KDFParams
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		params, err = readKDFParams(tx.Bucket(metaBucket))
+		return err
+	})
+	return params, err
+}
+
+func (s *Store) desiredKDFParams() crypto.KDFParams {
+	if params, ok := s.requestedKDFParams(); ok {
+		return params
+	}
+	return crypto.DefaultKDFParams()
+}
+
+func (s *Store) requestedKDFParams() (crypto.KDFParams, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.vaultKey != nil
+	if s.kdfParams == nil {
+		return crypto.KDFParams{}, false
+	}
+	return *s.kdfParams, true
+}
+
+func readKDFParams(meta Bucket) (crypto.KDFParams, error) {
+	data := meta.Get(keyKDFParams)
+	if data == nil {
+		return crypto.DefaultKDFParams(), nil
+	}
+	var params crypto.KDFParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return params, fmt.Errorf("failed to parse kdf params: %w", err)
+	}
+	if err := params.Validate(); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// ChangeMasterPassword rewraps the vault key under a KEK derived from
+// newPassword with a fresh salt. The data itself is not re-encrypted.
+func (s *Store) ChangeMasterPassword(oldPassword, newPassword string) error {
+	vaultKey, params, err := s.openVaultKey(oldPassword)
+	if err != nil {
+		return err
+	}
+	defer wipe(vaultKey)
+
+	if desired, ok := s.requestedKDFParams(); ok {
+		params = desired
+	}
+
+	keyfile, err := s.currentKeyfile()
+	if err != nil {
+		return err
+	}
+
+	return s.wrapVaultKey(vaultKey, newPassword, params, keyfile)
+}
+
+// wrapVaultKey derives a new KEK from password, and keyfile when it is not
+// nil, with a fresh salt and the given parameters and stores vaultKey
+// wrapped under it.
+func (s *Store) wrapVaultKey(vaultKey []byte, password string, params crypto.KDFParams, keyfile []byte) error {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return err
+	}
+	kek, err := deriveKEK(password, salt, params, keyfile)
+	if err != nil {
+		return err
+	}
+	defer wipe(kek)
+
+	wrappedKey, err := seal(kek, metaBucket, keyVaultKeyWrapped, vaultKey)
+	if err != nil {
+		return err
+	}
+
+	return s.backend.Update(func(tx Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if err := meta.Put(keyVaultSalt, salt); err != nil {
+			return err
+		}
+		if err := meta.Put(keyKDFParams, paramsJSON); err != nil {
+			return err
+		}
+		if keyfile != nil {
+			if err := meta.Put(keyKeyfileRequired, []byte("1")); err != nil {
+				return err
+			}
+		} else if err := meta.Delete(keyKeyfileRequired); err != nil {
+			return err
+		}
+		return meta.Put(keyVaultKeyWrapped, wrappedKey)
+	})
+}
+
+func deriveKEK(password string, salt []byte, params crypto.KDFParams, keyfile []byte) ([]byte, error) {
+	kek := crypto.DeriveKeyWithParams(password, salt, params)
+	if keyfile == nil {
+		return kek, nil
+	}
+	defer wipe(kek)
+	return crypto.MixKeyfile(kek, keyfile)
+}
+
+// LoadKeyfile reads the keyfile at path for this session. It is used to
+// unlock vaults that require one and is bound to new vaults on Initialize.
+func (s *Store) LoadKeyfile(path string) error {
+	hash, err := hashKeyfile(path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	wipe(s.keyfileHash)
+	s.keyfileHash = hash
+	s.mu.Unlock()
+	return nil
 }
 
-func (s *Store) SaveEntries(entries []models.Entry) error {
+func (s *Store) HasKeyfile() bool {
 	s.mu.RLock()
-	if s.vaultKey == nil {
-		s.mu.RUnlock()
-		return fmt.Errorf("vault is locked")
+	defer s.mu.RUnlock()
+	return s.keyfileHash != nil
+}
+
+func (s *Store) KeyfileRequired() bool {
+	var required bool
+	s.backend.View(func(tx Tx) error {
+		required = tx.Bucket(metaBucket).Get(keyKeyfileRequired) != nil
+		return nil
+	})
+	return required
+}
+
+// RequireKeyfile binds the vault to the keyfile at path, so unlocking needs
+// both masterPassword and the file. An existing binding is replaced.
+func (s *Store) RequireKeyfile(masterPassword, path string) error {
+	hash, err := hashKeyfile(path)
+	if err != nil {
+		return err
 	}
-	// Copy the key bytes, not just the slice header
-	vaultKey := make([]byte, len(s.vaultKey))
-	copy(vaultKey, s.vaultKey)
-	s.mu.RUnlock()
 
-	plaintext, err := json.Marshal(entries)
+	vaultKey, params, err := s.openVaultKey(masterPassword)
 	if err != nil {
-		return fmt.Errorf("failed to serialize entries: %w", err)
+		wipe(hash)
+		return err
 	}
+	defer wipe(vaultKey)
 
-	ciphertext, err := crypto.Encrypt(vaultKey, plaintext)
+	if err := s.wrapVaultKey(vaultKey, masterPassword, params, hash); err != nil {
+		wipe(hash)
+		return err
+	}
+
+	s.mu.Lock()
+	wipe(s.keyfileHash)
+	s.keyfileHash = hash
+	s.mu.Unlock()
+	return nil
+}
+
+// RemoveKeyfile drops the keyfile requirement. The currently required
+// keyfile must be loaded to prove possession.
+func (s *Store) RemoveKeyfile(masterPassword string) error {
+	vaultKey, params, err := s.openVaultKey(masterPassword)
 	if err != nil {
 		return err
 	}
+	defer wipe(vaultKey)
 
-	return s.db.Update(func(tx *bolt.Tx) error {
-		vault := tx.Bucket(vaultBucket)
-		return vault.Put(keyVaultBlob, ciphertext)
+	return s.wrapVaultKey(vaultKey, masterPassword, params, nil)
+}
+
+func (s *Store) loadedKeyfile() []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyBytes(s.keyfileHash)
+}
+
+// currentKeyfile returns the keyfile digest to mix into the KEK, or nil when
+// the vault does not require one.
+func (s *Store) currentKeyfile() ([]byte, error) {
+	if !s.KeyfileRequired() {
+		return nil, nil
+	}
+	keyfile := s.loadedKeyfile()
+	if keyfile == nil {
+		return nil, ErrKeyfileRequired
+	}
+	return keyfile, nil
+}
+
+func hashKeyfile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keyfile: %w", err)
+	}
+	defer f.Close()
+	return crypto.HashKeyfile(f)
+}
+
+// GenerateRecoveryKey creates a new recovery code and stores a second copy of
+// the vault key wrapped by it, replacing any previous recovery key. The code
+// is returned once and never stored.
+func (s *Store) GenerateRecoveryKey() (string, error) {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return "", err
+	}
+	defer wipe(vaultKey)
+
+	code, err := crypto.GenerateRecoveryCode()
+	if err != nil {
+		return "", err
+	}
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return "", err
+	}
+	kek, err := crypto.DeriveRecoveryKey(code, salt)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(kek)
+
+	wrappedKey, err := seal(kek, metaBucket, keyRecoveryWrapped, vaultKey)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.backend.Update(func(tx Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if err := meta.Put(keyRecoverySalt, salt); err != nil {
+			return err
+		}
+		return meta.Put(keyRecoveryWrapped, wrappedKey)
 	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save recovery key: %w", err)
+	}
+	return code, nil
 }
 
+func (s *Store) HasRecoveryKey() bool {
+	var ok bool
+	s.backend.View(func(tx Tx) error {
+		ok = tx.Bucket(metaBucket).Get(keyRecoveryWrapped) != nil
+		return nil
+	})
+	return ok
+}
+
+// UnlockWithRecoveryKey unlocks the vault with a recovery code instead of the
+// master password. Callers should follow up with ResetMasterPassword.
+func (s *Store) UnlockWithRecoveryKey(code string) ([]models.Entry, error) {
+	var salt, wrappedKey []byte
+	err := s.backend.View(func(tx Tx) error {
+		meta := tx.Bucket(metaBucket)
+		salt = copyBytes(meta.Get(keyRecoverySalt))
+		wrappedKey = copyBytes(meta.Get(keyRecoveryWrapped))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if wrappedKey == nil {
+		return nil, fmt.Errorf("no recovery key is set up for this vault")
+	}
+
+	kek, err := crypto.DeriveRecoveryKey(code, salt)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(kek)
+
+	vaultKey, err := s.unwrapKey(kek, keyRecoveryWrapped, wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.migrate(&migrationContext{vaultKey: vaultKey}); err != nil {
+		wipe(vaultKey)
+		return nil, err
+	}
+
+	entries, err := s.readEntries(vaultKey)
+	if err != nil {
+		wipe(vaultKey)
+		return nil, err
+	}
+	_ = s.unlockSucceeded()
+
+	s.setVaultKey(vaultKey)
+	return entries, nil
+}
+
+// ResetMasterPassword rewraps the unlocked vault key under newPassword
+// without needing the old one. It is used after a recovery key unlock.
+func (s *Store) ResetMasterPassword(newPassword string) error {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(vaultKey)
+
+	params, err := s.KDFParams()
+	if err != nil {
+		return err
+	}
+	if desired, ok := s.requestedKDFParams(); ok {
+		params = desired
+	}
+
+	// The recovery key is meant to work when every other factor is lost,
+	// so a missing keyfile drops the requirement instead of failing.
+	keyfile, err := s.currentKeyfile()
+	if errors.Is(err, ErrKeyfileRequired) {
+		keyfile = nil
+	} else if err != nil {
+		return err
+	}
+
+	return s.wrapVaultKey(vaultKey, newPassword, params, keyfile)
+}
+
+// unwrapKey opens a wrapped vault key stored in meta under name. Keys wrapped
+// before ciphertexts were bound to their location are still accepted, since
+// each KEK wraps only this one value, and are rewrapped with their AD.
+func (s *Store) unwrapKey(kek, name, wrappedKey []byte) ([]byte, error) {
+	vaultKey, err := unseal(kek, metaBucket, name, wrappedKey)
+	if err == nil {
+		return vaultKey, nil
+	}
+	vaultKey, err = crypto.Decrypt(kek, wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	if rewrapped, err := seal(kek, metaBucket, name, vaultKey); err == nil {
+		_ = s.backend.Update(func(tx Tx) error {
+			return tx.Bucket(metaBucket).Put(name, rewrapped)
+		})
+	}
+	return vaultKey, nil
+}
+
+// reencryptAll moves every ciphertext sealed with oldKey over to newKey.
+// It predates associated data and is only used by the schema 2 migration.
+func reencryptAll(tx Tx, oldKey, newKey []byte) error {
+	if err := reencryptBucket(tx.Bucket(vaultBucket), oldKey, newKey); err != nil {
+		return fmt.Errorf("vault: %w", err)
+	}
+	if err := reencryptValue(tx.Bucket(friendsBucket), keyFriendsBlob, oldKey, newKey); err != nil {
+		return fmt.Errorf("friends: %w", err)
+	}
+	if err := reencryptBucket(tx.Bucket(historyBucket), oldKey, newKey); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	if err := reencryptValue(tx.Bucket(metaBucket), keyDevicePrivKeyEnc, oldKey, newKey); err != nil {
+		return fmt.Errorf("device key: %w", err)
+	}
+
+	if syncMeta := tx.Bucket(syncMetaBucket); syncMeta != nil {
+		for _, key := range syncMetaEncryptedKeys {
+			if err := reencryptValue(syncMeta, key, oldKey, newKey); err != nil {
+				return fmt.Errorf("sync_meta %s: %w", key, err)
+			}
+		}
+	}
+
+	if err := reencryptBucket(tx.Bucket(syncPendingBucket), oldKey, newKey); err != nil {
+		return fmt.Errorf("sync_pending: %w", err)
+	}
+
+	return nil
+}
+
+func reencryptBucket(bucket Bucket, oldKey, newKey []byte) error {
+	if bucket == nil {
+		return nil
+	}
+	var keys [][]byte
+	if err := bucket.ForEach(func(k, _ []byte) error {
+		keys = append(keys, copyBytes(k))
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := reencryptValue(bucket, key, oldKey, newKey); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func reencryptValue(bucket Bucket, key, oldKey, newKey []byte) error {
+	if bucket == nil {
+		return nil
+	}
+	ciphertext := bucket.Get(key)
+	if ciphertext == nil {
+		return nil
+	}
+	plaintext, err := crypto.Decrypt(oldKey, ciphertext)
+	if err != nil {
+		return err
+	}
+	defer wipe(plaintext)
+	resealed, err := crypto.Encrypt(newKey, plaintext)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, resealed)
+}
+
+func (s *Store) IsUnlocked() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.vaultKey != nil
+}
+
+// GetDevice returns this device. Its private key is derived from the vault
+// key and is wiped by Lock; callers may Destroy it sooner.
 func (s *Store) GetDevice() (*models.Device, error) {
 	s.mu.RLock()
-	if s.vaultKey == nil {
-		s.mu.RUnlock()
+	session := s.vaultKey
+	s.mu.RUnlock()
+
+	vaultKey, err := session.Copy()
+	if err != nil {
 		return nil, fmt.Errorf("vault is locked")
 	}
-	vaultKey := make([]byte, len(s.vaultKey))
-	copy(vaultKey, s.vaultKey)
-	s.mu.RUnlock()
+	defer wipe(vaultKey)
 
 	var device models.Device
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err = s.backend.View(func(tx Tx) error {
 		meta := tx.Bucket(metaBucket)
 
 		nameBytes := meta.Get(keyDeviceName)
@@ -247,12 +824,17 @@ func (s *Store) GetDevice() (*models.Device, error) {
 
 		privKeyEnc := meta.Get(keyDevicePrivKeyEnc)
 		if privKeyEnc != nil {
-			privKeyPlain, err := crypto.Decrypt(vaultKey, privKeyEnc)
+			privKeyPlain, err := unseal(vaultKey, metaBucket, keyDevicePrivKeyEnc, privKeyEnc)
 			if err != nil {
 				return fmt.Errorf("failed to decrypt device private key: %w", err)
 			}
-			if len(privKeyPlain) == 32 {
-				copy(device.PrivKey[:], privKeyPlain)
+			if len(privKeyPlain) != 32 {
+				wipe(privKeyPlain)
+				return fmt.Errorf("invalid device private key length")
+			}
+			device.PrivKey, err = session.Derive(privKeyPlain)
+			if err != nil {
+				return fmt.Errorf("vault is locked")
 			}
 		}
 
@@ -288,26 +870,23 @@ func (s *Store) SaveFriend(friend models.Friend) error {
 }
 
 func (s *Store) saveFriends(friends []models.Friend) error {
-	s.mu.RLock()
-	if s.vaultKey == nil {
-		s.mu.RUnlock()
-		return fmt.Errorf("vault is locked")
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return err
 	}
-	vaultKey := make([]byte, len(s.vaultKey))
-	copy(vaultKey, s.vaultKey)
-	s.mu.RUnlock()
+	defer wipe(vaultKey)
 
 	plaintext, err := json.Marshal(friends)
 	if err != nil {
 		return fmt.Errorf("failed to serialize friends: %w", err)
 	}
 
-	ciphertext, err := crypto.Encrypt(vaultKey, plaintext)
+	ciphertext, err := seal(vaultKey, friendsBucket, keyFriendsBlob, plaintext)
 	if err != nil {
 		return err
 	}
 
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.backend.Update(func(tx Tx) error {
 		bucket := tx.Bucket(friendsBucket)
 		return bucket.Put(keyFriendsBlob, ciphertext)
 	})
@@ -328,17 +907,14 @@ func (s *Store) GetFriend(fingerprint string) (*models.Friend, error) {
 }
 
 func (s *Store) GetAllFriends() ([]models.Friend, error) {
-	s.mu.RLock()
-	if s.vaultKey == nil {
-		s.mu.RUnlock()
-		return nil, fmt.Errorf("vault is locked")
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return nil, err
 	}
-	vaultKey := make([]byte, len(s.vaultKey))
-	copy(vaultKey, s.vaultKey)
-	s.mu.RUnlock()
+	defer wipe(vaultKey)
 
 	var encryptedFriends []byte
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err = s.backend.View(func(tx Tx) error {
 		bucket := tx.Bucket(friendsBucket)
 		encryptedFriends = copyBytes(bucket.Get(keyFriendsBlob))
 		return nil
@@ -351,7 +927,7 @@ func (s *Store) GetAllFriends() ([]models.Friend, error) {
 		return []models.Friend{}, nil
 	}
 
-	plaintext, err := crypto.Decrypt(vaultKey, encryptedFriends)
+	plaintext, err := unseal(vaultKey, friendsBucket, keyFriendsBlob, encryptedFriends)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt friends: %w", err)
 	}
@@ -381,12 +957,28 @@ func (s *Store) DeleteFriend(fingerprint string) error {
 }
 
 func (s *Store) UpdateDeviceName(name string) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.backend.Update(func(tx Tx) error {
 		meta := tx.Bucket(metaBucket)
 		return meta.Put(keyDeviceName, []byte(name))
 	})
 }
 
+// seal encrypts a value that will be stored under name in bucket, binding
+// the ciphertext to that location.
+func seal(key, bucket, name, plaintext []byte) ([]byte, error) {
+	return crypto.EncryptWithAD(key, plaintext, crypto.StorageAD(bucket, name))
+}
+
+func unseal(key, bucket, name, ciphertext []byte) ([]byte, error) {
+	return crypto.DecryptWithAD(key, ciphertext, crypto.StorageAD(bucket, name))
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
 func copyBytes(b []byte) []byte {
 	if b == nil {
 		return nil
@@ -396,12 +988,25 @@ func copyBytes(b []byte) []byte {
 	return c
 }
 
-func (s *Store) GetDB() *bolt.DB {
-	return s.db
+// SyncView runs fn in a read transaction that only reaches the sync
+// package's buckets, the ones named sync_*.
+func (s *Store) SyncView(fn func(tx Tx) error) error {
+	return s.backend.View(func(tx Tx) error {
+		return fn(syncTx{tx})
+	})
+}
+
+// SyncUpdate is SyncView for writes.
+func (s *Store) SyncUpdate(fn func(tx Tx) error) error {
+	return s.backend.Update(func(tx Tx) error {
+		return fn(syncTx{tx})
+	})
 }
 
-func (s *Store) GetVaultKey() []byte {
+// VaultKey returns the guarded vault key shared with the sync state, or nil
+// while locked. It is destroyed by Lock and must not be destroyed by callers.
+func (s *Store) VaultKey() *secmem.Buffer {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return copyBytes(s.vaultKey)
+	return s.vaultKey
 }
@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"forgor/internal/crypto"
+	"forgor/internal/models"
+)
+
+func TestSwappedRecordsDoNotDecrypt(t *testing.T) {
+	s := newTestStore(t)
+	entries := []models.Entry{
+		{ID: "a", Website: "a.example", Password: "1"},
+		{ID: "b", Website: "b.example", Password: "2"},
+	}
+	if err := s.SaveEntries(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	// Copy a's record over b's. Without associated data the vault would
+	// now hold a twice.
+	keys := s.recordKeys(t)
+	s.backend.Update(func(tx Tx) error {
+		vault := tx.Bucket(vaultBucket)
+		return vault.Put(keys["b"], copyBytes(vault.Get(keys["a"])))
+	})
+
+	got, err := s.Entries()
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if want := entryIDs(entries[:1]); !equalStrings(entryIDs(got), want) {
+		t.Errorf("got %v, want %v", entryIDs(got), want)
+	}
+}
+
+func TestUnwrapKey(t *testing.T) {
+	vaultKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKEK, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, err := seal(kek, metaBucket, keyVaultKeyWrapped, vaultKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unbound, err := crypto.Encrypt(kek, vaultKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elsewhere, err := seal(kek, metaBucket, keyRecoveryWrapped, vaultKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		wrapped []byte
+		kek     []byte
+		wantErr error
+		// rewrapped is whether the stored key must afterwards be bound.
+		rewrapped bool
+	}{
+		{name: "bound", wrapped: bound, kek: kek, rewrapped: true},
+		{name: "no ad falls back and rewraps", wrapped: unbound, kek: kek, rewrapped: true},
+		{name: "bound, wrong kek", wrapped: bound, kek: wrongKEK, wantErr: crypto.ErrDecryptionFailed},
+		{name: "no ad, wrong kek", wrapped: unbound, kek: wrongKEK, wantErr: crypto.ErrDecryptionFailed},
+		{name: "bound to another key", wrapped: elsewhere, kek: kek, wantErr: crypto.ErrDecryptionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := OpenMemory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.backend.Update(func(tx Tx) error {
+				return tx.Bucket(metaBucket).Put(keyVaultKeyWrapped, tt.wrapped)
+			})
+
+			got, err := s.unwrapKey(tt.kek, keyVaultKeyWrapped, tt.wrapped)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unwrapKey: %v", err)
+			}
+			if !bytes.Equal(got, vaultKey) {
+				t.Error("unwrapped the wrong key")
+			}
+
+			var stored []byte
+			s.backend.View(func(tx Tx) error {
+				stored = copyBytes(tx.Bucket(metaBucket).Get(keyVaultKeyWrapped))
+				return nil
+			})
+			_, err = unseal(tt.kek, metaBucket, keyVaultKeyWrapped, stored)
+			if tt.rewrapped && err != nil {
+				t.Errorf("stored key is not bound: %v", err)
+			}
+		})
+	}
+}
+
+func TestChangeMasterPassword(t *testing.T) {
+	s := newTestStore(t)
+	entries := []models.Entry{{ID: "a", Website: "a.example", Password: "1"}}
+	if err := s.SaveEntries(entries); err != nil {
+		t.Fatal(err)
+	}
+	friend := models.Friend{Name: "bob", Fingerprint: "fp"}
+	if err := s.SaveFriend(friend); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ChangeMasterPassword("wrong", "new password"); !errors.Is(err, crypto.ErrDecryptionFailed) {
+		t.Fatalf("ChangeMasterPassword with the wrong password: got %v, want %v", err, crypto.ErrDecryptionFailed)
+	}
+	if n := s.FailedUnlocks(); n != 1 {
+		t.Errorf("FailedUnlocks = %d, want 1", n)
+	}
+	if err := s.ChangeMasterPassword(testPassword, "new password"); err != nil {
+		t.Fatalf("ChangeMasterPassword: %v", err)
+	}
+
+	s.Lock()
+	if _, err := s.Unlock(testPassword); !errors.Is(err, crypto.ErrDecryptionFailed) {
+		t.Errorf("Unlock with the old password: got %v, want %v", err, crypto.ErrDecryptionFailed)
+	}
+	got, err := s.Unlock("new password")
+	if err != nil {
+		t.Fatalf("Unlock with the new password: %v", err)
+	}
+	if !equalStrings(entryIDs(got), entryIDs(entries)) {
+		t.Errorf("entries = %v, want %v", entryIDs(got), entryIDs(entries))
+	}
+	if _, err := s.GetFriend(friend.Fingerprint); err != nil {
+		t.Errorf("GetFriend: %v", err)
+	}
+	device, err := s.GetDevice()
+	if err != nil {
+		t.Fatalf("GetDevice: %v", err)
+	}
+	device.Destroy()
+}
+
+func TestVaultKeyIsWrapped(t *testing.T) {
+	a, b := newTestStore(t), newTestStore(t)
+	if bytes.Equal(a.mustSessionKey(t), b.mustSessionKey(t)) {
+		t.Error("two vaults with the same password share a vault key")
+	}
+
+	s := newTestStore(t)
+	if err := s.SaveEntries([]models.Entry{{ID: "a", Website: "a.example", Password: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	vaultKey := copyBytes(s.mustSessionKey(t))
+	records := s.recordCiphertexts(t)
+	meta := func() (salt, wrapped []byte) {
+		s.backend.View(func(tx Tx) error {
+			salt = copyBytes(tx.Bucket(metaBucket).Get(keyVaultSalt))
+			wrapped = copyBytes(tx.Bucket(metaBucket).Get(keyVaultKeyWrapped))
+			return nil
+		})
+		return salt, wrapped
+	}
+	oldSalt, oldWrapped := meta()
+
+	// Changing the password only rewraps the vault key.
+	if err := s.ChangeMasterPassword(testPassword, "new password"); err != nil {
+		t.Fatal(err)
+	}
+	newSalt, newWrapped := meta()
+	if bytes.Equal(oldSalt, newSalt) || bytes.Equal(oldWrapped, newWrapped) {
+		t.Error("salt or wrapped key unchanged by a password change")
+	}
+	if bytes.Equal(newWrapped, vaultKey) || bytes.Contains(newWrapped, vaultKey) {
+		t.Error("vault key stored in the clear")
+	}
+	s.Lock()
+	if _, err := s.Unlock("new password"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s.mustSessionKey(t), vaultKey) {
+		t.Error("vault key changed with the password")
+	}
+	after := s.recordCiphertexts(t)
+	for id, ciphertext := range records {
+		if after[id] != ciphertext {
+			t.Errorf("record %s was re-encrypted", id)
+		}
+	}
+}
+
+func writeKeyfile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keyfile")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKeyfile(t *testing.T) {
+	keyfile := writeKeyfile(t, "first keyfile")
+	otherKeyfile := writeKeyfile(t, "second keyfile")
+	backend := NewMemoryBackend()
+	s, err := New(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initTestStore(t, s)
+	if err := s.RequireKeyfile(testPassword, keyfile); err != nil {
+		t.Fatalf("RequireKeyfile: %v", err)
+	}
+	if !s.KeyfileRequired() {
+		t.Fatal("KeyfileRequired = false")
+	}
+
+	// reopen returns the vault as a new process would see it, with no
+	// keyfile loaded.
+	reopen := func() *Store {
+		t.Helper()
+		s, err := New(backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	s = reopen()
+	if _, err := s.Unlock(testPassword); !errors.Is(err, ErrKeyfileRequired) {
+		t.Errorf("Unlock without the keyfile: got %v, want %v", err, ErrKeyfileRequired)
+	}
+	if err := s.LoadKeyfile(writeKeyfile(t, "")); err == nil {
+		t.Error("LoadKeyfile accepted an empty file")
+	}
+	if err := s.LoadKeyfile(otherKeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Unlock(testPassword); !errors.Is(err, crypto.ErrDecryptionFailed) {
+		t.Errorf("Unlock with the wrong keyfile: got %v, want %v", err, crypto.ErrDecryptionFailed)
+	}
+	if err := s.LoadKeyfile(keyfile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Unlock(testPassword); err != nil {
+		t.Fatalf("Unlock with the keyfile: %v", err)
+	}
+
+	if err := s.RemoveKeyfile(testPassword); err != nil {
+		t.Fatalf("RemoveKeyfile: %v", err)
+	}
+	s = reopen()
+	if s.KeyfileRequired() {
+		t.Error("KeyfileRequired after RemoveKeyfile")
+	}
+	if _, err := s.Unlock(testPassword); err != nil {
+		t.Errorf("Unlock after RemoveKeyfile: %v", err)
+	}
+}
+
+func TestKeyfileBoundOnInitialize(t *testing.T) {
+	keyfile := writeKeyfile(t, "keyfile")
+	backend := NewMemoryBackend()
+	s, err := New(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LoadKeyfile(keyfile); err != nil {
+		t.Fatal(err)
+	}
+	initTestStore(t, s)
+	if !s.KeyfileRequired() {
+		t.Error("a vault created with a keyfile loaded does not require it")
+	}
+}
+
+func TestRecoveryKeyDropsLostKeyfile(t *testing.T) {
+	keyfile := writeKeyfile(t, "keyfile")
+	backend := NewMemoryBackend()
+	s, err := New(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initTestStore(t, s)
+	if err := s.RequireKeyfile(testPassword, keyfile); err != nil {
+		t.Fatal(err)
+	}
+	code, err := s.GenerateRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both the password and the keyfile are lost.
+	s, err = New(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UnlockWithRecoveryKey(code); err != nil {
+		t.Fatalf("UnlockWithRecoveryKey: %v", err)
+	}
+	if err := s.ResetMasterPassword("new password"); err != nil {
+		t.Fatalf("ResetMasterPassword: %v", err)
+	}
+	if s.KeyfileRequired() {
+		t.Error("keyfile still required after a recovery without it")
+	}
+	s.Lock()
+	if _, err := s.Unlock("new password"); err != nil {
+		t.Errorf("Unlock with the new password: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// syncBucketPrefix starts the names of the buckets the sync package keeps
+// its state in. The store re-encrypts, backs up and restores them with the
+// vault, but sync cannot reach any other bucket.
+var syncBucketPrefix = []byte("sync_")
+
+// syncTx limits a transaction to the sync buckets.
+type syncTx struct {
+	tx Tx
+}
+
+func isSyncBucket(name []byte) bool {
+	return bytes.HasPrefix(name, syncBucketPrefix)
+}
+
+func notSyncBucket(name []byte) error {
+	return fmt.Errorf("bucket %s is not a sync bucket", name)
+}
+
+func (t syncTx) Bucket(name []byte) Bucket {
+	if !isSyncBucket(name) {
+		return nil
+	}
+	return t.tx.Bucket(name)
+}
+
+func (t syncTx) CreateBucket(name []byte) (Bucket, error) {
+	if !isSyncBucket(name) {
+		return nil, notSyncBucket(name)
+	}
+	return t.tx.CreateBucket(name)
+}
+
+func (t syncTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if !isSyncBucket(name) {
+		return nil, notSyncBucket(name)
+	}
+	return t.tx.CreateBucketIfNotExists(name)
+}
+
+func (t syncTx) DeleteBucket(name []byte) error {
+	if !isSyncBucket(name) {
+		return notSyncBucket(name)
+	}
+	return t.tx.DeleteBucket(name)
+}
+
+func (t syncTx) ForEach(fn func(name []byte, b Bucket) error) error {
+	return t.tx.ForEach(func(name []byte, b Bucket) error {
+		if !isSyncBucket(name) {
+			return nil
+		}
+		return fn(name, b)
+	})
+}
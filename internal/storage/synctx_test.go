@@ -0,0 +1,50 @@
+package storage
+
+import "testing"
+
+func TestSyncTxReachesOnlySyncBuckets(t *testing.T) {
+	s := newTestStore(t)
+
+	err := s.SyncUpdate(func(tx Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("sync_test"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("k"), []byte("v"))
+	})
+	if err != nil {
+		t.Fatalf("SyncUpdate on a sync bucket: %v", err)
+	}
+
+	s.SyncView(func(tx Tx) error {
+		if tx.Bucket(vaultBucket) != nil || tx.Bucket(metaBucket) != nil {
+			t.Error("sync transaction reached a vault bucket")
+		}
+		if b := tx.Bucket([]byte("sync_test")); b == nil || string(b.Get([]byte("k"))) != "v" {
+			t.Error("sync transaction cannot read its own bucket")
+		}
+		tx.ForEach(func(name []byte, _ Bucket) error {
+			if !isSyncBucket(name) {
+				t.Errorf("ForEach visited %s", name)
+			}
+			return nil
+		})
+		return nil
+	})
+
+	err = s.SyncUpdate(func(tx Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte("other")); err == nil {
+			t.Error("created a bucket outside sync_")
+		}
+		if err := tx.DeleteBucket(vaultBucket); err == nil {
+			t.Error("deleted the vault bucket")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Entries(); err != nil {
+		t.Errorf("vault unreadable after sync transactions: %v", err)
+	}
+}
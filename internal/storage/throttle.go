@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Failed password attempts are recorded in meta so the backoff survives
+// restarts. The first few attempts are free, after which each failure
+// doubles the wait before the next attempt is accepted.
+//
+// Read-only stores cannot write meta, so they append failures to a file
+// beside the database instead. Every store counts those too, and the next
+// writer to open the vault moves them into meta.
+var (
+	keyUnlockFailures     = []byte("unlock_failures")
+	keyUnlockFailureLimit = []byte("unlock_failure_limit")
+)
+
+const (
+	freeUnlockAttempts  = 3
+	unlockBaseDelay     = time.Second
+	maxUnlockDelay      = 30 * time.Minute
+	maxRecordedFailures = 10
+)
+
+var ErrRecoveryRequired = errors.New("too many failed unlock attempts; unlock with the recovery key")
+
+// ThrottledError is returned by password checks made before the backoff
+// from earlier failures has run out.
+type ThrottledError struct {
+	Wait time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("too many failed unlock attempts, try again in %s", e.Wait.Round(time.Second))
+}
+
+type unlockFailures struct {
+	Count int `json:"count"`
+	// Times holds the most recent failures, oldest first.
+	Times []time.Time `json:"times"`
+}
+
+// add records a failure at t, keeping Times in order.
+func (f *unlockFailures) add(t time.Time) {
+	f.Count++
+	f.Times = append(f.Times, t)
+	sort.Slice(f.Times, func(i, j int) bool { return f.Times[i].Before(f.Times[j]) })
+	if len(f.Times) > maxRecordedFailures {
+		f.Times = f.Times[len(f.Times)-maxRecordedFailures:]
+	}
+}
+
+func unlockDelay(count int) time.Duration {
+	if count < freeUnlockAttempts {
+		return 0
+	}
+	shift := count - freeUnlockAttempts
+	if shift > 20 {
+		return maxUnlockDelay
+	}
+	delay := unlockBaseDelay << shift
+	if delay > maxUnlockDelay {
+		return maxUnlockDelay
+	}
+	return delay
+}
+
+// wait returns how long after now the next attempt is allowed. A clock that
+// moved backwards restarts the full delay rather than skipping it.
+func (f unlockFailures) wait(now time.Time) time.Duration {
+	if len(f.Times) == 0 {
+		return 0
+	}
+	delay := unlockDelay(f.Count)
+	elapsed := now.Sub(f.Times[len(f.Times)-1])
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	if elapsed >= delay {
+		return 0
+	}
+	return delay - elapsed
+}
+
+func readUnlockFailures(meta Bucket) unlockFailures {
+	var f unlockFailures
+	if data := meta.Get(keyUnlockFailures); data != nil {
+		json.Unmarshal(data, &f)
+	}
+	return f
+}
+
+func failuresPath(dbPath string) string {
+	return dbPath + ".failures"
+}
+
+// readPendingFailures returns the failures read-only stores recorded for
+// dbPath, one time per line. A line that does not parse still counts, as
+// a failure long ago.
+func readPendingFailures(dbPath string) []time.Time {
+	if dbPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(failuresPath(dbPath))
+	if err != nil {
+		return nil
+	}
+	var times []time.Time
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		t, _ := time.Parse(time.RFC3339Nano, line)
+		times = append(times, t)
+	}
+	return times
+}
+
+func recordPendingFailure(dbPath string) error {
+	if dbPath == "" {
+		return fmt.Errorf("read-only vault has no file to record failures next to")
+	}
+	f, err := os.OpenFile(failuresPath(dbPath), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(time.Now().UTC().Format(time.RFC3339Nano) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func removePendingFailures(dbPath string) error {
+	if dbPath == "" {
+		return nil
+	}
+	if err := os.Remove(failuresPath(dbPath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func readUnlockFailureLimit(meta Bucket) int {
+	var limit int
+	if data := meta.Get(keyUnlockFailureLimit); data != nil {
+		json.Unmarshal(data, &limit)
+	}
+	return limit
+}
+
+// SetUnlockFailureLimit sets how many failed password attempts force the
+// recovery key to be used. Zero removes the limit. Like SetKDFParams, the
+// setting is written to the vault on the next successful unlock.
+func (s *Store) SetUnlockFailureLimit(limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("invalid unlock failure limit: %d", limit)
+	}
+	s.mu.Lock()
+	s.failureLimit = &limit
+	s.mu.Unlock()
+	return nil
+}
+
+// unlockFailures returns the failures recorded in meta together with those
+// read-only stores have recorded since.
+func (s *Store) unlockFailures() unlockFailures {
+	var f unlockFailures
+	s.backend.View(func(tx Tx) error {
+		f = readUnlockFailures(tx.Bucket(metaBucket))
+		return nil
+	})
+	for _, t := range readPendingFailures(s.backend.Path()) {
+		f.add(t)
+	}
+	return f
+}
+
+// FailedUnlocks returns the number of failed password attempts since the
+// last successful unlock.
+func (s *Store) FailedUnlocks() int {
+	return s.unlockFailures().Count
+}
+
+// UnlockWait returns how long until the next password attempt is accepted.
+func (s *Store) UnlockWait() time.Duration {
+	return s.unlockFailures().wait(time.Now())
+}
+
+// RecoveryRequired reports whether the failure limit has been reached, in
+// which case only the recovery key can unlock the vault. The limit is not
+// enforced on vaults without a recovery key.
+func (s *Store) RecoveryRequired() bool {
+	var limit int
+	var hasRecovery bool
+	s.backend.View(func(tx Tx) error {
+		meta := tx.Bucket(metaBucket)
+		limit = readUnlockFailureLimit(meta)
+		hasRecovery = meta.Get(keyRecoveryWrapped) != nil
+		return nil
+	})
+	return limit > 0 && hasRecovery && s.FailedUnlocks() >= limit
+}
+
+// checkUnlockAllowed returns an error when a password attempt must not be
+// made yet.
+func (s *Store) checkUnlockAllowed() error {
+	if s.RecoveryRequired() {
+		return ErrRecoveryRequired
+	}
+	if wait := s.UnlockWait(); wait > 0 {
+		return &ThrottledError{Wait: wait}
+	}
+	return nil
+}
+
+func (s *Store) recordUnlockFailure() error {
+	if s.backend.ReadOnly() {
+		return recordPendingFailure(s.backend.Path())
+	}
+	return s.moveUnlockFailures(time.Now().UTC())
+}
+
+// moveUnlockFailures adds the failures at times, and those read-only stores
+// recorded, to meta.
+func (s *Store) moveUnlockFailures(times ...time.Time) error {
+	path := s.backend.Path()
+	times = append(readPendingFailures(path), times...)
+	if len(times) == 0 {
+		return nil
+	}
+	err := s.backend.Update(func(tx Tx) error {
+		meta := tx.Bucket(metaBucket)
+		f := readUnlockFailures(meta)
+		for _, t := range times {
+			f.add(t)
+		}
+		data, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		return meta.Put(keyUnlockFailures, data)
+	})
+	if err != nil {
+		return err
+	}
+	return removePendingFailures(path)
+}
+
+// unlockSucceeded clears the failure record and stores a requested failure
+// limit and trash retention. Read-only stores can only clear the failures
+// kept beside the database.
+func (s *Store) unlockSucceeded() error {
+	if s.backend.ReadOnly() {
+		return removePendingFailures(s.backend.Path())
+	}
+
+	s.mu.RLock()
+	limit := s.failureLimit
+	retention := s.trashRetention
+	s.mu.RUnlock()
+
+	err := s.backend.Update(func(tx Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if limit != nil {
+			if *limit == 0 {
+				if err := meta.Delete(keyUnlockFailureLimit); err != nil {
+					return err
+				}
+			} else if err := meta.Put(keyUnlockFailureLimit, []byte(fmt.Sprint(*limit))); err != nil {
+				return err
+			}
+		}
+		if retention != nil {
+			if err := meta.Put(keyTrashRetention, []byte(fmt.Sprint(*retention))); err != nil {
+				return err
+			}
+		}
+		if meta.Get(keyUnlockFailures) == nil {
+			return nil
+		}
+		return meta.Delete(keyUnlockFailures)
+	})
+	if err != nil {
+		return err
+	}
+	return removePendingFailures(s.backend.Path())
+}
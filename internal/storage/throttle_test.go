@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"forgor/internal/crypto"
+)
+
+func TestUnlockDelay(t *testing.T) {
+	tests := []struct {
+		count int
+		want  time.Duration
+	}{
+		{0, 0},
+		{freeUnlockAttempts - 1, 0},
+		{freeUnlockAttempts, time.Second},
+		{freeUnlockAttempts + 1, 2 * time.Second},
+		{freeUnlockAttempts + 2, 4 * time.Second},
+		{freeUnlockAttempts + 10, 1024 * time.Second},
+		{freeUnlockAttempts + 11, maxUnlockDelay},
+		{freeUnlockAttempts + 64, maxUnlockDelay},
+	}
+	for _, tt := range tests {
+		if got := unlockDelay(tt.count); got != tt.want {
+			t.Errorf("unlockDelay(%d) = %s, want %s", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestUnlockFailuresWait(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		count int
+		last  time.Duration // age of the last failure
+		want  time.Duration
+	}{
+		{"free attempt", freeUnlockAttempts - 1, 0, 0},
+		{"just failed", freeUnlockAttempts + 2, 0, 4 * time.Second},
+		{"partly waited", freeUnlockAttempts + 2, time.Second, 3 * time.Second},
+		{"waited out", freeUnlockAttempts + 2, 4 * time.Second, 0},
+		{"clock moved back", freeUnlockAttempts + 2, -time.Hour, 4 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := unlockFailures{Count: tt.count, Times: []time.Time{now.Add(-tt.last)}}
+			if got := f.wait(now); got != tt.want {
+				t.Errorf("wait = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if got := (unlockFailures{}).wait(now); got != 0 {
+		t.Errorf("wait with no failures = %s, want 0", got)
+	}
+}
+
+// ageFailures moves the recorded failures into the past, as if the user
+// had waited.
+func ageFailures(t *testing.T, s *Store, by time.Duration) {
+	t.Helper()
+	err := s.backend.Update(func(tx Tx) error {
+		meta := tx.Bucket(metaBucket)
+		f := readUnlockFailures(meta)
+		for i := range f.Times {
+			f.Times[i] = f.Times[i].Add(-by)
+		}
+		data, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		return meta.Put(keyUnlockFailures, data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnlockBackoff(t *testing.T) {
+	s := newTestStore(t)
+	s.Lock()
+
+	for i := 1; i <= freeUnlockAttempts; i++ {
+		if _, err := s.Unlock("wrong"); !errors.Is(err, crypto.ErrDecryptionFailed) {
+			t.Fatalf("attempt %d: got %v, want %v", i, err, crypto.ErrDecryptionFailed)
+		}
+		if n := s.FailedUnlocks(); n != i {
+			t.Fatalf("attempt %d: FailedUnlocks = %d", i, n)
+		}
+	}
+
+	// Even the right password has to wait, and waiting attempts are not
+	// counted.
+	var throttled *ThrottledError
+	if _, err := s.Unlock(testPassword); !errors.As(err, &throttled) {
+		t.Fatalf("got %v, want a ThrottledError", err)
+	}
+	if throttled.Wait <= 0 || throttled.Wait > unlockDelay(freeUnlockAttempts) {
+		t.Errorf("Wait = %s, want up to %s", throttled.Wait, unlockDelay(freeUnlockAttempts))
+	}
+	if n := s.FailedUnlocks(); n != freeUnlockAttempts {
+		t.Errorf("FailedUnlocks after throttled attempt = %d, want %d", n, freeUnlockAttempts)
+	}
+
+	ageFailures(t, s, unlockDelay(freeUnlockAttempts))
+	if wait := s.UnlockWait(); wait != 0 {
+		t.Fatalf("UnlockWait after waiting = %s, want 0", wait)
+	}
+	if _, err := s.Unlock(testPassword); err != nil {
+		t.Fatalf("Unlock after waiting: %v", err)
+	}
+	if n := s.FailedUnlocks(); n != 0 {
+		t.Errorf("FailedUnlocks after unlocking = %d, want 0", n)
+	}
+}
+
+func TestUnlockFailureLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		limit        int
+		recoveryKey  bool
+		wantRecovery bool
+	}{
+		{"limit reached", 2, true, true},
+		{"no recovery key", 2, false, false},
+		{"no limit", 0, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			if err := s.SetUnlockFailureLimit(tt.limit); err != nil {
+				t.Fatal(err)
+			}
+			var code string
+			if tt.recoveryKey {
+				var err error
+				if code, err = s.GenerateRecoveryKey(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// The limit is saved by a successful unlock.
+			s.Lock()
+			if _, err := s.Unlock(testPassword); err != nil {
+				t.Fatal(err)
+			}
+			s.Lock()
+
+			for i := 0; i < 2; i++ {
+				s.Unlock("wrong")
+			}
+			if got := s.RecoveryRequired(); got != tt.wantRecovery {
+				t.Fatalf("RecoveryRequired = %v, want %v", got, tt.wantRecovery)
+			}
+			_, err := s.Unlock(testPassword)
+			if !tt.wantRecovery {
+				if err != nil {
+					t.Errorf("Unlock: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrRecoveryRequired) {
+				t.Fatalf("Unlock: got %v, want %v", err, ErrRecoveryRequired)
+			}
+			if _, err := s.UnlockWithRecoveryKey(code); err != nil {
+				t.Fatalf("UnlockWithRecoveryKey: %v", err)
+			}
+			if s.RecoveryRequired() {
+				t.Error("RecoveryRequired after unlocking with the recovery key")
+			}
+		})
+	}
+}
+
+func TestSetUnlockFailureLimitRejectsNegative(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.SetUnlockFailureLimit(-1); err == nil {
+		t.Error("SetUnlockFailureLimit(-1) succeeded")
+	}
+}
+
+func TestReadOnlyUnlockFailures(t *testing.T) {
+	path, writer := newTestFile(t, nil)
+	writer.Close()
+
+	ro, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= freeUnlockAttempts; i++ {
+		if _, err := ro.Unlock("wrong"); !errors.Is(err, crypto.ErrDecryptionFailed) {
+			t.Fatalf("attempt %d: got %v, want %v", i, err, crypto.ErrDecryptionFailed)
+		}
+	}
+	var throttled *ThrottledError
+	if _, err := ro.Unlock(testPassword); !errors.As(err, &throttled) {
+		t.Fatalf("read-only unlock after %d failures: got %v, want a ThrottledError", freeUnlockAttempts, err)
+	}
+	ro.Close()
+
+	// A later read-only open, as from the next run of a script, still
+	// sees them.
+	ro, err = OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ro.FailedUnlocks(); n != freeUnlockAttempts {
+		t.Errorf("FailedUnlocks in a new read-only store = %d, want %d", n, freeUnlockAttempts)
+	}
+	ro.Close()
+
+	// The next writer moves them into meta.
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := os.Stat(failuresPath(path)); !os.IsNotExist(err) {
+		t.Errorf("failures file left after opening for writing: %v", err)
+	}
+	if n := s.FailedUnlocks(); n != freeUnlockAttempts {
+		t.Errorf("FailedUnlocks after opening for writing = %d, want %d", n, freeUnlockAttempts)
+	}
+	if s.UnlockWait() <= 0 {
+		t.Error("backoff lost when opening for writing")
+	}
+}
+
+func TestReadOnlyUnlockFailuresWhileInUse(t *testing.T) {
+	path, writer := newTestFile(t, nil)
+	writer.Lock()
+
+	ro, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if _, err := ro.Unlock("wrong"); !errors.Is(err, crypto.ErrDecryptionFailed) {
+		t.Fatalf("got %v, want %v", err, crypto.ErrDecryptionFailed)
+	}
+
+	// The app holding the vault counts the failure, and clears it when it
+	// is unlocked.
+	if n := writer.FailedUnlocks(); n != 1 {
+		t.Errorf("writer FailedUnlocks = %d, want 1", n)
+	}
+	if _, err := writer.Unlock(testPassword); err != nil {
+		t.Fatal(err)
+	}
+	if n := ro.FailedUnlocks(); n != 0 {
+		t.Errorf("FailedUnlocks after the writer unlocked = %d, want 0", n)
+	}
+}
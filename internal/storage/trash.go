@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"forgor/internal/models"
+)
+
+// The trash bucket holds trashed entries as one sealed blob, apart from the
+// vault records, so nothing that lists entries has to skip them.
+var (
+	trashBucket  = []byte("trash")
+	keyTrashBlob = []byte("blob")
+
+	// keyTrashRetention holds the retention period in days; 0 keeps
+	// trashed entries until they are purged by hand.
+	keyTrashRetention = []byte("trash_retention_days")
+)
+
+// Trash returns the entries in the trash of an unlocked vault.
+func (s *Store) Trash() ([]models.Entry, error) {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(vaultKey)
+
+	var trash []models.Entry
+	err = s.backend.View(func(tx Tx) error {
+		trash, err = readTrash(tx, vaultKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return trash, nil
+}
+
+// SaveTrash replaces the trash. Files only used by entries purged from it
+// are removed by the next SaveEntries; use PurgeTrash to remove them now.
+func (s *Store) SaveTrash(trash []models.Entry) error {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(vaultKey)
+
+	return s.backend.Update(func(tx Tx) error {
+		return writeTrash(tx, vaultKey, trash)
+	})
+}
+
+// SaveEntriesAndTrash saves the vault entries and the trash in one
+// transaction, so an entry moved between them is never in both or neither.
+func (s *Store) SaveEntriesAndTrash(entries, trash []models.Entry) error {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(vaultKey)
+
+	return s.backend.Update(func(tx Tx) error {
+		// The trash goes first so pruning keeps the files it refers to.
+		if err := writeTrash(tx, vaultKey, trash); err != nil {
+			return err
+		}
+		return saveEntries(tx, vaultKey, entries)
+	})
+}
+
+// PurgeTrash deletes the entries with the given IDs from the trash for good,
+// along with the files that nothing else refers to.
+func (s *Store) PurgeTrash(ids []string) error {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(vaultKey)
+
+	gone := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		gone[id] = true
+	}
+	return s.backend.Update(func(tx Tx) error {
+		trash, err := readTrash(tx, vaultKey)
+		if err != nil {
+			return err
+		}
+		kept := make([]models.Entry, 0, len(trash))
+		for _, e := range trash {
+			if !gone[e.ID] {
+				kept = append(kept, e)
+			}
+		}
+		if err := writeTrash(tx, vaultKey, kept); err != nil {
+			return err
+		}
+
+		vault := tx.Bucket(vaultBucket)
+		index, err := loadIndex(vault, vaultKey)
+		if err != nil {
+			return err
+		}
+		entries := make([]models.Entry, 0, len(index.Records))
+		for _, rec := range index.Records {
+			entry, err := readRecord(vault, vaultKey, rec.RecordID)
+			if err != nil {
+				// As in SaveEntries, a damaged record may still refer to
+				// files, so nothing is pruned until it is repaired.
+				return nil
+			}
+			entries = append(entries, entry)
+		}
+		if err := pruneAttachments(tx, vaultKey, entries); err != nil {
+			return fmt.Errorf("failed to prune attachments: %w", err)
+		}
+		return nil
+	})
+}
+
+func writeTrash(tx Tx, vaultKey []byte, trash []models.Entry) error {
+	plaintext, err := json.Marshal(trash)
+	if err != nil {
+		return fmt.Errorf("failed to serialize trash: %w", err)
+	}
+	defer wipe(plaintext)
+	ciphertext, err := seal(vaultKey, trashBucket, keyTrashBlob, plaintext)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(trashBucket).Put(keyTrashBlob, ciphertext)
+}
+
+func readTrash(tx Tx, vaultKey []byte) ([]models.Entry, error) {
+	bucket := tx.Bucket(trashBucket)
+	if bucket == nil {
+		return nil, nil
+	}
+	ciphertext := bucket.Get(keyTrashBlob)
+	if ciphertext == nil {
+		return nil, nil
+	}
+
+	plaintext, err := unseal(vaultKey, trashBucket, keyTrashBlob, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt trash: %w", err)
+	}
+	defer wipe(plaintext)
+	var trash []models.Entry
+	if err := json.Unmarshal(plaintext, &trash); err != nil {
+		return nil, fmt.Errorf("failed to parse trash: %w", err)
+	}
+	return trash, nil
+}
+
+// TrashRetention returns how long trashed entries are kept, or 0 if they
+// are kept until purged by hand.
+func (s *Store) TrashRetention() time.Duration {
+	retention := models.DefaultTrashRetention
+	s.backend.View(func(tx Tx) error {
+		if data := tx.Bucket(metaBucket).Get(keyTrashRetention); data != nil {
+			if days, err := strconv.Atoi(string(data)); err == nil && days >= 0 {
+				retention = time.Duration(days) * 24 * time.Hour
+			}
+		}
+		return nil
+	})
+	return retention
+}
+
+// SetTrashRetention sets how many days trashed entries are kept; 0 keeps
+// them until purged by hand. Like SetUnlockFailureLimit, the setting is
+// written to the vault on the next successful unlock.
+func (s *Store) SetTrashRetention(days int) error {
+	if days < 0 {
+		return fmt.Errorf("invalid trash retention: %d days", days)
+	}
+	s.mu.Lock()
+	s.trashRetention = &days
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"forgor/internal/models"
+)
+
+func TestTrash(t *testing.T) {
+	s := newTestStore(t)
+	keep := models.Entry{ID: "keep", Website: "a.example", Password: "1"}
+	trashed := models.Entry{ID: "trashed", Website: "b.example", Password: "2"}
+	if err := s.SaveEntries([]models.Entry{keep, trashed}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SaveEntriesAndTrash([]models.Entry{keep}, []models.Entry{trashed.Trashed(time.Now())}); err != nil {
+		t.Fatalf("SaveEntriesAndTrash: %v", err)
+	}
+	entries, err := s.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := entryIDs([]models.Entry{keep}); !equalStrings(entryIDs(entries), want) {
+		t.Errorf("entries = %v, want %v", entryIDs(entries), want)
+	}
+	trash, err := s.Trash()
+	if err != nil {
+		t.Fatalf("Trash: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != trashed.ID || trash[0].DeletedAt == nil {
+		t.Errorf("trash = %+v, want the trashed entry", trash)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	s := newTestStore(t)
+	withFile := func(id, attachmentID string) models.Entry {
+		return models.Entry{ID: id, Website: id + ".example", Password: id,
+			Attachments: []models.Attachment{{ID: attachmentID, Name: attachmentID}}}
+	}
+	for _, id := range []string{"shared", "purged-only", "kept-only"} {
+		if err := s.PutAttachment(id, []byte(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry := withFile("entry", "shared")
+	purged := withFile("purged", "purged-only")
+	purged.Attachments = append(purged.Attachments, models.Attachment{ID: "shared"})
+	kept := withFile("kept", "kept-only")
+	now := time.Now()
+	if err := s.SaveEntriesAndTrash([]models.Entry{entry}, []models.Entry{purged.Trashed(now), kept.Trashed(now)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.PurgeTrash([]string{purged.ID}); err != nil {
+		t.Fatalf("PurgeTrash: %v", err)
+	}
+	trash, err := s.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != kept.ID {
+		t.Errorf("trash = %+v, want kept", trash)
+	}
+	for id, want := range map[string]bool{"shared": true, "kept-only": true, "purged-only": false} {
+		if _, err := s.Attachment(id); (err == nil) != want {
+			t.Errorf("attachment %s present = %v, want %v", id, err == nil, want)
+		}
+	}
+}
+
+func TestTrashRetention(t *testing.T) {
+	backend := NewMemoryBackend()
+	s, err := New(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initTestStore(t, s)
+	if got := s.TrashRetention(); got != models.DefaultTrashRetention {
+		t.Errorf("TrashRetention = %v, want the default", got)
+	}
+	if err := s.SetTrashRetention(-1); err == nil {
+		t.Error("accepted a negative retention")
+	}
+
+	// The setting is stored by the next unlock.
+	if err := s.SetTrashRetention(7); err != nil {
+		t.Fatal(err)
+	}
+	s.Lock()
+	if _, err := s.Unlock(testPassword); err != nil {
+		t.Fatal(err)
+	}
+	s, err = New(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.TrashRetention(); got != 7*24*time.Hour {
+		t.Errorf("TrashRetention = %v, want 7 days", got)
+	}
+}
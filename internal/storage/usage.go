@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"forgor/internal/models"
+)
+
+// The usage bucket holds entry usage as one sealed blob, outside the entry
+// records, so that viewing an entry does not rewrite it, snapshot the vault
+// or sync a change.
+var (
+	usageBucket  = []byte("usage")
+	keyUsageBlob = []byte("blob")
+
+	// keySortMode holds the vault list order. It is a display preference,
+	// so like the KDF parameters it is stored in the clear.
+	keySortMode = []byte("sort_mode")
+)
+
+// Usage returns the usage recorded for each entry ID.
+func (s *Store) Usage() (map[string]models.Usage, error) {
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(vaultKey)
+
+	var usage map[string]models.Usage
+	err = s.backend.View(func(tx Tx) error {
+		usage, err = readUsage(tx, vaultKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// RecordUse counts a use of an entry at the given time.
+func (s *Store) RecordUse(entryID string, at time.Time) error {
+	if entryID == "" {
+		return fmt.Errorf("entry id is required")
+	}
+	vaultKey, err := s.sessionKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(vaultKey)
+
+	return s.backend.Update(func(tx Tx) error {
+		usage, err := readUsage(tx, vaultKey)
+		if err != nil {
+			// Usage is only used for sorting, so a damaged blob starts over
+			// rather than blocking every view.
+			usage = make(map[string]models.Usage)
+		}
+		u := usage[entryID]
+		u.Count++
+		if at.After(u.LastUsedAt) {
+			u.LastUsedAt = at
+		}
+		usage[entryID] = u
+
+		plaintext, err := json.Marshal(usage)
+		if err != nil {
+			return fmt.Errorf("failed to serialize usage: %w", err)
+		}
+		defer wipe(plaintext)
+		ciphertext, err := seal(vaultKey, usageBucket, keyUsageBlob, plaintext)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(usageBucket).Put(keyUsageBlob, ciphertext)
+	})
+}
+
+func readUsage(tx Tx, vaultKey []byte) (map[string]models.Usage, error) {
+	usage := make(map[string]models.Usage)
+	bucket := tx.Bucket(usageBucket)
+	if bucket == nil {
+		return usage, nil
+	}
+	ciphertext := bucket.Get(keyUsageBlob)
+	if ciphertext == nil {
+		return usage, nil
+	}
+
+	plaintext, err := unseal(vaultKey, usageBucket, keyUsageBlob, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt usage: %w", err)
+	}
+	defer wipe(plaintext)
+	if err := json.Unmarshal(plaintext, &usage); err != nil {
+		return nil, fmt.Errorf("failed to parse usage: %w", err)
+	}
+	return usage, nil
+}
+
+// SortMode returns the saved vault list order.
+func (s *Store) SortMode() models.SortMode {
+	var mode models.SortMode
+	s.backend.View(func(tx Tx) error {
+		mode = models.ParseSortMode(string(tx.Bucket(metaBucket).Get(keySortMode)))
+		return nil
+	})
+	return mode
+}
+
+func (s *Store) SetSortMode(mode models.SortMode) error {
+	return s.backend.Update(func(tx Tx) error {
+		return tx.Bucket(metaBucket).Put(keySortMode, []byte(mode))
+	})
+}
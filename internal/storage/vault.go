@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"time"
+
+	"forgor/internal/models"
+	"forgor/internal/secmem"
+)
+
+// Vault is what the app, the share server and sync need from a vault.
+// *Store implements it over any Backend: bbolt files from Open, or memory
+// from OpenMemory.
+type Vault interface {
+	IsInitialized() bool
+	Initialize(masterPassword, deviceName string) error
+	Unlock(masterPassword string) ([]models.Entry, error)
+	UnlockWithRecoveryKey(code string) ([]models.Entry, error)
+	ResetMasterPassword(newPassword string) error
+	ChangeMasterPassword(oldPassword, newPassword string) error
+	IsUnlocked() bool
+	Lock()
+
+	LoadKeyfile(path string) error
+	HasKeyfile() bool
+	KeyfileRequired() bool
+	RequireKeyfile(masterPassword, path string) error
+	RemoveKeyfile(masterPassword string) error
+	GenerateRecoveryKey() (string, error)
+	HasRecoveryKey() bool
+	RecoveryRequired() bool
+	UnlockWait() time.Duration
+
+	Entries() ([]models.Entry, error)
+	SaveEntries(entries []models.Entry) error
+	ListSnapshots() ([]models.VaultSnapshot, error)
+
+	Folders() ([]models.Folder, error)
+	SaveFolders(folders []models.Folder) error
+
+	Trash() ([]models.Entry, error)
+	SaveTrash(trash []models.Entry) error
+	SaveEntriesAndTrash(entries, trash []models.Entry) error
+	PurgeTrash(ids []string) error
+	TrashRetention() time.Duration
+
+	Usage() (map[string]models.Usage, error)
+	RecordUse(entryID string, at time.Time) error
+	SortMode() models.SortMode
+	SetSortMode(mode models.SortMode) error
+
+	PutAttachment(id string, content []byte) error
+	Attachment(id string) ([]byte, error)
+	HasAttachment(id string) bool
+
+	GetFriend(fingerprint string) (*models.Friend, error)
+	GetAllFriends() ([]models.Friend, error)
+	SaveFriend(friend models.Friend) error
+	DeleteFriend(fingerprint string) error
+
+	GetDevice() (*models.Device, error)
+	UpdateDeviceName(name string) error
+
+	// The sync state is kept in the vault's sync_* buckets, which SyncView
+	// and SyncUpdate reach without exposing the rest of the vault. It is
+	// sealed with the vault key, which is nil while locked.
+	SyncView(fn func(tx Tx) error) error
+	SyncUpdate(fn func(tx Tx) error) error
+	ReadOnly() bool
+	VaultKey() *secmem.Buffer
+}
+
+var _ Vault = (*Store)(nil)
@@ -0,0 +1,175 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"forgor/internal/crypto"
+	"forgor/internal/secmem"
+	"forgor/internal/storage"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// sync_meta damage has no safe automatic repair; leaving and rejoining the
+// vault rebuilds it.
+const rejoinHint = "leave the sync vault and join it again"
+
+// Check verifies that sync_meta is consistent and reports sync_entry_schemes
+// and sync_pending rows for entries that do not exist. entryIDs holds every
+// entry in the local vault. With repair set, orphaned rows are deleted.
+func (s *SyncState) Check(entryIDs map[string]bool, repair bool) ([]storage.Problem, error) {
+	vaultKey, err := s.getVaultKey()
+	if err != nil {
+		return nil, err
+	}
+	defer secmem.Wipe(vaultKey)
+
+	var problems []storage.Problem
+	report := func(location, issue, fix string) bool {
+		fixed := repair && fix != ""
+		problems = append(problems, storage.Problem{Location: location, Issue: issue, Fix: fix, Fixed: fixed})
+		return fixed
+	}
+
+	run := s.store.SyncView
+	if repair {
+		run = s.store.SyncUpdate
+	}
+	err = run(func(tx storage.Tx) error {
+		if meta := tx.Bucket(syncMetaBucket); meta != nil && meta.Get(keyDeviceID) != nil {
+			checkDeviceKeys(meta, vaultKey, report)
+			if meta.Get(keyVaultID) != nil {
+				checkVaultMeta(meta, vaultKey, report)
+			}
+		}
+
+		var orphans [][]byte
+		if bucket := tx.Bucket(syncEntrySchemes); bucket != nil {
+			bucket.ForEach(func(k, _ []byte) error {
+				if !entryIDs[string(k)] && report("sync_entry_schemes/"+string(k), "scheme for an entry that does not exist", "delete the row") {
+					orphans = append(orphans, copyBytes(k))
+				}
+				return nil
+			})
+			for _, k := range orphans {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+
+		orphans = nil
+		if bucket := tx.Bucket(syncPendingBucket); bucket != nil {
+			bucket.ForEach(func(k, v []byte) error {
+				if issue := checkPending(vaultKey, k, v, entryIDs); issue != "" && report("sync_pending/"+string(k), issue, "delete the row") {
+					orphans = append(orphans, copyBytes(k))
+				}
+				return nil
+			})
+			for _, k := range orphans {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
+
+func checkDeviceKeys(meta storage.Bucket, vaultKey []byte, report func(location, issue, fix string) bool) {
+	pubSign := meta.Get(keyPubkeySign)
+	if len(pubSign) != ed25519.PublicKeySize {
+		report("sync_meta/pubkey_sign", fmt.Sprintf("invalid length %d", len(pubSign)), rejoinHint)
+		return
+	}
+	hash := sha256.Sum256(pubSign)
+	if string(meta.Get(keyDeviceID)) != hex.EncodeToString(hash[:]) {
+		report("sync_meta/device_id", "does not match pubkey_sign", "")
+	}
+
+	privSign, err := crypto.DecryptWithAD(vaultKey, meta.Get(keyPrivkeySignEnc), crypto.StorageAD(syncMetaBucket, keyPrivkeySignEnc))
+	switch {
+	case err != nil:
+		report("sync_meta/privkey_sign_enc", "does not decrypt", "")
+	case len(privSign) != ed25519.PrivateKeySize:
+		report("sync_meta/privkey_sign_enc", fmt.Sprintf("invalid length %d", len(privSign)), "")
+	case !bytes.Equal(ed25519.PrivateKey(privSign).Public().(ed25519.PublicKey), pubSign):
+		report("sync_meta/privkey_sign_enc", "does not match pubkey_sign", "")
+	}
+	secmem.Wipe(privSign)
+
+	pubBox := meta.Get(keyPubkeyBox)
+	privBox, err := crypto.DecryptWithAD(vaultKey, meta.Get(keyPrivkeyBoxEnc), crypto.StorageAD(syncMetaBucket, keyPrivkeyBoxEnc))
+	switch {
+	case err != nil:
+		report("sync_meta/privkey_box_enc", "does not decrypt", "")
+	case len(privBox) != 32:
+		report("sync_meta/privkey_box_enc", fmt.Sprintf("invalid length %d", len(privBox)), "")
+	default:
+		derived, err := curve25519.X25519(privBox, curve25519.Basepoint)
+		if err != nil || !bytes.Equal(derived, pubBox) {
+			report("sync_meta/pubkey_box", "does not match privkey_box", "")
+		}
+	}
+	secmem.Wipe(privBox)
+}
+
+func checkVaultMeta(meta storage.Bucket, vaultKey []byte, report func(location, issue, fix string) bool) {
+	if len(meta.Get(keyVaultID)) != 16 {
+		report("sync_meta/vault_id", "invalid length", rejoinHint)
+	}
+
+	vaultKeyEnc := meta.Get(keyVaultKeyEnc)
+	if vaultKeyEnc == nil {
+		report("sync_meta/vault_key_enc", "missing", rejoinHint)
+	} else {
+		key, err := crypto.DecryptWithAD(vaultKey, vaultKeyEnc, crypto.StorageAD(syncMetaBucket, keyVaultKeyEnc))
+		switch {
+		case err != nil:
+			report("sync_meta/vault_key_enc", "does not decrypt", rejoinHint)
+		case len(key) != 32:
+			report("sync_meta/vault_key_enc", fmt.Sprintf("invalid length %d", len(key)), rejoinHint)
+		}
+		secmem.Wipe(key)
+	}
+
+	if len(meta.Get(keyMemberSeq)) != 8 {
+		report("sync_meta/member_seq", "membership head is missing", rejoinHint)
+	}
+	if len(meta.Get(keyMemberHeadHash)) != 32 {
+		report("sync_meta/member_head_hash", "membership head is missing", rejoinHint)
+	}
+}
+
+// checkPending returns why a sync_pending row is unusable, or "" if it is
+// fine. Pending deletes and trashes are expected to name entries that are
+// gone.
+func checkPending(vaultKey, k, v []byte, entryIDs map[string]bool) string {
+	dec, err := crypto.DecryptWithAD(vaultKey, v, crypto.StorageAD(syncPendingBucket, k))
+	if err != nil {
+		return "does not decrypt"
+	}
+	defer secmem.Wipe(dec)
+	var pending PendingEntry
+	if err := json.Unmarshal(dec, &pending); err != nil {
+		return "does not parse"
+	}
+	switch {
+	case pending.Entry.ID != string(k):
+		return fmt.Sprintf("holds entry %s", pending.Entry.ID)
+	case (pending.Op == "upsert" || pending.Op == "restore") && !entryIDs[pending.Entry.ID]:
+		return pending.Op + " for an entry that does not exist"
+	case !isEntryOp(pending.Op):
+		return fmt.Sprintf("unknown op %q", pending.Op)
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"testing"
+
+	"forgor/internal/models"
+)
+
+func TestCheckRepairsOrphanedRows(t *testing.T) {
+	store := newTestVault(t)
+	state, err := NewSyncState(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := GenerateDeviceKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keys.Destroy()
+	if err := state.SetDeviceKeys(keys); err != nil {
+		t.Fatal(err)
+	}
+
+	kept := models.Entry{ID: "kept", Website: "a.example", Password: "1"}
+	gone := models.Entry{ID: "gone", Website: "b.example", Password: "2"}
+	deleted := models.Entry{ID: "deleted", Website: "c.example", Password: "3"}
+	if err := state.AddPendingEntry("upsert", kept); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.AddPendingEntry("upsert", gone); err != nil {
+		t.Fatal(err)
+	}
+	// Deletes name entries that are no longer in the vault.
+	if err := state.AddPendingEntry("delete", deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SetEntryScheme(kept.ID, "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SetEntryScheme(gone.ID, "v2"); err != nil {
+		t.Fatal(err)
+	}
+	entryIDs := map[string]bool{kept.ID: true}
+
+	problems, err := state.Check(entryIDs, false)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	want := map[string]bool{"sync_pending/gone": true, "sync_entry_schemes/gone": true}
+	if len(problems) != len(want) {
+		t.Fatalf("problems = %v, want %d", problems, len(want))
+	}
+	for _, p := range problems {
+		if !want[p.Location] || p.Fixed {
+			t.Errorf("unexpected problem %v", p)
+		}
+	}
+
+	problems, err = state.Check(entryIDs, true)
+	if err != nil {
+		t.Fatalf("Check with repair: %v", err)
+	}
+	for _, p := range problems {
+		if !p.Fixed {
+			t.Errorf("%v was not fixed", p)
+		}
+	}
+	if problems, _ := state.Check(entryIDs, false); len(problems) != 0 {
+		t.Errorf("problems left after repair: %v", problems)
+	}
+
+	pending, err := state.GetPendingEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := make(map[string]string)
+	for _, p := range pending {
+		ops[p.Entry.ID] = p.Op
+	}
+	if len(ops) != 2 || ops[kept.ID] != "upsert" || ops[deleted.ID] != "delete" {
+		t.Errorf("pending after repair = %v", ops)
+	}
+	if scheme, _ := state.GetEntryScheme(gone.ID); scheme != "" {
+		t.Errorf("scheme of a missing entry kept: %q", scheme)
+	}
+	if scheme, _ := state.GetEntryScheme(kept.ID); scheme != "v2" {
+		t.Errorf("scheme = %q, want v2", scheme)
+	}
+}
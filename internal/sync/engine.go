@@ -10,9 +10,11 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"forgor/internal/crypto"
 	"forgor/internal/models"
+	"forgor/internal/secmem"
 	"forgor/internal/storage"
 
 	"golang.org/x/crypto/chacha20poly1305"
@@ -23,11 +25,11 @@ import (
 type Engine struct {
 	client *Client
 	state  *SyncState
-	store  *storage.Store
+	store  storage.Vault
 	mu     sync.Mutex
 }
 
-func NewEngine(client *Client, state *SyncState, store *storage.Store) *Engine {
+func NewEngine(client *Client, state *SyncState, store storage.Vault) *Engine {
 	return &Engine{
 		client: client,
 		state:  state,
@@ -43,6 +45,7 @@ func (e *Engine) RegisterDevice() error {
 	if err != nil {
 		return fmt.Errorf("failed to get device keys: %w", err)
 	}
+	defer keys.Destroy()
 
 	deviceIDBytes, err := keys.DeviceID.Bytes()
 	if err != nil {
@@ -54,7 +57,10 @@ func (e *Engine) RegisterDevice() error {
 		return fmt.Errorf("failed to compute sign bytes: %w", err)
 	}
 
-	signature := crypto.Sign(keys.PrivkeySign, signBytes)
+	signature, err := crypto.Sign(keys.PrivkeySign.Bytes(), signBytes)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
 
 	bundle := DeviceBundle{
 		DeviceID:         keys.DeviceID,
@@ -78,6 +84,7 @@ func (e *Engine) CreateVault() error {
 	if err != nil {
 		return fmt.Errorf("failed to get device keys: %w", err)
 	}
+	defer keys.Destroy()
 
 	vaultID := NewUUID()
 
@@ -85,6 +92,7 @@ func (e *Engine) CreateVault() error {
 	if _, err := rand.Read(vaultKey[:]); err != nil {
 		return fmt.Errorf("failed to generate vault key: %w", err)
 	}
+	defer secmem.Wipe(vaultKey[:])
 
 	memberEventID := NewUUID()
 	memberSeq := uint64(1)
@@ -99,7 +107,10 @@ func (e *Engine) CreateVault() error {
 	if err != nil {
 		return fmt.Errorf("failed to compute bundle sign bytes: %w", err)
 	}
-	bundleSig := crypto.Sign(keys.PrivkeySign, bundleSignBytes)
+	bundleSig, err := crypto.Sign(keys.PrivkeySign.Bytes(), bundleSignBytes)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
 
 	signBytes, err := SignBytesMemberAdd(
 		memberEventID.Bytes(),
@@ -118,7 +129,10 @@ func (e *Engine) CreateVault() error {
 		return fmt.Errorf("failed to compute sign bytes: %w", err)
 	}
 
-	signature := crypto.Sign(keys.PrivkeySign, signBytes)
+	signature, err := crypto.Sign(keys.PrivkeySign.Bytes(), signBytes)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
 
 	memberEvent := MemberEvent{
 		MsgType:           "member_add",
@@ -143,7 +157,7 @@ func (e *Engine) CreateVault() error {
 	if err := e.state.SetVaultID(vaultID); err != nil {
 		return fmt.Errorf("failed to save vault_id: %w", err)
 	}
-	if err := e.state.SetVaultKey(vaultKey); err != nil {
+	if err := e.state.SetVaultKey(vaultKey[:]); err != nil {
 		return fmt.Errorf("failed to save vault_key: %w", err)
 	}
 	if err := e.state.SetKeyEpoch(1); err != nil {
@@ -181,6 +195,7 @@ func (e *Engine) JoinVault(inviteID UUID) error {
 	if err != nil {
 		return fmt.Errorf("failed to get device keys: %w", err)
 	}
+	defer keys.Destroy()
 
 	invites, err := e.client.GetInvites(string(keys.DeviceID))
 	if err != nil {
@@ -209,7 +224,7 @@ func (e *Engine) JoinVault(inviteID UUID) error {
 	decrypted, err := crypto.BoxOpen(
 		append(invite.Nonce, invite.WrappedPayload...),
 		&creatorPubBox,
-		&keys.PrivkeyBox,
+		keys.PrivkeyBox.Array32(),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to decrypt invite payload: %w", err)
@@ -221,6 +236,8 @@ func (e *Engine) JoinVault(inviteID UUID) error {
 
 	var vaultKey [32]byte
 	copy(vaultKey[:], decrypted[:32])
+	secmem.Wipe(decrypted)
+	defer secmem.Wipe(vaultKey[:])
 
 	deviceIDBytes, err := keys.DeviceID.Bytes()
 	if err != nil {
@@ -232,7 +249,10 @@ func (e *Engine) JoinVault(inviteID UUID) error {
 		return fmt.Errorf("failed to compute claim sign bytes: %w", err)
 	}
 
-	claimSig := crypto.Sign(keys.PrivkeySign, claimSignBytes)
+	claimSig, err := crypto.Sign(keys.PrivkeySign.Bytes(), claimSignBytes)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
 
 	claim := InviteClaim{
 		MsgType:   "invite_claim",
@@ -249,7 +269,7 @@ func (e *Engine) JoinVault(inviteID UUID) error {
 	if err := e.state.SetVaultID(invite.VaultID); err != nil {
 		return fmt.Errorf("failed to save vault_id: %w", err)
 	}
-	if err := e.state.SetVaultKey(vaultKey); err != nil {
+	if err := e.state.SetVaultKey(vaultKey[:]); err != nil {
 		return fmt.Errorf("failed to save vault_key: %w", err)
 	}
 	if err := e.state.SetKeyEpoch(1); err != nil {
@@ -299,6 +319,7 @@ func (e *Engine) InviteDevice(targetBundle DeviceBundle) (*Invite, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get device keys: %w", err)
 	}
+	defer keys.Destroy()
 
 	vaultID, err := e.state.GetVaultID()
 	if err != nil {
@@ -309,11 +330,12 @@ func (e *Engine) InviteDevice(targetBundle DeviceBundle) (*Invite, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get vault_key: %w", err)
 	}
+	defer vaultKey.Destroy()
 
 	targetPubBox := [32]byte{}
 	copy(targetPubBox[:], targetBundle.DevicePubkeyBox)
 
-	sealed, err := crypto.BoxSeal(vaultKey[:], &targetPubBox, &keys.PrivkeyBox)
+	sealed, err := crypto.BoxSeal(vaultKey.Bytes(), &targetPubBox, keys.PrivkeyBox.Array32())
 	if err != nil {
 		return nil, fmt.Errorf("failed to encrypt vault key: %w", err)
 	}
@@ -349,7 +371,10 @@ func (e *Engine) InviteDevice(targetBundle DeviceBundle) (*Invite, error) {
 		return nil, fmt.Errorf("failed to compute sign bytes: %w", err)
 	}
 
-	signature := crypto.Sign(keys.PrivkeySign, signBytes)
+	signature, err := crypto.Sign(keys.PrivkeySign.Bytes(), signBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
 
 	invite := Invite{
 		MsgType:                "invite",
@@ -390,6 +415,7 @@ func (e *Engine) AcceptInviteClaim(claim InviteClaim) error {
 	if err != nil {
 		return fmt.Errorf("failed to get device keys: %w", err)
 	}
+	defer keys.Destroy()
 
 	vaultID, err := e.state.GetVaultID()
 	if err != nil {
@@ -440,7 +466,10 @@ func (e *Engine) AcceptInviteClaim(claim InviteClaim) error {
 		return fmt.Errorf("failed to compute sign bytes: %w", err)
 	}
 
-	signature := crypto.Sign(keys.PrivkeySign, signBytes)
+	signature, err := crypto.Sign(keys.PrivkeySign.Bytes(), signBytes)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
 
 	memberEvent := MemberEvent{
 		MsgType:           "member_add",
@@ -487,6 +516,7 @@ func (e *Engine) AcceptPendingInviteClaims() error {
 	if err != nil {
 		return fmt.Errorf("failed to get device keys: %w", err)
 	}
+	defer keys.Destroy()
 
 	claims, err := e.client.GetInviteClaims(string(keys.DeviceID))
 	if err != nil {
@@ -525,6 +555,7 @@ func (e *Engine) RemoveMember(targetDeviceID DeviceID) error {
 	if err != nil {
 		return fmt.Errorf("failed to get device keys: %w", err)
 	}
+	defer keys.Destroy()
 
 	vaultID, err := e.state.GetVaultID()
 	if err != nil {
@@ -568,7 +599,10 @@ func (e *Engine) RemoveMember(targetDeviceID DeviceID) error {
 		return fmt.Errorf("failed to compute sign bytes: %w", err)
 	}
 
-	signature := crypto.Sign(keys.PrivkeySign, signBytes)
+	signature, err := crypto.Sign(keys.PrivkeySign.Bytes(), signBytes)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
 
 	memberEvent := MemberEvent{
 		MsgType:         "member_remove",
@@ -642,17 +676,33 @@ func (e *Engine) RefreshMembership() error {
 }
 
 func (e *Engine) FlushPendingEntries() error {
+	// Folders go first so entries do not arrive before the folders they
+	// are placed in.
+	folders, err := e.state.GetPendingFolders()
+	if err != nil {
+		return fmt.Errorf("failed to load pending folders: %w", err)
+	}
+	var firstErr error
+	for _, item := range folders {
+		if err := e.PushFolder(item.Folder, item.Op); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		_ = e.state.RemovePendingFolder(item.Folder.ID)
+	}
+
 	pending, err := e.state.GetPendingEntries()
 	if err != nil {
 		return fmt.Errorf("failed to load pending entries: %w", err)
 	}
 	if len(pending) == 0 {
-		return nil
+		return firstErr
 	}
 
-	var firstErr error
 	for _, item := range pending {
-		if item.Op != "upsert" && item.Op != "delete" {
+		if !isEntryOp(item.Op) {
 			if firstErr == nil {
 				firstErr = fmt.Errorf("invalid pending operation: %s", item.Op)
 			}
@@ -686,18 +736,246 @@ func isInviteAlreadyUsed(err error) bool {
 	return false
 }
 
+// opAttachmentChunk events carry one models.AttachmentChunk and no entry.
+// Clients that predate attachments skip them as unknown ops.
+const opAttachmentChunk = "attachment_chunk"
+
+// Folder events carry one models.Folder and no entry, so the folder tree
+// syncs separately from the entries placed in it.
+const (
+	opFolderUpsert = "folder_upsert"
+	opFolderDelete = "folder_delete"
+)
+
+// Entry events are "upsert" and "delete", plus "trash", which carries the
+// entry with DeletedAt set, and "restore", which takes it back out. A
+// delete also purges the entry from the trash.
+func isEntryOp(op string) bool {
+	switch op {
+	case "upsert", "delete", "trash", "restore":
+		return true
+	}
+	return false
+}
+
+// eventPayload is the plaintext of an event.
+type eventPayload struct {
+	Op     string                  `json:"op"`
+	Entry  models.Entry            `json:"entry"`
+	Chunk  *models.AttachmentChunk `json:"chunk,omitempty"`
+	Folder *models.Folder          `json:"folder,omitempty"`
+}
+
+// PushFolder pushes a folder change. op is "upsert" or "delete", as for
+// entries.
+func (e *Engine) PushFolder(folder models.Folder, op string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch op {
+	case "upsert":
+		op = opFolderUpsert
+	case "delete":
+		op = opFolderDelete
+	default:
+		return fmt.Errorf("invalid operation: %s", op)
+	}
+	return e.pushEvent(eventPayload{Op: op, Folder: &folder})
+}
+
+// receiveFolder applies a pulled folder change to the local folder list.
+// Like entries, the last change pulled wins.
+func (e *Engine) receiveFolder(op string, folder *models.Folder) {
+	if folder == nil || folder.ID == "" {
+		return
+	}
+	folders, err := e.store.Folders()
+	if err != nil {
+		return
+	}
+	next := make([]models.Folder, 0, len(folders)+1)
+	for _, f := range folders {
+		if f.ID != folder.ID {
+			next = append(next, f)
+		}
+	}
+	if op == opFolderUpsert {
+		if folder.Validate() != nil {
+			return
+		}
+		next = append(next, *folder)
+	}
+	_ = e.store.SaveFolders(next)
+}
+
+// updateTrash puts a pulled entry in the local trash, or takes it out.
+// The trash is only rewritten when that changes it.
+func (e *Engine) updateTrash(entry models.Entry, trashed bool) {
+	trash, err := e.store.Trash()
+	if err != nil {
+		return
+	}
+	next := make([]models.Entry, 0, len(trash)+1)
+	for _, t := range trash {
+		if t.ID != entry.ID {
+			next = append(next, t)
+		}
+	}
+	if trashed {
+		if entry.DeletedAt == nil {
+			entry = entry.Trashed(time.Now())
+		}
+		next = append(next, entry)
+	} else if len(next) == len(trash) {
+		return
+	}
+	_ = e.store.SaveTrash(next)
+}
+
+// PushEntry pushes an entry change. Upserts and restores are followed by
+// the contents of any attachments this device has not pushed yet, in
+// chunks.
 func (e *Engine) PushEntry(entry models.Entry, op string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	if op != "upsert" && op != "delete" {
+	if !isEntryOp(op) {
 		return fmt.Errorf("invalid operation: %s", op)
 	}
 
+	if err := e.pushEvent(eventPayload{Op: op, Entry: entry}); err != nil {
+		return err
+	}
+
+	if op == "upsert" || op == "restore" {
+		_ = e.state.SetEntryScheme(entry.ID, "v2")
+		return e.pushAttachments(entry)
+	}
+	_ = e.state.RemoveEntryScheme(entry.ID)
+	return nil
+}
+
+func (e *Engine) pushAttachments(entry models.Entry) error {
+	for _, a := range entry.Attachments {
+		if e.state.AttachmentSent(a.ID) || !e.store.HasAttachment(a.ID) {
+			continue
+		}
+		content, err := e.store.Attachment(a.ID)
+		if err != nil {
+			return fmt.Errorf("failed to read attachment %s: %w", a.Name, err)
+		}
+		for _, chunk := range models.SplitAttachment(a, content, AttachmentChunkSize) {
+			chunk := chunk
+			if err := e.pushEvent(eventPayload{Op: opAttachmentChunk, Chunk: &chunk}); err != nil {
+				secmem.Wipe(content)
+				return fmt.Errorf("failed to push attachment %s: %w", a.Name, err)
+			}
+		}
+		secmem.Wipe(content)
+		_ = e.state.SetAttachmentSent(a.ID)
+	}
+	return nil
+}
+
+// receiveChunk keeps a pulled chunk and stores the attachment once it is
+// complete. Bad chunks are dropped like events that fail to decrypt.
+func (e *Engine) receiveChunk(chunk *models.AttachmentChunk) {
+	if chunk == nil || e.store.HasAttachment(chunk.AttachmentID) {
+		return
+	}
+	content, err := e.state.PutAttachmentChunk(*chunk)
+	if err != nil || content == nil {
+		return
+	}
+	defer secmem.Wipe(content)
+	if err := e.store.PutAttachment(chunk.AttachmentID, content); err != nil {
+		return
+	}
+	_ = e.state.SetAttachmentSent(chunk.AttachmentID)
+}
+
+// Resync rebuilds this device's event head and lamport clock from the
+// server after the database was restored from a backup, so the next push
+// continues the chain peers have instead of forking it. It does nothing
+// otherwise. Pushes call it first.
+func (e *Engine) Resync() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.resync()
+}
+
+func (e *Engine) resync() error {
+	if !e.state.ResyncRequired() {
+		return nil
+	}
+
 	keys, err := e.state.GetDeviceKeys()
 	if err != nil {
 		return fmt.Errorf("failed to get device keys: %w", err)
 	}
+	defer keys.Destroy()
+
+	vaultID, err := e.state.GetVaultID()
+	if err != nil {
+		return fmt.Errorf("failed to get vault_id: %w", err)
+	}
+
+	// The pull cursor is left alone: the restore reset it, and the next
+	// pull applies these events to the vault.
+	events, err := e.client.PullEvents(vaultID, 0)
+	if err != nil {
+		return fmt.Errorf("failed to pull events: %w", err)
+	}
+
+	var head EventHead
+	var maxLamport uint64
+	for _, event := range events {
+		if uint64(event.Lamport) > maxLamport {
+			maxLamport = uint64(event.Lamport)
+		}
+		if event.DeviceID != keys.DeviceID || uint64(event.Counter) <= head.LastCounter {
+			continue
+		}
+		deviceIDBytes, err := event.DeviceID.Bytes()
+		if err != nil {
+			continue
+		}
+		signBytes, err := SignBytesEvent(
+			event.EventID.Bytes(),
+			event.VaultID.Bytes(),
+			deviceIDBytes,
+			uint64(event.Counter),
+			uint64(event.Lamport),
+			uint64(event.KeyEpoch),
+			event.PrevHash,
+			event.Nonce,
+			event.Ciphertext,
+		)
+		if err != nil || !crypto.Verify(keys.PubkeySign, signBytes, event.Signature) {
+			continue
+		}
+		head = EventHead{LastCounter: uint64(event.Counter), LastHash: sha256.Sum256(signBytes)}
+	}
+
+	if err := e.state.SetEventHead(keys.DeviceID, &head); err != nil {
+		return fmt.Errorf("failed to update event head: %w", err)
+	}
+	if _, err := e.state.UpdateLamport(maxLamport); err != nil {
+		return fmt.Errorf("failed to update lamport: %w", err)
+	}
+	return e.state.ClearResyncRequired()
+}
+
+// pushEvent encrypts, signs and pushes one event. The caller holds e.mu.
+func (e *Engine) pushEvent(payload eventPayload) error {
+	if err := e.resync(); err != nil {
+		return err
+	}
+	keys, err := e.state.GetDeviceKeys()
+	if err != nil {
+		return fmt.Errorf("failed to get device keys: %w", err)
+	}
+	defer keys.Destroy()
 
 	vaultID, err := e.state.GetVaultID()
 	if err != nil {
@@ -719,10 +997,13 @@ func (e *Engine) PushEntry(entry models.Entry, op string) error {
 		return fmt.Errorf("failed to increment lamport: %w", err)
 	}
 
-	ciphertext, nonce, err := e.encryptEventPayload(op, entry)
+	ciphertext, nonce, err := e.encryptEventPayload(payload)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt event: %w", err)
 	}
+	if len(ciphertext) > MaxEventCiphertext {
+		return fmt.Errorf("event of %d bytes exceeds the %d byte limit", len(ciphertext), MaxEventCiphertext)
+	}
 
 	eventID := NewUUID()
 	counter := eventHead.LastCounter + 1
@@ -747,7 +1028,10 @@ func (e *Engine) PushEntry(entry models.Entry, op string) error {
 		return fmt.Errorf("failed to compute sign bytes: %w", err)
 	}
 
-	signature := crypto.Sign(keys.PrivkeySign, signBytes)
+	signature, err := crypto.Sign(keys.PrivkeySign.Bytes(), signBytes)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
 
 	event := Event{
 		MsgType:    "event",
@@ -775,12 +1059,6 @@ func (e *Engine) PushEntry(entry models.Entry, op string) error {
 		return fmt.Errorf("failed to update event head: %w", err)
 	}
 
-	if op == "upsert" {
-		_ = e.state.SetEntryScheme(entry.ID, "v2")
-	} else {
-		_ = e.state.RemoveEntryScheme(entry.ID)
-	}
-
 	return nil
 }
 
@@ -849,16 +1127,25 @@ func (e *Engine) PullEvents() ([]models.Entry, error) {
 			continue
 		}
 
-		op, entry, scheme, err := e.decryptEventPayload(event.Ciphertext, event.Nonce, uint64(event.KeyEpoch))
+		payload, scheme, err := e.decryptEventPayload(event.Ciphertext, event.Nonce, uint64(event.KeyEpoch))
 		if err != nil {
 			continue
 		}
-
-		if op == "upsert" || op == "delete" {
+		op, entry := payload.Op, payload.Entry
+
+		if op == opAttachmentChunk {
+			e.receiveChunk(payload.Chunk)
+		} else if op == opFolderUpsert || op == opFolderDelete {
+			e.receiveFolder(op, payload.Folder)
+		} else if isEntryOp(op) {
+			if op == "restore" {
+				entry = entry.Restored()
+			}
 			updatedEntries = append(updatedEntries, entry)
-			if op == "upsert" {
+			e.updateTrash(entry, op == "trash")
+			if op == "upsert" || op == "restore" {
 				_ = e.state.SetEntryScheme(entry.ID, scheme)
-			} else if op == "delete" {
+			} else {
 				_ = e.state.RemoveEntryScheme(entry.ID)
 			}
 		}
@@ -955,34 +1242,53 @@ func (e *Engine) SyncEntries(localEntries []models.Entry) ([]models.Entry, error
 			continue
 		}
 
-		op, entry, scheme, err := e.decryptEventPayload(event.Ciphertext, event.Nonce, uint64(event.KeyEpoch))
+		payload, scheme, err := e.decryptEventPayload(event.Ciphertext, event.Nonce, uint64(event.KeyEpoch))
 		if err != nil {
 			continue
 		}
+		op, entry := payload.Op, payload.Entry
 
 		eventLamport := uint64(event.Lamport)
 		eventDeviceID := string(event.DeviceID)
 
-		if op == "delete" {
+		if op == opAttachmentChunk {
+			e.receiveChunk(payload.Chunk)
+		} else if op == opFolderUpsert || op == opFolderDelete {
+			e.receiveFolder(op, payload.Folder)
+		} else if op == "delete" || op == "trash" {
 			existingLamport, exists := entryLamport[entry.ID]
 			if !exists || eventLamport > existingLamport ||
 				(eventLamport == existingLamport && eventDeviceID > entryDeviceID[entry.ID]) {
-				deletedIDs[entry.ID] = true
+				// A trashed entry can still be restored; a deleted one
+				// is gone for good.
+				if op == "delete" {
+					deletedIDs[entry.ID] = true
+				}
 				delete(entryMap, entry.ID)
 				entryLamport[entry.ID] = eventLamport
 				entryDeviceID[entry.ID] = eventDeviceID
+				e.updateTrash(entry, op == "trash")
 				_ = e.state.RemoveEntryScheme(entry.ID)
 			}
-		} else if op == "upsert" {
+		} else if op == "upsert" || op == "restore" {
+			if op == "restore" {
+				entry = entry.Restored()
+			}
 			existingLamport, exists := entryLamport[entry.ID]
 			if !exists || eventLamport > existingLamport ||
 				(eventLamport == existingLamport && eventDeviceID > entryDeviceID[entry.ID]) {
 				if !deletedIDs[entry.ID] {
+					if prev, ok := entryMap[entry.ID]; ok {
+						entry = mergeEntryHistory(prev, entry)
+					}
 					entryMap[entry.ID] = entry
 					entryLamport[entry.ID] = eventLamport
 					entryDeviceID[entry.ID] = eventDeviceID
+					e.updateTrash(entry, false)
 					_ = e.state.SetEntryScheme(entry.ID, scheme)
 				}
+			} else if current, ok := entryMap[entry.ID]; ok {
+				entryMap[entry.ID] = mergeEntryHistory(entry, current)
 			}
 		}
 
@@ -1014,29 +1320,48 @@ func (e *Engine) SyncEntries(localEntries []models.Entry) ([]models.Entry, error
 	return result, nil
 }
 
-func (e *Engine) encryptEventPayload(op string, entry models.Entry) (ciphertext, nonce []byte, err error) {
+// mergeEntryHistory keeps the credential history of both versions when
+// winner replaces prev, and records prev's password if it was never seen by
+// the winner, so concurrent rotations on two devices do not lose one.
+func mergeEntryHistory(prev, winner models.Entry) models.Entry {
+	history := models.MergeCredentialHistory(winner.History, prev.History)
+	if prev.Password != winner.Password || prev.Username != winner.Username {
+		known := false
+		for _, c := range history {
+			if c.Password == prev.Password && c.Username == prev.Username {
+				known = true
+				break
+			}
+		}
+		if !known {
+			history = models.MergeCredentialHistory(history, []models.CredentialChange{{
+				Username:  prev.Username,
+				Password:  prev.Password,
+				ChangedAt: prev.UpdatedAt,
+			}})
+		}
+	}
+	winner.History = history
+	return winner
+}
+
+func (e *Engine) encryptEventPayload(payload eventPayload) (ciphertext, nonce []byte, err error) {
 	vaultKey, err := e.state.GetVaultKey()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get vault_key: %w", err)
 	}
+	defer vaultKey.Destroy()
 
 	keyEpoch, err := e.state.GetKeyEpoch()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get key_epoch: %w", err)
 	}
 
-	eventKey, err := deriveEventKey(vaultKey[:], keyEpoch)
+	eventKey, err := deriveEventKey(vaultKey.Bytes(), keyEpoch)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to derive event key: %w", err)
 	}
-
-	payload := struct {
-		Op    string       `json:"op"`
-		Entry models.Entry `json:"entry"`
-	}{
-		Op:    op,
-		Entry: entry,
-	}
+	defer secmem.Wipe(eventKey)
 
 	plaintext, err := json.Marshal(payload)
 	if err != nil {
@@ -1058,33 +1383,29 @@ func (e *Engine) encryptEventPayload(op string, entry models.Entry) (ciphertext,
 	return ciphertext, nonce, nil
 }
 
-func (e *Engine) decryptEventPayload(ciphertext, nonce []byte, keyEpoch uint64) (op string, entry models.Entry, scheme string, err error) {
+func (e *Engine) decryptEventPayload(ciphertext, nonce []byte, keyEpoch uint64) (payload eventPayload, scheme string, err error) {
 	vaultKey, err := e.state.GetVaultKey()
 	if err != nil {
-		return "", entry, "", fmt.Errorf("failed to get vault_key: %w", err)
+		return payload, "", fmt.Errorf("failed to get vault_key: %w", err)
 	}
+	defer vaultKey.Destroy()
 
-	plaintext, err := decryptEventPayloadXChaCha(vaultKey[:], keyEpoch, nonce, ciphertext)
+	plaintext, err := decryptEventPayloadXChaCha(vaultKey.Bytes(), keyEpoch, nonce, ciphertext)
 	if err != nil {
-		plaintext, err = decryptEventPayloadLegacy(vaultKey[:], keyEpoch, nonce, ciphertext)
+		plaintext, err = decryptEventPayloadLegacy(vaultKey.Bytes(), keyEpoch, nonce, ciphertext)
 		if err != nil {
-			return "", entry, "", fmt.Errorf("failed to decrypt: %w", err)
+			return payload, "", fmt.Errorf("failed to decrypt: %w", err)
 		}
 		scheme = "legacy"
 	} else {
 		scheme = "v2"
 	}
 
-	var payload struct {
-		Op    string       `json:"op"`
-		Entry models.Entry `json:"entry"`
-	}
-
 	if err := json.Unmarshal(plaintext, &payload); err != nil {
-		return "", entry, "", fmt.Errorf("failed to unmarshal payload: %w", err)
+		return payload, "", fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
 
-	return payload.Op, payload.Entry, scheme, nil
+	return payload, scheme, nil
 }
 
 func decryptEventPayloadXChaCha(vaultKey []byte, keyEpoch uint64, nonce, ciphertext []byte) ([]byte, error) {
@@ -1092,6 +1413,7 @@ func decryptEventPayloadXChaCha(vaultKey []byte, keyEpoch uint64, nonce, ciphert
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive event key: %w", err)
 	}
+	defer secmem.Wipe(eventKey)
 
 	aead, err := chacha20poly1305.NewX(eventKey)
 	if err != nil {
@@ -1112,6 +1434,7 @@ func decryptEventPayloadLegacy(vaultKey []byte, keyEpoch uint64, nonce, cipherte
 	}
 
 	legacyKey := deriveLegacyEventKey(vaultKey, keyEpoch)
+	defer secmem.Wipe(legacyKey[:])
 	var nonceArr [24]byte
 	copy(nonceArr[:], nonce)
 
@@ -1128,6 +1451,7 @@ func (e *Engine) signEvent(event *Event) error {
 	if err != nil {
 		return fmt.Errorf("failed to get device keys: %w", err)
 	}
+	defer keys.Destroy()
 
 	deviceIDBytes, err := keys.DeviceID.Bytes()
 	if err != nil {
@@ -1149,7 +1473,11 @@ func (e *Engine) signEvent(event *Event) error {
 		return fmt.Errorf("failed to compute sign bytes: %w", err)
 	}
 
-	event.Signature = crypto.Sign(keys.PrivkeySign, signBytes)
+	signature, err := crypto.Sign(keys.PrivkeySign.Bytes(), signBytes)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
+	event.Signature = signature
 	return nil
 }
 
@@ -1158,6 +1486,7 @@ func (e *Engine) signMemberEvent(event *MemberEvent) error {
 	if err != nil {
 		return fmt.Errorf("failed to get device keys: %w", err)
 	}
+	defer keys.Destroy()
 
 	deviceIDBytes, err := keys.DeviceID.Bytes()
 	if err != nil {
@@ -1201,7 +1530,11 @@ func (e *Engine) signMemberEvent(event *MemberEvent) error {
 		return fmt.Errorf("failed to compute sign bytes: %w", err)
 	}
 
-	event.Signature = crypto.Sign(keys.PrivkeySign, signBytes)
+	signature, err := crypto.Sign(keys.PrivkeySign.Bytes(), signBytes)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
+	event.Signature = signature
 	return nil
 }
 
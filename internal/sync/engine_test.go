@@ -0,0 +1,109 @@
+package sync
+
+import (
+	"testing"
+
+	"forgor/internal/models"
+)
+
+func TestReceiveFolder(t *testing.T) {
+	store := newTestVault(t)
+	state, err := NewSyncState(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(nil, state, store)
+
+	work := models.NewFolder("Work", "")
+	e.receiveFolder(opFolderUpsert, &work)
+	renamed := work
+	renamed.Name = "Job"
+	e.receiveFolder(opFolderUpsert, &renamed)
+	// Invalid folders and folders without an ID are ignored.
+	e.receiveFolder(opFolderUpsert, &models.Folder{ID: "empty"})
+	e.receiveFolder(opFolderUpsert, &models.Folder{Name: "No ID"})
+	e.receiveFolder(opFolderUpsert, nil)
+
+	folders, err := store.Folders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != 1 || folders[0].ID != work.ID || folders[0].Name != "Job" {
+		t.Fatalf("folders = %+v, want the renamed folder", folders)
+	}
+
+	e.receiveFolder(opFolderDelete, &work)
+	folders, err = store.Folders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != 0 {
+		t.Errorf("folders after delete = %+v", folders)
+	}
+}
+
+func TestPendingFolders(t *testing.T) {
+	store := newTestVault(t)
+	state, err := NewSyncState(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	work := models.NewFolder("Work", "")
+	if err := state.AddPendingFolder("upsert", work); err != nil {
+		t.Fatal(err)
+	}
+	// A later change replaces the queued one.
+	if err := state.AddPendingFolder("delete", work); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.AddPendingEntry("upsert", models.Entry{ID: "a", Website: "a.example"}); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := state.GetPendingFolders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Op != "delete" || pending[0].Folder.ID != work.ID {
+		t.Fatalf("pending folders = %+v", pending)
+	}
+
+	if err := state.ClearPendingEntries(); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := state.GetPendingFolders(); len(pending) != 0 {
+		t.Errorf("pending folders after clear = %+v", pending)
+	}
+	if pending, _ := state.GetPendingEntries(); len(pending) != 0 {
+		t.Errorf("pending entries after clear = %+v", pending)
+	}
+}
+
+func TestUpdateTrash(t *testing.T) {
+	store := newTestVault(t)
+	state, err := NewSyncState(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(nil, state, store)
+	entry := models.Entry{ID: "a", Website: "a.example", Password: "1"}
+
+	// A pulled trash keeps the entry restorable.
+	e.updateTrash(entry, true)
+	trash, err := store.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != entry.ID || trash[0].DeletedAt == nil {
+		t.Fatalf("trash = %+v, want the trashed entry", trash)
+	}
+
+	// A pulled delete, from a purge or expiry elsewhere, removes it.
+	e.updateTrash(entry, false)
+	trash, err = store.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 0 {
+		t.Errorf("trash after delete = %+v", trash)
+	}
+}
@@ -18,14 +18,14 @@ import (
 // I focused majority on the cloud based coordination server since that's the main use case for now imo.
 
 type LANServer struct {
-	store  *storage.Store
+	store  storage.Vault
 	state  *SyncState
 	port   int
 	server *http.Server
 	mu     gosync.RWMutex
 }
 
-func NewLANServer(store *storage.Store, state *SyncState, port int) *LANServer {
+func NewLANServer(store storage.Vault, state *SyncState, port int) *LANServer {
 	return &LANServer{
 		store: store,
 		state: state,
@@ -84,6 +84,7 @@ func (s *LANServer) handleWhoami(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusInternalServerError, "internal_error", "Failed to get device keys")
 		return
 	}
+	keys.Destroy()
 
 	vaultID, err := s.state.GetVaultID()
 	if err != nil {
@@ -230,6 +230,7 @@ type EventResponse struct {
 
 const (
 	MaxEventCiphertext    = 65536   // this is 64 KiB
+	AttachmentChunkSize   = 32768   // this is 32 KiB, which stays under MaxEventCiphertext as base64
 	MaxSnapshotCiphertext = 8388608 // this is 8 MiB
 	MaxWrappedPayload     = 1024    // this is 1 KiB
 	MaxTags               = 128
@@ -13,8 +13,9 @@ import (
 
 	"forgor/internal/crypto"
 	"forgor/internal/models"
+	"forgor/internal/secmem"
+	"forgor/internal/storage"
 
-	bolt "go.etcd.io/bbolt"
 	"golang.org/x/crypto/curve25519"
 )
 
@@ -23,7 +24,12 @@ var (
 	syncMembersBucket    = []byte("sync_members")
 	syncEventHeadsBucket = []byte("sync_event_heads")
 	syncPendingBucket    = []byte("sync_pending")
+	syncPendingFolders   = []byte("sync_pending_folders")
 	syncEntrySchemes     = []byte("sync_entry_schemes")
+	// Chunks of attachments still arriving, and the IDs of attachments
+	// whose contents this device has pushed or received.
+	syncAttachmentChunks = []byte("sync_attachment_chunks")
+	syncAttachmentsSent  = []byte("sync_attachments_sent")
 
 	keyVaultID        = []byte("vault_id")
 	keyDeviceID       = []byte("device_id")
@@ -40,14 +46,24 @@ var (
 	keyLamport        = []byte("lamport")
 	keyServerURL      = []byte("server_url")
 	keySchemeCutover  = []byte("scheme_cutover")
+	// keyResyncRequired is set when the database is restored from a backup;
+	// see Engine.Resync.
+	keyResyncRequired = []byte("resync_required")
 )
 
+// DeviceKeys are this device's sync identity. The private keys live in
+// guarded memory; call Destroy once they are no longer needed.
 type DeviceKeys struct {
 	DeviceID    DeviceID
 	PubkeySign  [32]byte
-	PrivkeySign [64]byte
+	PrivkeySign *secmem.Buffer
 	PubkeyBox   [32]byte
-	PrivkeyBox  [32]byte
+	PrivkeyBox  *secmem.Buffer
+}
+
+func (k *DeviceKeys) Destroy() {
+	k.PrivkeySign.Destroy()
+	k.PrivkeyBox.Destroy()
 }
 
 type MembershipHead struct {
@@ -72,18 +88,29 @@ type PendingEntry struct {
 	Entry models.Entry `json:"entry"`
 }
 
+type PendingFolder struct {
+	Op     string        `json:"op"`
+	Folder models.Folder `json:"folder"`
+}
+
 type SyncState struct {
-	db       *bolt.DB
-	vaultKey []byte
+	store storage.Vault
+	// vaultKey is the store's own buffer, not a copy, so locking the
+	// store also wipes it and every device key derived from it.
+	vaultKey *secmem.Buffer
 	mu       sync.RWMutex
 }
 
-func NewSyncState(db *bolt.DB, vaultKey []byte) (*SyncState, error) {
+// NewSyncState opens the sync state kept in store, which must be unlocked.
+func NewSyncState(store storage.Vault) (*SyncState, error) {
+	vaultKey := store.VaultKey()
+	if !vaultKey.Alive() {
+		return nil, fmt.Errorf("vault is locked")
+	}
 	s := &SyncState{
-		db:       db,
-		vaultKey: make([]byte, len(vaultKey)),
+		store:    store,
+		vaultKey: vaultKey,
 	}
-	copy(s.vaultKey, vaultKey)
 
 	if err := s.initBuckets(); err != nil {
 		return nil, err
@@ -92,9 +119,14 @@ func NewSyncState(db *bolt.DB, vaultKey []byte) (*SyncState, error) {
 	return s, nil
 }
 
+// initBuckets creates the sync buckets. A read-only database is left as
+// it is; readers treat missing buckets as empty.
 func (s *SyncState) initBuckets() error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		for _, bucket := range [][]byte{syncMetaBucket, syncMembersBucket, syncEventHeadsBucket, syncPendingBucket, syncEntrySchemes} {
+	if s.store.ReadOnly() {
+		return nil
+	}
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
+		for _, bucket := range [][]byte{syncMetaBucket, syncMembersBucket, syncEventHeadsBucket, syncPendingBucket, syncPendingFolders, syncEntrySchemes, syncAttachmentChunks, syncAttachmentsSent} {
 			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
 				return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
 			}
@@ -103,20 +135,24 @@ func (s *SyncState) initBuckets() error {
 	})
 }
 
+// getVaultKey returns a copy of the vault key for one operation. Callers
+// wipe it.
 func (s *SyncState) getVaultKey() ([]byte, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if s.vaultKey == nil {
 		return nil, fmt.Errorf("sync state not initialized")
 	}
-	key := make([]byte, len(s.vaultKey))
-	copy(key, s.vaultKey)
+	key, err := s.vaultKey.Copy()
+	if err != nil {
+		return nil, fmt.Errorf("vault is locked")
+	}
 	return key, nil
 }
 
 func (s *SyncState) IsConfigured() bool {
 	var configured bool
-	s.db.View(func(tx *bolt.Tx) error {
+	s.store.SyncView(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		if meta == nil {
 			return nil
@@ -129,7 +165,7 @@ func (s *SyncState) IsConfigured() bool {
 
 func (s *SyncState) GetVaultID() (UUID, error) {
 	var vaultID UUID
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		data := meta.Get(keyVaultID)
 		if data == nil {
@@ -145,7 +181,7 @@ func (s *SyncState) GetVaultID() (UUID, error) {
 }
 
 func (s *SyncState) SetVaultID(vaultID UUID) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		return meta.Put(keyVaultID, vaultID.Bytes())
 	})
@@ -156,9 +192,10 @@ func (s *SyncState) GetDeviceKeys() (*DeviceKeys, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer secmem.Wipe(vaultKey)
 
 	var keys DeviceKeys
-	err = s.db.View(func(tx *bolt.Tx) error {
+	err = s.store.SyncView(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 
 		deviceIDBytes := meta.Get(keyDeviceID)
@@ -177,14 +214,17 @@ func (s *SyncState) GetDeviceKeys() (*DeviceKeys, error) {
 		if privkeySignEnc == nil {
 			return fmt.Errorf("privkey_sign not set")
 		}
-		privkeySign, err := crypto.Decrypt(vaultKey, privkeySignEnc)
+		privkeySign, err := crypto.DecryptWithAD(vaultKey, privkeySignEnc, crypto.StorageAD(syncMetaBucket, keyPrivkeySignEnc))
 		if err != nil {
 			return fmt.Errorf("failed to decrypt privkey_sign: %w", err)
 		}
 		if len(privkeySign) != 64 {
+			secmem.Wipe(privkeySign)
 			return fmt.Errorf("invalid privkey_sign length")
 		}
-		copy(keys.PrivkeySign[:], privkeySign)
+		if keys.PrivkeySign, err = s.vaultKey.Derive(privkeySign); err != nil {
+			return fmt.Errorf("vault is locked")
+		}
 
 		pubkeyBox := meta.Get(keyPubkeyBox)
 		if len(pubkeyBox) != 32 {
@@ -196,19 +236,26 @@ func (s *SyncState) GetDeviceKeys() (*DeviceKeys, error) {
 		if privkeyBoxEnc == nil {
 			return fmt.Errorf("privkey_box not set")
 		}
-		privkeyBox, err := crypto.Decrypt(vaultKey, privkeyBoxEnc)
+		privkeyBox, err := crypto.DecryptWithAD(vaultKey, privkeyBoxEnc, crypto.StorageAD(syncMetaBucket, keyPrivkeyBoxEnc))
 		if err != nil {
 			return fmt.Errorf("failed to decrypt privkey_box: %w", err)
 		}
 		if len(privkeyBox) != 32 {
+			secmem.Wipe(privkeyBox)
 			return fmt.Errorf("invalid privkey_box length")
 		}
-		copy(keys.PrivkeyBox[:], privkeyBox)
+		if keys.PrivkeyBox, err = s.vaultKey.Derive(privkeyBox); err != nil {
+			return fmt.Errorf("vault is locked")
+		}
 
 		return nil
 	})
+	if err != nil {
+		keys.Destroy()
+		return nil, err
+	}
 
-	return &keys, err
+	return &keys, nil
 }
 
 func (s *SyncState) SetDeviceKeys(keys *DeviceKeys) error {
@@ -216,18 +263,19 @@ func (s *SyncState) SetDeviceKeys(keys *DeviceKeys) error {
 	if err != nil {
 		return err
 	}
+	defer secmem.Wipe(vaultKey)
 
-	privkeySignEnc, err := crypto.Encrypt(vaultKey, keys.PrivkeySign[:])
+	privkeySignEnc, err := crypto.EncryptWithAD(vaultKey, keys.PrivkeySign.Bytes(), crypto.StorageAD(syncMetaBucket, keyPrivkeySignEnc))
 	if err != nil {
 		return fmt.Errorf("failed to encrypt privkey_sign: %w", err)
 	}
 
-	privkeyBoxEnc, err := crypto.Encrypt(vaultKey, keys.PrivkeyBox[:])
+	privkeyBoxEnc, err := crypto.EncryptWithAD(vaultKey, keys.PrivkeyBox.Bytes(), crypto.StorageAD(syncMetaBucket, keyPrivkeyBoxEnc))
 	if err != nil {
 		return fmt.Errorf("failed to encrypt privkey_box: %w", err)
 	}
 
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 
 		if err := meta.Put(keyDeviceID, []byte(keys.DeviceID)); err != nil {
@@ -250,45 +298,63 @@ func (s *SyncState) SetDeviceKeys(keys *DeviceKeys) error {
 	})
 }
 
-func (s *SyncState) GetVaultKey() ([32]byte, error) {
-	var key [32]byte
+// GetVaultKey returns the shared sync key in guarded memory. It is derived
+// from the session buffer, so locking the vault destroys it too; callers
+// Destroy it once they are done.
+func (s *SyncState) GetVaultKey() (*secmem.Buffer, error) {
 	vaultKey, err := s.getVaultKey()
 	if err != nil {
-		return key, err
+		return nil, err
 	}
+	defer secmem.Wipe(vaultKey)
 
-	err = s.db.View(func(tx *bolt.Tx) error {
+	var decKey []byte
+	err = s.store.SyncView(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		encKey := meta.Get(keyVaultKeyEnc)
 		if encKey == nil {
 			return fmt.Errorf("vault_key not set")
 		}
-		decKey, err := crypto.Decrypt(vaultKey, encKey)
+		decKey, err = crypto.DecryptWithAD(vaultKey, encKey, crypto.StorageAD(syncMetaBucket, keyVaultKeyEnc))
 		if err != nil {
 			return fmt.Errorf("failed to decrypt vault_key: %w", err)
 		}
 		if len(decKey) != 32 {
+			secmem.Wipe(decKey)
 			return fmt.Errorf("invalid vault_key length")
 		}
-		copy(key[:], decKey)
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return key, err
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.vaultKey == nil {
+		secmem.Wipe(decKey)
+		return nil, fmt.Errorf("sync state not initialized")
+	}
+	key, err := s.vaultKey.Derive(decKey)
+	if err != nil {
+		return nil, fmt.Errorf("vault is locked")
+	}
+	return key, nil
 }
 
-func (s *SyncState) SetVaultKey(key [32]byte) error {
+func (s *SyncState) SetVaultKey(key []byte) error {
 	vaultKey, err := s.getVaultKey()
 	if err != nil {
 		return err
 	}
+	defer secmem.Wipe(vaultKey)
 
-	encKey, err := crypto.Encrypt(vaultKey, key[:])
+	encKey, err := crypto.EncryptWithAD(vaultKey, key, crypto.StorageAD(syncMetaBucket, keyVaultKeyEnc))
 	if err != nil {
 		return fmt.Errorf("failed to encrypt vault_key: %w", err)
 	}
 
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		return meta.Put(keyVaultKeyEnc, encKey)
 	})
@@ -296,7 +362,7 @@ func (s *SyncState) SetVaultKey(key [32]byte) error {
 
 func (s *SyncState) GetKeyEpoch() (uint64, error) {
 	var epoch uint64
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		data := meta.Get(keyKeyEpoch)
 		if data == nil {
@@ -309,7 +375,7 @@ func (s *SyncState) GetKeyEpoch() (uint64, error) {
 }
 
 func (s *SyncState) SetKeyEpoch(epoch uint64) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		buf := make([]byte, 8)
 		binary.BigEndian.PutUint64(buf, epoch)
@@ -319,7 +385,7 @@ func (s *SyncState) SetKeyEpoch(epoch uint64) error {
 
 func (s *SyncState) GetOwnerDeviceID() (DeviceID, error) {
 	var deviceID DeviceID
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		data := meta.Get(keyOwnerDeviceID)
 		if data == nil {
@@ -332,7 +398,7 @@ func (s *SyncState) GetOwnerDeviceID() (DeviceID, error) {
 }
 
 func (s *SyncState) SetOwnerDeviceID(deviceID DeviceID) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		return meta.Put(keyOwnerDeviceID, []byte(deviceID))
 	})
@@ -340,7 +406,7 @@ func (s *SyncState) SetOwnerDeviceID(deviceID DeviceID) error {
 
 func (s *SyncState) GetMembershipHead() (*MembershipHead, error) {
 	var head MembershipHead
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 
 		seqData := meta.Get(keyMemberSeq)
@@ -360,7 +426,7 @@ func (s *SyncState) GetMembershipHead() (*MembershipHead, error) {
 }
 
 func (s *SyncState) SetMembershipHead(head *MembershipHead) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 
 		seqBuf := make([]byte, 8)
@@ -375,7 +441,7 @@ func (s *SyncState) SetMembershipHead(head *MembershipHead) error {
 
 func (s *SyncState) GetEventHead(deviceID DeviceID) (*EventHead, error) {
 	var head EventHead
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncEventHeadsBucket)
 		data := bucket.Get([]byte(deviceID))
 		if data == nil {
@@ -392,7 +458,7 @@ func (s *SyncState) GetEventHead(deviceID DeviceID) (*EventHead, error) {
 }
 
 func (s *SyncState) SetEventHead(deviceID DeviceID, head *EventHead) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncEventHeadsBucket)
 		data := make([]byte, 40)
 		binary.BigEndian.PutUint64(data[:8], head.LastCounter)
@@ -403,7 +469,7 @@ func (s *SyncState) SetEventHead(deviceID DeviceID, head *EventHead) error {
 
 func (s *SyncState) GetSyncCursor() (uint64, error) {
 	var cursor uint64
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		data := meta.Get(keySyncCursor)
 		if data == nil {
@@ -416,7 +482,7 @@ func (s *SyncState) GetSyncCursor() (uint64, error) {
 }
 
 func (s *SyncState) SetSyncCursor(cursor uint64) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		buf := make([]byte, 8)
 		binary.BigEndian.PutUint64(buf, cursor)
@@ -426,7 +492,7 @@ func (s *SyncState) SetSyncCursor(cursor uint64) error {
 
 func (s *SyncState) GetLamport() (uint64, error) {
 	var lamport uint64
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		data := meta.Get(keyLamport)
 		if data == nil {
@@ -440,7 +506,7 @@ func (s *SyncState) GetLamport() (uint64, error) {
 
 func (s *SyncState) IncrementLamport() (uint64, error) {
 	var newLamport uint64
-	err := s.db.Update(func(tx *bolt.Tx) error {
+	err := s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 
 		data := meta.Get(keyLamport)
@@ -459,7 +525,7 @@ func (s *SyncState) IncrementLamport() (uint64, error) {
 
 func (s *SyncState) UpdateLamport(observed uint64) (uint64, error) {
 	var newLamport uint64
-	err := s.db.Update(func(tx *bolt.Tx) error {
+	err := s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 
 		data := meta.Get(keyLamport)
@@ -481,9 +547,24 @@ func (s *SyncState) UpdateLamport(observed uint64) (uint64, error) {
 	return newLamport, err
 }
 
+func (s *SyncState) ResyncRequired() bool {
+	var required bool
+	s.store.SyncView(func(tx storage.Tx) error {
+		required = tx.Bucket(syncMetaBucket).Get(keyResyncRequired) != nil
+		return nil
+	})
+	return required
+}
+
+func (s *SyncState) ClearResyncRequired() error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
+		return tx.Bucket(syncMetaBucket).Delete(keyResyncRequired)
+	})
+}
+
 func (s *SyncState) GetServerURL() (string, error) {
 	var url string
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		data := meta.Get(keyServerURL)
 		if data != nil {
@@ -495,7 +576,7 @@ func (s *SyncState) GetServerURL() (string, error) {
 }
 
 func (s *SyncState) SetServerURL(url string) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		return meta.Put(keyServerURL, []byte(url))
 	})
@@ -503,7 +584,7 @@ func (s *SyncState) SetServerURL(url string) error {
 
 func (s *SyncState) GetSchemeCutover() (*time.Time, error) {
 	var cutover *time.Time
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		data := meta.Get(keySchemeCutover)
 		if data == nil {
@@ -529,7 +610,7 @@ func (s *SyncState) EnsureSchemeCutover() (time.Time, error) {
 	}
 
 	now := time.Now()
-	err = s.db.Update(func(tx *bolt.Tx) error {
+	err = s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		return meta.Put(keySchemeCutover, []byte(now.Format(time.RFC3339)))
 	})
@@ -538,7 +619,7 @@ func (s *SyncState) EnsureSchemeCutover() (time.Time, error) {
 
 func (s *SyncState) GetVerifiedMembers() ([]VerifiedMember, error) {
 	var members []VerifiedMember
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncMembersBucket)
 		return bucket.ForEach(func(k, v []byte) error {
 			var member VerifiedMember
@@ -554,7 +635,7 @@ func (s *SyncState) GetVerifiedMembers() ([]VerifiedMember, error) {
 
 func (s *SyncState) GetVerifiedMember(deviceID DeviceID) (*VerifiedMember, error) {
 	var member VerifiedMember
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncMembersBucket)
 		data := bucket.Get([]byte(deviceID))
 		if data == nil {
@@ -574,21 +655,21 @@ func (s *SyncState) SetVerifiedMember(member *VerifiedMember) error {
 		return fmt.Errorf("failed to marshal member: %w", err)
 	}
 
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncMembersBucket)
 		return bucket.Put([]byte(member.DeviceID), data)
 	})
 }
 
 func (s *SyncState) RemoveVerifiedMember(deviceID DeviceID) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncMembersBucket)
 		return bucket.Delete([]byte(deviceID))
 	})
 }
 
 func (s *SyncState) ClearVerifiedMembers() error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		if err := tx.DeleteBucket(syncMembersBucket); err != nil {
 			return err
 		}
@@ -605,16 +686,17 @@ func (s *SyncState) AddPendingEntry(op string, entry models.Entry) error {
 	if err != nil {
 		return err
 	}
+	defer secmem.Wipe(vaultKey)
 	data, err := json.Marshal(PendingEntry{Op: op, Entry: entry})
 	if err != nil {
 		return fmt.Errorf("failed to marshal pending entry: %w", err)
 	}
-	enc, err := crypto.Encrypt(vaultKey, data)
+	enc, err := crypto.EncryptWithAD(vaultKey, data, crypto.StorageAD(syncPendingBucket, []byte(entry.ID)))
 	if err != nil {
 		return fmt.Errorf("failed to encrypt pending entry: %w", err)
 	}
 
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncPendingBucket)
 		if bucket == nil {
 			return fmt.Errorf("pending bucket not initialized")
@@ -627,7 +709,7 @@ func (s *SyncState) RemovePendingEntry(entryID string) error {
 	if entryID == "" {
 		return nil
 	}
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncPendingBucket)
 		if bucket == nil {
 			return nil
@@ -642,14 +724,15 @@ func (s *SyncState) GetPendingEntries() ([]PendingEntry, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = s.db.View(func(tx *bolt.Tx) error {
+	defer secmem.Wipe(vaultKey)
+	err = s.store.SyncView(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncPendingBucket)
 		if bucket == nil {
 			return nil
 		}
-		return bucket.ForEach(func(_, v []byte) error {
+		return bucket.ForEach(func(k, v []byte) error {
 			var entry PendingEntry
-			dec, err := crypto.Decrypt(vaultKey, v)
+			dec, err := crypto.DecryptWithAD(vaultKey, v, crypto.StorageAD(syncPendingBucket, k))
 			if err != nil {
 				return fmt.Errorf("failed to decrypt pending entry: %w", err)
 			}
@@ -664,20 +747,94 @@ func (s *SyncState) GetPendingEntries() ([]PendingEntry, error) {
 }
 
 func (s *SyncState) ClearPendingEntries() error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		if err := tx.DeleteBucket(syncPendingBucket); err != nil {
-			return err
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
+		for _, name := range [][]byte{syncPendingBucket, syncPendingFolders} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
 		}
-		_, err := tx.CreateBucket(syncPendingBucket)
+		return nil
+	})
+}
+
+// AddPendingFolder queues a folder change that could not be pushed. A
+// later change to the same folder replaces it.
+func (s *SyncState) AddPendingFolder(op string, folder models.Folder) error {
+	if folder.ID == "" {
+		return fmt.Errorf("folder id is required")
+	}
+	vaultKey, err := s.getVaultKey()
+	if err != nil {
 		return err
+	}
+	defer secmem.Wipe(vaultKey)
+	data, err := json.Marshal(PendingFolder{Op: op, Folder: folder})
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending folder: %w", err)
+	}
+	enc, err := crypto.EncryptWithAD(vaultKey, data, crypto.StorageAD(syncPendingFolders, []byte(folder.ID)))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt pending folder: %w", err)
+	}
+
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
+		bucket := tx.Bucket(syncPendingFolders)
+		if bucket == nil {
+			return fmt.Errorf("pending folders bucket not initialized")
+		}
+		return bucket.Put([]byte(folder.ID), enc)
+	})
+}
+
+func (s *SyncState) RemovePendingFolder(folderID string) error {
+	if folderID == "" {
+		return nil
+	}
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
+		bucket := tx.Bucket(syncPendingFolders)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(folderID))
 	})
 }
 
+func (s *SyncState) GetPendingFolders() ([]PendingFolder, error) {
+	var pending []PendingFolder
+	vaultKey, err := s.getVaultKey()
+	if err != nil {
+		return nil, err
+	}
+	defer secmem.Wipe(vaultKey)
+	err = s.store.SyncView(func(tx storage.Tx) error {
+		bucket := tx.Bucket(syncPendingFolders)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var folder PendingFolder
+			dec, err := crypto.DecryptWithAD(vaultKey, v, crypto.StorageAD(syncPendingFolders, k))
+			if err != nil {
+				return fmt.Errorf("failed to decrypt pending folder: %w", err)
+			}
+			if err := json.Unmarshal(dec, &folder); err != nil {
+				return fmt.Errorf("failed to unmarshal pending folder: %w", err)
+			}
+			pending = append(pending, folder)
+			return nil
+		})
+	})
+	return pending, err
+}
+
 func (s *SyncState) SetEntryScheme(entryID, scheme string) error {
 	if entryID == "" {
 		return nil
 	}
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncEntrySchemes)
 		if bucket == nil {
 			return fmt.Errorf("entry schemes bucket not initialized")
@@ -690,7 +847,7 @@ func (s *SyncState) RemoveEntryScheme(entryID string) error {
 	if entryID == "" {
 		return nil
 	}
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncEntrySchemes)
 		if bucket == nil {
 			return nil
@@ -704,7 +861,7 @@ func (s *SyncState) GetEntryScheme(entryID string) (string, error) {
 		return "", nil
 	}
 	var scheme string
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncEntrySchemes)
 		if bucket == nil {
 			return nil
@@ -720,7 +877,7 @@ func (s *SyncState) GetEntryScheme(entryID string) (string, error) {
 
 func (s *SyncState) GetEntrySchemes() (map[string]string, error) {
 	schemes := make(map[string]string)
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.SyncView(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncEntrySchemes)
 		if bucket == nil {
 			return nil
@@ -734,7 +891,7 @@ func (s *SyncState) GetEntrySchemes() (map[string]string, error) {
 }
 
 func (s *SyncState) ClearEntrySchemes() error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		if err := tx.DeleteBucket(syncEntrySchemes); err != nil {
 			return err
 		}
@@ -743,8 +900,115 @@ func (s *SyncState) ClearEntrySchemes() error {
 	})
 }
 
+func chunkKey(attachmentID string, index int) []byte {
+	return []byte(fmt.Sprintf("%s/%08d", attachmentID, index))
+}
+
+// PutAttachmentChunk stores a received chunk. Once every chunk of the
+// attachment is there it returns the verified contents and drops the
+// chunks; until then it returns nil.
+func (s *SyncState) PutAttachmentChunk(chunk models.AttachmentChunk) ([]byte, error) {
+	if err := chunk.Validate(AttachmentChunkSize); err != nil {
+		return nil, err
+	}
+	vaultKey, err := s.getVaultKey()
+	if err != nil {
+		return nil, err
+	}
+	defer secmem.Wipe(vaultKey)
+
+	key := chunkKey(chunk.AttachmentID, chunk.Index)
+	enc, err := crypto.EncryptWithAD(vaultKey, chunk.Data, crypto.StorageAD(syncAttachmentChunks, key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt attachment chunk: %w", err)
+	}
+
+	var content []byte
+	err = s.store.SyncUpdate(func(tx storage.Tx) error {
+		bucket := tx.Bucket(syncAttachmentChunks)
+		if bucket == nil {
+			return fmt.Errorf("attachment chunks bucket not initialized")
+		}
+		if err := bucket.Put(key, enc); err != nil {
+			return err
+		}
+
+		keys := make([][]byte, 0, chunk.Count)
+		for i := 0; i < chunk.Count; i++ {
+			if bucket.Get(chunkKey(chunk.AttachmentID, i)) == nil {
+				return nil
+			}
+			keys = append(keys, chunkKey(chunk.AttachmentID, i))
+		}
+
+		buf := make([]byte, 0, chunk.Size)
+		for _, k := range keys {
+			data, err := crypto.DecryptWithAD(vaultKey, bucket.Get(k), crypto.StorageAD(syncAttachmentChunks, k))
+			if err != nil {
+				return fmt.Errorf("failed to decrypt attachment chunk: %w", err)
+			}
+			buf = append(buf, data...)
+			secmem.Wipe(data)
+		}
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		content = buf
+		return nil
+	})
+	if err != nil || content == nil {
+		return nil, err
+	}
+
+	whole := models.Attachment{ID: chunk.AttachmentID, Name: chunk.AttachmentID, Size: chunk.Size, SHA256: chunk.SHA256}
+	if err := whole.Verify(content); err != nil {
+		secmem.Wipe(content)
+		return nil, err
+	}
+	return content, nil
+}
+
+func (s *SyncState) SetAttachmentSent(attachmentID string) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
+		bucket := tx.Bucket(syncAttachmentsSent)
+		if bucket == nil {
+			return fmt.Errorf("attachments bucket not initialized")
+		}
+		return bucket.Put([]byte(attachmentID), []byte{1})
+	})
+}
+
+func (s *SyncState) AttachmentSent(attachmentID string) bool {
+	var sent bool
+	s.store.SyncView(func(tx storage.Tx) error {
+		if bucket := tx.Bucket(syncAttachmentsSent); bucket != nil {
+			sent = bucket.Get([]byte(attachmentID)) != nil
+		}
+		return nil
+	})
+	return sent
+}
+
+// ClearAttachments forgets partial downloads and which attachments were
+// pushed, so they are pushed again to the next vault.
+func (s *SyncState) ClearAttachments() error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
+		for _, name := range [][]byte{syncAttachmentChunks, syncAttachmentsSent} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (s *SyncState) ClearEventHeads() error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		bucket := tx.Bucket(syncEventHeadsBucket)
 		if bucket == nil {
 			return nil
@@ -771,7 +1035,7 @@ func (s *SyncState) ClearEventHeads() error {
 }
 
 func (s *SyncState) ClearVaultState() error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.store.SyncUpdate(func(tx storage.Tx) error {
 		meta := tx.Bucket(syncMetaBucket)
 		if meta == nil {
 			return nil
@@ -825,12 +1089,12 @@ func GenerateDeviceKeys() (*DeviceKeys, error) {
 	deviceID := DeviceID(hex.EncodeToString(deviceIDHash[:]))
 
 	keys := &DeviceKeys{
-		DeviceID:   deviceID,
-		PrivkeyBox: privBox,
-		PubkeyBox:  pubBox,
+		DeviceID:    deviceID,
+		PrivkeySign: secmem.FromBytes(privSign),
+		PubkeyBox:   pubBox,
+		PrivkeyBox:  secmem.FromBytes(privBox[:]),
 	}
 	copy(keys.PubkeySign[:], pubSign)
-	copy(keys.PrivkeySign[:], privSign)
 
 	return keys, nil
 }
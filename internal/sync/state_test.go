@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"testing"
+
+	"forgor/internal/crypto"
+	"forgor/internal/models"
+	"forgor/internal/storage"
+)
+
+// newTestVault returns an unlocked vault in memory.
+func newTestVault(t *testing.T) *storage.Store {
+	t.Helper()
+	store, err := storage.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.SetKDFParams(crypto.KDFParams{Time: 1, Memory: 64, Threads: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Initialize("password", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Unlock("password"); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSyncStateInMemory(t *testing.T) {
+	store := newTestVault(t)
+	state, err := NewSyncState(store)
+	if err != nil {
+		t.Fatalf("NewSyncState: %v", err)
+	}
+
+	keys, err := GenerateDeviceKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keys.Destroy()
+	if err := state.SetDeviceKeys(keys); err != nil {
+		t.Fatalf("SetDeviceKeys: %v", err)
+	}
+	if err := state.SetVaultID(NewUUID()); err != nil {
+		t.Fatal(err)
+	}
+	if !state.IsConfigured() {
+		t.Error("IsConfigured = false after setting the vault and device")
+	}
+
+	entry := models.NewEntry("example.com", "alice", "secret", "", nil)
+	if err := state.AddPendingEntry("upsert", entry); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second SyncState over the same vault sees the same state.
+	again, err := NewSyncState(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := again.GetDeviceKeys()
+	if err != nil {
+		t.Fatalf("GetDeviceKeys: %v", err)
+	}
+	defer got.Destroy()
+	if got.DeviceID != keys.DeviceID {
+		t.Errorf("DeviceID = %s, want %s", got.DeviceID, keys.DeviceID)
+	}
+	pending, err := again.GetPendingEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Entry.Password != "secret" {
+		t.Errorf("pending = %+v, want the entry", pending)
+	}
+
+	store.Lock()
+	if _, err := again.GetDeviceKeys(); err == nil {
+		t.Error("GetDeviceKeys succeeded after the vault was locked")
+	}
+	if _, err := NewSyncState(store); err == nil {
+		t.Error("NewSyncState succeeded on a locked vault")
+	}
+}
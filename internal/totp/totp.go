@@ -0,0 +1,194 @@
+// Package totp generates RFC 6238 time-based one-time passwords from
+// otpauth:// URIs or bare base32 secrets.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDigits = 6
+	DefaultPeriod = 30
+
+	// Steam Guard codes are five characters from this alphabet.
+	steamDigits   = 5
+	steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+)
+
+var ErrNoSecret = errors.New("no TOTP secret")
+
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "SHA1"
+	SHA256 Algorithm = "SHA256"
+	SHA512 Algorithm = "SHA512"
+)
+
+func (a Algorithm) hash() func() hash.Hash {
+	switch a {
+	case SHA256:
+		return sha256.New
+	case SHA512:
+		return sha512.New
+	default:
+		return sha1.New
+	}
+}
+
+type Key struct {
+	Secret    []byte
+	Algorithm Algorithm
+	Digits    int
+	Period    int
+	Steam     bool
+	Issuer    string
+	Account   string
+}
+
+// Parse accepts an otpauth://totp/ URI, a steam:// URI or a base32 secret.
+// Spaces and lower case in secrets are tolerated.
+func Parse(s string) (*Key, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, ErrNoSecret
+	}
+
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(lower, "otpauth://"):
+		return parseURI(s)
+	case strings.HasPrefix(lower, "steam://"):
+		secret, err := decodeSecret(s[len("steam://"):])
+		if err != nil {
+			return nil, err
+		}
+		return &Key{Secret: secret, Algorithm: SHA1, Digits: steamDigits, Period: DefaultPeriod, Steam: true, Issuer: "Steam"}, nil
+	}
+
+	secret, err := decodeSecret(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{Secret: secret, Algorithm: SHA1, Digits: DefaultDigits, Period: DefaultPeriod}, nil
+}
+
+func parseURI(s string) (*Key, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse otpauth URI: %w", err)
+	}
+	if !strings.EqualFold(u.Host, "totp") {
+		return nil, fmt.Errorf("unsupported OTP type %q (only totp is supported)", u.Host)
+	}
+
+	q := u.Query()
+	secret, err := decodeSecret(q.Get("secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{Secret: secret, Algorithm: SHA1, Digits: DefaultDigits, Period: DefaultPeriod}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		key.Issuer = strings.TrimSpace(issuer)
+		key.Account = strings.TrimSpace(account)
+	} else {
+		key.Account = label
+	}
+	if issuer := q.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+
+	if alg := q.Get("algorithm"); alg != "" {
+		switch Algorithm(strings.ToUpper(alg)) {
+		case SHA1, SHA256, SHA512:
+			key.Algorithm = Algorithm(strings.ToUpper(alg))
+		default:
+			return nil, fmt.Errorf("unsupported algorithm %q", alg)
+		}
+	}
+
+	if digits := q.Get("digits"); digits != "" {
+		n, err := strconv.Atoi(digits)
+		if err != nil || (n != 6 && n != 8) {
+			return nil, fmt.Errorf("unsupported digits %q (must be 6 or 8)", digits)
+		}
+		key.Digits = n
+	}
+
+	if period := q.Get("period"); period != "" {
+		n, err := strconv.Atoi(period)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid period %q", period)
+		}
+		key.Period = n
+	}
+
+	if strings.EqualFold(q.Get("encoder"), "steam") || strings.EqualFold(key.Issuer, "steam") {
+		key.Steam = true
+		key.Digits = steamDigits
+	}
+
+	return key, nil
+}
+
+func decodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.Join(strings.Fields(s), ""))
+	s = strings.TrimRight(s, "=")
+	if s == "" {
+		return nil, ErrNoSecret
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("secret is not valid base32: %w", err)
+	}
+	return secret, nil
+}
+
+// Code returns the code for the period containing t.
+func (k *Key) Code(t time.Time) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix())/uint64(k.Period))
+
+	mac := hmac.New(k.Algorithm.hash(), k.Secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	if k.Steam {
+		code := make([]byte, steamDigits)
+		for i := range code {
+			code[i] = steamAlphabet[value%uint32(len(steamAlphabet))]
+			value /= uint32(len(steamAlphabet))
+		}
+		return string(code)
+	}
+
+	mod := uint32(1)
+	for i := 0; i < k.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", k.Digits, value%mod)
+}
+
+// Remaining returns how long the code for t stays valid.
+func (k *Key) Remaining(t time.Time) time.Duration {
+	period := time.Duration(k.Period) * time.Second
+	return period - time.Duration(t.UnixNano())%period
+}
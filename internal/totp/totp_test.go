@@ -0,0 +1,177 @@
+package totp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Secrets from RFC 6238 appendix B, base32 encoded.
+const (
+	rfcSHA1   = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	rfcSHA256 = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA"
+	rfcSHA512 = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNA"
+)
+
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		sha1 string
+		s256 string
+		s512 string
+	}{
+		{59, "94287082", "46119246", "90693936"},
+		{1111111109, "07081804", "68084774", "25091201"},
+		{1111111111, "14050471", "67062674", "99943326"},
+		{1234567890, "89005924", "91819424", "93441116"},
+		{2000000000, "69279037", "90698825", "38618901"},
+		{20000000000, "65353130", "77737706", "47863826"},
+	}
+	keys := []struct {
+		alg    Algorithm
+		secret string
+		want   func(i int) string
+	}{
+		{SHA1, rfcSHA1, func(i int) string { return tests[i].sha1 }},
+		{SHA256, rfcSHA256, func(i int) string { return tests[i].s256 }},
+		{SHA512, rfcSHA512, func(i int) string { return tests[i].s512 }},
+	}
+	for _, k := range keys {
+		key, err := Parse("otpauth://totp/Example:alice?secret=" + k.secret + "&algorithm=" + string(k.alg) + "&digits=8")
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", k.alg, err)
+		}
+		for i, tt := range tests {
+			if got := key.Code(time.Unix(tt.unix, 0)); got != k.want(i) {
+				t.Errorf("%s at %d: got %s, want %s", k.alg, tt.unix, got, k.want(i))
+			}
+		}
+	}
+}
+
+func TestCodeSixDigits(t *testing.T) {
+	key, err := Parse(rfcSHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last six digits of the eight-digit RFC 6238 code.
+	if got := key.Code(time.Unix(59, 0)); got != "287082" {
+		t.Errorf("got %s, want 287082", got)
+	}
+}
+
+func TestCodeSteam(t *testing.T) {
+	// The same HOTP values as RFC 4226 appendix D, counters 0, 1 and 3,
+	// written in the Steam alphabet.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{0, "GG5F5"},
+		{59, "PV9M4"},
+		{90, "5H85C"},
+	}
+	for _, uri := range []string{
+		"steam://" + rfcSHA1,
+		"otpauth://totp/Steam:alice?secret=" + rfcSHA1 + "&issuer=Steam",
+		"otpauth://totp/alice?secret=" + rfcSHA1 + "&encoder=steam",
+	} {
+		key, err := Parse(uri)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", uri, err)
+		}
+		if !key.Steam {
+			t.Errorf("Parse(%q) is not a Steam key", uri)
+		}
+		for _, tt := range tests {
+			if got := key.Code(time.Unix(tt.unix, 0)); got != tt.want {
+				t.Errorf("%s at %d: got %s, want %s", uri, tt.unix, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Key
+		wantErr bool
+	}{
+		{
+			name:  "bare secret with spaces and lower case",
+			input: " gezd gnbv gy3t qojq gezd gnbv gy3t qojq ",
+			want:  Key{Algorithm: SHA1, Digits: 6, Period: 30},
+		},
+		{
+			name:  "padded secret",
+			input: rfcSHA256 + "====",
+			want:  Key{Algorithm: SHA1, Digits: 6, Period: 30},
+		},
+		{
+			name:  "uri with label and parameters",
+			input: "otpauth://totp/ACME%20Co:john@example.com?secret=" + rfcSHA1 + "&issuer=ACME%20Co&algorithm=sha256&digits=8&period=60",
+			want:  Key{Algorithm: SHA256, Digits: 8, Period: 60, Issuer: "ACME Co", Account: "john@example.com"},
+		},
+		{
+			name:  "issuer parameter wins",
+			input: "otpauth://totp/Old:bob?secret=" + rfcSHA1 + "&issuer=New",
+			want:  Key{Algorithm: SHA1, Digits: 6, Period: 30, Issuer: "New", Account: "bob"},
+		},
+		{
+			name:  "label without issuer",
+			input: "otpauth://totp/bob?secret=" + rfcSHA1,
+			want:  Key{Algorithm: SHA1, Digits: 6, Period: 30, Account: "bob"},
+		},
+		{name: "empty", input: "  ", wantErr: true},
+		{name: "not base32", input: "not-base32!", wantErr: true},
+		{name: "hotp", input: "otpauth://hotp/bob?secret=" + rfcSHA1 + "&counter=1", wantErr: true},
+		{name: "no secret", input: "otpauth://totp/bob", wantErr: true},
+		{name: "bad algorithm", input: "otpauth://totp/bob?secret=" + rfcSHA1 + "&algorithm=MD5", wantErr: true},
+		{name: "bad digits", input: "otpauth://totp/bob?secret=" + rfcSHA1 + "&digits=7", wantErr: true},
+		{name: "bad period", input: "otpauth://totp/bob?secret=" + rfcSHA1 + "&period=0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := Parse(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse succeeded: %+v", key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(key.Secret) == 0 {
+				t.Error("empty secret")
+			}
+			got := *key
+			if got.Algorithm != tt.want.Algorithm || got.Digits != tt.want.Digits || got.Period != tt.want.Period ||
+				got.Steam != tt.want.Steam || got.Issuer != tt.want.Issuer || got.Account != tt.want.Account {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Parse(""); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("Parse(\"\"): got %v, want %v", err, ErrNoSecret)
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	key := &Key{Period: 30}
+	tests := []struct {
+		at   time.Time
+		want time.Duration
+	}{
+		{time.Unix(0, 0), 30 * time.Second},
+		{time.Unix(59, 0), time.Second},
+		{time.Unix(60, 500*int64(time.Millisecond)), 29500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := key.Remaining(tt.at); got != tt.want {
+			t.Errorf("Remaining(%d) = %s, want %s", tt.at.Unix(), got, tt.want)
+		}
+	}
+}
@@ -1,13 +1,17 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"time"
 
 	"forgor/internal/clipboard"
+	"forgor/internal/crypto"
 	"forgor/internal/models"
+	"forgor/internal/profile"
+	"forgor/internal/secmem"
 	"forgor/internal/server"
 	"forgor/internal/storage"
 	"forgor/internal/sync"
@@ -28,7 +32,8 @@ const (
 var tabNames = []string{"Vault", "Nearby", "Friends", "Sync"}
 
 type App struct {
-	store      *storage.Store
+	profiles   *profile.Manager
+	store      storage.Vault
 	isLocked   bool
 	isNewVault bool
 	activeTab  Tab
@@ -41,6 +46,11 @@ type App struct {
 	friendsScreen  FriendsScreen
 	syncScreen     SyncScreen
 	incomingScreen IncomingShareScreen
+	recoveryScreen RecoveryKitScreen
+
+	// recoveryEntries holds the entries loaded by a recovery key unlock
+	// until the forced password reset completes.
+	recoveryEntries []models.Entry
 
 	device    *models.Device
 	localAddr string
@@ -57,24 +67,32 @@ type App struct {
 	statusIsError bool
 }
 
-func NewApp(store *storage.Store, peerChan chan models.Peer, shareChan chan models.IncomingShare, port int) *App {
+// NewApp starts on the lock screen of the active profile.
+func NewApp(profiles *profile.Manager, peerChan chan models.Peer, shareChan chan models.IncomingShare, port int) *App {
+	_, store := profiles.Active()
 	isNew := !store.IsInitialized()
 	localAddr := fmt.Sprintf("%s:%d", getOutboundIP(), port)
 
-	return &App{
+	app := &App{
+		profiles:       profiles,
 		store:          store,
 		isLocked:       true,
 		isNewVault:     isNew,
-		lockScreen:     NewLockScreen(isNew),
 		nearbyScreen:   NewNearbyScreen(),
 		friendsScreen:  NewFriendsScreen(),
 		syncScreen:     NewSyncScreen(),
 		incomingScreen: NewIncomingShareScreen(),
+		recoveryScreen: NewRecoveryKitScreen(),
 		peerChan:       peerChan,
 		shareChan:      shareChan,
 		localAddr:      localAddr,
 		peerAddresses:  make(map[string]string),
 	}
+	app.lockScreen = app.newLockScreen()
+	if !isNew {
+		app.applyUnlockThrottle()
+	}
+	return app
 }
 
 func getOutboundIP() string {
@@ -133,20 +151,31 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c":
-			a.store.Lock()
+			a.profiles.LockAll()
 			return a, tea.Quit
 		case "ctrl+l":
-			if !a.isLocked {
-				a.store.Lock()
+			if !a.isLocked || a.store.IsUnlocked() {
+				a.profiles.LockAll()
 				a.isLocked = true
 				a.isNewVault = false
-				a.lockScreen = NewLockScreen(false)
-				return a, nil
+				a.lockScreen = a.newLockScreen()
+				a.recoveryScreen = NewRecoveryKitScreen()
+				return a, a.applyUnlockThrottle()
 			}
 		}
 
-		if !a.isLocked && !a.incomingScreen.IsVisible() && !a.isInputActive() {
+		if !a.isLocked && !a.incomingScreen.IsVisible() && !a.recoveryScreen.IsVisible() && !a.isInputActive() {
 			switch msg.String() {
+			case "ctrl+k":
+				a.showRecoveryStatus()
+				return a, nil
+			case "ctrl+o":
+				if a.profiles.CanSwitch() {
+					a.isLocked = true
+					a.lockScreen = a.newLockScreen()
+					a.showProfiles()
+					return a, a.lockScreen.Init()
+				}
 			case "1":
 				a.activeTab = TabVault
 				return a, nil
@@ -166,11 +195,85 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case UnlockRequestMsg:
+		if err := a.loadKeyfile(msg.Keyfile); err != nil {
+			a.lockScreen.SetError("Failed to load keyfile: " + err.Error())
+			return a, nil
+		}
+		entries, err := a.store.Unlock(msg.Password)
+		if err != nil {
+			return a, a.unlockFailed(err)
+		}
+		return a.handleUnlock(entries)
+
+	case ChangePasswordRequestMsg:
+		if err := a.loadKeyfile(msg.Keyfile); err != nil {
+			a.lockScreen.SetError("Failed to load keyfile: " + err.Error())
+			return a, nil
+		}
+		if err := a.store.ChangeMasterPassword(msg.OldPassword, msg.NewPassword); err != nil {
+			if isUnlockError(err) {
+				return a, a.unlockFailed(err)
+			}
+			a.lockScreen.SetError("Failed to change password: " + err.Error())
+			return a, nil
+		}
+		entries, err := a.store.Unlock(msg.NewPassword)
+		if err != nil {
+			a.lockScreen.SetError("Failed to unlock: " + err.Error())
+			return a, nil
+		}
+		return a.handleUnlock(entries)
+
+	case KeyfileRequestMsg:
+		if err := a.loadKeyfile(msg.Keyfile); err != nil {
+			a.lockScreen.SetError("Failed to load keyfile: " + err.Error())
+			return a, nil
+		}
+		var err error
+		if msg.NewKeyfile == "" {
+			err = a.store.RemoveKeyfile(msg.Password)
+		} else {
+			err = a.store.RequireKeyfile(msg.Password, msg.NewKeyfile)
+		}
+		if err != nil {
+			if isUnlockError(err) {
+				return a, a.unlockFailed(err)
+			}
+			a.lockScreen.SetError("Failed to update keyfile: " + err.Error())
+			return a, nil
+		}
 		entries, err := a.store.Unlock(msg.Password)
 		if err != nil {
-			a.lockScreen.SetError("Invalid password")
+			a.lockScreen.SetError("Failed to unlock: " + err.Error())
+			return a, nil
+		}
+		return a.handleUnlock(entries)
+
+	case RecoveryUnlockRequestMsg:
+		entries, err := a.store.UnlockWithRecoveryKey(msg.RecoveryKey)
+		if err != nil {
+			if errors.Is(err, crypto.ErrDecryptionFailed) || errors.Is(err, crypto.ErrInvalidRecoveryCode) {
+				a.lockScreen.SetError("Invalid recovery key")
+			} else {
+				a.lockScreen.SetError(err.Error())
+			}
+			return a, nil
+		}
+		a.recoveryEntries = entries
+		a.lockScreen.StartPasswordReset()
+		return a, nil
+
+	case RegenerateRecoveryKeyMsg:
+		a.showRecoveryKit()
+		return a, nil
+
+	case ResetPasswordRequestMsg:
+		if err := a.store.ResetMasterPassword(msg.NewPassword); err != nil {
+			a.lockScreen.SetError("Failed to reset password: " + err.Error())
 			return a, nil
 		}
+		entries := a.recoveryEntries
+		a.recoveryEntries = nil
 		return a.handleUnlock(entries)
 
 	case InitRequestMsg:
@@ -183,7 +286,9 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			a.lockScreen.SetError("Failed to unlock: " + err.Error())
 			return a, nil
 		}
-		return a.handleUnlock(entries)
+		a.handleUnlock(entries)
+		a.showRecoveryKit()
+		return a, nil
 
 	case SaveEntriesMsg:
 		if err := a.store.SaveEntries(msg.Entries); err != nil {
@@ -194,15 +299,108 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return a, nil
 
+	case SaveTrashMsg:
+		if err := a.store.SaveEntriesAndTrash(msg.Entries, msg.Trash); err != nil {
+			a.statusMsg = "Failed to save: " + err.Error()
+			a.statusIsError = true
+		} else {
+			a.vaultScreen.SetEntries(msg.Entries)
+			a.vaultScreen.SetTrash(msg.Trash, a.store.TrashRetention())
+		}
+		return a, nil
+
+	case PurgeTrashMsg:
+		ids := make([]string, len(msg.Entries))
+		for i, e := range msg.Entries {
+			ids[i] = e.ID
+		}
+		if err := a.store.PurgeTrash(ids); err != nil {
+			a.statusMsg = "Failed to empty trash: " + err.Error()
+			a.statusIsError = true
+		}
+		a.loadTrash()
+		return a, nil
+
+	case SaveFoldersMsg:
+		if err := a.store.SaveFolders(msg.Folders); err != nil {
+			a.statusMsg = "Failed to save folders: " + err.Error()
+			a.statusIsError = true
+		} else {
+			a.vaultScreen.SetFolders(msg.Folders)
+		}
+		return a, nil
+
+	case LoadProfilesMsg:
+		a.showProfiles()
+		return a, nil
+
+	case SwitchProfileMsg:
+		return a, a.openProfile(msg.Name)
+
+	case LoadTransferTargetsMsg:
+		targets := a.transferTargets()
+		if len(targets) == 0 {
+			text := "Unlock another profile first (ctrl+o)"
+			if !a.profiles.CanSwitch() {
+				text = "Profiles are not available with -db"
+			}
+			a.vaultScreen, _ = a.vaultScreen.Update(StatusMsg{Message: text, IsError: true})
+			return a, nil
+		}
+		a.vaultScreen.ShowTransfer(targets)
+		return a, nil
+
+	case TransferEntryMsg:
+		return a, a.transferEntry(msg)
+
+	case LoadHistoryMsg:
+		snapshots, err := a.store.ListSnapshots()
+		if err != nil {
+			a.vaultScreen, _ = a.vaultScreen.Update(StatusMsg{Message: "Failed to load history: " + err.Error(), IsError: true})
+			return a, nil
+		}
+		a.vaultScreen.ShowHistory(snapshots)
+		return a, nil
+
+	case RestoreSnapshotMsg:
+		return a, a.handleRestoreSnapshot(msg.Snapshot)
+
+	case AddAttachmentMsg:
+		return a, a.addAttachment(msg)
+
+	case ExportAttachmentMsg:
+		return a, a.exportAttachment(msg)
+
 	case SyncPushEntryMsg:
 		return a, a.handleSyncPushEntry(msg.Entry, msg.Op)
 
+	case EntryUsedMsg:
+		return a, a.recordUse(msg.EntryID)
+
+	case SortModeMsg:
+		if err := a.store.SetSortMode(msg.Mode); err != nil {
+			a.statusMsg = "Failed to save sort order: " + err.Error()
+			a.statusIsError = true
+		}
+		return a, nil
+
+	case SyncPushFolderMsg:
+		return a, a.handleSyncPushFolder(msg.Folder, msg.Op)
+
 	case RemoveDeviceMsg:
 		return a, a.handleRemoveDevice(msg.DeviceID)
 
 	case CopyToClipboardMsg:
 		return a, a.copyToClipboard(msg.Text, msg.Label)
 
+	case totpTickMsg:
+		if a.isLocked {
+			return a, nil
+		}
+		var cmd tea.Cmd
+		a.vaultScreen, cmd = a.vaultScreen.Update(msg)
+		return a, cmd
+
 	case PeerFoundMsg:
 		friends, _ := a.store.GetAllFriends()
 		for _, f := range friends {
@@ -247,6 +445,8 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return a, nil
 
 	case SendShareMsg:
+		// Earlier passwords stay on this device.
+		msg.Entry.History = nil
 		return a, a.handleSendShare(msg.Friend, msg.Entry)
 
 	case ShareSentMsg:
@@ -316,6 +516,9 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return a, nil
 		}
 		a.vaultScreen.SetEntries(msg.Entries)
+		a.loadFolders()
+		a.loadTrash()
+		cmds = append(cmds, a.expireTrash())
 		if a.syncState != nil {
 			if schemes, err := a.syncState.GetEntrySchemes(); err == nil {
 				a.vaultScreen.SetEntrySchemes(schemes)
@@ -408,6 +611,10 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		var cmd tea.Cmd
 		a.lockScreen, cmd = a.lockScreen.Update(msg)
 		cmds = append(cmds, cmd)
+	} else if a.recoveryScreen.IsVisible() {
+		var cmd tea.Cmd
+		a.recoveryScreen, cmd = a.recoveryScreen.Update(msg)
+		cmds = append(cmds, cmd)
 	} else if a.incomingScreen.IsVisible() {
 		var cmd tea.Cmd
 		a.incomingScreen, cmd = a.incomingScreen.Update(msg)
@@ -440,6 +647,11 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (a *App) handleUnlock(entries []models.Entry) (*App, tea.Cmd) {
 	a.isLocked = false
 	a.vaultScreen = NewVaultScreen(entries)
+	a.vaultScreen.SetAttachmentLookup(a.store.HasAttachment)
+	a.loadUsage()
+	a.vaultScreen.SetSortMode(a.store.SortMode())
+	a.loadFolders()
+	a.loadTrash()
 
 	device, err := a.store.GetDevice()
 	if err == nil {
@@ -458,7 +670,82 @@ func (a *App) handleUnlock(entries []models.Entry) (*App, tea.Cmd) {
 
 	a.initSyncFromState()
 
-	return a, nil
+	return a, a.expireTrash()
+}
+
+func (a *App) loadKeyfile(path string) error {
+	if path == "" {
+		return nil
+	}
+	return a.store.LoadKeyfile(path)
+}
+
+func isUnlockError(err error) bool {
+	var throttled *storage.ThrottledError
+	return errors.Is(err, crypto.ErrDecryptionFailed) || errors.Is(err, storage.ErrKeyfileRequired) ||
+		errors.Is(err, storage.ErrRecoveryRequired) || errors.As(err, &throttled)
+}
+
+// unlockFailed reports a failed password check on the lock screen and
+// starts the countdown when further attempts are being held back.
+func (a *App) unlockFailed(err error) tea.Cmd {
+	var throttled *storage.ThrottledError
+	if errors.As(err, &throttled) {
+		a.lockScreen.SetError("Too many failed attempts")
+		return a.lockScreen.SetLockout(time.Now().Add(throttled.Wait))
+	}
+	if errors.Is(err, storage.ErrRecoveryRequired) {
+		a.lockScreen.RequireRecovery()
+		return nil
+	}
+	a.lockScreen.SetError(a.unlockErrorText(err))
+	return a.applyUnlockThrottle()
+}
+
+// applyUnlockThrottle carries the stored backoff over to the lock screen.
+func (a *App) applyUnlockThrottle() tea.Cmd {
+	if a.store.RecoveryRequired() {
+		a.lockScreen.RequireRecovery()
+		return nil
+	}
+	if wait := a.store.UnlockWait(); wait > 0 {
+		return a.lockScreen.SetLockout(time.Now().Add(wait))
+	}
+	return nil
+}
+
+func (a *App) unlockErrorText(err error) string {
+	if errors.Is(err, storage.ErrKeyfileRequired) {
+		return "Keyfile required"
+	}
+	if a.store.KeyfileRequired() {
+		return "Invalid password or keyfile"
+	}
+	return "Invalid password"
+}
+
+// showRecoveryStatus opens the recovery key screen without touching the
+// stored key.
+func (a *App) showRecoveryStatus() {
+	a.recoveryScreen.ShowStatus(a.store.HasRecoveryKey(), a.deviceName())
+}
+
+// showRecoveryKit generates a fresh recovery key and opens the emergency kit.
+func (a *App) showRecoveryKit() {
+	code, err := a.store.GenerateRecoveryKey()
+	if err != nil {
+		a.statusMsg = "Failed to create recovery key: " + err.Error()
+		a.statusIsError = true
+		return
+	}
+	a.recoveryScreen.Show(code, a.deviceName())
+}
+
+func (a *App) deviceName() string {
+	if a.device == nil {
+		return ""
+	}
+	return a.device.Name
 }
 
 func (a *App) initSyncFromState() {
@@ -467,18 +754,18 @@ func (a *App) initSyncFromState() {
 	a.syncScreen.SetConfigured(false)
 	a.syncScreen.SetVaultID("")
 
-	vaultKey := a.store.GetVaultKey()
-	if vaultKey == nil {
+	if !a.store.IsUnlocked() {
 		return
 	}
 
-	syncState, err := sync.NewSyncState(a.store.GetDB(), vaultKey)
+	syncState, err := sync.NewSyncState(a.store)
 	if err != nil {
 		return
 	}
 
 	if keys, err := syncState.GetDeviceKeys(); err == nil {
 		a.syncScreen.SetDeviceFingerprint(string(keys.DeviceID))
+		keys.Destroy()
 	}
 
 	if vaultID, err := syncState.GetVaultID(); err == nil {
@@ -604,7 +891,19 @@ func (a *App) handleSendShare(friend models.Friend, entry models.Entry) tea.Cmd
 		var port int
 		fmt.Sscanf(portStr, "%d", &port)
 
-		err = server.SendShare(host, port, entry, a.device, &friend.PubKey)
+		attachments := make(map[string][]byte, len(entry.Attachments))
+		for _, att := range entry.Attachments {
+			if content, err := a.store.Attachment(att.ID); err == nil {
+				attachments[att.ID] = content
+			}
+		}
+		defer func() {
+			for _, content := range attachments {
+				secmem.Wipe(content)
+			}
+		}()
+
+		err = server.SendShare(host, port, entry, attachments, a.device, &friend.PubKey)
 		if err != nil {
 			return ShareFailMsg{Err: fmt.Errorf("failed (is peer online at %s?): %w", addr, err)}
 		}
@@ -616,13 +915,26 @@ func (a *App) handleSendShare(friend models.Friend, entry models.Entry) tea.Cmd
 func (a *App) handleAcceptShare(share models.IncomingShare) tea.Cmd {
 	currentEntries := a.vaultScreen.GetEntries()
 
-	entry := models.NewEntry(
-		share.Entry.Website,
-		share.Entry.Username,
-		share.Entry.Password,
-		share.Entry.Notes+" (shared by "+share.FromName+")",
-		share.Entry.Tags,
-	)
+	entry := share.Entry.Duplicate()
+	entry.Notes += " (shared by " + share.FromName + ")"
+	entry.History = nil
+	entry.UpdatedAt = time.Now()
+
+	// Attachments whose contents did not arrive are dropped rather than
+	// shown as missing forever.
+	entry.Attachments = nil
+	for _, att := range share.Entry.Attachments {
+		if content, ok := share.Attachments[att.ID]; ok {
+			err := a.store.PutAttachment(att.ID, content)
+			secmem.Wipe(content)
+			if err != nil {
+				continue
+			}
+		}
+		if a.store.HasAttachment(att.ID) {
+			entry.Attachments = append(entry.Attachments, att)
+		}
+	}
 
 	newEntries := append(currentEntries, entry)
 
@@ -636,6 +948,74 @@ func (a *App) handleAcceptShare(share models.IncomingShare) tea.Cmd {
 	)
 }
 
+// handleRestoreSnapshot replaces the vault with a snapshot and pushes the
+// difference to sync. Restored entries get a fresh UpdatedAt so they win
+// over the versions other devices hold.
+func (a *App) handleRestoreSnapshot(snapshot models.VaultSnapshot) tea.Cmd {
+	current := a.vaultScreen.GetEntries()
+	diff := diffEntries(current, snapshot.Entries)
+	if diff.empty() {
+		return func() tea.Msg {
+			return StatusMsg{Message: "Vault already matches this version", IsError: false}
+		}
+	}
+
+	touched := make(map[string]bool, len(diff.added)+len(diff.changed))
+	for _, e := range diff.added {
+		touched[e.ID] = true
+	}
+	for _, e := range diff.changed {
+		touched[e.ID] = true
+	}
+
+	now := time.Now()
+	restored := make([]models.Entry, len(snapshot.Entries))
+	var upserts []models.Entry
+	for i, e := range snapshot.Entries {
+		if touched[e.ID] {
+			e.UpdatedAt = now
+			upserts = append(upserts, e)
+		}
+		restored[i] = e
+	}
+
+	// Entries the restore brings back leave the trash, and the ones it
+	// drops go into it.
+	var trash []models.Entry
+	for _, e := range a.vaultScreen.GetTrash() {
+		if !touched[e.ID] {
+			trash = append(trash, e)
+		}
+	}
+	trashed := make([]models.Entry, len(diff.removed))
+	for i, e := range diff.removed {
+		trashed[i] = e.Trashed(now)
+		trash = append(trash, trashed[i])
+	}
+
+	cmds := []tea.Cmd{
+		func() tea.Msg {
+			return SaveTrashMsg{Entries: restored, Trash: trash}
+		},
+		func() tea.Msg {
+			return StatusMsg{Message: "Restored version from " + snapshot.SavedAt.Format("2006-01-02 3:04 PM"), IsError: false}
+		},
+	}
+	for _, e := range upserts {
+		entry := e
+		cmds = append(cmds, func() tea.Msg {
+			return SyncPushEntryMsg{Entry: entry, Op: "upsert"}
+		})
+	}
+	for _, e := range trashed {
+		entry := e
+		cmds = append(cmds, func() tea.Msg {
+			return SyncPushEntryMsg{Entry: entry, Op: "trash"}
+		})
+	}
+	return tea.Sequence(cmds...)
+}
+
 func (a *App) copyToClipboard(text, label string) tea.Cmd {
 	return func() tea.Msg {
 		if err := clipboard.Copy(text); err != nil {
@@ -653,6 +1033,11 @@ func (a App) View() string {
 		return lipgloss.Place(a.width, a.height, lipgloss.Center, lipgloss.Center, content)
 	}
 
+	if a.recoveryScreen.IsVisible() {
+		content := a.recoveryScreen.View()
+		return lipgloss.Place(a.width, a.height, lipgloss.Center, lipgloss.Center, content)
+	}
+
 	if a.incomingScreen.IsVisible() {
 		content := a.incomingScreen.View()
 		return lipgloss.Place(a.width, a.height, lipgloss.Center, lipgloss.Center, content)
@@ -673,11 +1058,20 @@ func (a App) View() string {
 	}
 
 	b.WriteString("\n\n")
-	b.WriteString(mutedStyle.Render("1-4 switch tabs • ctrl+l lock • ctrl+c quit"))
+	help := "1-4 switch tabs • ctrl+k recovery key • ctrl+l lock • ctrl+c quit"
+	if a.profiles.CanSwitch() {
+		help = "1-4 switch tabs • ctrl+k recovery key • ctrl+o profiles • ctrl+l lock • ctrl+c quit"
+	}
+	b.WriteString(mutedStyle.Render(help))
 
 	if a.device != nil {
 		b.WriteString("\n")
-		b.WriteString(mutedStyle.Render(fmt.Sprintf("Device: %s [%s]", a.device.Name, a.device.Fingerprint())))
+		device := fmt.Sprintf("Device: %s [%s]", a.device.Name, a.device.Fingerprint())
+		if a.profiles.CanSwitch() {
+			name, _ := a.profiles.Active()
+			device += " • Profile: " + name
+		}
+		b.WriteString(mutedStyle.Render(device))
 		b.WriteString("\n")
 		b.WriteString(successStyle.Render(fmt.Sprintf("Manual add: %s", a.localAddr)))
 	}
@@ -715,17 +1109,17 @@ func (a *App) isInputActive() bool {
 
 func (a *App) handleSetupSync(serverURL, action string) tea.Cmd {
 	entries := append([]models.Entry(nil), a.vaultScreen.GetEntries()...)
+	folders := append([]models.Folder(nil), a.vaultScreen.GetFolders()...)
 	return func() tea.Msg {
 		if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
 			serverURL = "http://" + serverURL
 		}
 
-		vaultKey := a.store.GetVaultKey()
-		if vaultKey == nil {
+		if !a.store.IsUnlocked() {
 			return SyncSetupFailMsg{Err: fmt.Errorf("vault not unlocked")}
 		}
 
-		syncState, err := sync.NewSyncState(a.store.GetDB(), vaultKey)
+		syncState, err := sync.NewSyncState(a.store)
 		if err != nil {
 			return SyncSetupFailMsg{Err: fmt.Errorf("failed to initialize sync state: %w", err)}
 		}
@@ -749,6 +1143,11 @@ func (a *App) handleSetupSync(serverURL, action string) tea.Cmd {
 			if err := engine.CreateVault(); err != nil {
 				return SyncSetupFailMsg{Err: fmt.Errorf("failed to create vault: %w", err)}
 			}
+			for _, folder := range folders {
+				if err := engine.PushFolder(folder, "upsert"); err != nil {
+					return SyncSetupFailMsg{Err: fmt.Errorf("failed to seed vault folders: %w", err)}
+				}
+			}
 			if len(entries) > 0 {
 				for _, entry := range entries {
 					if err := engine.PushEntry(entry, "upsert"); err != nil {
@@ -763,8 +1162,8 @@ func (a *App) handleSetupSync(serverURL, action string) tea.Cmd {
 }
 
 func (a *App) initDeviceKeysIfNeeded(syncState *sync.SyncState) error {
-	_, err := syncState.GetDeviceKeys()
-	if err == nil {
+	if keys, err := syncState.GetDeviceKeys(); err == nil {
+		keys.Destroy()
 		return nil
 	}
 
@@ -772,18 +1171,18 @@ func (a *App) initDeviceKeysIfNeeded(syncState *sync.SyncState) error {
 	if err != nil {
 		return fmt.Errorf("failed to generate device keys: %w", err)
 	}
+	defer keys.Destroy()
 
 	return syncState.SetDeviceKeys(keys)
 }
 
 func (a *App) handleLeaveVault() tea.Cmd {
 	return func() tea.Msg {
-		vaultKey := a.store.GetVaultKey()
-		if vaultKey == nil {
+		if !a.store.IsUnlocked() {
 			return LeaveVaultFailMsg{Err: fmt.Errorf("vault not unlocked")}
 		}
 
-		syncState, err := sync.NewSyncState(a.store.GetDB(), vaultKey)
+		syncState, err := sync.NewSyncState(a.store)
 		if err != nil {
 			return LeaveVaultFailMsg{Err: fmt.Errorf("failed to initialize sync state: %w", err)}
 		}
@@ -803,6 +1202,9 @@ func (a *App) handleLeaveVault() tea.Cmd {
 		if err := syncState.ClearPendingEntries(); err != nil {
 			return LeaveVaultFailMsg{Err: fmt.Errorf("failed to clear pending changes: %w", err)}
 		}
+		if err := syncState.ClearAttachments(); err != nil {
+			return LeaveVaultFailMsg{Err: fmt.Errorf("failed to clear attachment state: %w", err)}
+		}
 
 		return LeaveVaultCompleteMsg{}
 	}
@@ -814,12 +1216,11 @@ func (a *App) handleRegisterDevice(serverURL string) tea.Cmd {
 			serverURL = "http://" + serverURL
 		}
 
-		vaultKey := a.store.GetVaultKey()
-		if vaultKey == nil {
+		if !a.store.IsUnlocked() {
 			return SyncRegisterFailMsg{Err: fmt.Errorf("vault not unlocked")}
 		}
 
-		syncState, err := sync.NewSyncState(a.store.GetDB(), vaultKey)
+		syncState, err := sync.NewSyncState(a.store)
 		if err != nil {
 			return SyncRegisterFailMsg{Err: fmt.Errorf("failed to initialize sync state: %w", err)}
 		}
@@ -854,12 +1255,11 @@ func (a *App) handleAcceptInvite(inviteCode, serverURL string) tea.Cmd {
 			serverURL = "http://" + serverURL
 		}
 
-		vaultKey := a.store.GetVaultKey()
-		if vaultKey == nil {
+		if !a.store.IsUnlocked() {
 			return InviteFailMsg{Err: fmt.Errorf("vault not unlocked")}
 		}
 
-		syncState, err := sync.NewSyncState(a.store.GetDB(), vaultKey)
+		syncState, err := sync.NewSyncState(a.store)
 		if err != nil {
 			return InviteFailMsg{Err: fmt.Errorf("failed to initialize sync state: %w", err)}
 		}
@@ -1061,10 +1461,17 @@ func (a *App) seedLocalEntriesIfNeeded(entries []models.Entry) error {
 		return nil
 	}
 
+	// A restored vault has to find its own events on the server first, or
+	// it would push its old entries over newer changes.
+	if err := a.syncEngine.Resync(); err != nil {
+		return err
+	}
+
 	keys, err := a.syncState.GetDeviceKeys()
 	if err != nil {
 		return fmt.Errorf("failed to get device keys: %w", err)
 	}
+	keys.Destroy()
 	head, err := a.syncState.GetEventHead(keys.DeviceID)
 	if err != nil {
 		return fmt.Errorf("failed to get event head: %w", err)
@@ -1074,6 +1481,20 @@ func (a *App) seedLocalEntriesIfNeeded(entries []models.Entry) error {
 	}
 
 	var firstErr error
+	folders, err := a.store.Folders()
+	if err != nil {
+		return fmt.Errorf("failed to load folders: %w", err)
+	}
+	for _, folder := range folders {
+		if err := a.syncEngine.PushFolder(folder, "upsert"); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			_ = a.syncState.AddPendingFolder("upsert", folder)
+			continue
+		}
+		_ = a.syncState.RemovePendingFolder(folder.ID)
+	}
 	for _, entry := range entries {
 		if err := a.syncEngine.PushEntry(entry, "upsert"); err != nil {
 			if firstErr == nil {
@@ -1097,6 +1518,7 @@ func (a *App) isSyncOwner() (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("failed to get device keys: %w", err)
 	}
+	keys.Destroy()
 
 	owner, err := a.syncState.GetOwnerDeviceID()
 	if err != nil {
@@ -1126,7 +1548,38 @@ func (a *App) acceptInviteClaimsIfOwner() error {
 	return nil
 }
 
-func (a *App) handleSyncPushEntry(entry models.Entry, op string) tea.Cmd {
+// loadTrash shows the trash. Entries past the retention period are left
+// to expireTrash, which deletes them the same way as purging by hand.
+func (a *App) loadTrash() {
+	trash, err := a.store.Trash()
+	if err != nil {
+		a.statusMsg = "Failed to load trash: " + err.Error()
+		a.statusIsError = true
+		return
+	}
+	a.vaultScreen.SetTrash(trash, a.store.TrashRetention())
+}
+
+// expireTrash deletes the entries kept in the trash past the retention
+// period, on every synced device.
+func (a *App) expireTrash() tea.Cmd {
+	var cmd tea.Cmd
+	a.vaultScreen, cmd = a.vaultScreen.expireTrash(time.Now())
+	return cmd
+}
+
+// loadFolders shows the stored folders in the vault list.
+func (a *App) loadFolders() {
+	folders, err := a.store.Folders()
+	if err != nil {
+		a.statusMsg = "Failed to load folders: " + err.Error()
+		a.statusIsError = true
+		return
+	}
+	a.vaultScreen.SetFolders(folders)
+}
+
+func (a *App) handleSyncPushFolder(folder models.Folder, op string) tea.Cmd {
 	return func() tea.Msg {
 		if a.syncState == nil || a.syncEngine == nil {
 			return nil
@@ -1135,6 +1588,25 @@ func (a *App) handleSyncPushEntry(entry models.Entry, op string) tea.Cmd {
 			return StatusMsg{Message: "Sync failed: invalid operation", IsError: true}
 		}
 
+		if err := a.syncEngine.PushFolder(folder, op); err != nil {
+			_ = a.syncState.AddPendingFolder(op, folder)
+			return StatusMsg{Message: "Sync push failed (queued for retry): " + err.Error(), IsError: true}
+		}
+		_ = a.syncState.RemovePendingFolder(folder.ID)
+
+		return SyncPushCompleteMsg{LastSync: time.Now()}
+	}
+}
+
+func (a *App) handleSyncPushEntry(entry models.Entry, op string) tea.Cmd {
+	return func() tea.Msg {
+		if a.syncState == nil || a.syncEngine == nil {
+			return nil
+		}
+		if op != "upsert" && op != "delete" && op != "trash" && op != "restore" {
+			return StatusMsg{Message: "Sync failed: invalid operation", IsError: true}
+		}
+
 		if err := a.syncEngine.PushEntry(entry, op); err != nil {
 			_ = a.syncState.AddPendingEntry(op, entry)
 			return StatusMsg{Message: "Sync push failed (queued for retry): " + err.Error(), IsError: true}
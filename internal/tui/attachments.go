@@ -0,0 +1,350 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"forgor/internal/models"
+	"forgor/internal/secmem"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// AddAttachmentMsg asks the app to read the file at Path and attach it to
+// the entry.
+type AddAttachmentMsg struct {
+	EntryID string
+	Path    string
+}
+
+// ExportAttachmentMsg asks the app to write an attachment's contents to
+// Path, which must not exist yet.
+type ExportAttachmentMsg struct {
+	Attachment models.Attachment
+	Path       string
+}
+
+// SetAttachmentLookup tells the screen how to find out whether an
+// attachment's contents are stored, so ones still syncing can be marked.
+func (v *VaultScreen) SetAttachmentLookup(has func(id string) bool) {
+	v.hasAttachment = has
+}
+
+func (v VaultScreen) attachmentMissing(a models.Attachment) bool {
+	return v.hasAttachment != nil && !v.hasAttachment(a.ID)
+}
+
+func (v VaultScreen) updateAttachments(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
+	if len(v.filtered) == 0 {
+		v.mode = modeList
+		return v, nil
+	}
+	entry := v.filtered[v.cursor]
+	if v.attachCursor >= len(entry.Attachments) {
+		v.attachCursor = max(len(entry.Attachments)-1, 0)
+	}
+
+	if v.attachInput.Focused() {
+		switch msg.String() {
+		case "esc":
+			v.attachInput.Blur()
+			return v, nil
+		case "enter":
+			path := strings.TrimSpace(v.attachInput.Value())
+			v.attachInput.Blur()
+			if path == "" {
+				return v, nil
+			}
+			if v.attachAction == "add" {
+				return v, func() tea.Msg {
+					return AddAttachmentMsg{EntryID: entry.ID, Path: path}
+				}
+			}
+			if v.attachCursor < len(entry.Attachments) {
+				att := entry.Attachments[v.attachCursor]
+				return v, func() tea.Msg {
+					return ExportAttachmentMsg{Attachment: att, Path: path}
+				}
+			}
+			return v, nil
+		}
+		var cmd tea.Cmd
+		v.attachInput, cmd = v.attachInput.Update(msg)
+		return v, cmd
+	}
+
+	if v.attachConfirm {
+		v.attachConfirm = false
+		if msg.String() == "y" && v.attachCursor < len(entry.Attachments) {
+			return v.removeAttachment(entry.ID, entry.Attachments[v.attachCursor])
+		}
+		return v, nil
+	}
+
+	switch msg.String() {
+	case "up", "k":
+		if v.attachCursor > 0 {
+			v.attachCursor--
+		}
+	case "down", "j":
+		if v.attachCursor < len(entry.Attachments)-1 {
+			v.attachCursor++
+		}
+	case "a":
+		if len(entry.Attachments) >= models.MaxAttachments {
+			return v, func() tea.Msg {
+				return StatusMsg{Message: fmt.Sprintf("An entry can have at most %d attachments", models.MaxAttachments), IsError: true}
+			}
+		}
+		v.attachAction = "add"
+		v.attachInput = newPathInput("Path to the file to attach", "")
+		return v, v.attachInput.Focus()
+	case "enter", "x":
+		if v.attachCursor < len(entry.Attachments) {
+			att := entry.Attachments[v.attachCursor]
+			if v.attachmentMissing(att) {
+				return v, func() tea.Msg {
+					return StatusMsg{Message: att.Name + " has not finished syncing", IsError: true}
+				}
+			}
+			v.attachAction = "export"
+			v.attachInput = newPathInput("Where to save the file", att.Name)
+			return v, v.attachInput.Focus()
+		}
+	case "d":
+		if v.attachCursor < len(entry.Attachments) {
+			v.attachConfirm = true
+		}
+	case "esc", "q":
+		v.mode = modeView
+	}
+	return v, nil
+}
+
+func newPathInput(placeholder, value string) textinput.Model {
+	input := textinput.New()
+	input.Placeholder = placeholder
+	input.SetValue(value)
+	input.CursorEnd()
+	input.Width = 50
+	return input
+}
+
+// removeAttachment drops an attachment from an entry. Its contents stay
+// on disk while a history snapshot still refers to them.
+func (v VaultScreen) removeAttachment(entryID string, att models.Attachment) (VaultScreen, tea.Cmd) {
+	var updated models.Entry
+	for i, e := range v.entries {
+		if e.ID != entryID {
+			continue
+		}
+		kept := make([]models.Attachment, 0, len(e.Attachments))
+		for _, a := range e.Attachments {
+			if a.ID != att.ID {
+				kept = append(kept, a)
+			}
+		}
+		v.entries[i].Attachments = kept
+		v.entries[i].UpdatedAt = time.Now()
+		updated = v.entries[i]
+		break
+	}
+	if updated.ID == "" {
+		return v, nil
+	}
+	v.filterEntries()
+
+	return v, tea.Batch(
+		func() tea.Msg {
+			return SaveEntriesMsg{Entries: v.entries}
+		},
+		func() tea.Msg {
+			return SyncPushEntryMsg{Entry: updated, Op: "upsert"}
+		},
+		func() tea.Msg {
+			return StatusMsg{Message: "Removed " + att.Name, IsError: false}
+		},
+	)
+}
+
+func (v VaultScreen) viewAttachments() string {
+	if len(v.filtered) == 0 {
+		return ""
+	}
+
+	entry := v.filtered[v.cursor]
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render(entry.Title() + " - Attachments"))
+	b.WriteString("\n\n")
+
+	if len(entry.Attachments) == 0 {
+		b.WriteString(mutedStyle.Render("No attachments. Press 'a' to attach a file."))
+		b.WriteString("\n")
+	}
+
+	sizeStyle := lipgloss.NewStyle().Width(12).Foreground(mutedColor)
+	for i, att := range entry.Attachments {
+		cursor := "  "
+		style := normalStyle
+		if i == v.attachCursor {
+			cursor = "▸ "
+			style = selectedStyle
+		}
+		b.WriteString(cursor)
+		b.WriteString(sizeStyle.Render(models.FormatSize(att.Size)))
+		b.WriteString(style.Render(att.Name))
+		if v.attachmentMissing(att) {
+			b.WriteString(errorStyle.Render(" (not synced yet)"))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	switch {
+	case v.attachInput.Focused():
+		if v.attachAction == "add" {
+			b.WriteString("Attach file:\n")
+		} else {
+			b.WriteString("Export to:\n")
+		}
+		b.WriteString(focusedInputStyle.Render(v.attachInput.View()))
+		b.WriteString("\n\n")
+		b.WriteString(helpStyle.Render("enter confirm • esc cancel"))
+	case v.attachConfirm:
+		b.WriteString(errorStyle.Render(fmt.Sprintf("Remove %s?", entry.Attachments[v.attachCursor].Name)))
+		b.WriteString("\n\n")
+		b.WriteString(helpStyle.Render("y confirm • any key cancel"))
+	default:
+		b.WriteString(mutedStyle.Render(fmt.Sprintf("Files are encrypted in the vault, up to %s each.", models.FormatSize(models.MaxAttachmentSize))))
+		b.WriteString("\n\n")
+		help := []string{"a attach"}
+		if len(entry.Attachments) > 0 {
+			help = append([]string{"↑/↓ navigate"}, append(help, "enter export", "d remove")...)
+		}
+		help = append(help, "esc back")
+		b.WriteString(helpStyle.Render(strings.Join(help, " • ")))
+	}
+
+	return boxStyle.Render(b.String())
+}
+
+// expandHome replaces a leading ~ with the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+func (a *App) addAttachment(msg AddAttachmentMsg) tea.Cmd {
+	status := func(text string, isError bool) tea.Cmd {
+		return func() tea.Msg {
+			return StatusMsg{Message: text, IsError: isError}
+		}
+	}
+
+	path := expandHome(msg.Path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return status("Failed to read file: "+err.Error(), true)
+	}
+	if info.IsDir() {
+		return status(path+" is a directory", true)
+	}
+	if info.Size() > models.MaxAttachmentSize {
+		return status(fmt.Sprintf("%s is %s, the limit is %s", info.Name(), models.FormatSize(info.Size()), models.FormatSize(models.MaxAttachmentSize)), true)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return status("Failed to read file: "+err.Error(), true)
+	}
+	defer secmem.Wipe(content)
+
+	att, err := models.NewAttachment(info.Name(), content)
+	if err != nil {
+		return status(err.Error(), true)
+	}
+
+	entries := append([]models.Entry(nil), a.vaultScreen.GetEntries()...)
+	index := -1
+	for i, e := range entries {
+		if e.ID == msg.EntryID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return status("Entry no longer exists", true)
+	}
+	if len(entries[index].Attachments) >= models.MaxAttachments {
+		return status(fmt.Sprintf("An entry can have at most %d attachments", models.MaxAttachments), true)
+	}
+
+	if err := a.store.PutAttachment(att.ID, content); err != nil {
+		return status("Failed to store attachment: "+err.Error(), true)
+	}
+	entry := entries[index]
+	entry.Attachments = append(append([]models.Attachment(nil), entry.Attachments...), att)
+	entry.UpdatedAt = time.Now()
+	entries[index] = entry
+
+	return tea.Batch(
+		func() tea.Msg {
+			return SaveEntriesMsg{Entries: entries}
+		},
+		func() tea.Msg {
+			return SyncPushEntryMsg{Entry: entry, Op: "upsert"}
+		},
+		status("Attached "+att.Name, false),
+	)
+}
+
+func (a *App) exportAttachment(msg ExportAttachmentMsg) tea.Cmd {
+	status := func(text string, isError bool) tea.Cmd {
+		return func() tea.Msg {
+			return StatusMsg{Message: text, IsError: isError}
+		}
+	}
+
+	content, err := a.store.Attachment(msg.Attachment.ID)
+	if err != nil {
+		return status("Failed to read attachment: "+err.Error(), true)
+	}
+	defer secmem.Wipe(content)
+	if err := msg.Attachment.Verify(content); err != nil {
+		return status(err.Error(), true)
+	}
+
+	path := expandHome(msg.Path)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, msg.Attachment.Name)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return status(path+" already exists", true)
+	}
+	if err != nil {
+		return status("Failed to export: "+err.Error(), true)
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(path)
+		return status("Failed to export: "+err.Error(), true)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return status("Failed to export: "+err.Error(), true)
+	}
+	return status("Exported to "+path, false)
+}
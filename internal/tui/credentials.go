@@ -0,0 +1,133 @@
+package tui
+
+import (
+	"strings"
+	"time"
+
+	"forgor/internal/models"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func (v VaultScreen) updateCredentialHistory(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
+	if len(v.filtered) == 0 {
+		v.mode = modeList
+		return v, nil
+	}
+	entry := v.filtered[v.cursor]
+	if len(entry.History) == 0 {
+		v.mode = modeView
+		return v, nil
+	}
+	if v.credCursor >= len(entry.History) {
+		v.credCursor = len(entry.History) - 1
+	}
+	change := entry.History[v.credCursor]
+
+	switch msg.String() {
+	case "up", "k":
+		if v.credCursor > 0 {
+			v.credCursor--
+		}
+	case "down", "j":
+		if v.credCursor < len(entry.History)-1 {
+			v.credCursor++
+		}
+	case "p":
+		v.showPassword = !v.showPassword
+	case "u":
+		return v, func() tea.Msg {
+			return CopyToClipboardMsg{Text: change.Username, Label: "Old username"}
+		}
+	case "c":
+		return v, func() tea.Msg {
+			return CopyToClipboardMsg{Text: change.Password, Label: "Old password"}
+		}
+	case "r":
+		return v.restoreCredentials(entry.ID, change)
+	case "esc", "q":
+		v.mode = modeView
+		v.showPassword = false
+	}
+	return v, nil
+}
+
+// restoreCredentials makes an old username and password current again. The
+// values being replaced go into the history, so a restore can be undone.
+func (v VaultScreen) restoreCredentials(entryID string, change models.CredentialChange) (VaultScreen, tea.Cmd) {
+	var restored models.Entry
+	for i, e := range v.entries {
+		if e.ID != entryID {
+			continue
+		}
+		v.entries[i].RecordCredentials(time.Now())
+		v.entries[i].Username = change.Username
+		v.entries[i].Password = change.Password
+		v.entries[i].UpdatedAt = time.Now()
+		restored = v.entries[i]
+		break
+	}
+	if restored.ID == "" {
+		return v, nil
+	}
+
+	v.filterEntries()
+	v.mode = modeView
+	v.showPassword = false
+
+	return v, tea.Batch(
+		func() tea.Msg {
+			return SaveEntriesMsg{Entries: v.entries}
+		},
+		func() tea.Msg {
+			return SyncPushEntryMsg{Entry: restored, Op: "upsert"}
+		},
+		func() tea.Msg {
+			return StatusMsg{Message: "Previous password restored", IsError: false}
+		},
+	)
+}
+
+func (v VaultScreen) viewCredentialHistory() string {
+	if len(v.filtered) == 0 {
+		return ""
+	}
+
+	entry := v.filtered[v.cursor]
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render(entry.Title() + " - Password History"))
+	b.WriteString("\n\n")
+
+	timeStyle := lipgloss.NewStyle().Width(22).Foreground(mutedColor)
+	for i, change := range entry.History {
+		cursor := "  "
+		style := normalStyle
+		if i == v.credCursor {
+			cursor = "▸ "
+			style = selectedStyle
+		}
+
+		password := strings.Repeat("•", min(len(change.Password), 20))
+		if v.showPassword && i == v.credCursor {
+			password = change.Password
+		}
+
+		b.WriteString(cursor)
+		b.WriteString(timeStyle.Render(change.ChangedAt.Format("2006-01-02 3:04 PM")))
+		line := password
+		if change.Username != "" {
+			line = change.Username + "  " + password
+		}
+		b.WriteString(style.Render(line))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(mutedStyle.Render("Times show when each value was replaced."))
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render("↑/↓ navigate • u copy username • c copy password • p toggle password • r restore • esc back"))
+
+	return boxStyle.Render(b.String())
+}
@@ -0,0 +1,235 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"forgor/internal/models"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// tagsSpec ends every type's fixed inputs. After it each custom field takes
+// three inputs: name, type, value.
+var tagsSpec = models.FieldSpec{Key: "tags", Label: "Tags", Placeholder: "Tags (comma separated)"}
+
+func (v VaultScreen) fixedEditFields() int {
+	return len(v.editSpecs)
+}
+
+func newSpecInput(spec models.FieldSpec, value string) formInput {
+	placeholder := spec.Placeholder
+	if placeholder == "" {
+		placeholder = spec.Label
+	}
+	if spec.Multiline {
+		return newAreaInput(placeholder, value)
+	}
+	return newTextInput(placeholder, value)
+}
+
+func newCustomFieldInputs(field models.CustomField) []formInput {
+	var typeNames []string
+	for _, t := range models.FieldTypes {
+		typeNames = append(typeNames, string(t))
+	}
+	return []formInput{
+		newTextInput("Field name", field.Name),
+		newTextInput(strings.Join(typeNames, ", "), string(field.Type)),
+		newTextInput("Value", field.Value),
+	}
+}
+
+// addCustomField appends an empty text field to the form and focuses its name.
+func (v *VaultScreen) addCustomField() {
+	if (len(v.editFields)-v.fixedEditFields())/3 >= models.MaxCustomFields {
+		v.statusMsg = fmt.Sprintf("An entry can have at most %d fields", models.MaxCustomFields)
+		v.statusIsError = true
+		return
+	}
+	v.editFields[v.editFocus].Blur()
+	v.editFields = append(v.editFields, newCustomFieldInputs(models.CustomField{})...)
+	v.editFocus = len(v.editFields) - 3
+	v.editFields[v.editFocus].Focus()
+}
+
+// removeCustomField drops the custom field that has focus, if any.
+func (v *VaultScreen) removeCustomField() {
+	fixed := v.fixedEditFields()
+	if v.editFocus < fixed {
+		return
+	}
+	start := fixed + (v.editFocus-fixed)/3*3
+	v.editFields = append(v.editFields[:start:start], v.editFields[start+3:]...)
+	if v.editFocus >= len(v.editFields) {
+		v.editFocus = len(v.editFields) - 1
+	} else {
+		v.editFocus = start
+	}
+	v.editFields[v.editFocus].Focus()
+}
+
+// cycleFieldType steps the focused type input through models.FieldTypes.
+// It reports false when the focused input is not a type input.
+func (v *VaultScreen) cycleFieldType(step int) bool {
+	fixed := v.fixedEditFields()
+	if v.editFocus < fixed || (v.editFocus-fixed)%3 != 1 {
+		return false
+	}
+	input := &v.editFields[v.editFocus]
+	current, err := models.ParseFieldType(input.Value())
+	if err != nil {
+		current = models.FieldText
+	}
+	n := len(models.FieldTypes)
+	for i, t := range models.FieldTypes {
+		if t == current {
+			input.SetValue(string(models.FieldTypes[(i+step+n)%n]))
+			break
+		}
+	}
+	return true
+}
+
+func (v VaultScreen) parseCustomFields() ([]models.CustomField, error) {
+	var fields []models.CustomField
+	for i := v.fixedEditFields(); i+2 < len(v.editFields); i += 3 {
+		name := strings.TrimSpace(v.editFields[i].Value())
+		value := v.editFields[i+2].Value()
+		if name == "" && value == "" {
+			continue
+		}
+		fieldType, err := models.ParseFieldType(v.editFields[i+1].Value())
+		if err != nil {
+			return nil, err
+		}
+		if fieldType != models.FieldHidden {
+			value = strings.TrimSpace(value)
+		}
+		field := models.CustomField{Name: name, Type: fieldType, Value: value}
+		if err := field.Validate(); err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// editFieldLabel names the input at index i of the edit form.
+func (v VaultScreen) editFieldLabel(i int) string {
+	fixed := v.fixedEditFields()
+	if i < fixed {
+		return v.editSpecs[i].Label + ":"
+	}
+	n := (i-fixed)/3 + 1
+	return fmt.Sprintf("Field %d %s:", n, []string{"name", "type", "value"}[(i-fixed)%3])
+}
+
+// entryRow is one line of the entry view that can be selected and copied.
+type entryRow struct {
+	Label     string
+	Value     string
+	Note      string
+	Hidden    bool
+	Multiline bool
+	TOTP      bool
+}
+
+// entryRows lists the entry's non-empty fields in form order, followed by
+// its custom fields. The title field is shown as the heading instead.
+func entryRows(entry models.Entry) []entryRow {
+	spec := models.SpecFor(entry.Kind())
+	var rows []entryRow
+	for _, f := range spec.Fields {
+		value := entry.Get(f.Key)
+		if f.Key == spec.TitleKey || value == "" {
+			continue
+		}
+		rows = append(rows, entryRow{
+			Label:     f.Label,
+			Value:     value,
+			Hidden:    f.Hidden(),
+			Multiline: f.Multiline,
+			TOTP:      f.Key == "totp",
+		})
+	}
+	for _, f := range entry.Fields {
+		row := entryRow{Label: f.Name, Value: f.Value, Hidden: f.Hidden()}
+		if f.Type != models.FieldText && f.Type != models.FieldHidden {
+			row.Note = string(f.Type)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (v VaultScreen) copyRow(entry models.Entry, row entryRow) tea.Cmd {
+	if row.TOTP {
+		return v.copyTOTP(entry)
+	}
+	return func() tea.Msg {
+		return CopyToClipboardMsg{Text: row.Value, Label: row.Label}
+	}
+}
+
+func (v VaultScreen) viewRows(entry models.Entry, rows []entryRow, labelStyle lipgloss.Style) string {
+	var b strings.Builder
+	for i, row := range rows {
+		cursor := "  "
+		if i == v.fieldCursor {
+			cursor = "▸ "
+		}
+		if row.TOTP {
+			b.WriteString(cursor)
+			b.WriteString(v.viewTOTP(entry, labelStyle))
+			continue
+		}
+
+		value := row.Value
+		if row.Hidden && !v.showPassword {
+			value = strings.Repeat("•", min(len(value), 20))
+		}
+		if row.Note != "" {
+			value += mutedStyle.Render(" (" + row.Note + ")")
+		}
+		label := labelStyle.Render(row.Label + ":")
+		if row.Multiline {
+			b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, cursor, label, value))
+		} else {
+			b.WriteString(cursor + label + value)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func entryMatches(entry models.Entry, query string) bool {
+	spec := models.SpecFor(entry.Kind())
+	for _, f := range spec.Fields {
+		if f.Hidden() || f.Key == "totp" {
+			continue
+		}
+		if strings.Contains(strings.ToLower(entry.Get(f.Key)), query) {
+			return true
+		}
+	}
+	for _, t := range entry.Tags {
+		if strings.Contains(strings.ToLower(t), query) {
+			return true
+		}
+	}
+	for _, f := range entry.Fields {
+		if fieldMatches(f, query) {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldMatches(field models.CustomField, query string) bool {
+	if strings.Contains(strings.ToLower(field.Name), query) {
+		return true
+	}
+	return !field.Hidden() && strings.Contains(strings.ToLower(field.Value), query)
+}
@@ -0,0 +1,503 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"forgor/internal/models"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// SaveFoldersMsg asks the app to store the folder list.
+type SaveFoldersMsg struct {
+	Folders []models.Folder
+}
+
+// listRow is one line of the vault list: a folder, or an entry by its
+// index in filtered.
+type listRow struct {
+	folder *models.Folder
+	entry  int
+	depth  int
+	// count is the number of entries in a folder and its subfolders.
+	count int
+}
+
+func (v *VaultScreen) SetFolders(folders []models.Folder) {
+	v.folders = folders
+	v.filterEntries()
+}
+
+func (v VaultScreen) GetFolders() []models.Folder {
+	return v.folders
+}
+
+// rebuildRows lays out the list. Without a query it is a tree starting at
+// the search scope; with one it is the flat list of matches. The row whose
+// rowKey was selected stays selected when it is still listed.
+func (v *VaultScreen) rebuildRows(selected string) {
+	rows := make([]listRow, 0, len(v.filtered)+len(v.folders))
+
+	if v.searchInput.Value() != "" {
+		for i := range v.filtered {
+			rows = append(rows, listRow{entry: i})
+		}
+	} else {
+		byFolder := make(map[string][]int)
+		counts := make(map[string]int)
+		for i, e := range v.filtered {
+			folderID := v.tree.Resolve(e.FolderID)
+			byFolder[folderID] = append(byFolder[folderID], i)
+			for cur := folderID; cur != ""; cur = v.tree.Parent(cur) {
+				counts[cur]++
+			}
+		}
+
+		var walk func(parent string, depth int)
+		walk = func(parent string, depth int) {
+			for _, f := range v.tree.Children(parent) {
+				f := f
+				rows = append(rows, listRow{folder: &f, entry: -1, depth: depth, count: counts[f.ID]})
+				if v.expanded[f.ID] {
+					walk(f.ID, depth+1)
+				}
+			}
+			for _, i := range byFolder[parent] {
+				rows = append(rows, listRow{entry: i, depth: depth})
+			}
+		}
+		walk(v.tree.Resolve(v.searchScope), 0)
+	}
+
+	v.rows = rows
+	index := min(v.rowCursor, max(len(rows)-1, 0))
+	for i := range rows {
+		if v.rowKey(i) == selected {
+			index = i
+			break
+		}
+	}
+	v.selectRow(index)
+}
+
+// rowKey identifies the folder or entry on row i across rebuilds.
+func (v VaultScreen) rowKey(i int) string {
+	if i < 0 || i >= len(v.rows) {
+		return ""
+	}
+	if f := v.rows[i].folder; f != nil {
+		return "folder:" + f.ID
+	}
+	if v.rows[i].entry < len(v.filtered) {
+		return "entry:" + v.filtered[v.rows[i].entry].ID
+	}
+	return ""
+}
+
+// selectRow moves the list cursor, pointing cursor at the row's entry so
+// the entry screens show it.
+func (v *VaultScreen) selectRow(i int) {
+	v.rowCursor = i
+	if i >= 0 && i < len(v.rows) && v.rows[i].entry >= 0 {
+		v.cursor = v.rows[i].entry
+	}
+}
+
+func (v VaultScreen) selectedFolder() *models.Folder {
+	if v.rowCursor < len(v.rows) {
+		return v.rows[v.rowCursor].folder
+	}
+	return nil
+}
+
+// currentFolder is where new entries and folders go: the selected folder,
+// the folder of the selected entry, or the search scope.
+func (v VaultScreen) currentFolder() string {
+	if f := v.selectedFolder(); f != nil {
+		return f.ID
+	}
+	if v.rowCursor < len(v.rows) && v.rows[v.rowCursor].entry < len(v.filtered) {
+		return v.tree.Resolve(v.filtered[v.rows[v.rowCursor].entry].FolderID)
+	}
+	return v.tree.Resolve(v.searchScope)
+}
+
+func (v *VaultScreen) setExpanded(folderID string, open bool) {
+	if v.expanded == nil {
+		v.expanded = make(map[string]bool)
+	}
+	v.expanded[folderID] = open
+	v.rebuildRows(v.rowKey(v.rowCursor))
+}
+
+// updateFolderKeys handles the list keys that work on folders. It reports
+// whether it used the key.
+func (v VaultScreen) updateFolderKeys(msg tea.KeyMsg) (VaultScreen, tea.Cmd, bool) {
+	folder := v.selectedFolder()
+	switch msg.String() {
+	case "right", "l":
+		if folder != nil {
+			v.setExpanded(folder.ID, true)
+		}
+	case "left":
+		if folder != nil && v.expanded[folder.ID] {
+			v.setExpanded(folder.ID, false)
+			break
+		}
+		parent := v.tree.Parent(v.currentFolder())
+		if folder == nil {
+			parent = v.currentFolder()
+		}
+		for i, row := range v.rows {
+			if row.folder != nil && row.folder.ID == parent {
+				v.selectRow(i)
+			}
+		}
+	case "n":
+		parent := v.currentFolder()
+		label := "New folder"
+		if path := v.tree.Path(parent); path != "" {
+			label += " in " + path
+		}
+		return v, v.startFolderInput("new", parent, label, ""), true
+	case "r":
+		if folder != nil {
+			return v, v.startFolderInput("rename", folder.ID, "Rename "+folder.Name, folder.Name), true
+		}
+	case "x":
+		if folder != nil {
+			v.folderConfirm = true
+		}
+	case "o":
+		return v.startMove(), nil, true
+	default:
+		return v, nil, false
+	}
+	return v, nil, true
+}
+
+func (v *VaultScreen) startFolderInput(action, target, label, value string) tea.Cmd {
+	input := textinput.New()
+	input.Placeholder = "Folder name"
+	input.CharLimit = models.MaxFolderNameLength
+	input.SetValue(value)
+	input.CursorEnd()
+	input.Width = 40
+	v.folderInput = input
+	v.folderAction = action
+	v.folderTarget = target
+	v.folderLabel = label
+	return v.folderInput.Focus()
+}
+
+func (v VaultScreen) updateFolderInput(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		v.folderInput.Blur()
+		return v, nil
+	case "enter":
+		name := strings.TrimSpace(v.folderInput.Value())
+		v.folderInput.Blur()
+		if v.folderAction == "rename" {
+			return v.renameFolder(v.folderTarget, name)
+		}
+		return v.createFolder(name, v.folderTarget)
+	}
+	var cmd tea.Cmd
+	v.folderInput, cmd = v.folderInput.Update(msg)
+	return v, cmd
+}
+
+func (v VaultScreen) createFolder(name, parentID string) (VaultScreen, tea.Cmd) {
+	folder := models.NewFolder(name, parentID)
+	if err := folder.Validate(); err != nil {
+		v.statusMsg = err.Error()
+		v.statusIsError = true
+		return v, nil
+	}
+	v.folders = append(append([]models.Folder(nil), v.folders...), folder)
+	if v.expanded == nil {
+		v.expanded = make(map[string]bool)
+	}
+	v.expanded[parentID] = true
+	v.filterEntries()
+	for i, row := range v.rows {
+		if row.folder != nil && row.folder.ID == folder.ID {
+			v.selectRow(i)
+		}
+	}
+	return v, v.saveFolders([]models.Folder{folder}, nil, nil)
+}
+
+func (v VaultScreen) renameFolder(id, name string) (VaultScreen, tea.Cmd) {
+	folders := append([]models.Folder(nil), v.folders...)
+	for i := range folders {
+		if folders[i].ID != id {
+			continue
+		}
+		folders[i].Name = name
+		if err := folders[i].Validate(); err != nil {
+			v.statusMsg = err.Error()
+			v.statusIsError = true
+			return v, nil
+		}
+		folders[i].UpdatedAt = time.Now()
+		v.folders = folders
+		v.filterEntries()
+		return v, v.saveFolders([]models.Folder{folders[i]}, nil, nil)
+	}
+	return v, nil
+}
+
+// deleteFolder removes a folder, moving what it held up to its parent.
+func (v VaultScreen) deleteFolder(id string) (VaultScreen, tea.Cmd) {
+	folder, ok := v.tree.Get(id)
+	if !ok {
+		return v, nil
+	}
+	parent := v.tree.Parent(id)
+	now := time.Now()
+
+	var folders, changed []models.Folder
+	for _, f := range v.folders {
+		if f.ID == id {
+			continue
+		}
+		if v.tree.Parent(f.ID) == id {
+			f.ParentID = parent
+			f.UpdatedAt = now
+			changed = append(changed, f)
+		}
+		folders = append(folders, f)
+	}
+
+	var moved []models.Entry
+	for i, e := range v.entries {
+		if e.FolderID == id {
+			v.entries[i].FolderID = parent
+			v.entries[i].UpdatedAt = now
+			moved = append(moved, v.entries[i])
+		}
+	}
+
+	v.folders = folders
+	v.filterEntries()
+	v.statusMsg = "Deleted folder " + folder.Name
+	v.statusIsError = false
+	return v, v.saveFolders(changed, []models.Folder{folder}, moved)
+}
+
+// saveFolders stores the folder list and pushes the given changes. Moved
+// entries are saved and pushed too.
+func (v VaultScreen) saveFolders(upserted, deleted []models.Folder, moved []models.Entry) tea.Cmd {
+	folders := v.folders
+	cmds := []tea.Cmd{func() tea.Msg {
+		return SaveFoldersMsg{Folders: folders}
+	}}
+	for _, f := range upserted {
+		folder := f
+		cmds = append(cmds, func() tea.Msg {
+			return SyncPushFolderMsg{Folder: folder, Op: "upsert"}
+		})
+	}
+	for _, f := range deleted {
+		folder := f
+		cmds = append(cmds, func() tea.Msg {
+			return SyncPushFolderMsg{Folder: folder, Op: "delete"}
+		})
+	}
+	if len(moved) > 0 {
+		entries := v.entries
+		cmds = append(cmds, func() tea.Msg {
+			return SaveEntriesMsg{Entries: entries}
+		})
+		for _, e := range moved {
+			entry := e
+			cmds = append(cmds, func() tea.Msg {
+				return SyncPushEntryMsg{Entry: entry, Op: "upsert"}
+			})
+		}
+	}
+	return tea.Sequence(cmds...)
+}
+
+// startMove opens the folder picker for the selected folder or entry.
+func (v VaultScreen) startMove() VaultScreen {
+	v.moveFolderID = ""
+	v.moveEntryID = ""
+	if f := v.selectedFolder(); f != nil && v.mode == modeList {
+		v.moveFolderID = f.ID
+	} else if len(v.filtered) > 0 {
+		v.moveEntryID = v.filtered[v.cursor].ID
+	} else {
+		return v
+	}
+
+	v.moveChoices = []string{""}
+	for _, f := range v.tree.All() {
+		if v.moveFolderID != "" && v.tree.Contains(v.moveFolderID, f.ID) {
+			continue
+		}
+		v.moveChoices = append(v.moveChoices, f.ID)
+	}
+	v.moveCursor = 0
+	v.moveReturn = v.mode
+	v.mode = modeMoveFolder
+	return v
+}
+
+func (v VaultScreen) updateMoveFolder(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if v.moveCursor > 0 {
+			v.moveCursor--
+		}
+	case "down", "j":
+		if v.moveCursor < len(v.moveChoices)-1 {
+			v.moveCursor++
+		}
+	case "enter":
+		v.mode = v.moveReturn
+		target := v.moveChoices[v.moveCursor]
+		if v.moveFolderID != "" {
+			return v.moveFolder(v.moveFolderID, target)
+		}
+		return v.moveEntry(v.moveEntryID, target)
+	case "esc", "q":
+		v.mode = v.moveReturn
+	}
+	return v, nil
+}
+
+func (v VaultScreen) moveEntry(entryID, folderID string) (VaultScreen, tea.Cmd) {
+	var moved models.Entry
+	for i, e := range v.entries {
+		if e.ID == entryID {
+			if v.tree.Resolve(e.FolderID) == folderID {
+				return v, nil
+			}
+			v.entries[i].FolderID = folderID
+			v.entries[i].UpdatedAt = time.Now()
+			moved = v.entries[i]
+			break
+		}
+	}
+	if moved.ID == "" {
+		return v, nil
+	}
+	if folderID != "" {
+		v.setExpanded(folderID, true)
+	}
+	v.filterEntries()
+	for i, e := range v.filtered {
+		if e.ID == entryID {
+			v.cursor = i
+		}
+	}
+
+	return v, tea.Batch(
+		func() tea.Msg {
+			return SaveEntriesMsg{Entries: v.entries}
+		},
+		func() tea.Msg {
+			return SyncPushEntryMsg{Entry: moved, Op: "upsert"}
+		},
+		func() tea.Msg {
+			return StatusMsg{Message: "Moved to " + v.folderName(folderID), IsError: false}
+		},
+	)
+}
+
+func (v VaultScreen) moveFolder(id, parentID string) (VaultScreen, tea.Cmd) {
+	if v.tree.Parent(id) == parentID || v.tree.Contains(id, parentID) {
+		return v, nil
+	}
+	folders := append([]models.Folder(nil), v.folders...)
+	for i := range folders {
+		if folders[i].ID != id {
+			continue
+		}
+		folders[i].ParentID = parentID
+		folders[i].UpdatedAt = time.Now()
+		v.folders = folders
+		if parentID != "" {
+			v.setExpanded(parentID, true)
+		}
+		v.filterEntries()
+		v.statusMsg = "Moved to " + v.folderName(parentID)
+		v.statusIsError = false
+		return v, v.saveFolders([]models.Folder{folders[i]}, nil, nil)
+	}
+	return v, nil
+}
+
+func (v VaultScreen) folderName(id string) string {
+	if path := v.tree.Path(id); path != "" {
+		return path
+	}
+	return "the top level"
+}
+
+func (v VaultScreen) viewMoveFolder() string {
+	var b strings.Builder
+
+	what := ""
+	if f, ok := v.tree.Get(v.moveFolderID); ok {
+		what = f.Name
+	} else {
+		for _, e := range v.entries {
+			if e.ID == v.moveEntryID {
+				what = e.Title()
+			}
+		}
+	}
+	b.WriteString(titleStyle.Render("Move " + what))
+	b.WriteString("\n\n")
+
+	for i, id := range v.moveChoices {
+		name := "(top level)"
+		depth := 0
+		if id != "" {
+			f, _ := v.tree.Get(id)
+			name = f.Name
+			depth = v.tree.Depth(id) + 1
+		}
+		line := strings.Repeat("  ", depth) + name
+		if i == v.moveCursor {
+			b.WriteString("▸ " + selectedStyle.Render(line))
+		} else {
+			b.WriteString("  " + normalStyle.Render(line))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(helpStyle.Render("↑/↓ choose folder • enter move • esc cancel"))
+
+	return boxStyle.Render(b.String())
+}
+
+// viewFolderPrompt renders the folder name input or delete confirmation
+// under the list, if one is open.
+func (v VaultScreen) viewFolderPrompt() string {
+	var b strings.Builder
+	switch {
+	case v.folderInput.Focused():
+		b.WriteString(v.folderLabel + ":\n")
+		b.WriteString(focusedInputStyle.Render(v.folderInput.View()))
+		b.WriteString("\n")
+		b.WriteString(helpStyle.Render("enter save • esc cancel"))
+	case v.folderConfirm:
+		if f := v.selectedFolder(); f != nil {
+			b.WriteString(errorStyle.Render(fmt.Sprintf("Delete folder %s?", f.Name)))
+			b.WriteString(" ")
+			b.WriteString(mutedStyle.Render(fmt.Sprintf("Its %d entries and subfolders move to %s.", v.rows[v.rowCursor].count, v.folderName(v.tree.Parent(f.ID)))))
+			b.WriteString("\n")
+			b.WriteString(helpStyle.Render("y confirm • any key cancel"))
+		}
+	}
+	return b.String()
+}
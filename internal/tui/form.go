@@ -0,0 +1,84 @@
+package tui
+
+import (
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// formInput is one input of the entry form: a single-line textinput or,
+// for notes and keys, a textarea.
+type formInput struct {
+	text      textinput.Model
+	area      textarea.Model
+	multiline bool
+}
+
+func newTextInput(placeholder, value string) formInput {
+	text := textinput.New()
+	text.Placeholder = placeholder
+	text.SetValue(value)
+	text.Width = 40
+	return formInput{text: text}
+}
+
+func newAreaInput(placeholder, value string) formInput {
+	area := textarea.New()
+	area.Placeholder = placeholder
+	area.ShowLineNumbers = false
+	area.CharLimit = 0
+	area.MaxHeight = 0
+	area.SetWidth(44)
+	area.SetHeight(4)
+	area.SetValue(value)
+	area.Blur()
+	return formInput{area: area, multiline: true}
+}
+
+func (f formInput) Value() string {
+	if f.multiline {
+		return f.area.Value()
+	}
+	return f.text.Value()
+}
+
+func (f *formInput) SetValue(s string) {
+	if f.multiline {
+		f.area.SetValue(s)
+		return
+	}
+	f.text.SetValue(s)
+	f.text.CursorEnd()
+}
+
+func (f *formInput) Focus() tea.Cmd {
+	if f.multiline {
+		return f.area.Focus()
+	}
+	return f.text.Focus()
+}
+
+func (f *formInput) Blur() {
+	if f.multiline {
+		f.area.Blur()
+		return
+	}
+	f.text.Blur()
+}
+
+func (f formInput) Update(msg tea.Msg) (formInput, tea.Cmd) {
+	var cmd tea.Cmd
+	if f.multiline {
+		f.area, cmd = f.area.Update(msg)
+	} else {
+		f.text, cmd = f.text.Update(msg)
+	}
+	return f, cmd
+}
+
+func (f formInput) View() string {
+	if f.multiline {
+		return f.area.View()
+	}
+	return f.text.View()
+}
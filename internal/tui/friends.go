@@ -166,7 +166,7 @@ func (f FriendsScreen) viewList() string {
 	b.WriteString("\n\n")
 
 	if f.selectedEntry != nil {
-		b.WriteString(successStyle.Render(fmt.Sprintf("Selected: %s", f.selectedEntry.Website)))
+		b.WriteString(successStyle.Render(fmt.Sprintf("Selected: %s", f.selectedEntry.Title())))
 		b.WriteString("\n\n")
 	}
 
@@ -211,7 +211,7 @@ func (f FriendsScreen) viewShare() string {
 
 	b.WriteString(titleStyle.Render("Share Entry"))
 	b.WriteString("\n\n")
-	b.WriteString(fmt.Sprintf("Share '%s' with %s?\n\n", f.selectedEntry.Website, friend.Name))
+	b.WriteString(fmt.Sprintf("Share '%s' with %s?\n\n", f.selectedEntry.Title(), friend.Name))
 	b.WriteString("This action is E2E encrypted.\n")
 	b.WriteString("Your data remains private and secure.\n")
 	b.WriteString("Only the recipient can decrypt it.\n\n")
@@ -0,0 +1,172 @@
+package tui
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"forgor/internal/models"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type entryDiff struct {
+	added   []models.Entry
+	removed []models.Entry
+	changed []models.Entry
+}
+
+// diffEntries describes how to get from old to new: entries only in new are
+// added, entries only in old are removed, and changed entries are taken
+// from new.
+func diffEntries(old, new []models.Entry) entryDiff {
+	var d entryDiff
+
+	oldByID := make(map[string]models.Entry, len(old))
+	for _, e := range old {
+		oldByID[e.ID] = e
+	}
+	newIDs := make(map[string]bool, len(new))
+	for _, e := range new {
+		newIDs[e.ID] = true
+		prev, ok := oldByID[e.ID]
+		if !ok {
+			d.added = append(d.added, e)
+		} else if !reflect.DeepEqual(prev, e) {
+			d.changed = append(d.changed, e)
+		}
+	}
+	for _, e := range old {
+		if !newIDs[e.ID] {
+			d.removed = append(d.removed, e)
+		}
+	}
+	return d
+}
+
+func (d entryDiff) empty() bool {
+	return len(d.added) == 0 && len(d.removed) == 0 && len(d.changed) == 0
+}
+
+func (v *VaultScreen) ShowHistory(snapshots []models.VaultSnapshot) {
+	v.snapshots = snapshots
+	v.historyCursor = 0
+	v.mode = modeHistory
+}
+
+func (v VaultScreen) updateHistory(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if v.historyCursor > 0 {
+			v.historyCursor--
+		}
+	case "down", "j":
+		if v.historyCursor < len(v.snapshots)-1 {
+			v.historyCursor++
+		}
+	case "enter":
+		if len(v.snapshots) > 0 {
+			v.mode = modeHistoryDiff
+		}
+	case "esc", "q":
+		v.snapshots = nil
+		v.mode = modeList
+	}
+	return v, nil
+}
+
+func (v VaultScreen) updateHistoryDiff(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
+	switch msg.String() {
+	case "r":
+		snapshot := v.snapshots[v.historyCursor]
+		v.snapshots = nil
+		v.mode = modeList
+		return v, func() tea.Msg {
+			return RestoreSnapshotMsg{Snapshot: snapshot}
+		}
+	case "esc", "q":
+		v.mode = modeHistory
+	}
+	return v, nil
+}
+
+func (v VaultScreen) viewHistory() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("Vault History"))
+	b.WriteString("\n")
+	b.WriteString(subtitleStyle.Render("Earlier versions of your vault, newest first"))
+	b.WriteString("\n\n")
+
+	if len(v.snapshots) == 0 {
+		b.WriteString(mutedStyle.Render("No earlier versions yet."))
+		b.WriteString("\n")
+	}
+	for i, snapshot := range v.snapshots {
+		cursor := "  "
+		style := normalStyle
+		if i == v.historyCursor {
+			cursor = "▸ "
+			style = selectedStyle
+		}
+		b.WriteString(cursor)
+		b.WriteString(style.Render(snapshot.SavedAt.Format("2006-01-02 3:04:05 PM")))
+		b.WriteString(mutedStyle.Render(fmt.Sprintf(" (%d entries)", len(snapshot.Entries))))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(helpStyle.Render("↑/↓ navigate • enter compare • esc back"))
+
+	return b.String()
+}
+
+func (v VaultScreen) viewHistoryDiff() string {
+	if len(v.snapshots) == 0 {
+		return ""
+	}
+
+	snapshot := v.snapshots[v.historyCursor]
+	diff := diffEntries(v.entries, snapshot.Entries)
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("Version from " + snapshot.SavedAt.Format("2006-01-02 3:04:05 PM")))
+	b.WriteString("\n")
+	b.WriteString(subtitleStyle.Render("Restoring this version would make these changes"))
+	b.WriteString("\n\n")
+
+	if diff.empty() {
+		b.WriteString(mutedStyle.Render("Identical to the current vault."))
+		b.WriteString("\n")
+	}
+	writeDiffSection(&b, "+ Bring back", successStyle.Render, diff.added)
+	writeDiffSection(&b, "- Remove", errorStyle.Render, diff.removed)
+	writeDiffSection(&b, "~ Revert", normalStyle.Render, diff.changed)
+
+	b.WriteString("\n")
+	b.WriteString(helpStyle.Render("r restore this version • esc back"))
+
+	return boxStyle.Render(b.String())
+}
+
+func writeDiffSection(b *strings.Builder, label string, render func(...string) string, entries []models.Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	b.WriteString(render(fmt.Sprintf("%s (%d)", label, len(entries))))
+	b.WriteString("\n")
+	for _, e := range entries {
+		line := "    " + e.Title()
+		if e.Username != "" {
+			line += mutedStyle.Render(" (" + e.Username + ")")
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+}
+
+type LoadHistoryMsg struct{}
+
+type RestoreSnapshotMsg struct {
+	Snapshot models.VaultSnapshot
+}
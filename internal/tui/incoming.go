@@ -62,10 +62,13 @@ func (s IncomingShareScreen) View() string {
 
 	b.WriteString(titleStyle.Render("You got a share request!"))
 	b.WriteString("\n\n")
-	b.WriteString(fmt.Sprintf("%s wants to share their %s login with you\n\n", s.share.FromName, s.share.Entry.Website))
-	b.WriteString(fmt.Sprintf("Username: %s\n", s.share.Entry.Username))
+	kind := strings.ToLower(models.SpecFor(s.share.Entry.Kind()).Label)
+	b.WriteString(fmt.Sprintf("%s wants to share their %s %s with you\n\n", s.share.FromName, s.share.Entry.Title(), kind))
+	if s.share.Entry.Username != "" {
+		b.WriteString(fmt.Sprintf("Username: %s\n", s.share.Entry.Username))
+	}
 	b.WriteString("\n")
-	b.WriteString("Would you like to accept this login into your vault?\n")
+	b.WriteString(fmt.Sprintf("Would you like to accept this %s into your vault?\n", kind))
 	b.WriteString("This action is E2E encrypted. Your data remains private and secure.\n\n")
 	b.WriteString(helpStyle.Render("y accept • n decline"))
 
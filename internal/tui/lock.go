@@ -1,23 +1,63 @@
 package tui
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+type lockMode int
+
+const (
+	lockModeUnlock lockMode = iota
+	lockModeCreate
+	lockModeChangePassword
+	lockModeRecovery
+	lockModeResetPassword
+	lockModeKeyfile
+	lockModeProfiles
+)
+
 type LockScreen struct {
-	passwordInput textinput.Model
-	confirmInput  textinput.Model
-	deviceInput   textinput.Model
-	isNewVault    bool
-	focusIndex    int
-	err           string
-	loading       bool
+	passwordInput    textinput.Model
+	newPasswordInput textinput.Model
+	confirmInput     textinput.Model
+	deviceInput      textinput.Model
+	recoveryInput    textinput.Model
+	keyfileInput     textinput.Model
+	newKeyfileInput  textinput.Model
+	profileInput     textinput.Model
+	mode             lockMode
+	isNew            bool
+	needsKeyfile     bool
+	focusIndex       int
+	err              string
+	loading          bool
+
+	// lockedUntil is when the next password attempt is allowed after too
+	// many failures. recoveryOnly locks the screen into recovery mode.
+	lockedUntil  time.Time
+	ticking      bool
+	recoveryOnly bool
+
+	// profile names the open vault when more than one can exist; it is
+	// empty when running with a fixed database path.
+	profile       string
+	profiles      []profileInfo
+	profileCursor int
+}
+
+type lockField struct {
+	label string
+	input *textinput.Model
 }
 
-func NewLockScreen(isNewVault bool) LockScreen {
+// NewLockScreen builds the lock screen. needsKeyfile adds a keyfile path
+// field for vaults that require a keyfile that has not been loaded yet.
+func NewLockScreen(isNewVault, needsKeyfile bool) LockScreen {
 	password := textinput.New()
 	password.Placeholder = "Master password"
 	password.EchoMode = textinput.EchoPassword
@@ -25,6 +65,12 @@ func NewLockScreen(isNewVault bool) LockScreen {
 	password.Focus()
 	password.Width = 40
 
+	newPassword := textinput.New()
+	newPassword.Placeholder = "New master password"
+	newPassword.EchoMode = textinput.EchoPassword
+	newPassword.EchoCharacter = '•'
+	newPassword.Width = 40
+
 	confirm := textinput.New()
 	confirm.Placeholder = "Confirm password"
 	confirm.EchoMode = textinput.EchoPassword
@@ -35,114 +81,313 @@ func NewLockScreen(isNewVault bool) LockScreen {
 	device.Placeholder = "Device name (e.g., laptop, phone)"
 	device.Width = 40
 
+	recovery := textinput.New()
+	recovery.Placeholder = "XXXX-XXXX-XXXX-XXXX-XXXX-XXXX-XXXX-XXXX"
+	recovery.Width = 44
+
+	keyfile := textinput.New()
+	keyfile.Placeholder = "Path to keyfile"
+	keyfile.Width = 40
+
+	newKeyfile := textinput.New()
+	newKeyfile.Placeholder = "Path to new keyfile (leave empty to remove)"
+	newKeyfile.Width = 40
+
+	profileName := textinput.New()
+	profileName.Placeholder = "Name for a new profile"
+	profileName.CharLimit = 32
+	profileName.Width = 40
+
+	mode := lockModeUnlock
+	if isNewVault {
+		mode = lockModeCreate
+	}
+
 	return LockScreen{
-		passwordInput: password,
-		confirmInput:  confirm,
-		deviceInput:   device,
-		isNewVault:    isNewVault,
+		passwordInput:    password,
+		newPasswordInput: newPassword,
+		confirmInput:     confirm,
+		deviceInput:      device,
+		recoveryInput:    recovery,
+		keyfileInput:     keyfile,
+		newKeyfileInput:  newKeyfile,
+		profileInput:     profileName,
+		mode:             mode,
+		isNew:            isNewVault,
+		needsKeyfile:     needsKeyfile,
 	}
 }
 
 func (l LockScreen) Init() tea.Cmd {
+	if l.ticking {
+		return tea.Batch(textinput.Blink, lockoutTick())
+	}
 	return textinput.Blink
 }
 
-func (l LockScreen) Update(msg tea.Msg) (LockScreen, tea.Cmd) {
-	var cmds []tea.Cmd
+type lockoutTickMsg struct{}
+
+func lockoutTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return lockoutTickMsg{}
+	})
+}
+
+func (l *LockScreen) fields() []lockField {
+	switch l.mode {
+	case lockModeCreate:
+		return []lockField{
+			{"Master Password:", &l.passwordInput},
+			{"Confirm Password:", &l.confirmInput},
+			{"Device Name:", &l.deviceInput},
+		}
+	case lockModeChangePassword:
+		fields := []lockField{{"Current Password:", &l.passwordInput}}
+		if l.needsKeyfile {
+			fields = append(fields, lockField{"Keyfile:", &l.keyfileInput})
+		}
+		return append(fields,
+			lockField{"New Password:", &l.newPasswordInput},
+			lockField{"Confirm New Password:", &l.confirmInput},
+		)
+	case lockModeRecovery:
+		return []lockField{
+			{"Recovery Key:", &l.recoveryInput},
+		}
+	case lockModeResetPassword:
+		return []lockField{
+			{"New Password:", &l.newPasswordInput},
+			{"Confirm New Password:", &l.confirmInput},
+		}
+	case lockModeKeyfile:
+		fields := []lockField{{"Current Password:", &l.passwordInput}}
+		if l.needsKeyfile {
+			fields = append(fields, lockField{"Current Keyfile:", &l.keyfileInput})
+		}
+		return append(fields, lockField{"New Keyfile:", &l.newKeyfileInput})
+	case lockModeProfiles:
+		return []lockField{
+			{"New Profile:", &l.profileInput},
+		}
+	default:
+		fields := []lockField{{"Master Password:", &l.passwordInput}}
+		if l.needsKeyfile {
+			fields = append(fields, lockField{"Keyfile:", &l.keyfileInput})
+		}
+		return fields
+	}
+}
 
+func (l LockScreen) Update(msg tea.Msg) (LockScreen, tea.Cmd) {
 	switch msg := msg.(type) {
+	case lockoutTickMsg:
+		if l.lockedOut() {
+			return l, lockoutTick()
+		}
+		l.ticking = false
+		return l, nil
+
 	case tea.KeyMsg:
 		l.err = ""
 
+		if msg.String() == "ctrl+o" && l.profile != "" && !l.loading && l.mode != lockModeProfiles {
+			return l, func() tea.Msg {
+				return LoadProfilesMsg{}
+			}
+		}
+		if l.mode == lockModeProfiles {
+			return l.updateProfiles(msg)
+		}
+
 		switch msg.String() {
 		case "tab", "shift+tab", "down", "up":
-			if l.isNewVault {
-				if msg.String() == "tab" || msg.String() == "down" {
-					l.focusIndex = (l.focusIndex + 1) % 3
-				} else {
-					l.focusIndex = (l.focusIndex + 2) % 3
-				}
-				l.updateFocus()
+			count := len(l.fields())
+			if msg.String() == "tab" || msg.String() == "down" {
+				l.focusIndex = (l.focusIndex + 1) % count
+			} else {
+				l.focusIndex = (l.focusIndex + count - 1) % count
 			}
+			l.updateFocus()
 			return l, nil
 
-		case "enter":
-			if l.loading {
+		case "ctrl+p":
+			return l.switchMode(lockModeChangePassword)
+
+		case "ctrl+r":
+			return l.switchMode(lockModeRecovery)
+
+		case "ctrl+f":
+			return l.switchMode(lockModeKeyfile)
+
+		case "esc":
+			if l.recoveryOnly {
 				return l, nil
 			}
+			if (l.mode == lockModeChangePassword || l.mode == lockModeRecovery || l.mode == lockModeKeyfile) && !l.loading {
+				l.mode = lockModeUnlock
+				l.Reset()
+			}
+			return l, nil
 
-			password := l.passwordInput.Value()
-
-			if l.isNewVault {
-				confirm := l.confirmInput.Value()
-				deviceName := strings.TrimSpace(l.deviceInput.Value())
-
-				if password == "" {
-					l.err = "Password is required"
-					return l, nil
-				}
-				if len(password) < 8 {
-					l.err = "Password must be at least 8 characters"
-					return l, nil
-				}
-				if password != confirm {
-					l.err = "Passwords do not match"
-					return l, nil
-				}
-				if deviceName == "" {
-					l.err = "Device name is required"
-					return l, nil
-				}
-
-				l.loading = true
-				return l, func() tea.Msg {
-					return InitRequestMsg{Password: password, DeviceName: deviceName}
-				}
-			} else {
-				if password == "" {
-					l.err = "Password is required"
-					return l, nil
-				}
-
-				l.loading = true
-				return l, func() tea.Msg {
-					return UnlockRequestMsg{Password: password}
-				}
+		case "enter":
+			if l.loading {
+				return l, nil
 			}
+			return l.submit()
 		}
 	}
 
+	fields := l.fields()
 	var cmd tea.Cmd
-	if l.isNewVault {
-		switch l.focusIndex {
-		case 0:
-			l.passwordInput, cmd = l.passwordInput.Update(msg)
-		case 1:
-			l.confirmInput, cmd = l.confirmInput.Update(msg)
-		case 2:
-			l.deviceInput, cmd = l.deviceInput.Update(msg)
-		}
+	*fields[l.focusIndex].input, cmd = fields[l.focusIndex].input.Update(msg)
+	return l, cmd
+}
+
+// switchMode toggles between the unlock screen and one of its alternate
+// flows. It is a no-op while creating a vault or resetting the password.
+func (l LockScreen) switchMode(mode lockMode) (LockScreen, tea.Cmd) {
+	if l.loading || l.recoveryOnly || l.mode == lockModeCreate || l.mode == lockModeResetPassword {
+		return l, nil
+	}
+	if l.mode == mode {
+		l.mode = lockModeUnlock
 	} else {
-		l.passwordInput, cmd = l.passwordInput.Update(msg)
+		l.mode = mode
+	}
+	l.Reset()
+	return l, textinput.Blink
+}
+
+func (l LockScreen) submit() (LockScreen, tea.Cmd) {
+	password := l.passwordInput.Value()
+	newPassword := l.newPasswordInput.Value()
+	confirm := l.confirmInput.Value()
+	keyfile := strings.TrimSpace(l.keyfileInput.Value())
+
+	if l.lockedOut() && l.usesPassword() {
+		return l, nil
+	}
+	if l.needsKeyfile && keyfile == "" && l.usesPassword() {
+		l.err = "Keyfile is required"
+		return l, nil
 	}
-	cmds = append(cmds, cmd)
 
-	return l, tea.Batch(cmds...)
+	switch l.mode {
+	case lockModeCreate:
+		deviceName := strings.TrimSpace(l.deviceInput.Value())
+
+		if password == "" {
+			l.err = "Password is required"
+			return l, nil
+		}
+		if len(password) < 8 {
+			l.err = "Password must be at least 8 characters"
+			return l, nil
+		}
+		if password != confirm {
+			l.err = "Passwords do not match"
+			return l, nil
+		}
+		if deviceName == "" {
+			l.err = "Device name is required"
+			return l, nil
+		}
+
+		l.loading = true
+		return l, func() tea.Msg {
+			return InitRequestMsg{Password: password, DeviceName: deviceName}
+		}
+
+	case lockModeChangePassword:
+		if password == "" {
+			l.err = "Current password is required"
+			return l, nil
+		}
+		if len(newPassword) < 8 {
+			l.err = "New password must be at least 8 characters"
+			return l, nil
+		}
+		if newPassword != confirm {
+			l.err = "Passwords do not match"
+			return l, nil
+		}
+		if newPassword == password {
+			l.err = "New password must differ from the current one"
+			return l, nil
+		}
+
+		l.loading = true
+		return l, func() tea.Msg {
+			return ChangePasswordRequestMsg{OldPassword: password, NewPassword: newPassword, Keyfile: keyfile}
+		}
+
+	case lockModeKeyfile:
+		if password == "" {
+			l.err = "Current password is required"
+			return l, nil
+		}
+		newKeyfile := strings.TrimSpace(l.newKeyfileInput.Value())
+
+		l.loading = true
+		return l, func() tea.Msg {
+			return KeyfileRequestMsg{Password: password, Keyfile: keyfile, NewKeyfile: newKeyfile}
+		}
+
+	case lockModeRecovery:
+		code := strings.TrimSpace(l.recoveryInput.Value())
+		if code == "" {
+			l.err = "Recovery key is required"
+			return l, nil
+		}
+
+		l.loading = true
+		return l, func() tea.Msg {
+			return RecoveryUnlockRequestMsg{RecoveryKey: code}
+		}
+
+	case lockModeResetPassword:
+		if len(newPassword) < 8 {
+			l.err = "Password must be at least 8 characters"
+			return l, nil
+		}
+		if newPassword != confirm {
+			l.err = "Passwords do not match"
+			return l, nil
+		}
+
+		l.loading = true
+		return l, func() tea.Msg {
+			return ResetPasswordRequestMsg{NewPassword: newPassword}
+		}
+
+	default:
+		if password == "" {
+			l.err = "Password is required"
+			return l, nil
+		}
+
+		l.loading = true
+		return l, func() tea.Msg {
+			return UnlockRequestMsg{Password: password, Keyfile: keyfile}
+		}
+	}
 }
 
 func (l *LockScreen) updateFocus() {
 	l.passwordInput.Blur()
+	l.newPasswordInput.Blur()
 	l.confirmInput.Blur()
 	l.deviceInput.Blur()
-
-	switch l.focusIndex {
-	case 0:
-		l.passwordInput.Focus()
-	case 1:
-		l.confirmInput.Focus()
-	case 2:
-		l.deviceInput.Focus()
+	l.recoveryInput.Blur()
+	l.keyfileInput.Blur()
+	l.newKeyfileInput.Blur()
+	l.profileInput.Blur()
+
+	fields := l.fields()
+	if l.focusIndex >= len(fields) {
+		l.focusIndex = 0
 	}
+	fields[l.focusIndex].input.Focus()
 }
 
 func (l LockScreen) View() string {
@@ -151,44 +396,77 @@ func (l LockScreen) View() string {
 	b.WriteString(logoStyle.Render(logo))
 	b.WriteString("\n")
 
-	if l.isNewVault {
-		b.WriteString(titleStyle.Render("Create New Vault"))
-		b.WriteString("\n")
-		b.WriteString(subtitleStyle.Render("Set up your master password to get started"))
-		b.WriteString("\n\n")
-
-		b.WriteString("Master Password:\n")
-		if l.focusIndex == 0 {
-			b.WriteString(focusedInputStyle.Render(l.passwordInput.View()))
-		} else {
-			b.WriteString(inputStyle.Render(l.passwordInput.View()))
+	var title, subtitle, loadingText, help string
+	switch l.mode {
+	case lockModeCreate:
+		title = "Create New Vault"
+		subtitle = "Set up your master password to get started"
+		loadingText = "Creating vault..."
+		help = "Press Enter to submit • Ctrl+C to quit"
+	case lockModeChangePassword:
+		title = "Change Master Password"
+		subtitle = "Your data stays as is; only the key protecting it changes"
+		loadingText = "Changing password..."
+		help = "Press Enter to submit • Esc to cancel • Ctrl+C to quit"
+	case lockModeRecovery:
+		title = "Unlock with Recovery Key"
+		subtitle = "Enter the code from your emergency kit"
+		loadingText = "Unlocking..."
+		help = "Press Enter to submit • Esc to cancel • Ctrl+C to quit"
+		if l.recoveryOnly {
+			subtitle = "Too many failed attempts. Your recovery key is needed to unlock"
+			help = "Press Enter to submit • Ctrl+C to quit"
 		}
-		b.WriteString("\n\n")
-
-		b.WriteString("Confirm Password:\n")
-		if l.focusIndex == 1 {
-			b.WriteString(focusedInputStyle.Render(l.confirmInput.View()))
-		} else {
-			b.WriteString(inputStyle.Render(l.confirmInput.View()))
+	case lockModeKeyfile:
+		title = "Keyfile"
+		subtitle = "Require a keyfile in addition to your password, or remove it"
+		loadingText = "Updating keyfile..."
+		help = "Press Enter to submit • Esc to cancel • Ctrl+C to quit"
+	case lockModeResetPassword:
+		title = "Set a New Master Password"
+		subtitle = "You unlocked with your recovery key. Choose a new password to continue"
+		loadingText = "Saving password..."
+		help = "Press Enter to submit • Ctrl+C to quit"
+	default:
+		title = "Unlock Vault"
+		subtitle = "Enter your master password"
+		loadingText = "Unlocking..."
+		help = "Press Enter to submit • Ctrl+P change password • Ctrl+F keyfile • Ctrl+R use recovery key • Ctrl+C to quit"
+	case lockModeProfiles:
+		title = "Profiles"
+		subtitle = "Each profile is a separate vault with its own password"
+		loadingText = "Opening profile..."
+		help = "↑/↓ select • Enter to open • Type a name to create one • Esc to go back • Ctrl+C to quit"
+	}
+	if l.profile != "" && l.mode != lockModeProfiles {
+		subtitle += "\nProfile: " + l.profile
+		if l.mode == lockModeUnlock || l.mode == lockModeCreate {
+			help = strings.Replace(help, " • Ctrl+C to quit", " • Ctrl+O profiles • Ctrl+C to quit", 1)
 		}
-		b.WriteString("\n\n")
+	}
 
-		b.WriteString("Device Name:\n")
-		if l.focusIndex == 2 {
-			b.WriteString(focusedInputStyle.Render(l.deviceInput.View()))
+	b.WriteString(titleStyle.Render(title))
+	b.WriteString("\n")
+	b.WriteString(subtitleStyle.Render(subtitle))
+	b.WriteString("\n\n")
+
+	if l.mode == lockModeProfiles {
+		b.WriteString(l.viewProfiles())
+	}
+
+	fields := l.fields()
+	for i, field := range fields {
+		b.WriteString(field.label)
+		b.WriteString("\n")
+		if i == l.focusIndex {
+			b.WriteString(focusedInputStyle.Render(field.input.View()))
 		} else {
-			b.WriteString(inputStyle.Render(l.deviceInput.View()))
+			b.WriteString(inputStyle.Render(field.input.View()))
 		}
 		b.WriteString("\n")
-	} else {
-		b.WriteString(titleStyle.Render("Unlock Vault"))
-		b.WriteString("\n")
-		b.WriteString(subtitleStyle.Render("Enter your master password"))
-		b.WriteString("\n\n")
-
-		b.WriteString("Master Password:\n")
-		b.WriteString(focusedInputStyle.Render(l.passwordInput.View()))
-		b.WriteString("\n")
+		if i < len(fields)-1 {
+			b.WriteString("\n")
+		}
 	}
 
 	if l.err != "" {
@@ -196,19 +474,51 @@ func (l LockScreen) View() string {
 		b.WriteString(errorStyle.Render("⚠ " + l.err))
 	}
 
+	if l.lockedOut() && l.usesPassword() {
+		wait := time.Until(l.lockedUntil).Round(time.Second)
+		if wait < time.Second {
+			wait = time.Second
+		}
+		b.WriteString("\n")
+		b.WriteString(mutedStyle.Render(fmt.Sprintf("Too many failed attempts. Try again in %s", wait)))
+	}
+
 	if l.loading {
 		b.WriteString("\n")
-		b.WriteString(mutedStyle.Render("Unlocking..."))
+		b.WriteString(mutedStyle.Render(loadingText))
 	}
 
 	b.WriteString("\n")
-	b.WriteString(helpStyle.Render("Press Enter to submit • Ctrl+C to quit"))
+	b.WriteString(helpStyle.Render(help))
 
 	return boxStyle.Render(b.String())
 }
 
 type UnlockRequestMsg struct {
 	Password string
+	Keyfile  string
+}
+
+type ChangePasswordRequestMsg struct {
+	OldPassword string
+	NewPassword string
+	Keyfile     string
+}
+
+// KeyfileRequestMsg binds the vault to NewKeyfile, or removes the keyfile
+// requirement when NewKeyfile is empty.
+type KeyfileRequestMsg struct {
+	Password   string
+	Keyfile    string
+	NewKeyfile string
+}
+
+type RecoveryUnlockRequestMsg struct {
+	RecoveryKey string
+}
+
+type ResetPasswordRequestMsg struct {
+	NewPassword string
 }
 
 type InitRequestMsg struct {
@@ -221,9 +531,48 @@ func (l *LockScreen) SetError(err string) {
 	l.loading = false
 }
 
+// SetLockout blocks password attempts until until and starts the countdown.
+func (l *LockScreen) SetLockout(until time.Time) tea.Cmd {
+	l.lockedUntil = until
+	l.loading = false
+	if l.ticking || !l.lockedOut() {
+		return nil
+	}
+	l.ticking = true
+	return lockoutTick()
+}
+
+// RequireRecovery switches to recovery mode and keeps the screen there.
+func (l *LockScreen) RequireRecovery() {
+	l.mode = lockModeRecovery
+	l.recoveryOnly = true
+	l.Reset()
+}
+
+func (l LockScreen) lockedOut() bool {
+	return time.Now().Before(l.lockedUntil)
+}
+
+// usesPassword reports whether the current mode checks the master password.
+func (l LockScreen) usesPassword() bool {
+	return l.mode == lockModeUnlock || l.mode == lockModeChangePassword || l.mode == lockModeKeyfile
+}
+
+// StartPasswordReset moves the screen into the forced password reset that
+// follows a recovery key unlock.
+func (l *LockScreen) StartPasswordReset() {
+	l.mode = lockModeResetPassword
+	l.Reset()
+}
+
 func (l *LockScreen) Reset() {
 	l.passwordInput.SetValue("")
+	l.newPasswordInput.SetValue("")
 	l.confirmInput.SetValue("")
+	l.recoveryInput.SetValue("")
+	l.keyfileInput.SetValue("")
+	l.newKeyfileInput.SetValue("")
+	l.profileInput.SetValue("")
 	l.err = ""
 	l.loading = false
 	l.focusIndex = 0
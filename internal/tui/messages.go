@@ -62,6 +62,11 @@ type SyncPushEntryMsg struct {
 	Op    string
 }
 
+type SyncPushFolderMsg struct {
+	Folder models.Folder
+	Op     string
+}
+
 type SyncPushCompleteMsg struct {
 	LastSync time.Time
 	Schemes  map[string]string
@@ -0,0 +1,332 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"forgor/internal/models"
+	"forgor/internal/profile"
+	"forgor/internal/secmem"
+	"forgor/internal/sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type profileInfo struct {
+	name     string
+	unlocked bool
+}
+
+// LoadProfilesMsg asks the app for the profile list shown on the lock screen.
+type LoadProfilesMsg struct{}
+
+// SwitchProfileMsg makes Name the active profile, creating it if needed.
+type SwitchProfileMsg struct {
+	Name string
+}
+
+// LoadTransferTargetsMsg asks for the unlocked profiles an entry can be
+// copied or moved to.
+type LoadTransferTargetsMsg struct{}
+
+type TransferEntryMsg struct {
+	Entry   models.Entry
+	Profile string
+	Move    bool
+}
+
+// ShowProfiles opens the profile picker with the current profile selected.
+func (l *LockScreen) ShowProfiles(profiles []profileInfo) {
+	l.profiles = profiles
+	l.profileCursor = 0
+	for i, p := range profiles {
+		if p.name == l.profile {
+			l.profileCursor = i
+		}
+	}
+	l.mode = lockModeProfiles
+	l.Reset()
+}
+
+func (l LockScreen) updateProfiles(msg tea.KeyMsg) (LockScreen, tea.Cmd) {
+	switch msg.String() {
+	case "up":
+		if l.profileCursor > 0 {
+			l.profileCursor--
+		}
+		return l, nil
+	case "down":
+		if l.profileCursor < len(l.profiles)-1 {
+			l.profileCursor++
+		}
+		return l, nil
+	case "esc":
+		if l.loading {
+			return l, nil
+		}
+		for _, p := range l.profiles {
+			if p.name == l.profile && p.unlocked {
+				return l, switchProfile(l.profile)
+			}
+		}
+		l.mode = lockModeUnlock
+		if l.isNew {
+			l.mode = lockModeCreate
+		} else if l.recoveryOnly {
+			l.mode = lockModeRecovery
+		}
+		l.Reset()
+		return l, nil
+	case "enter":
+		if l.loading {
+			return l, nil
+		}
+		name := strings.TrimSpace(l.profileInput.Value())
+		if name == "" && len(l.profiles) > 0 {
+			name = l.profiles[l.profileCursor].name
+		}
+		if !profile.ValidName(name) {
+			l.err = "Names may use letters, digits, '-' and '_'"
+			return l, nil
+		}
+		l.loading = true
+		return l, switchProfile(name)
+	}
+
+	var cmd tea.Cmd
+	l.profileInput, cmd = l.profileInput.Update(msg)
+	return l, cmd
+}
+
+func switchProfile(name string) tea.Cmd {
+	return func() tea.Msg {
+		return SwitchProfileMsg{Name: name}
+	}
+}
+
+func (l LockScreen) viewProfiles() string {
+	var b strings.Builder
+	for i, p := range l.profiles {
+		cursor := "  "
+		style := normalStyle
+		if i == l.profileCursor {
+			cursor = "▸ "
+			style = selectedStyle
+		}
+		b.WriteString(cursor)
+		b.WriteString(style.Render(p.name))
+		var notes []string
+		if p.name == l.profile {
+			notes = append(notes, "current")
+		}
+		if p.unlocked {
+			notes = append(notes, "unlocked")
+		}
+		if len(notes) > 0 {
+			b.WriteString(mutedStyle.Render(" (" + strings.Join(notes, ", ") + ")"))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// ShowTransfer lists the profiles the selected entry can go to.
+func (v *VaultScreen) ShowTransfer(profiles []string) {
+	v.transferTargets = profiles
+	v.transferCursor = 0
+	v.mode = modeTransfer
+}
+
+func (v VaultScreen) updateTransfer(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
+	if len(v.filtered) == 0 || len(v.transferTargets) == 0 {
+		v.mode = modeList
+		return v, nil
+	}
+
+	switch msg.String() {
+	case "up", "k":
+		if v.transferCursor > 0 {
+			v.transferCursor--
+		}
+	case "down", "j":
+		if v.transferCursor < len(v.transferTargets)-1 {
+			v.transferCursor++
+		}
+	case "c", "m":
+		entry := v.filtered[v.cursor]
+		target := v.transferTargets[v.transferCursor]
+		move := msg.String() == "m"
+		v.mode = modeView
+		return v, func() tea.Msg {
+			return TransferEntryMsg{Entry: entry, Profile: target, Move: move}
+		}
+	case "esc", "q":
+		v.mode = modeView
+	}
+	return v, nil
+}
+
+func (v VaultScreen) viewTransfer() string {
+	if len(v.filtered) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(v.filtered[v.cursor].Title() + " - Copy or Move"))
+	b.WriteString("\n\n")
+
+	for i, name := range v.transferTargets {
+		cursor := "  "
+		style := normalStyle
+		if i == v.transferCursor {
+			cursor = "▸ "
+			style = selectedStyle
+		}
+		b.WriteString(cursor)
+		b.WriteString(style.Render(name))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(mutedStyle.Render("Only unlocked profiles are listed."))
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render("↑/↓ navigate • c copy • m move • esc back"))
+
+	return boxStyle.Render(b.String())
+}
+
+func (a *App) newLockScreen() LockScreen {
+	l := NewLockScreen(a.isNewVault, a.store.KeyfileRequired() && !a.store.HasKeyfile())
+	if a.profiles.CanSwitch() {
+		l.profile, _ = a.profiles.Active()
+	}
+	return l
+}
+
+func (a *App) showProfiles() {
+	names, err := a.profiles.List()
+	if err != nil {
+		a.lockScreen.SetError(err.Error())
+		return
+	}
+	profiles := make([]profileInfo, 0, len(names))
+	for _, name := range names {
+		profiles = append(profiles, profileInfo{name: name, unlocked: a.profiles.IsUnlocked(name)})
+	}
+	a.lockScreen.ShowProfiles(profiles)
+}
+
+// openProfile makes name the active profile and starts over with its vault,
+// or with its lock screen when it is not unlocked yet. Other profiles stay
+// unlocked so entries can be moved between them.
+func (a *App) openProfile(name string) tea.Cmd {
+	store, err := a.profiles.Switch(name)
+	if err != nil {
+		a.lockScreen.SetError(fmt.Sprintf("Failed to open profile: %v", err))
+		return nil
+	}
+
+	if a.device != nil {
+		a.device.Destroy()
+	}
+	a.store = store
+	a.isNewVault = !store.IsInitialized()
+	a.activeTab = TabVault
+	a.device = nil
+	a.recoveryEntries = nil
+	a.syncState = nil
+	a.syncEngine = nil
+	a.peerAddresses = make(map[string]string)
+	a.nearbyScreen = NewNearbyScreen()
+	a.friendsScreen = NewFriendsScreen()
+	a.syncScreen = NewSyncScreen()
+	a.incomingScreen = NewIncomingShareScreen()
+	a.recoveryScreen = NewRecoveryKitScreen()
+
+	if store.IsUnlocked() {
+		if entries, err := store.Entries(); err == nil {
+			_, cmd := a.handleUnlock(entries)
+			return cmd
+		}
+	}
+
+	a.isLocked = true
+	a.lockScreen = a.newLockScreen()
+	cmd := a.lockScreen.Init()
+	if !a.isNewVault {
+		return tea.Batch(cmd, a.applyUnlockThrottle())
+	}
+	return cmd
+}
+
+// transferEntry copies an entry into another unlocked profile under a new
+// ID, queueing it for that profile's sync, and removes it here for a move.
+func (a *App) transferEntry(msg TransferEntryMsg) tea.Cmd {
+	status := func(text string, isError bool) tea.Cmd {
+		return func() tea.Msg {
+			return StatusMsg{Message: text, IsError: isError}
+		}
+	}
+
+	target, err := a.profiles.Open(msg.Profile)
+	if err != nil {
+		return status("Failed to open profile: "+err.Error(), true)
+	}
+	if target == a.store || !target.IsUnlocked() {
+		return status("Profile "+msg.Profile+" is not unlocked", true)
+	}
+	entries, err := target.Entries()
+	if err != nil {
+		return status("Failed to read "+msg.Profile+": "+err.Error(), true)
+	}
+	copied := msg.Entry.Duplicate()
+	for _, att := range copied.Attachments {
+		if !a.store.HasAttachment(att.ID) {
+			continue
+		}
+		content, err := a.store.Attachment(att.ID)
+		if err == nil {
+			err = target.PutAttachment(att.ID, content)
+			secmem.Wipe(content)
+		}
+		if err != nil {
+			return status("Failed to copy "+att.Name+": "+err.Error(), true)
+		}
+	}
+	if err := target.SaveEntries(append(entries, copied)); err != nil {
+		return status("Failed to save to "+msg.Profile+": "+err.Error(), true)
+	}
+	if syncState, err := sync.NewSyncState(target); err == nil && syncState.IsConfigured() {
+		_ = syncState.AddPendingEntry("upsert", copied)
+	}
+
+	if !msg.Move {
+		return status("Copied to "+msg.Profile, false)
+	}
+
+	current := a.vaultScreen.GetEntries()
+	remaining := make([]models.Entry, 0, len(current))
+	for _, e := range current {
+		if e.ID != msg.Entry.ID {
+			remaining = append(remaining, e)
+		}
+	}
+	if err := a.store.SaveEntries(remaining); err != nil {
+		return status("Copied to "+msg.Profile+" but failed to remove here: "+err.Error(), true)
+	}
+	a.vaultScreen.SetEntries(remaining)
+	a.vaultScreen.mode = modeList
+	return tea.Batch(
+		func() tea.Msg {
+			return SyncPushEntryMsg{Entry: msg.Entry, Op: "delete"}
+		},
+		status("Moved to "+msg.Profile, false),
+	)
+}
+
+// transferTargets lists the unlocked profiles other than the active one.
+func (a *App) transferTargets() []string {
+	name, _ := a.profiles.Active()
+	return a.profiles.Unlocked(name)
+}
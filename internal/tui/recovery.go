@@ -0,0 +1,155 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// RegenerateRecoveryKeyMsg asks the app to replace the recovery key. It is
+// only sent after the user confirms, since the old kit stops working.
+type RegenerateRecoveryKeyMsg struct{}
+
+type RecoveryKitScreen struct {
+	code       string
+	deviceName string
+	createdAt  time.Time
+	hasKey     bool
+	confirm    bool
+	visible    bool
+}
+
+func NewRecoveryKitScreen() RecoveryKitScreen {
+	return RecoveryKitScreen{}
+}
+
+func (s RecoveryKitScreen) Init() tea.Cmd {
+	return nil
+}
+
+// Show opens the emergency kit for a freshly generated code.
+func (s *RecoveryKitScreen) Show(code, deviceName string) {
+	s.code = code
+	s.deviceName = deviceName
+	s.createdAt = time.Now()
+	s.hasKey = true
+	s.confirm = false
+	s.visible = true
+}
+
+// ShowStatus opens the recovery key screen without a code. The stored key
+// cannot be shown again, so this only offers to generate a new one.
+func (s *RecoveryKitScreen) ShowStatus(hasKey bool, deviceName string) {
+	s.code = ""
+	s.deviceName = deviceName
+	s.hasKey = hasKey
+	s.confirm = false
+	s.visible = true
+}
+
+func (s RecoveryKitScreen) Update(msg tea.Msg) (RecoveryKitScreen, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok || !s.visible {
+		return s, nil
+	}
+
+	if s.confirm {
+		s.confirm = false
+		if keyMsg.String() != "y" {
+			return s, nil
+		}
+		return s, func() tea.Msg {
+			return RegenerateRecoveryKeyMsg{}
+		}
+	}
+
+	if s.code == "" {
+		switch keyMsg.String() {
+		case "g":
+			if s.hasKey {
+				s.confirm = true
+				return s, nil
+			}
+			return s, func() tea.Msg {
+				return RegenerateRecoveryKeyMsg{}
+			}
+		case "enter", "esc":
+			s.visible = false
+		}
+		return s, nil
+	}
+
+	switch keyMsg.String() {
+	case "c":
+		code := s.code
+		return s, func() tea.Msg {
+			return CopyToClipboardMsg{Text: code, Label: "Recovery key"}
+		}
+	case "enter", "esc":
+		s.visible = false
+		s.code = ""
+	}
+
+	return s, nil
+}
+
+func (s RecoveryKitScreen) View() string {
+	if !s.visible {
+		return ""
+	}
+	if s.code == "" {
+		return s.viewStatus()
+	}
+
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("Emergency Kit"))
+	b.WriteString("\n")
+	b.WriteString(subtitleStyle.Render("Print this or write it down and keep it somewhere safe"))
+	b.WriteString("\n\n")
+	b.WriteString(fmt.Sprintf("Device:  %s\n", s.deviceName))
+	b.WriteString(fmt.Sprintf("Created: %s\n\n", s.createdAt.Format("2006-01-02 15:04")))
+	b.WriteString("Recovery Key:\n")
+	b.WriteString(focusedInputStyle.Render(s.code))
+	b.WriteString("\n\n")
+	b.WriteString("If you forget your master password, choose \"use recovery key\"\n")
+	b.WriteString("on the unlock screen and enter this code to set a new one.\n\n")
+	b.WriteString(errorStyle.Render("This key will not be shown again. Anyone with it can open your vault."))
+	b.WriteString("\n")
+	b.WriteString(mutedStyle.Render("Any kit printed before this one no longer works."))
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render("c copy • enter done"))
+
+	return boxStyle.Render(b.String())
+}
+
+func (s RecoveryKitScreen) viewStatus() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("Recovery Key"))
+	b.WriteString("\n\n")
+	if s.hasKey {
+		b.WriteString("This vault has a recovery key. It is only shown once, when it is\n")
+		b.WriteString("created, so use the emergency kit you printed then.\n\n")
+	} else {
+		b.WriteString(errorStyle.Render("This vault has no recovery key."))
+		b.WriteString("\n")
+		b.WriteString("Without one, a forgotten master password cannot be reset.\n\n")
+	}
+
+	if s.confirm {
+		b.WriteString(errorStyle.Render("Generate a new recovery key? The kit you already have will stop working."))
+		b.WriteString("\n\n")
+		b.WriteString(helpStyle.Render("y confirm • any key cancel"))
+	} else {
+		b.WriteString(helpStyle.Render("g generate new key • esc back"))
+	}
+
+	return boxStyle.Render(b.String())
+}
+
+func (s RecoveryKitScreen) IsVisible() bool {
+	return s.visible
+}
@@ -0,0 +1,100 @@
+package tui
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"forgor/internal/models"
+	"forgor/internal/totp"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const totpBarWidth = 20
+
+var lastTOTPTickID int64
+
+// totpTickMsg redraws the code and countdown. ID ties it to the tick loop
+// started by the last startTOTP, so loops from earlier views die out.
+type totpTickMsg struct {
+	ID int64
+}
+
+func totpTick(id int64) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return totpTickMsg{ID: id}
+	})
+}
+
+// startTOTP starts a redraw loop when the selected entry has a TOTP secret.
+func (v *VaultScreen) startTOTP() tea.Cmd {
+	entry := v.GetSelectedEntry()
+	if entry == nil || entry.TOTP == "" {
+		return nil
+	}
+	v.totpTickID = atomic.AddInt64(&lastTOTPTickID, 1)
+	return totpTick(v.totpTickID)
+}
+
+func (v VaultScreen) updateTOTPTick(msg totpTickMsg) (VaultScreen, tea.Cmd) {
+	if msg.ID != v.totpTickID || v.mode == modeList {
+		return v, nil
+	}
+	entry := v.GetSelectedEntry()
+	if entry == nil || entry.TOTP == "" {
+		return v, nil
+	}
+	return v, totpTick(msg.ID)
+}
+
+func (v VaultScreen) copyTOTP(entry models.Entry) tea.Cmd {
+	key, err := totp.Parse(entry.TOTP)
+	if err != nil {
+		return func() tea.Msg {
+			return StatusMsg{Message: "Invalid TOTP: " + err.Error(), IsError: true}
+		}
+	}
+	code := key.Code(time.Now())
+	return func() tea.Msg {
+		return CopyToClipboardMsg{Text: code, Label: "TOTP code"}
+	}
+}
+
+func (v VaultScreen) viewTOTP(entry models.Entry, labelStyle lipgloss.Style) string {
+	var b strings.Builder
+	b.WriteString(labelStyle.Render("TOTP:"))
+
+	key, err := totp.Parse(entry.TOTP)
+	if err != nil {
+		b.WriteString(errorStyle.Render("invalid: " + err.Error()))
+		b.WriteString("\n")
+		return b.String()
+	}
+
+	now := time.Now()
+	b.WriteString(lipgloss.NewStyle().Bold(true).Foreground(primaryColor).Render(formatTOTPCode(key.Code(now))))
+
+	remaining := key.Remaining(now)
+	period := time.Duration(key.Period) * time.Second
+	filled := int(int64(totpBarWidth) * int64(remaining) / int64(period))
+	barStyle := successStyle
+	if remaining <= 5*time.Second {
+		barStyle = errorStyle
+	}
+	b.WriteString("  ")
+	b.WriteString(barStyle.Render(strings.Repeat("█", filled)))
+	b.WriteString(mutedStyle.Render(strings.Repeat("░", totpBarWidth-filled)))
+	b.WriteString(mutedStyle.Render(" " + remaining.Round(time.Second).String()))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// formatTOTPCode splits numeric codes in half for readability.
+func formatTOTPCode(code string) string {
+	if len(code)%2 != 0 {
+		return code
+	}
+	return code[:len(code)/2] + " " + code[len(code)/2:]
+}
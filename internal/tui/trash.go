@@ -0,0 +1,263 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"forgor/internal/models"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// SaveTrashMsg asks the app to store the vault entries and the trash
+// together, after entries moved between them.
+type SaveTrashMsg struct {
+	Entries []models.Entry
+	Trash   []models.Entry
+}
+
+// PurgeTrashMsg asks the app to delete entries from the trash for good.
+type PurgeTrashMsg struct {
+	Entries []models.Entry
+}
+
+// SetTrash shows the trashed entries, most recently deleted first.
+func (v *VaultScreen) SetTrash(trash []models.Entry, retention time.Duration) {
+	sorted := append([]models.Entry(nil), trash...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return deletedAt(sorted[i]).After(deletedAt(sorted[j]))
+	})
+	v.trash = sorted
+	v.trashRetention = retention
+	if v.trashCursor >= len(v.trash) {
+		v.trashCursor = max(len(v.trash)-1, 0)
+	}
+}
+
+func (v VaultScreen) GetTrash() []models.Entry {
+	return v.trash
+}
+
+func deletedAt(e models.Entry) time.Time {
+	if e.DeletedAt == nil {
+		return time.Time{}
+	}
+	return *e.DeletedAt
+}
+
+// trashEntry moves an entry from the vault to the trash.
+func (v VaultScreen) trashEntry(entry models.Entry) (VaultScreen, tea.Cmd) {
+	entries := make([]models.Entry, 0, len(v.entries))
+	for _, e := range v.entries {
+		if e.ID != entry.ID {
+			entries = append(entries, e)
+		}
+	}
+	trashed := entry.Trashed(time.Now())
+	v.entries = entries
+	v.SetTrash(append(append([]models.Entry(nil), v.trash...), trashed), v.trashRetention)
+	v.filterEntries()
+
+	trash := v.trash
+	return v, tea.Sequence(
+		func() tea.Msg {
+			return SaveTrashMsg{Entries: entries, Trash: trash}
+		},
+		func() tea.Msg {
+			return SyncPushEntryMsg{Entry: trashed, Op: "trash"}
+		},
+		func() tea.Msg {
+			return StatusMsg{Message: "Moved " + entry.Title() + " to the trash (t to view)", IsError: false}
+		},
+	)
+}
+
+// restoreEntry moves a trashed entry back into the vault.
+func (v VaultScreen) restoreEntry(entry models.Entry) (VaultScreen, tea.Cmd) {
+	restored := entry.Restored()
+	entries := make([]models.Entry, 0, len(v.entries)+1)
+	for _, e := range v.entries {
+		if e.ID != entry.ID {
+			entries = append(entries, e)
+		}
+	}
+	entries = append(entries, restored)
+	v.entries = entries
+	v.SetTrash(v.withoutTrashed(entry.ID), v.trashRetention)
+	v.filterEntries()
+
+	trash := v.trash
+	return v, tea.Sequence(
+		func() tea.Msg {
+			return SaveTrashMsg{Entries: entries, Trash: trash}
+		},
+		func() tea.Msg {
+			return SyncPushEntryMsg{Entry: restored, Op: "restore"}
+		},
+		func() tea.Msg {
+			return StatusMsg{Message: "Restored " + entry.Title(), IsError: false}
+		},
+	)
+}
+
+// purgeEntries deletes trashed entries for good, on every synced device.
+// Purging by hand and expiry both go through here.
+func (v VaultScreen) purgeEntries(purged []models.Entry, text string) (VaultScreen, tea.Cmd) {
+	gone := make(map[string]bool, len(purged))
+	for _, e := range purged {
+		gone[e.ID] = true
+	}
+	trash := make([]models.Entry, 0, len(v.trash))
+	for _, e := range v.trash {
+		if !gone[e.ID] {
+			trash = append(trash, e)
+		}
+	}
+	v.SetTrash(trash, v.trashRetention)
+
+	cmds := []tea.Cmd{func() tea.Msg {
+		return PurgeTrashMsg{Entries: purged}
+	}}
+	for _, e := range purged {
+		entry := e
+		cmds = append(cmds, func() tea.Msg {
+			return SyncPushEntryMsg{Entry: entry, Op: "delete"}
+		})
+	}
+	cmds = append(cmds, func() tea.Msg {
+		return StatusMsg{Message: text, IsError: false}
+	})
+	return v, tea.Sequence(cmds...)
+}
+
+func purgedText(purged []models.Entry) string {
+	if len(purged) == 1 {
+		return "Deleted " + purged[0].Title() + " for good"
+	}
+	return fmt.Sprintf("Deleted %d entries for good", len(purged))
+}
+
+// expireTrash purges the entries kept in the trash past the retention
+// period.
+func (v VaultScreen) expireTrash(now time.Time) (VaultScreen, tea.Cmd) {
+	_, expired := models.PurgeTrash(v.trash, v.trashRetention, now)
+	if len(expired) == 0 {
+		return v, nil
+	}
+	text := fmt.Sprintf("Deleted %d entries from the trash after %d days", len(expired), int(v.trashRetention.Hours()/24))
+	return v.purgeEntries(expired, text)
+}
+
+func (v VaultScreen) withoutTrashed(id string) []models.Entry {
+	trash := make([]models.Entry, 0, len(v.trash))
+	for _, e := range v.trash {
+		if e.ID != id {
+			trash = append(trash, e)
+		}
+	}
+	return trash
+}
+
+func (v VaultScreen) updateTrash(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
+	if v.trashConfirm != "" {
+		confirm := v.trashConfirm
+		v.trashConfirm = ""
+		if msg.String() != "y" {
+			return v, nil
+		}
+		if confirm == "empty" {
+			return v.purgeEntries(v.trash, purgedText(v.trash))
+		}
+		if v.trashCursor < len(v.trash) {
+			purged := []models.Entry{v.trash[v.trashCursor]}
+			return v.purgeEntries(purged, purgedText(purged))
+		}
+		return v, nil
+	}
+
+	switch msg.String() {
+	case "up", "k":
+		if v.trashCursor > 0 {
+			v.trashCursor--
+		}
+	case "down", "j":
+		if v.trashCursor < len(v.trash)-1 {
+			v.trashCursor++
+		}
+	case "enter", "r":
+		if v.trashCursor < len(v.trash) {
+			return v.restoreEntry(v.trash[v.trashCursor])
+		}
+	case "d":
+		if v.trashCursor < len(v.trash) {
+			v.trashConfirm = "one"
+		}
+	case "E":
+		if len(v.trash) > 0 {
+			v.trashConfirm = "empty"
+		}
+	case "esc", "q":
+		v.mode = modeList
+	}
+	return v, nil
+}
+
+func (v VaultScreen) viewTrash() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("Trash"))
+	b.WriteString("\n\n")
+
+	if len(v.trash) == 0 {
+		b.WriteString(mutedStyle.Render("The trash is empty."))
+		b.WriteString("\n")
+	}
+
+	now := time.Now()
+	whenStyle := lipgloss.NewStyle().Width(26).Foreground(mutedColor)
+	for i, entry := range v.trash {
+		cursor := "  "
+		style := normalStyle
+		if i == v.trashCursor {
+			cursor = "▸ "
+			style = selectedStyle
+		}
+		b.WriteString(cursor)
+		b.WriteString(whenStyle.Render("deleted " + deletedAt(entry).Format("2006-01-02 15:04")))
+		b.WriteString(style.Render(entry.Title()))
+		if at := entry.PurgeAt(v.trashRetention); !at.IsZero() {
+			days := int(at.Sub(now).Hours()/24) + 1
+			b.WriteString(mutedStyle.Render(fmt.Sprintf("  purged in %d days", max(days, 0))))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	switch v.trashConfirm {
+	case "one":
+		b.WriteString(errorStyle.Render(fmt.Sprintf("Delete %s for good? This cannot be undone.", v.trash[v.trashCursor].Title())))
+		b.WriteString("\n\n")
+		b.WriteString(helpStyle.Render("y confirm • any key cancel"))
+	case "empty":
+		b.WriteString(errorStyle.Render(fmt.Sprintf("Delete all %d entries in the trash for good? This cannot be undone.", len(v.trash))))
+		b.WriteString("\n\n")
+		b.WriteString(helpStyle.Render("y confirm • any key cancel"))
+	default:
+		if v.trashRetention > 0 {
+			b.WriteString(mutedStyle.Render(fmt.Sprintf("Entries are deleted for good %d days after they are trashed.", int(v.trashRetention.Hours()/24))))
+		} else {
+			b.WriteString(mutedStyle.Render("Entries stay here until you delete them."))
+		}
+		b.WriteString("\n\n")
+		help := []string{"esc back"}
+		if len(v.trash) > 0 {
+			help = append([]string{"↑/↓ navigate", "enter restore", "d delete for good", "E empty trash"}, help...)
+		}
+		b.WriteString(helpStyle.Render(strings.Join(help, " • ")))
+	}
+
+	return boxStyle.Render(b.String())
+}
@@ -0,0 +1,93 @@
+package tui
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"forgor/internal/models"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// runCmd runs cmd and returns its messages, running the commands of a
+// tea.Sequence in order.
+func runCmd(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	msg := cmd()
+	v := reflect.ValueOf(msg)
+	if v.Kind() == reflect.Slice && v.Type().Elem() == reflect.TypeOf(cmd) {
+		var msgs []tea.Msg
+		for i := 0; i < v.Len(); i++ {
+			msgs = append(msgs, runCmd(v.Index(i).Interface().(tea.Cmd))...)
+		}
+		return msgs
+	}
+	return []tea.Msg{msg}
+}
+
+func TestExpireTrashSyncsAsDelete(t *testing.T) {
+	now := time.Now()
+	expired := models.Entry{ID: "expired", Website: "a.example"}.Trashed(now.Add(-31 * 24 * time.Hour))
+	recent := models.Entry{ID: "recent", Website: "b.example"}.Trashed(now.Add(-time.Hour))
+	v := NewVaultScreen(nil)
+	v.SetTrash([]models.Entry{expired, recent}, models.DefaultTrashRetention)
+
+	v, cmd := v.expireTrash(now)
+	if trash := v.GetTrash(); len(trash) != 1 || trash[0].ID != recent.ID {
+		t.Errorf("trash = %v, want recent", trash)
+	}
+
+	var purged []string
+	pushed := make(map[string]string)
+	for _, msg := range runCmd(cmd) {
+		switch msg := msg.(type) {
+		case PurgeTrashMsg:
+			for _, e := range msg.Entries {
+				purged = append(purged, e.ID)
+			}
+		case SyncPushEntryMsg:
+			pushed[msg.Entry.ID] = msg.Op
+		}
+	}
+	if len(purged) != 1 || purged[0] != expired.ID {
+		t.Errorf("purged = %v, want expired", purged)
+	}
+	// Other devices must drop the entry for good, not keep it trashed.
+	if len(pushed) != 1 || pushed[expired.ID] != "delete" {
+		t.Errorf("pushed = %v, want a delete of expired", pushed)
+	}
+
+	// Nothing is due now, and a retention of 0 keeps the trash forever.
+	if _, cmd := v.expireTrash(now); cmd != nil {
+		t.Error("expireTrash with nothing due returned a command")
+	}
+	v.SetTrash(v.GetTrash(), 0)
+	if _, cmd := v.expireTrash(now.Add(365 * 24 * time.Hour)); cmd != nil {
+		t.Error("expireTrash purged with a retention of 0")
+	}
+}
+
+func TestTrashEntrySyncsAsTrash(t *testing.T) {
+	entry := models.Entry{ID: "a", Website: "a.example"}
+	v := NewVaultScreen([]models.Entry{entry})
+
+	v, cmd := v.trashEntry(entry)
+	if len(v.GetEntries()) != 0 || len(v.GetTrash()) != 1 {
+		t.Fatalf("entries %d, trash %d after trashing", len(v.GetEntries()), len(v.GetTrash()))
+	}
+	var saved, pushed bool
+	for _, msg := range runCmd(cmd) {
+		switch msg := msg.(type) {
+		case SaveTrashMsg:
+			saved = len(msg.Entries) == 0 && len(msg.Trash) == 1 && msg.Trash[0].DeletedAt != nil
+		case SyncPushEntryMsg:
+			pushed = msg.Op == "trash" && msg.Entry.ID == entry.ID
+		}
+	}
+	if !saved || !pushed {
+		t.Errorf("saved = %v, pushed as trash = %v", saved, pushed)
+	}
+}
@@ -0,0 +1,100 @@
+package tui
+
+import (
+	"time"
+
+	"forgor/internal/models"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// EntryUsedMsg records that an entry was viewed or had a field copied.
+type EntryUsedMsg struct {
+	EntryID string
+}
+
+// SortModeMsg asks the app to remember the vault list order.
+type SortModeMsg struct {
+	Mode models.SortMode
+}
+
+// SetSortMode sets the saved list order and selects the first row.
+func (v *VaultScreen) SetSortMode(mode models.SortMode) {
+	v.sortMode = mode
+	v.rows, v.rowCursor = nil, 0
+	v.filterEntries()
+}
+
+func (v *VaultScreen) SetUsage(usage map[string]models.Usage) {
+	v.usage = usage
+	v.filterEntries()
+}
+
+func entryUsed(entry models.Entry) tea.Cmd {
+	return func() tea.Msg {
+		return EntryUsedMsg{EntryID: entry.ID}
+	}
+}
+
+func (v VaultScreen) cycleSortMode() (VaultScreen, tea.Cmd) {
+	v.sortMode = v.sortMode.Next()
+	v.filterEntries()
+	mode := v.sortMode
+	return v, func() tea.Msg {
+		return SortModeMsg{Mode: mode}
+	}
+}
+
+// toggleFavorite pins or unpins an entry. The flag syncs like any other
+// change, but does not count as modifying the entry.
+func (v VaultScreen) toggleFavorite(entryID string) (VaultScreen, tea.Cmd) {
+	var updated models.Entry
+	for i, e := range v.entries {
+		if e.ID == entryID {
+			v.entries[i].Favorite = !e.Favorite
+			updated = v.entries[i]
+			break
+		}
+	}
+	if updated.ID == "" {
+		return v, nil
+	}
+	v.filterEntries()
+
+	text := "Removed " + updated.Title() + " from favorites"
+	if updated.Favorite {
+		text = "Added " + updated.Title() + " to favorites"
+	}
+	return v, tea.Batch(
+		func() tea.Msg {
+			return SaveEntriesMsg{Entries: v.entries}
+		},
+		func() tea.Msg {
+			return SyncPushEntryMsg{Entry: updated, Op: "upsert"}
+		},
+		func() tea.Msg {
+			return StatusMsg{Message: text, IsError: false}
+		},
+	)
+}
+
+func (a *App) recordUse(entryID string) tea.Cmd {
+	if err := a.store.RecordUse(entryID, time.Now()); err != nil {
+		return func() tea.Msg {
+			return StatusMsg{Message: "Failed to record use: " + err.Error(), IsError: true}
+		}
+	}
+	a.loadUsage()
+	return nil
+}
+
+// loadUsage gives the vault list the stored usage counts.
+func (a *App) loadUsage() {
+	usage, err := a.store.Usage()
+	if err != nil {
+		a.statusMsg = "Failed to load usage: " + err.Error()
+		a.statusIsError = true
+		return
+	}
+	a.vaultScreen.SetUsage(usage)
+}
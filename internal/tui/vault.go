@@ -20,6 +20,14 @@ const (
 	modeEdit
 	modeAdd
 	modeDelete
+	modeHistory
+	modeHistoryDiff
+	modeCredentialHistory
+	modeTransfer
+	modeChooseType
+	modeAttachments
+	modeMoveFolder
+	modeTrash
 )
 
 type VaultScreen struct {
@@ -29,7 +37,8 @@ type VaultScreen struct {
 	searchInput   textinput.Model
 	mode          vaultMode
 	editEntry     models.Entry
-	editFields    []textinput.Model
+	editSpecs     []models.FieldSpec
+	editFields    []formInput
 	editFocus     int
 	showPassword  bool
 	statusMsg     string
@@ -38,6 +47,46 @@ type VaultScreen struct {
 	height        int
 	schemeCutover *time.Time
 	schemeByID    map[string]string
+	snapshots     []models.VaultSnapshot
+	historyCursor int
+	credCursor    int
+	fieldCursor   int
+	totpTickID    int64
+	typeCursor    int
+
+	attachCursor  int
+	attachInput   textinput.Model
+	attachAction  string
+	attachConfirm bool
+	hasAttachment func(id string) bool
+
+	transferTargets []string
+	transferCursor  int
+
+	folders       []models.Folder
+	tree          models.Folders
+	expanded      map[string]bool
+	rows          []listRow
+	rowCursor     int
+	searchScope   string
+	folderInput   textinput.Model
+	folderAction  string
+	folderTarget  string
+	folderLabel   string
+	folderConfirm bool
+	moveChoices   []string
+	moveCursor    int
+	moveEntryID   string
+	moveFolderID  string
+	moveReturn    vaultMode
+
+	sortMode models.SortMode
+	usage    map[string]models.Usage
+
+	trash          []models.Entry
+	trashRetention time.Duration
+	trashCursor    int
+	trashConfirm   string
 }
 
 func NewVaultScreen(entries []models.Entry) VaultScreen {
@@ -57,6 +106,9 @@ func NewVaultScreen(entries []models.Entry) VaultScreen {
 func (v *VaultScreen) SetEntries(entries []models.Entry) {
 	v.entries = entries
 	v.filterEntries()
+	if v.cursor >= len(v.filtered) {
+		v.cursor = max(len(v.filtered)-1, 0)
+	}
 }
 
 func (v *VaultScreen) SetSchemeCutover(cutover time.Time) {
@@ -89,6 +141,9 @@ func (v VaultScreen) Update(msg tea.Msg) (VaultScreen, tea.Cmd) {
 	case ClearStatusMsg:
 		v.statusMsg = ""
 
+	case totpTickMsg:
+		return v.updateTOTPTick(msg)
+
 	case tea.KeyMsg:
 		switch v.mode {
 		case modeList:
@@ -99,6 +154,22 @@ func (v VaultScreen) Update(msg tea.Msg) (VaultScreen, tea.Cmd) {
 			return v.updateEdit(msg)
 		case modeDelete:
 			return v.updateDelete(msg)
+		case modeHistory:
+			return v.updateHistory(msg)
+		case modeHistoryDiff:
+			return v.updateHistoryDiff(msg)
+		case modeCredentialHistory:
+			return v.updateCredentialHistory(msg)
+		case modeTransfer:
+			return v.updateTransfer(msg)
+		case modeChooseType:
+			return v.updateChooseType(msg)
+		case modeAttachments:
+			return v.updateAttachments(msg)
+		case modeMoveFolder:
+			return v.updateMoveFolder(msg)
+		case modeTrash:
+			return v.updateTrash(msg)
 		}
 	}
 
@@ -111,34 +182,94 @@ func (v VaultScreen) Update(msg tea.Msg) (VaultScreen, tea.Cmd) {
 }
 
 func (v VaultScreen) updateList(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
+	if v.folderInput.Focused() {
+		return v.updateFolderInput(msg)
+	}
+	if v.folderConfirm {
+		v.folderConfirm = false
+		if f := v.selectedFolder(); f != nil && msg.String() == "y" {
+			return v.deleteFolder(f.ID)
+		}
+		return v, nil
+	}
+	if v.searchInput.Focused() {
+		switch msg.String() {
+		case "up", "down":
+		case "enter":
+			v.searchInput.Blur()
+			return v, nil
+		case "esc":
+			v.clearSearch()
+			return v, nil
+		default:
+			var cmd tea.Cmd
+			v.searchInput, cmd = v.searchInput.Update(msg)
+			v.filterEntries()
+			return v, cmd
+		}
+	}
+
 	switch msg.String() {
 	case "up", "k":
-		if v.cursor > 0 {
-			v.cursor--
+		if v.rowCursor > 0 {
+			v.selectRow(v.rowCursor - 1)
 		}
 	case "down", "j":
-		if v.cursor < len(v.filtered)-1 {
-			v.cursor++
+		if v.rowCursor < len(v.rows)-1 {
+			v.selectRow(v.rowCursor + 1)
 		}
 	case "enter":
-		if len(v.filtered) > 0 {
+		if f := v.selectedFolder(); f != nil {
+			v.setExpanded(f.ID, !v.expanded[f.ID])
+			return v, nil
+		}
+		if len(v.rows) > 0 {
 			v.mode = modeView
 			v.showPassword = false
+			v.fieldCursor = 0
+			return v, tea.Batch(v.startTOTP(), entryUsed(v.filtered[v.cursor]))
 		}
 	case "a":
-		v.mode = modeAdd
-		v.editEntry = models.Entry{}
-		v.initEditFields()
+		v.mode = modeChooseType
+		v.typeCursor = 0
+	case "s":
+		return v.cycleSortMode()
+	case "t":
+		v.mode = modeTrash
+		v.trashCursor = 0
+		v.trashConfirm = ""
+	case "*":
+		if v.selectedFolder() == nil && len(v.rows) > 0 {
+			return v.toggleFavorite(v.filtered[v.cursor].ID)
+		}
+	case "h":
+		return v, func() tea.Msg {
+			return LoadHistoryMsg{}
+		}
 	case "/":
+		// Searching from a folder searches inside it.
+		if f := v.selectedFolder(); f != nil {
+			v.searchScope = f.ID
+			v.filterEntries()
+		}
 		v.searchInput.Focus()
 	case "esc":
-		v.searchInput.Blur()
-		v.searchInput.SetValue("")
-		v.filterEntries()
+		v.clearSearch()
+	default:
+		var cmd tea.Cmd
+		v, cmd, _ = v.updateFolderKeys(msg)
+		return v, cmd
 	}
 	return v, nil
 }
 
+func (v *VaultScreen) clearSearch() {
+	v.searchInput.Blur()
+	v.searchInput.SetValue("")
+	v.searchScope = ""
+	v.filterEntries()
+}
+
 func (v VaultScreen) updateView(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
 	switch msg.String() {
 	case "esc", "q":
@@ -151,21 +282,73 @@ func (v VaultScreen) updateView(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
 		}
 	case "d":
 		v.mode = modeDelete
+	case "h":
+		if len(v.filtered) > 0 && len(v.filtered[v.cursor].History) > 0 {
+			v.mode = modeCredentialHistory
+			v.credCursor = 0
+			v.showPassword = false
+		}
+	case "m":
+		if len(v.filtered) > 0 {
+			return v, func() tea.Msg {
+				return LoadTransferTargetsMsg{}
+			}
+		}
+	case "o":
+		if len(v.filtered) > 0 {
+			return v.startMove(), nil
+		}
+	case "*":
+		if len(v.filtered) > 0 {
+			return v.toggleFavorite(v.filtered[v.cursor].ID)
+		}
+	case "f":
+		if len(v.filtered) > 0 {
+			v.mode = modeAttachments
+			v.attachCursor = 0
+			v.attachConfirm = false
+		}
 	case "p":
 		v.showPassword = !v.showPassword
-	case "u":
+	case "up", "k":
+		if v.fieldCursor > 0 {
+			v.fieldCursor--
+		}
+	case "down", "j":
+		if len(v.filtered) > 0 && v.fieldCursor < len(entryRows(v.filtered[v.cursor]))-1 {
+			v.fieldCursor++
+		}
+	case "y":
 		if len(v.filtered) > 0 {
 			entry := v.filtered[v.cursor]
-			return v, func() tea.Msg {
-				return CopyToClipboardMsg{Text: entry.Username, Label: "Username"}
+			if rows := entryRows(entry); v.fieldCursor < len(rows) {
+				return v, tea.Batch(v.copyRow(entry, rows[v.fieldCursor]), entryUsed(entry))
 			}
 		}
+	case "t":
+		if len(v.filtered) > 0 && v.filtered[v.cursor].TOTP != "" {
+			return v, tea.Batch(v.copyTOTP(v.filtered[v.cursor]), entryUsed(v.filtered[v.cursor]))
+		}
+	case "u":
+		if len(v.filtered) > 0 && v.filtered[v.cursor].Kind() == models.EntryLogin {
+			entry := v.filtered[v.cursor]
+			return v, tea.Batch(func() tea.Msg {
+				return CopyToClipboardMsg{Text: entry.Username, Label: "Username"}
+			}, entryUsed(entry))
+		}
 	case "c":
 		if len(v.filtered) > 0 {
 			entry := v.filtered[v.cursor]
-			return v, func() tea.Msg {
-				return CopyToClipboardMsg{Text: entry.Password, Label: "Password"}
+			spec := models.SpecFor(entry.Kind())
+			label := spec.Label
+			for _, f := range spec.Fields {
+				if f.Key == spec.SecretKey {
+					label = f.Label
+				}
 			}
+			return v, tea.Batch(func() tea.Msg {
+				return CopyToClipboardMsg{Text: entry.Get(spec.SecretKey), Label: label}
+			}, entryUsed(entry))
 		}
 	}
 	return v, nil
@@ -177,15 +360,33 @@ func (v VaultScreen) updateEdit(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
 		v.mode = modeList
 		return v, nil
 	case "tab", "down":
+		if msg.String() == "down" && v.editFields[v.editFocus].multiline {
+			break
+		}
 		v.editFields[v.editFocus].Blur()
 		v.editFocus = (v.editFocus + 1) % len(v.editFields)
-		v.editFields[v.editFocus].Focus()
-		return v, nil
+		return v, v.editFields[v.editFocus].Focus()
 	case "shift+tab", "up":
+		if msg.String() == "up" && v.editFields[v.editFocus].multiline {
+			break
+		}
 		v.editFields[v.editFocus].Blur()
 		v.editFocus = (v.editFocus + len(v.editFields) - 1) % len(v.editFields)
-		v.editFields[v.editFocus].Focus()
+		return v, v.editFields[v.editFocus].Focus()
+	case "ctrl+n":
+		v.addCustomField()
+		return v, nil
+	case "ctrl+x":
+		v.removeCustomField()
 		return v, nil
+	case "left", "right":
+		step := 1
+		if msg.String() == "left" {
+			step = -1
+		}
+		if v.cycleFieldType(step) {
+			return v, nil
+		}
 	case "ctrl+s":
 		return v.saveEntry()
 	}
@@ -199,27 +400,8 @@ func (v VaultScreen) updateDelete(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
 	switch msg.String() {
 	case "y", "Y":
 		if len(v.filtered) > 0 {
-			entryToDelete := v.filtered[v.cursor]
-			newEntries := make([]models.Entry, 0, len(v.entries)-1)
-			for _, e := range v.entries {
-				if e.ID != entryToDelete.ID {
-					newEntries = append(newEntries, e)
-				}
-			}
-			v.entries = newEntries
-			v.filterEntries()
-			if v.cursor >= len(v.filtered) && v.cursor > 0 {
-				v.cursor--
-			}
 			v.mode = modeList
-			return v, tea.Batch(
-				func() tea.Msg {
-					return SaveEntriesMsg{Entries: v.entries}
-				},
-				func() tea.Msg {
-					return SyncPushEntryMsg{Entry: entryToDelete, Op: "delete"}
-				},
-			)
+			return v.trashEntry(v.filtered[v.cursor])
 		}
 	case "n", "N", "esc":
 		v.mode = modeView
@@ -227,81 +409,107 @@ func (v VaultScreen) updateDelete(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
 	return v, nil
 }
 
+func (v VaultScreen) updateChooseType(msg tea.KeyMsg) (VaultScreen, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if v.typeCursor > 0 {
+			v.typeCursor--
+		}
+	case "down", "j":
+		if v.typeCursor < len(models.EntryTypes)-1 {
+			v.typeCursor++
+		}
+	case "enter":
+		v.mode = modeAdd
+		v.editEntry = models.Entry{Type: models.EntryTypes[v.typeCursor].Type, FolderID: v.currentFolder()}
+		v.initEditFields()
+	case "esc", "q":
+		v.mode = modeList
+	}
+	return v, nil
+}
+
 func (v *VaultScreen) initEditFields() {
-	fields := make([]textinput.Model, 5)
-
-	website := textinput.New()
-	website.Placeholder = "Website"
-	website.SetValue(v.editEntry.Website)
-	website.Width = 40
-	website.Focus()
-	fields[0] = website
-
-	username := textinput.New()
-	username.Placeholder = "Username"
-	username.SetValue(v.editEntry.Username)
-	username.Width = 40
-	fields[1] = username
-
-	password := textinput.New()
-	password.Placeholder = "Password"
-	password.SetValue(v.editEntry.Password)
-	password.Width = 40
-	fields[2] = password
-
-	notes := textinput.New()
-	notes.Placeholder = "Notes"
-	notes.SetValue(v.editEntry.Notes)
-	notes.Width = 40
-	fields[3] = notes
-
-	tags := textinput.New()
-	tags.Placeholder = "Tags (comma separated)"
-	tags.SetValue(strings.Join(v.editEntry.Tags, ", "))
-	tags.Width = 40
-	fields[4] = tags
+	spec := models.SpecFor(v.editEntry.Kind())
+	v.editSpecs = append(append([]models.FieldSpec(nil), spec.Fields...), tagsSpec)
+
+	fields := make([]formInput, 0, len(v.editSpecs)+3*len(v.editEntry.Fields))
+	for _, fieldSpec := range v.editSpecs {
+		value := v.editEntry.Get(fieldSpec.Key)
+		if fieldSpec.Key == tagsSpec.Key {
+			value = strings.Join(v.editEntry.Tags, ", ")
+		}
+		fields = append(fields, newSpecInput(fieldSpec, value))
+	}
+	fields[0].Focus()
+
+	for _, field := range v.editEntry.Fields {
+		fields = append(fields, newCustomFieldInputs(field)...)
+	}
 
 	v.editFields = fields
 	v.editFocus = 0
 }
 
 func (v VaultScreen) saveEntry() (VaultScreen, tea.Cmd) {
-	website := strings.TrimSpace(v.editFields[0].Value())
-	username := strings.TrimSpace(v.editFields[1].Value())
-	password := v.editFields[2].Value()
-	notes := v.editFields[3].Value()
-	tagsStr := v.editFields[4].Value()
-
-	if website == "" {
-		v.statusMsg = "Website is required"
+	values := make(map[string]string, len(v.editSpecs))
+	var tags []string
+	for i, spec := range v.editSpecs {
+		value := v.editFields[i].Value()
+		if spec.Key == tagsSpec.Key {
+			for _, t := range strings.Split(value, ",") {
+				t = strings.TrimSpace(t)
+				if t != "" {
+					tags = append(tags, t)
+				}
+			}
+			continue
+		}
+		if !spec.Hidden() {
+			value = strings.TrimSpace(value)
+		}
+		if err := spec.Validate(value); err != nil {
+			v.statusMsg = err.Error()
+			v.statusIsError = true
+			return v, nil
+		}
+		values[spec.Key] = value
+	}
+
+	customFields, err := v.parseCustomFields()
+	if err != nil {
+		v.statusMsg = err.Error()
 		v.statusIsError = true
 		return v, nil
 	}
 
-	var tags []string
-	if tagsStr != "" {
-		for _, t := range strings.Split(tagsStr, ",") {
-			t = strings.TrimSpace(t)
-			if t != "" {
-				tags = append(tags, t)
-			}
+	// Setting every key the form owns clears the ones left empty. Other
+	// Data keys are kept, such as those of a type this version does not
+	// know and shows as a secure note.
+	apply := func(e *models.Entry) {
+		for key, value := range values {
+			e.Set(key, value)
 		}
+		e.Tags = tags
+		e.Fields = customFields
+		e.UpdatedAt = time.Now()
 	}
 
 	var pushedEntry models.Entry
 	if v.mode == modeAdd {
-		entry := models.NewEntry(website, username, password, notes, tags)
+		entry := models.NewEntry("", "", "", "", nil)
+		entry.Type = v.editEntry.Kind()
+		entry.FolderID = v.editEntry.FolderID
+		apply(&entry)
 		v.entries = append(v.entries, entry)
 		pushedEntry = entry
 	} else {
 		for i, e := range v.entries {
 			if e.ID == v.editEntry.ID {
-				v.entries[i].Website = website
-				v.entries[i].Username = username
-				v.entries[i].Password = password
-				v.entries[i].Notes = notes
-				v.entries[i].Tags = tags
-				v.entries[i].UpdatedAt = time.Now()
+				if e.Password != values["password"] || e.Username != values["username"] {
+					v.entries[i].RecordCredentials(time.Now())
+				}
+				apply(&v.entries[i])
 				pushedEntry = v.entries[i]
 				break
 			}
@@ -322,30 +530,44 @@ func (v VaultScreen) saveEntry() (VaultScreen, tea.Cmd) {
 }
 
 func (v *VaultScreen) filterEntries() {
-	query := strings.ToLower(v.searchInput.Value())
-	if query == "" {
-		v.filtered = v.entries
-		return
+	selected := v.rowKey(v.rowCursor)
+	v.tree = models.NewFolders(v.folders)
+	v.searchScope = v.tree.Resolve(v.searchScope)
+
+	entries := v.entries
+	if v.searchScope != "" {
+		entries = make([]models.Entry, 0, len(v.entries))
+		for _, e := range v.entries {
+			if v.tree.Contains(v.searchScope, e.FolderID) {
+				entries = append(entries, e)
+			}
+		}
 	}
 
-	v.filtered = make([]models.Entry, 0)
-	for _, e := range v.entries {
-		if strings.Contains(strings.ToLower(e.Website), query) ||
-			strings.Contains(strings.ToLower(e.Username), query) ||
-			strings.Contains(strings.ToLower(e.Notes), query) {
-			v.filtered = append(v.filtered, e)
+	query := strings.ToLower(v.searchInput.Value())
+	if query == "" {
+		v.filtered = models.SortEntries(entries, v.sortMode, v.usage)
+	} else if strings.HasPrefix(query, "http://") || strings.HasPrefix(query, "https://") {
+		// A URL lists the entries used on it, best match first.
+		v.filtered = make([]models.Entry, 0)
+		matches, _ := models.Lookup(entries, v.searchInput.Value())
+		for _, m := range matches {
+			v.filtered = append(v.filtered, m.Entry)
 		}
-		for _, t := range e.Tags {
-			if strings.Contains(strings.ToLower(t), query) {
-				v.filtered = append(v.filtered, e)
-				break
+	} else {
+		matched := make([]models.Entry, 0)
+		for _, e := range entries {
+			if entryMatches(e, query) {
+				matched = append(matched, e)
 			}
 		}
+		v.filtered = models.SortEntries(matched, v.sortMode, v.usage)
 	}
 
 	if v.cursor >= len(v.filtered) {
 		v.cursor = max(0, len(v.filtered)-1)
 	}
+	v.rebuildRows(selected)
 }
 
 func (v VaultScreen) View() string {
@@ -360,6 +582,22 @@ func (v VaultScreen) View() string {
 		b.WriteString(v.viewEdit())
 	case modeDelete:
 		b.WriteString(v.viewDelete())
+	case modeHistory:
+		b.WriteString(v.viewHistory())
+	case modeHistoryDiff:
+		b.WriteString(v.viewHistoryDiff())
+	case modeCredentialHistory:
+		b.WriteString(v.viewCredentialHistory())
+	case modeTransfer:
+		b.WriteString(v.viewTransfer())
+	case modeChooseType:
+		b.WriteString(v.viewChooseType())
+	case modeAttachments:
+		b.WriteString(v.viewAttachments())
+	case modeMoveFolder:
+		b.WriteString(v.viewMoveFolder())
+	case modeTrash:
+		b.WriteString(v.viewTrash())
 	}
 
 	if v.statusMsg != "" {
@@ -380,35 +618,74 @@ func (v VaultScreen) viewList() string {
 	b.WriteString(titleStyle.Render("Vault"))
 	b.WriteString("\n\n")
 	b.WriteString(v.searchInput.View())
+	if v.searchScope != "" {
+		b.WriteString(mutedStyle.Render("  in " + v.tree.Path(v.searchScope)))
+	}
+	b.WriteString("\n")
+	b.WriteString(mutedStyle.Render("Sorted by " + v.sortMode.Label()))
 	b.WriteString("\n\n")
 
-	if len(v.filtered) == 0 {
-		if len(v.entries) == 0 {
+	searching := v.searchInput.Value() != ""
+	if len(v.rows) == 0 {
+		if len(v.entries) == 0 && len(v.folders) == 0 {
 			b.WriteString(mutedStyle.Render("No entries yet. Press 'a' to add one."))
-		} else {
+		} else if searching {
 			b.WriteString(mutedStyle.Render("No entries match your search."))
+		} else {
+			b.WriteString(mutedStyle.Render("This folder is empty."))
 		}
 	} else {
-		for i, entry := range v.filtered {
+		for i, row := range v.rows {
 			cursor := "  "
 			style := normalStyle
-			if i == v.cursor {
+			if i == v.rowCursor {
 				cursor = "▸ "
 				style = selectedStyle
 			}
+			indent := strings.Repeat("  ", row.depth)
 
-			line := fmt.Sprintf("%s%s", cursor, style.Render(entry.Website))
-			if entry.Username != "" {
+			if row.folder != nil {
+				arrow := "▹ "
+				if v.expanded[row.folder.ID] {
+					arrow = "▿ "
+				}
+				line := cursor + indent + mutedStyle.Render(arrow) + style.Render(row.folder.Name+"/")
+				line += mutedStyle.Render(fmt.Sprintf(" (%d)", row.count))
+				b.WriteString(line)
+				b.WriteString("\n")
+				continue
+			}
+
+			entry := v.filtered[row.entry]
+			title := entry.Title()
+			if entry.Favorite {
+				title = "★ " + title
+			}
+			line := fmt.Sprintf("%s%s%s", cursor, indent, style.Render(title))
+			if entry.Kind() != models.EntryLogin {
+				line += mutedStyle.Render(" [" + models.SpecFor(entry.Kind()).Label + "]")
+			} else if entry.Username != "" {
 				line += mutedStyle.Render(" (" + entry.Username + ")")
 			}
 			line += " " + v.renderSchemeBadge(entry)
+			if path := v.tree.Path(entry.FolderID); searching && path != "" {
+				line += mutedStyle.Render("  " + path)
+			}
 			b.WriteString(line)
 			b.WriteString("\n")
 		}
 	}
 
 	b.WriteString("\n")
-	b.WriteString(helpStyle.Render("↑/↓ navigate • enter view • a add • / search • q quit"))
+	if prompt := v.viewFolderPrompt(); prompt != "" {
+		b.WriteString(prompt)
+		return b.String()
+	}
+	help := "↑/↓ navigate • enter view • a add • * favorite • s sort • n new folder • o move • / search • h history • t trash • q quit"
+	if v.selectedFolder() != nil {
+		help = "↑/↓ navigate • enter/←/→ open/close • a add • n new folder • r rename • x delete • o move • s sort • / search in folder • q quit"
+	}
+	b.WriteString(helpStyle.Render(help))
 
 	return b.String()
 }
@@ -433,43 +710,108 @@ func (v VaultScreen) viewEntry() string {
 	}
 
 	entry := v.filtered[v.cursor]
+	spec := models.SpecFor(entry.Kind())
 	var b strings.Builder
 
-	b.WriteString(titleStyle.Render(entry.Website))
+	title := entry.Title()
+	if entry.Kind() != models.EntryLogin {
+		title += " · " + spec.Label
+	}
+	b.WriteString(titleStyle.Render(title))
 	b.WriteString("\n\n")
 
-	labelStyle := lipgloss.NewStyle().Width(12).Foreground(mutedColor)
+	labelStyle := lipgloss.NewStyle().Width(14).Foreground(mutedColor)
 
-	b.WriteString(labelStyle.Render("Username:"))
-	b.WriteString(entry.Username)
-	b.WriteString("\n")
+	rows := entryRows(entry)
+	b.WriteString(v.viewRows(entry, rows, labelStyle))
 
-	b.WriteString(labelStyle.Render("Password:"))
-	if v.showPassword {
-		b.WriteString(entry.Password)
-	} else {
-		b.WriteString(strings.Repeat("•", min(len(entry.Password), 20)))
-	}
-	b.WriteString("\n")
-
-	if entry.Notes != "" {
-		b.WriteString(labelStyle.Render("Notes:"))
-		b.WriteString(entry.Notes)
+	if path := v.tree.Path(entry.FolderID); path != "" {
+		b.WriteString("  ")
+		b.WriteString(labelStyle.Render("Folder:"))
+		b.WriteString(path)
 		b.WriteString("\n")
 	}
 
 	if len(entry.Tags) > 0 {
+		b.WriteString("  ")
 		b.WriteString(labelStyle.Render("Tags:"))
 		b.WriteString(strings.Join(entry.Tags, ", "))
 		b.WriteString("\n")
 	}
 
+	b.WriteString("  ")
 	b.WriteString(labelStyle.Render("Updated:"))
 	b.WriteString(entry.UpdatedAt.Format("2006-01-02 3:04 PM"))
 	b.WriteString("\n")
 
+	var help []string
+	if len(rows) > 0 {
+		help = append(help, "↑/↓ select • y copy field")
+	}
+	if entry.Kind() == models.EntryLogin {
+		help = append(help, "u copy username", "c copy password")
+	} else if entry.Get(spec.SecretKey) != "" {
+		for _, f := range spec.Fields {
+			if f.Key == spec.SecretKey {
+				help = append(help, "c copy "+strings.ToLower(f.Label))
+			}
+		}
+	}
+	if entry.TOTP != "" {
+		help = append(help, "t copy code")
+	}
+	for _, row := range rows {
+		if row.Hidden {
+			help = append(help, "p toggle hidden")
+			break
+		}
+	}
+	if len(entry.Attachments) > 0 {
+		b.WriteString("  ")
+		b.WriteString(labelStyle.Render("Files:"))
+		names := make([]string, len(entry.Attachments))
+		for i, att := range entry.Attachments {
+			names[i] = att.Name
+		}
+		b.WriteString(strings.Join(names, ", "))
+		b.WriteString("\n")
+	}
+	if len(entry.History) > 0 {
+		b.WriteString("  ")
+		b.WriteString(labelStyle.Render("History:"))
+		b.WriteString(fmt.Sprintf("%d earlier password(s)", len(entry.History)))
+		b.WriteString("\n")
+		help = append(help, "h history")
+	}
+	star := "* favorite"
+	if entry.Favorite {
+		star = "* unfavorite"
+	}
+	help = append(help, star, "f files", "e edit", "o folder", "m copy/move", "d delete", "esc back")
+
+	b.WriteString("\n")
+	b.WriteString(helpStyle.Render(strings.Join(help, " • ")))
+
+	return boxStyle.Render(b.String())
+}
+
+func (v VaultScreen) viewChooseType() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("Add Entry"))
+	b.WriteString("\n\n")
+
+	for i, spec := range models.EntryTypes {
+		if i == v.typeCursor {
+			b.WriteString("▸ " + selectedStyle.Render(spec.Label))
+		} else {
+			b.WriteString("  " + normalStyle.Render(spec.Label))
+		}
+		b.WriteString("\n")
+	}
+
 	b.WriteString("\n")
-	b.WriteString(helpStyle.Render("u copy username • c copy password • p toggle password • e edit • d delete • esc back"))
+	b.WriteString(helpStyle.Render("↑/↓ choose type • enter continue • esc cancel"))
 
 	return boxStyle.Render(b.String())
 }
@@ -478,15 +820,14 @@ func (v VaultScreen) viewEdit() string {
 	var b strings.Builder
 
 	if v.mode == modeAdd {
-		b.WriteString(titleStyle.Render("Add Entry"))
+		b.WriteString(titleStyle.Render("Add " + models.SpecFor(v.editEntry.Kind()).Label))
 	} else {
-		b.WriteString(titleStyle.Render("Edit Entry"))
+		b.WriteString(titleStyle.Render("Edit " + models.SpecFor(v.editEntry.Kind()).Label))
 	}
 	b.WriteString("\n\n")
 
-	labels := []string{"Website:", "Username:", "Password:", "Notes:", "Tags:"}
 	for i, field := range v.editFields {
-		b.WriteString(labels[i])
+		b.WriteString(v.editFieldLabel(i))
 		b.WriteString("\n")
 		if i == v.editFocus {
 			b.WriteString(focusedInputStyle.Render(field.View()))
@@ -496,7 +837,7 @@ func (v VaultScreen) viewEdit() string {
 		b.WriteString("\n\n")
 	}
 
-	b.WriteString(helpStyle.Render("tab next field • ctrl+s save • esc cancel"))
+	b.WriteString(helpStyle.Render("tab next field • ←/→ field type • ctrl+n add field • ctrl+x remove field • ctrl+s save • esc cancel"))
 
 	return boxStyle.Render(b.String())
 }
@@ -511,8 +852,12 @@ func (v VaultScreen) viewDelete() string {
 
 	b.WriteString(errorStyle.Render("Delete Entry?"))
 	b.WriteString("\n\n")
-	b.WriteString(fmt.Sprintf("Are you sure you want to delete '%s'?\n", entry.Website))
-	b.WriteString("This action cannot be undone.\n\n")
+	b.WriteString(fmt.Sprintf("Move '%s' to the trash?\n", entry.Title()))
+	if v.trashRetention > 0 {
+		b.WriteString(fmt.Sprintf("It can be restored from the trash for %d days.\n\n", int(v.trashRetention.Hours()/24)))
+	} else {
+		b.WriteString("It can be restored from the trash until you empty it.\n\n")
+	}
 	b.WriteString(helpStyle.Render("y confirm • n cancel"))
 
 	return boxStyle.Render(b.String())
@@ -522,12 +867,15 @@ func (v VaultScreen) GetSelectedEntry() *models.Entry {
 	if len(v.filtered) == 0 || v.cursor >= len(v.filtered) {
 		return nil
 	}
+	if v.mode == modeList && v.selectedFolder() != nil {
+		return nil
+	}
 	entry := v.filtered[v.cursor]
 	return &entry
 }
 
 func (v VaultScreen) IsInputActive() bool {
-	return v.mode == modeEdit || v.mode == modeAdd || v.searchInput.Focused()
+	return v.mode == modeEdit || v.mode == modeAdd || v.searchInput.Focused() || v.folderInput.Focused() || (v.mode == modeAttachments && v.attachInput.Focused())
 }
 
 func (v VaultScreen) GetEntries() []models.Entry {
@@ -0,0 +1,75 @@
+package tui
+
+import (
+	"testing"
+
+	"forgor/internal/models"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// editEntry opens the edit form for the only entry on the screen, sets the
+// inputs in values and saves.
+func editEntry(t *testing.T, entry models.Entry, values map[string]string) models.Entry {
+	t.Helper()
+	v := NewVaultScreen([]models.Entry{entry})
+	v, _ = v.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	v, _ = v.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	if v.mode != modeEdit {
+		t.Fatalf("mode = %v, want the edit form", v.mode)
+	}
+	for key, value := range values {
+		found := false
+		for i, spec := range v.editSpecs {
+			if spec.Key == key {
+				v.editFields[i].SetValue(value)
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("form has no %q input", key)
+		}
+	}
+	v, _ = v.saveEntry()
+	if v.mode != modeList {
+		t.Fatalf("save failed: %s", v.statusMsg)
+	}
+	return v.GetEntries()[0]
+}
+
+func TestEditUnknownTypeKeepsData(t *testing.T) {
+	entry := models.NewEntry("", "", "", "", nil)
+	entry.Type = "vehicle"
+	entry.Name = "Car"
+	entry.Data = map[string]string{"vin": "1HGCM82633A004352", "plate": "AB-123"}
+
+	got := editEntry(t, entry, map[string]string{"name": "Family car", "notes": "Serviced in May"})
+
+	if got.Type != "vehicle" {
+		t.Errorf("Type = %q, want vehicle", got.Type)
+	}
+	if got.Name != "Family car" || got.Notes != "Serviced in May" {
+		t.Errorf("form values not saved: name %q, notes %q", got.Name, got.Notes)
+	}
+	for key, want := range entry.Data {
+		if got.Data[key] != want {
+			t.Errorf("Data[%q] = %q, want %q", key, got.Data[key], want)
+		}
+	}
+}
+
+func TestEditClearsEmptiedFields(t *testing.T) {
+	entry := models.NewEntry("", "", "", "", nil)
+	entry.Type = models.EntryCard
+	entry.Name = "Visa"
+	entry.Data = map[string]string{"number": "4111 1111 1111 1111", "pin": "1234"}
+
+	got := editEntry(t, entry, map[string]string{"pin": ""})
+
+	if _, ok := got.Data["pin"]; ok {
+		t.Error("emptied PIN was kept")
+	}
+	if got.Data["number"] != entry.Data["number"] {
+		t.Errorf("number = %q, want %q", got.Data["number"], entry.Data["number"])
+	}
+}
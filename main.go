@@ -6,10 +6,14 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
+	"forgor/internal/crypto"
 	"forgor/internal/discovery"
 	"forgor/internal/models"
+	"forgor/internal/profile"
 	"forgor/internal/server"
 	"forgor/internal/storage"
 	"forgor/internal/tui"
@@ -18,65 +22,128 @@ import (
 )
 
 var (
-	portFlag   = flag.Int("port", 8765, "HTTP server port for sharing")
-	dbPathFlag = flag.String("db", "", "Custom database path (for testing multiple instances)")
+	portFlag    = flag.Int("port", 8765, "HTTP server port for sharing")
+	dbPathFlag  = flag.String("db", "", "Custom database path (for testing multiple instances)")
+	profileFlag = flag.String("profile", "", "Named vault to open; other profiles can be switched to from the lock screen")
+	keyfile     = flag.String("keyfile", "", "Path to a keyfile needed to unlock the vault; new vaults are bound to it")
+	kdfTarget   = flag.Duration("kdf-target", 0, "Calibrate Argon2id to take about this long to unlock (e.g. 500ms, 2s) and upgrade the vault on unlock")
+	maxFails    = flag.Int("max-unlock-failures", -1, "Require the recovery key after this many failed unlocks (0 for no limit); saved to the vault on unlock")
+	trashDays   = flag.Int("trash-days", -1, "Purge deleted entries from the trash after this many days (0 keeps them until emptied, default 30); saved to the vault on unlock")
 )
 
 func main() {
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	flag.Parse()
 
-	var dbPath string
-	var err error
+	opts := profile.Options{
+		Keyfile:            *keyfile,
+		UnlockFailureLimit: *maxFails,
+		TrashRetentionDays: *trashDays,
+	}
+	if *kdfTarget > 0 {
+		params := crypto.CalibrateKDF(*kdfTarget)
+		if err := params.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid KDF parameters: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Calibrated KDF for %s: %s\n", *kdfTarget, params)
+		opts.KDFParams = &params
+	}
+
+	var profiles *profile.Manager
 	if *dbPathFlag != "" {
-		dbPath = *dbPathFlag
+		if *profileFlag != "" {
+			fmt.Fprintln(os.Stderr, "Error: -db and -profile cannot be combined")
+			os.Exit(2)
+		}
+		store, err := storage.Open(*dbPathFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+			os.Exit(1)
+		}
+		name := strings.TrimSuffix(filepath.Base(*dbPathFlag), filepath.Ext(*dbPathFlag))
+		profiles, err = profile.Fixed(name, store, opts)
+		if err != nil {
+			store.Close()
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	} else {
-		dbPath, err = getDBPath()
+		dataDir, err := getDataDir()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		name := *profileFlag
+		if name == "" {
+			name = profile.DefaultName
+		}
+		profiles = profile.NewManager(dataDir, opts)
+		if _, err := profiles.Switch(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open profile %q: %v\n", name, err)
+			os.Exit(1)
+		}
 	}
-
-	store, err := storage.Open(dbPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
-		os.Exit(1)
-	}
-	defer store.Close()
+	defer profiles.Close()
 
 	peerChan := make(chan models.Peer, 10)
 	shareChan := make(chan models.IncomingShare, 10)
 
-	app := tui.NewApp(store, peerChan, shareChan, *portFlag)
+	app := tui.NewApp(profiles, peerChan, shareChan, *portFlag)
 
 	p := tea.NewProgram(app, tea.WithAltScreen())
 
-	var disc *discovery.Discovery
-	var srv *server.Server
+	var (
+		netMu sync.Mutex
+		disc  *discovery.Discovery
+		srv   *server.Server
+	)
+	stopNetwork := func() {
+		if disc != nil {
+			disc.Stop()
+			disc = nil
+		}
+		if srv != nil {
+			srv.Stop()
+			srv = nil
+		}
+	}
 
+	// Sharing follows the active profile: once it is unlocked the server and
+	// discovery are restarted with its device identity.
 	go func() {
 		ticker := time.NewTicker(100 * time.Millisecond)
 		defer ticker.Stop()
 
+		var served *storage.Store
 		for range ticker.C {
-			if store.IsUnlocked() {
-				device, err := store.GetDevice()
-				if err != nil {
-					continue
-				}
-
-				srv = server.New(store, shareChan, *portFlag)
-				if err := srv.Start(); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: Failed to start server: %v\n", err)
-				}
-
-				disc = discovery.New(device.Name, device.Fingerprint(), *portFlag, peerChan)
-				if err := disc.Start(); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: Failed to start discovery: %v\n", err)
-				}
-
-				break
+			_, store := profiles.Active()
+			if store == nil || store == served || !store.IsUnlocked() {
+				continue
 			}
+			device, err := store.GetDevice()
+			if err != nil {
+				continue
+			}
+			// Only the public half is needed here.
+			device.Destroy()
+
+			netMu.Lock()
+			stopNetwork()
+			srv = server.New(store, shareChan, *portFlag)
+			if err := srv.Start(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to start server: %v\n", err)
+			}
+
+			disc = discovery.New(device.Name, device.Fingerprint(), *portFlag, peerChan)
+			if err := disc.Start(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to start discovery: %v\n", err)
+			}
+			netMu.Unlock()
+			served = store
 		}
 	}()
 
@@ -85,15 +152,13 @@ func main() {
 		os.Exit(1)
 	}
 
-	if disc != nil {
-		disc.Stop()
-	}
-	if srv != nil {
-		srv.Stop()
-	}
+	netMu.Lock()
+	stopNetwork()
+	netMu.Unlock()
 }
 
-func getDBPath() (string, error) {
+// getDataDir returns the per-user directory that holds the vaults.
+func getDataDir() (string, error) {
 	var dataDir string
 
 	switch runtime.GOOS {
@@ -119,6 +184,5 @@ func getDBPath() (string, error) {
 		}
 	}
 
-	forgorDir := filepath.Join(dataDir, "forgor")
-	return filepath.Join(forgorDir, "vault.db"), nil
+	return filepath.Join(dataDir, "forgor"), nil
 }